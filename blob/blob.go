@@ -0,0 +1,61 @@
+// Package blob stores opaque files such as PDFs, logos and attachments.
+// Everything that needs to keep a file goes through a BlobStore, so the
+// backend can be swapped by configuration.
+package blob
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// NotFound is returned when the named blob doesn't exist.
+var NotFound = errors.New("blob not found")
+
+// BlobStore is a flat namespace of named files. Names may contain slashes,
+// which backends are free to treat as directories.
+type BlobStore interface {
+	// Put stores the contents of r under name, replacing any existing blob.
+	Put(ctx context.Context, name string, r io.Reader, contentType string) error
+	// Get returns length bytes of the named blob starting at offset. A
+	// negative length reads to the end.
+	Get(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error)
+	// Stat returns the named blob's attributes.
+	Stat(ctx context.Context, name string) (*Attrs, error)
+	// Delete removes the named blob.
+	Delete(ctx context.Context, name string) error
+	// List returns the attributes of every blob whose name starts with
+	// prefix, ordered by name.
+	List(ctx context.Context, prefix string) ([]Attrs, error)
+	// SignedURL returns a URL that allows anyone holding it to GET the
+	// named blob until it expires. Backends that can't do this return an
+	// error satisfying errors.IsNotSupported.
+	SignedURL(ctx context.Context, name string, expires time.Duration) (string, error)
+}
+
+// Attrs describes a stored blob.
+type Attrs struct {
+	Name        string
+	Size        int64
+	ContentType string
+	Updated     time.Time
+	// ETag is quoted, ready to be used as an HTTP header value.
+	ETag string
+}
+
+// ReadAll returns the whole of the named blob.
+func ReadAll(ctx context.Context, store BlobStore, name string) ([]byte, error) {
+	rc, err := store.Get(ctx, name, 0, -1)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rc.Close()
+
+	body, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return body, nil
+}
@@ -0,0 +1,116 @@
+package blob
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"strconv"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/juju/errors"
+	"google.golang.org/api/option"
+)
+
+// Environment variables that choose and configure the BlobStore.
+const (
+	BLOB_STORE           = "BLOB_STORE"
+	BLOB_BUCKET          = "BLOB_BUCKET"
+	BLOB_DIR             = "BLOB_DIR"
+	S3_ENDPOINT          = "S3_ENDPOINT"
+	S3_REGION            = "S3_REGION"
+	S3_ACCESS_KEY_ID     = "S3_ACCESS_KEY_ID"
+	S3_SECRET_ACCESS_KEY = "S3_SECRET_ACCESS_KEY"
+	S3_PATH_STYLE        = "S3_PATH_STYLE"
+)
+
+// Backends understood by New.
+const (
+	BackendGCS   = "gcs"
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// Config says which BlobStore to use and how to reach it.
+type Config struct {
+	Backend string
+	Bucket  string
+
+	// CredentialsFile is the service account key used for GCS.
+	CredentialsFile string
+
+	// Dir is where the local backend keeps its files.
+	Dir string
+
+	S3Endpoint        string
+	S3Region          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3PathStyle       bool
+}
+
+// ConfigFromEnv overrides the fields of defaults with any that are set in
+// the environment.
+func ConfigFromEnv(defaults Config) Config {
+	cfg := defaults
+	setFromEnv(&cfg.Backend, BLOB_STORE)
+	setFromEnv(&cfg.Bucket, BLOB_BUCKET)
+	setFromEnv(&cfg.Dir, BLOB_DIR)
+	setFromEnv(&cfg.S3Endpoint, S3_ENDPOINT)
+	setFromEnv(&cfg.S3Region, S3_REGION)
+	setFromEnv(&cfg.S3AccessKeyID, S3_ACCESS_KEY_ID)
+	setFromEnv(&cfg.S3SecretAccessKey, S3_SECRET_ACCESS_KEY)
+	if v, err := strconv.ParseBool(os.Getenv(S3_PATH_STYLE)); err == nil {
+		cfg.S3PathStyle = v
+	}
+	return cfg
+}
+
+func setFromEnv(field *string, key string) {
+	if v := os.Getenv(key); v != "" {
+		*field = v
+	}
+}
+
+// New returns the BlobStore described by cfg.
+func New(ctx context.Context, cfg Config) (BlobStore, error) {
+	switch cfg.Backend {
+	case BackendGCS:
+		if cfg.Bucket == "" {
+			return nil, errors.NotValidf("gcs blob store without a bucket")
+		}
+		var opts []option.ClientOption
+		if cfg.CredentialsFile != "" {
+			opts = append(opts, option.WithCredentialsFile(cfg.CredentialsFile))
+		}
+		client, err := gcs.NewClient(ctx, opts...)
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot create gcs client")
+		}
+		return NewGCS(client.Bucket(cfg.Bucket)), nil
+
+	case BackendLocal:
+		if cfg.Dir == "" {
+			return nil, errors.NotValidf("local blob store without a directory")
+		}
+		return NewLocal(cfg.Dir)
+
+	case BackendS3:
+		if cfg.Bucket == "" || cfg.S3Endpoint == "" || cfg.S3Region == "" {
+			return nil, errors.NotValidf("s3 blob store without bucket, endpoint and region")
+		}
+		endpoint, err := url.Parse(cfg.S3Endpoint)
+		if err != nil {
+			return nil, errors.Annotate(err, "invalid s3 endpoint")
+		}
+		return &S3{
+			Endpoint:        endpoint,
+			Region:          cfg.S3Region,
+			Bucket:          cfg.Bucket,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+			PathStyle:       cfg.S3PathStyle,
+		}, nil
+	}
+
+	return nil, errors.NotValidf("blob store backend %q", cfg.Backend)
+}
@@ -0,0 +1,11 @@
+package blob
+
+import "time"
+
+func SetClock(s *S3, now func() time.Time) {
+	s.now = now
+}
+
+func SetPartSize(s *S3, size int) {
+	s.parts = size
+}
@@ -0,0 +1,119 @@
+package blob
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/juju/errors"
+	"google.golang.org/api/iterator"
+)
+
+// GCS stores blobs in a Google Cloud Storage bucket. This is where the
+// Firebase storage bucket lives.
+type GCS struct {
+	bucket *gcs.BucketHandle
+}
+
+// NewGCS returns a BlobStore backed by the given bucket.
+func NewGCS(bucket *gcs.BucketHandle) *GCS {
+	return &GCS{bucket: bucket}
+}
+
+// Put is part of the BlobStore interface.
+func (s *GCS) Put(ctx context.Context, name string, r io.Reader, contentType string) error {
+	// NOTE when cancel is called all resources using ctx are released.
+	ctx, cancel := context.WithTimeout(ctx, time.Second*50)
+	defer cancel()
+
+	writer := s.bucket.Object(name).NewWriter(ctx)
+	writer.ContentType = contentType
+	if _, err := io.Copy(writer, r); err != nil {
+		writer.Close()
+		return errors.Trace(err)
+	}
+	if err := writer.Close(); err != nil {
+		return errors.Trace(err)
+	}
+
+	return nil
+}
+
+// Get is part of the BlobStore interface.
+func (s *GCS) Get(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	reader, err := s.bucket.Object(name).NewRangeReader(ctx, offset, length)
+	if err == gcs.ErrObjectNotExist {
+		return nil, NotFound
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return reader, nil
+}
+
+// Stat is part of the BlobStore interface.
+func (s *GCS) Stat(ctx context.Context, name string) (*Attrs, error) {
+	attrs, err := s.bucket.Object(name).Attrs(ctx)
+	if err == gcs.ErrObjectNotExist {
+		return nil, NotFound
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	a := gcsAttrs(attrs)
+	return &a, nil
+}
+
+// Delete is part of the BlobStore interface.
+func (s *GCS) Delete(ctx context.Context, name string) error {
+	err := s.bucket.Object(name).Delete(ctx)
+	if err == gcs.ErrObjectNotExist {
+		return NotFound
+	}
+	return errors.Trace(err)
+}
+
+// List is part of the BlobStore interface.
+func (s *GCS) List(ctx context.Context, prefix string) ([]Attrs, error) {
+	var list []Attrs
+	iter := s.bucket.Objects(ctx, &gcs.Query{Prefix: prefix})
+	for {
+		attrs, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		list = append(list, gcsAttrs(attrs))
+	}
+
+	return list, nil
+}
+
+// SignedURL is part of the BlobStore interface. It needs credentials that
+// include a private key, such as a service account key file.
+func (s *GCS) SignedURL(ctx context.Context, name string, expires time.Duration) (string, error) {
+	url, err := s.bucket.SignedURL(name, &gcs.SignedURLOptions{
+		Method:  "GET",
+		Expires: time.Now().Add(expires),
+		Scheme:  gcs.SigningSchemeV4,
+	})
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return url, nil
+}
+
+func gcsAttrs(attrs *gcs.ObjectAttrs) Attrs {
+	return Attrs{
+		Name:        attrs.Name,
+		Size:        attrs.Size,
+		ContentType: attrs.ContentType,
+		Updated:     attrs.Updated,
+		ETag:        fmt.Sprintf("%q", attrs.Etag),
+	}
+}
@@ -0,0 +1,212 @@
+package blob
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// metaDir holds the content type of each blob, alongside the blobs
+// themselves. List skips it.
+const metaDir = ".meta"
+
+// Local stores blobs as files under a directory. It is meant for development
+// and single-instance deployments with a persistent volume.
+type Local struct {
+	dir string
+}
+
+// NewLocal returns a BlobStore that keeps its files under dir, creating it if
+// necessary.
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &Local{dir: dir}, nil
+}
+
+type localMeta struct {
+	ContentType string `json:"content_type"`
+}
+
+// Put is part of the BlobStore interface. The blob is written to a temporary
+// file and renamed into place, so readers never see a partial blob.
+func (s *Local) Put(ctx context.Context, name string, r io.Reader, contentType string) error {
+	p, err := s.path(name)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return errors.Trace(err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".put-*")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return errors.Trace(err)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Trace(err)
+	}
+
+	meta, err := json.Marshal(localMeta{ContentType: contentType})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	metaPath := s.metaPath(name)
+	if err := os.MkdirAll(filepath.Dir(metaPath), 0o755); err != nil {
+		return errors.Trace(err)
+	}
+	if err := os.WriteFile(metaPath, meta, 0o644); err != nil {
+		return errors.Trace(err)
+	}
+
+	return errors.Trace(os.Rename(tmp.Name(), p))
+}
+
+// Get is part of the BlobStore interface.
+func (s *Local) Get(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	p, err := s.path(name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, NotFound
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, errors.Trace(err)
+	}
+	if length < 0 {
+		return f, nil
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
+}
+
+// Stat is part of the BlobStore interface.
+func (s *Local) Stat(ctx context.Context, name string) (*Attrs, error) {
+	p, err := s.path(name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	info, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return nil, NotFound
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	attrs := s.attrs(name, info)
+	return &attrs, nil
+}
+
+// Delete is part of the BlobStore interface.
+func (s *Local) Delete(ctx context.Context, name string) error {
+	p, err := s.path(name)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	err = os.Remove(p)
+	if os.IsNotExist(err) {
+		return NotFound
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	os.Remove(s.metaPath(name))
+
+	return nil
+}
+
+// List is part of the BlobStore interface.
+func (s *Local) List(ctx context.Context, prefix string) ([]Attrs, error) {
+	var list []Attrs
+	err := filepath.Walk(s.dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.dir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if info.IsDir() {
+			if name == metaDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(path.Base(name), ".put-") || !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		list = append(list, s.attrs(name, info))
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// SignedURL is part of the BlobStore interface. Local files aren't served
+// over HTTP, so there is nothing to sign.
+func (s *Local) SignedURL(ctx context.Context, name string, expires time.Duration) (string, error) {
+	return "", errors.NotSupportedf("signed URLs for local blobs")
+}
+
+func (s *Local) attrs(name string, info os.FileInfo) Attrs {
+	var meta localMeta
+	if data, err := os.ReadFile(s.metaPath(name)); err == nil {
+		json.Unmarshal(data, &meta)
+	}
+
+	return Attrs{
+		Name:        name,
+		Size:        info.Size(),
+		ContentType: meta.ContentType,
+		Updated:     info.ModTime(),
+		ETag:        fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()),
+	}
+}
+
+// path returns the file holding the named blob. Names can't escape the
+// store's directory or reach into the metadata.
+func (s *Local) path(name string) (string, error) {
+	clean := path.Clean("/" + name)[1:]
+	if name == "" || clean != name || clean == metaDir || strings.HasPrefix(clean, metaDir+"/") {
+		return "", errors.NotValidf("blob name %q", name)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(clean)), nil
+}
+
+func (s *Local) metaPath(name string) string {
+	return filepath.Join(s.dir, metaDir, filepath.FromSlash(name)+".json")
+}
@@ -0,0 +1,120 @@
+package blob_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/wham-invoice/wham-platform/blob"
+)
+
+type localSuite struct {
+	store *blob.Local
+}
+
+var _ = gc.Suite(&localSuite{})
+
+func (s *localSuite) SetUpTest(c *gc.C) {
+	store, err := blob.NewLocal(c.MkDir())
+	c.Assert(err, jc.ErrorIsNil)
+	s.store = store
+}
+
+func (s *localSuite) put(c *gc.C, name, body string) {
+	err := s.store.Put(context.Background(), name, strings.NewReader(body), "text/plain")
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *localSuite) TestPutGet(c *gc.C) {
+	ctx := context.Background()
+	s.put(c, "pdfs/one", "hello world")
+
+	body, err := blob.ReadAll(ctx, s.store, "pdfs/one")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(body), gc.Equals, "hello world")
+
+	rc, err := s.store.Get(ctx, "pdfs/one", 6, 3)
+	c.Assert(err, jc.ErrorIsNil)
+	defer rc.Close()
+	part, err := ioutil.ReadAll(rc)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(part), gc.Equals, "wor")
+}
+
+func (s *localSuite) TestStat(c *gc.C) {
+	s.put(c, "logo", "png")
+
+	attrs, err := s.store.Stat(context.Background(), "logo")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(attrs.Name, gc.Equals, "logo")
+	c.Check(attrs.Size, gc.Equals, int64(3))
+	c.Check(attrs.ContentType, gc.Equals, "text/plain")
+	c.Check(attrs.ETag, gc.Matches, `"[0-9a-f]+-3"`)
+}
+
+func (s *localSuite) TestNotFound(c *gc.C) {
+	ctx := context.Background()
+	_, err := s.store.Get(ctx, "missing", 0, -1)
+	c.Check(err, gc.Equals, blob.NotFound)
+	_, err = s.store.Stat(ctx, "missing")
+	c.Check(err, gc.Equals, blob.NotFound)
+	c.Check(s.store.Delete(ctx, "missing"), gc.Equals, blob.NotFound)
+}
+
+func (s *localSuite) TestDelete(c *gc.C) {
+	ctx := context.Background()
+	s.put(c, "gone", "x")
+
+	c.Assert(s.store.Delete(ctx, "gone"), jc.ErrorIsNil)
+	_, err := s.store.Stat(ctx, "gone")
+	c.Check(err, gc.Equals, blob.NotFound)
+}
+
+func (s *localSuite) TestList(c *gc.C) {
+	s.put(c, "logos/b", "b")
+	s.put(c, "logos/a", "a")
+	s.put(c, "pdf", "p")
+
+	list, err := s.store.List(context.Background(), "logos/")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(list, gc.HasLen, 2)
+	c.Check(list[0].Name, gc.Equals, "logos/a")
+	c.Check(list[1].Name, gc.Equals, "logos/b")
+}
+
+func (s *localSuite) TestInvalidNames(c *gc.C) {
+	for _, name := range []string{"", "../escape", "a/../../b", "/abs", ".meta/x"} {
+		err := s.store.Put(context.Background(), name, strings.NewReader("x"), "")
+		c.Check(err, jc.Satisfies, errors.IsNotValid, gc.Commentf("name %q", name))
+	}
+}
+
+func (s *localSuite) TestSignedURL(c *gc.C) {
+	_, err := s.store.SignedURL(context.Background(), "anything", 0)
+	c.Check(err, jc.Satisfies, errors.IsNotSupported)
+}
+
+func (s *localSuite) TestObjectSeek(c *gc.C) {
+	s.put(c, "doc", "0123456789")
+
+	obj, err := blob.Open(context.Background(), s.store, "doc")
+	c.Assert(err, jc.ErrorIsNil)
+	defer obj.Close()
+	c.Check(obj.Size, gc.Equals, int64(10))
+
+	buf := make([]byte, 3)
+	_, err = io.ReadFull(obj, buf)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(buf), gc.Equals, "012")
+
+	_, err = obj.Seek(-4, io.SeekEnd)
+	c.Assert(err, jc.ErrorIsNil)
+	rest, err := ioutil.ReadAll(obj)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(rest), gc.Equals, "6789")
+}
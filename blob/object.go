@@ -0,0 +1,89 @@
+package blob
+
+import (
+	"context"
+	"io"
+
+	"github.com/juju/errors"
+)
+
+// Object is a stored blob opened for reading. It implements io.ReadSeeker by
+// fetching byte ranges from the store on demand, so it can be handed to
+// http.ServeContent without reading the whole blob into memory.
+type Object struct {
+	Attrs
+
+	ctx    context.Context
+	store  BlobStore
+	offset int64
+	reader io.ReadCloser
+}
+
+// Open returns the named blob, ready to stream.
+func Open(ctx context.Context, store BlobStore, name string) (*Object, error) {
+	attrs, err := store.Stat(ctx, name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return &Object{
+		Attrs: *attrs,
+		ctx:   ctx,
+		store: store,
+	}, nil
+}
+
+// Read is part of the io.Reader interface.
+func (o *Object) Read(p []byte) (int, error) {
+	if o.offset >= o.Size {
+		return 0, io.EOF
+	}
+	if o.reader == nil {
+		reader, err := o.store.Get(o.ctx, o.Name, o.offset, -1)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		o.reader = reader
+	}
+
+	n, err := o.reader.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+// Seek is part of the io.Seeker interface. Seeking is free; the next Read
+// starts a new range request from the new offset.
+func (o *Object) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = o.offset + offset
+	case io.SeekEnd:
+		abs = o.Size + offset
+	default:
+		return 0, errors.NotValidf("whence %d", whence)
+	}
+	if abs < 0 {
+		return 0, errors.NotValidf("negative offset %d", abs)
+	}
+
+	if abs != o.offset && o.reader != nil {
+		o.reader.Close()
+		o.reader = nil
+	}
+	o.offset = abs
+
+	return abs, nil
+}
+
+// Close is part of the io.Closer interface.
+func (o *Object) Close() error {
+	if o.reader == nil {
+		return nil
+	}
+	err := o.reader.Close()
+	o.reader = nil
+	return errors.Trace(err)
+}
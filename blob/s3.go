@@ -0,0 +1,468 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const (
+	amzDateFormat   = "20060102T150405Z"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	// s3PartSize is the smallest part S3 allows in a multipart upload, bar
+	// the last.
+	s3PartSize = 5 << 20
+)
+
+// S3 stores blobs in an S3-compatible bucket, such as AWS S3, MinIO or
+// Cloudflare R2. Requests are signed with AWS Signature Version 4.
+type S3 struct {
+	Endpoint        *url.URL
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// PathStyle addresses the bucket as a path on the endpoint rather than
+	// as a subdomain of it. Most self-hosted servers need this.
+	PathStyle bool
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+
+	now func() time.Time
+	// parts overrides s3PartSize, for testing.
+	parts int
+}
+
+// Put is part of the BlobStore interface. S3 needs the length of what it is
+// sent up front, so bodies are sent a part at a time: one that fits in a
+// part in a single request, and larger ones as a multipart upload. Only one
+// part is held in memory at once.
+func (s *S3) Put(ctx context.Context, name string, r io.Reader, contentType string) error {
+	part := make([]byte, s.partSize())
+	n, err := io.ReadFull(r, part)
+	switch err {
+	case io.EOF, io.ErrUnexpectedEOF:
+		header := http.Header{}
+		header.Set("Content-Type", contentType)
+		res, err := s.do(ctx, "PUT", name, nil, header, part[:n])
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		return nil
+	case nil:
+		return errors.Trace(s.putMultipart(ctx, name, r, contentType, part))
+	}
+	return errors.Trace(err)
+}
+
+// s3Part is a part of a multipart upload, as CompleteMultipartUpload lists
+// them.
+type s3Part struct {
+	PartNumber int
+	ETag       string
+}
+
+// putMultipart uploads first, which fills a part, then the rest of r a
+// part at a time. The upload is aborted if any of it fails, so S3 doesn't
+// keep the parts.
+func (s *S3) putMultipart(ctx context.Context, name string, r io.Reader, contentType string, first []byte) error {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	res, err := s.do(ctx, "POST", name, url.Values{"uploads": {""}}, header, nil)
+	if err != nil {
+		return err
+	}
+	var upload struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(res.Body).Decode(&upload)
+	res.Body.Close()
+	if err != nil {
+		return errors.Annotate(err, "cannot decode multipart upload")
+	}
+
+	if err := s.uploadParts(ctx, name, upload.UploadID, r, first); err != nil {
+		// Aborting is best effort; the upload's failure is what matters.
+		if res, abortErr := s.do(ctx, "DELETE", name, url.Values{"uploadId": {upload.UploadID}}, nil, nil); abortErr == nil {
+			res.Body.Close()
+		}
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// uploadParts sends the parts of an upload and completes it.
+func (s *S3) uploadParts(ctx context.Context, name, uploadID string, r io.Reader, part []byte) error {
+	var complete struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}
+	n := len(part)
+	for number := 1; n > 0; number++ {
+		query := url.Values{
+			"partNumber": {strconv.Itoa(number)},
+			"uploadId":   {uploadID},
+		}
+		res, err := s.do(ctx, "PUT", name, query, nil, part[:n])
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		complete.Parts = append(complete.Parts, s3Part{PartNumber: number, ETag: res.Header.Get("ETag")})
+
+		n, err = io.ReadFull(r, part)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return errors.Trace(err)
+		}
+	}
+
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	res, err := s.do(ctx, "POST", name, url.Values{"uploadId": {uploadID}}, nil, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	// S3 can report a failed completion in a 200 response.
+	var result struct {
+		XMLName xml.Name
+		Code    string
+		Message string
+	}
+	if err := xml.NewDecoder(res.Body).Decode(&result); err == nil && result.XMLName.Local == "Error" {
+		return errors.Errorf("s3 complete upload %q: %s %s", name, result.Code, result.Message)
+	}
+	return nil
+}
+
+// Get is part of the BlobStore interface.
+func (s *S3) Get(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	switch {
+	case length == 0:
+		// There is no range for no bytes, but the blob must still exist.
+		if _, err := s.Stat(ctx, name); err != nil {
+			return nil, err
+		}
+		return io.NopCloser(strings.NewReader("")), nil
+	case length > 0:
+		header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	case offset > 0:
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	res, err := s.do(ctx, "GET", name, nil, header, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// Stat is part of the BlobStore interface.
+func (s *S3) Stat(ctx context.Context, name string) (*Attrs, error) {
+	res, err := s.do(ctx, "HEAD", name, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+
+	updated, _ := http.ParseTime(res.Header.Get("Last-Modified"))
+	return &Attrs{
+		Name:        name,
+		Size:        res.ContentLength,
+		ContentType: res.Header.Get("Content-Type"),
+		Updated:     updated,
+		ETag:        res.Header.Get("ETag"),
+	}, nil
+}
+
+// Delete is part of the BlobStore interface. S3 doesn't report whether the
+// blob existed, so deleting a missing blob succeeds.
+func (s *S3) Delete(ctx context.Context, name string) error {
+	res, err := s.do(ctx, "DELETE", name, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	return nil
+}
+
+type s3ListResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key          string
+		LastModified time.Time
+		ETag         string
+		Size         int64
+	}
+}
+
+// List is part of the BlobStore interface. Listings don't include content
+// types; Stat each blob if you need them.
+func (s *S3) List(ctx context.Context, prefix string) ([]Attrs, error) {
+	var list []Attrs
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		res, err := s.do(ctx, "GET", "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var result s3ListResult
+		err = xml.NewDecoder(res.Body).Decode(&result)
+		res.Body.Close()
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot decode bucket listing")
+		}
+
+		for _, obj := range result.Contents {
+			list = append(list, Attrs{
+				Name:    obj.Key,
+				Size:    obj.Size,
+				Updated: obj.LastModified,
+				ETag:    obj.ETag,
+			})
+		}
+		if !result.IsTruncated {
+			return list, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// SignedURL is part of the BlobStore interface. S3 allows at most a week.
+func (s *S3) SignedURL(ctx context.Context, name string, expires time.Duration) (string, error) {
+	if expires <= 0 || expires > 7*24*time.Hour {
+		return "", errors.NotValidf("expiry %v", expires)
+	}
+
+	u := s.url(name, nil)
+	now := s.clock()
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {s.AccessKeyID + "/" + s.scope(now)},
+		"X-Amz-Date":          {now.Format(amzDateFormat)},
+		"X-Amz-Expires":       {strconv.Itoa(int(expires.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	u.RawQuery = canonicalQuery(query)
+
+	header := http.Header{}
+	header.Set("Host", u.Host)
+	signature := s.signature(now, "GET", u, header, unsignedPayload)
+	u.RawQuery += "&X-Amz-Signature=" + signature
+
+	return u.String(), nil
+}
+
+// do sends a signed request for the named blob, or for the bucket itself if
+// name is empty. Missing blobs are reported as NotFound, unwrapped so callers
+// can return it as is; the caller must close the body of a successful
+// response.
+func (s *S3) do(ctx context.Context, method, name string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := s.url(name, query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.ContentLength = int64(len(body))
+	s.sign(req, body)
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	switch {
+	case res.StatusCode == http.StatusNotFound && name != "":
+		res.Body.Close()
+		return nil, NotFound
+	case res.StatusCode >= 300:
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		res.Body.Close()
+		return nil, errors.Errorf("s3 %s %q: %s %s", method, name, res.Status, msg)
+	}
+
+	return res, nil
+}
+
+// sign adds the SigV4 Authorization header to req.
+func (s *S3) sign(req *http.Request, body []byte) {
+	now := s.clock()
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signature := s.signature(now, req.Method, req.URL, req.Header, payloadHash)
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKeyID, s.scope(now), signedHeaders(req.Header), signature,
+	))
+	// net/http takes the host from the request, not the header map.
+	req.Header.Del("Host")
+}
+
+// signature computes the SigV4 signature of a request, signing the host and
+// x-amz-* headers.
+func (s *S3) signature(now time.Time, method string, u *url.URL, header http.Header, payloadHash string) string {
+	canonical := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		canonicalQuery(u.Query()),
+		canonicalHeaders(header),
+		signedHeaders(header),
+		payloadHash,
+	}, "\n")
+	sum := sha256.Sum256([]byte(canonical))
+
+	toSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format(amzDateFormat),
+		s.scope(now),
+		hex.EncodeToString(sum[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func (s *S3) scope(now time.Time) string {
+	return fmt.Sprintf("%s/%s/s3/aws4_request", now.Format("20060102"), s.Region)
+}
+
+func (s *S3) partSize() int {
+	if s.parts > 0 {
+		return s.parts
+	}
+	return s3PartSize
+}
+
+func (s *S3) clock() time.Time {
+	if s.now != nil {
+		return s.now().UTC()
+	}
+	return time.Now().UTC()
+}
+
+// url returns the address of the named blob.
+func (s *S3) url(name string, query url.Values) *url.URL {
+	u := *s.Endpoint
+	key := "/" + name
+	if s.PathStyle {
+		key = "/" + s.Bucket + key
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+	}
+	u.Path = key
+	u.RawPath = escapePath(key)
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+// signedHeader reports whether we sign the header with the given
+// canonical (lower case) name.
+func signedHeader(name string) bool {
+	return name == "host" || strings.HasPrefix(name, "x-amz-")
+}
+
+func canonicalHeaders(header http.Header) string {
+	var lines []string
+	for k, v := range header {
+		name := strings.ToLower(k)
+		if signedHeader(name) {
+			lines = append(lines, name+":"+strings.TrimSpace(strings.Join(v, ",")))
+		}
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func signedHeaders(header http.Header) string {
+	var names []string
+	for k := range header {
+		name := strings.ToLower(k)
+		if signedHeader(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ";")
+}
+
+// canonicalQuery encodes query sorted by key, escaping as SigV4 requires.
+func canonicalQuery(query url.Values) string {
+	var pairs []string
+	for k, vs := range query {
+		for _, v := range vs {
+			pairs = append(pairs, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, seg := range segments {
+		segments[i] = awsEscape(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+// awsEscape percent-encodes everything except the RFC 3986 unreserved
+// characters.
+func awsEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,741 @@
+package db
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/juju/errors"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Analytics are running totals of an owner's invoices, kept up to date as
+// invoices are written so reading them doesn't mean reading every invoice.
+// Amounts are in cents, and every map ends in one keyed by currency, as
+// amounts in different currencies are never added together.
+//
+// They're stored as a document for each month and each contact, so that
+// no document grows with the owner's history and an invoice write only
+// touches the months and contacts it changes.
+type Analytics struct {
+	// Months are keyed by month, as 2006-01.
+	Months map[string]map[string]MonthTotals `json:"months"`
+	// Contacts are keyed by contact ID.
+	Contacts map[string]map[string]ContactTotals `json:"contacts"`
+	// Statuses are keyed by invoice status.
+	Statuses map[string]map[string]StatusTotals `json:"statuses"`
+	// Due is what is outstanding, keyed by contact ID then due date, as
+	// 2006-01-02.
+	Due map[string]map[string]map[string]int64 `json:"due"`
+
+	// contactStatuses and dueInvoices are Statuses and Due as they're
+	// stored: by contact ID, and by contact ID then invoice ID. In a change,
+	// a nil invoice is one that is no longer due.
+	contactStatuses map[string]map[string]map[string]StatusTotals
+	dueInvoices     map[string]map[string]*dueInvoice
+}
+
+// MonthTotals are what happened in a month.
+type MonthTotals struct {
+	// Invoiced is the total of the invoices issued, and Invoices how many
+	// there were. Drafts and void invoices aren't counted.
+	Invoiced int64 `firestore:"invoiced" json:"invoiced"`
+	Invoices int64 `firestore:"invoices" json:"invoices"`
+	// Received is the total of the invoices paid.
+	Received int64 `firestore:"received" json:"received"`
+	// Credited is the total of the credit notes issued.
+	Credited int64 `firestore:"credited" json:"credited"`
+}
+
+// ContactTotals are everything invoiced to a contact. Drafts and void
+// invoices aren't counted.
+type ContactTotals struct {
+	Invoiced    int64 `firestore:"invoiced" json:"invoiced"`
+	Invoices    int64 `firestore:"invoices" json:"invoices"`
+	Received    int64 `firestore:"received" json:"received"`
+	Outstanding int64 `firestore:"outstanding" json:"outstanding"`
+	// Paid counts the invoices paid with a known date, and DaysToPay and
+	// DaysLate add up how many days each took from its issue and due date.
+	Paid      int64 `firestore:"paid" json:"paid"`
+	DaysToPay int64 `firestore:"days_to_pay" json:"days_to_pay"`
+	DaysLate  int64 `firestore:"days_late" json:"days_late"`
+}
+
+// StatusTotals count the invoices with a status.
+type StatusTotals struct {
+	Amount   int64 `firestore:"amount" json:"amount"`
+	Invoices int64 `firestore:"invoices" json:"invoices"`
+}
+
+// dueInvoice is an outstanding invoice.
+type dueInvoice struct {
+	// Date is the due date, as 2006-01-02.
+	Date     string `firestore:"date"`
+	Currency string `firestore:"currency"`
+	Amount   int64  `firestore:"amount"`
+}
+
+// NewAnalytics returns empty analytics.
+func NewAnalytics() *Analytics {
+	return &Analytics{
+		Months:          map[string]map[string]MonthTotals{},
+		Contacts:        map[string]map[string]ContactTotals{},
+		Statuses:        map[string]map[string]StatusTotals{},
+		Due:             map[string]map[string]map[string]int64{},
+		contactStatuses: map[string]map[string]map[string]StatusTotals{},
+		dueInvoices:     map[string]map[string]*dueInvoice{},
+	}
+}
+
+// noContact stands in for the contact of invoices without one, as Firestore
+// document IDs and fields can't be empty.
+const noContact = "-"
+
+// AddInvoice counts the invoice n times; -1 takes it back out.
+func (a *Analytics) AddInvoice(i *Invoice, n int64) {
+	cur := i.Currency
+	if cur == "" {
+		cur = DefaultCurrency
+	}
+	amount := n * Cents(i.GetTotal())
+	invoiceStatus := i.CurrentStatus()
+	contactID := i.ContactID
+	if contactID == "" {
+		contactID = noContact
+	}
+
+	addStatus(a.Statuses, string(invoiceStatus), cur, amount, n)
+	if a.contactStatuses[contactID] == nil {
+		a.contactStatuses[contactID] = map[string]map[string]StatusTotals{}
+	}
+	addStatus(a.contactStatuses[contactID], string(invoiceStatus), cur, amount, n)
+
+	if invoiceStatus == InvoiceStatusDraft || invoiceStatus == InvoiceStatusVoid {
+		return
+	}
+
+	issued := a.month(i.IssueDate.UTC().Format(monthFormat), cur)
+	issued.Invoiced += amount
+	issued.Invoices += n
+	a.setMonth(i.IssueDate.UTC().Format(monthFormat), cur, issued)
+
+	byContact := a.Contacts[contactID]
+	if byContact == nil {
+		byContact = map[string]ContactTotals{}
+		a.Contacts[contactID] = byContact
+	}
+	c := byContact[cur]
+	c.Invoiced += amount
+	c.Invoices += n
+
+	switch {
+	case invoiceStatus == InvoiceStatusPaid:
+		c.Received += amount
+		if !i.PaidDate.IsZero() {
+			paid := a.month(i.PaidDate.UTC().Format(monthFormat), cur)
+			paid.Received += amount
+			a.setMonth(i.PaidDate.UTC().Format(monthFormat), cur, paid)
+			c.Paid += n
+			c.DaysToPay += n * days(i.IssueDate, i.PaidDate)
+			c.DaysLate += n * days(i.DueDate, i.PaidDate)
+		}
+	default:
+		c.Outstanding += amount
+		day := i.DueDate.UTC().Format(dateFormat)
+		a.addDue(contactID, day, cur, amount)
+		a.setDue(contactID, i.ID, &dueInvoice{Date: day, Currency: cur, Amount: amount}, n)
+	}
+	byContact[cur] = c
+}
+
+func addStatus(statuses map[string]map[string]StatusTotals, invoiceStatus, cur string, amount, n int64) {
+	byStatus := statuses[invoiceStatus]
+	if byStatus == nil {
+		byStatus = map[string]StatusTotals{}
+		statuses[invoiceStatus] = byStatus
+	}
+	s := byStatus[cur]
+	s.Amount += amount
+	s.Invoices += n
+	byStatus[cur] = s
+}
+
+func (a *Analytics) addDue(contactID, day, cur string, amount int64) {
+	due := a.Due[contactID]
+	if due == nil {
+		due = map[string]map[string]int64{}
+		a.Due[contactID] = due
+	}
+	if due[day] == nil {
+		due[day] = map[string]int64{}
+	}
+	due[day][cur] += amount
+}
+
+// setDue records the invoice as due from the contact or, for n of -1, as no
+// longer due. Invoices are taken out before they're put back, so the last
+// call wins.
+func (a *Analytics) setDue(contactID, invoiceID string, due *dueInvoice, n int64) {
+	if invoiceID == "" {
+		return
+	}
+	if a.dueInvoices[contactID] == nil {
+		a.dueInvoices[contactID] = map[string]*dueInvoice{}
+	}
+	if n <= 0 || due.Amount == 0 {
+		due = nil
+	}
+	a.dueInvoices[contactID][invoiceID] = due
+}
+
+// AddCreditNote counts the credit note n times; -1 takes it back out.
+func (a *Analytics) AddCreditNote(note *CreditNote, n int64) {
+	cur := note.Currency
+	if cur == "" {
+		cur = DefaultCurrency
+	}
+	month := note.IssueDate.UTC().Format(monthFormat)
+	m := a.month(month, cur)
+	m.Credited += n * Cents(note.GetTotal())
+	a.setMonth(month, cur, m)
+}
+
+func (a *Analytics) month(month, cur string) MonthTotals {
+	return a.Months[month][cur]
+}
+
+func (a *Analytics) setMonth(month, cur string, m MonthTotals) {
+	if a.Months[month] == nil {
+		a.Months[month] = map[string]MonthTotals{}
+	}
+	a.Months[month][cur] = m
+}
+
+// increment adds value to data at path, as a change to a stored total for
+// setting with firestore.MergeAll. Totals that haven't changed are left
+// out.
+func increment(data map[string]interface{}, value int64, path ...string) {
+	if value == 0 {
+		return
+	}
+	m := data
+	for _, key := range path[:len(path)-1] {
+		next, ok := m[key].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			m[key] = next
+		}
+		m = next
+	}
+	m[path[len(path)-1]] = firestore.Increment(value)
+}
+
+// analyticsMonth is how an owner's totals for a month are stored.
+type analyticsMonth struct {
+	Owner  string                 `firestore:"owner"`
+	Month  string                 `firestore:"month"`
+	Totals map[string]MonthTotals `firestore:"totals"`
+}
+
+// analyticsContact is how an owner's totals for a contact are stored.
+type analyticsContact struct {
+	Owner     string                             `firestore:"owner"`
+	ContactID string                             `firestore:"contact_id"`
+	Totals    map[string]ContactTotals           `firestore:"totals"`
+	Statuses  map[string]map[string]StatusTotals `firestore:"statuses"`
+	// Due are the contact's outstanding invoices, keyed by invoice ID. They
+	// are deleted once paid, so only what is outstanding is kept.
+	Due map[string]dueInvoice `firestore:"due"`
+}
+
+// analyticsBuild records that an owner's analytics have been worked out
+// from all their invoices, as they're stored in analyticsVersion.
+type analyticsBuild struct {
+	Version int `firestore:"version"`
+}
+
+// analyticsVersion is the version of how analytics are stored. Owners whose
+// analytics were built for another version have them built again.
+const analyticsVersion = 2
+
+const (
+	analyticsCollection         = "analytics"
+	analyticsMonthsCollection   = "analytics_months"
+	analyticsContactsCollection = "analytics_contacts"
+)
+
+func (app *App) analyticsRef(owner string) *firestore.DocumentRef {
+	return app.firestoreClient.Collection(analyticsCollection).Doc(owner)
+}
+
+func (app *App) analyticsMonthRef(owner, month string) *firestore.DocumentRef {
+	return app.firestoreClient.Collection(analyticsMonthsCollection).Doc(owner + "_" + month)
+}
+
+func (app *App) analyticsContactRef(owner, contactID string) *firestore.DocumentRef {
+	return app.firestoreClient.Collection(analyticsContactsCollection).Doc(owner + "_" + contactID)
+}
+
+// monthDoc returns the month's totals to store, or nil if there are none.
+func (a *Analytics) monthDoc(owner, month string) *analyticsMonth {
+	if len(a.Months[month]) == 0 {
+		return nil
+	}
+	return &analyticsMonth{Owner: owner, Month: month, Totals: a.Months[month]}
+}
+
+// contactDoc returns the contact's totals to store, or nil if there are
+// none.
+func (a *Analytics) contactDoc(owner, contactID string) *analyticsContact {
+	if len(a.Contacts[contactID]) == 0 && len(a.contactStatuses[contactID]) == 0 {
+		return nil
+	}
+	doc := &analyticsContact{
+		Owner:     owner,
+		ContactID: contactID,
+		Totals:    a.Contacts[contactID],
+		Statuses:  a.contactStatuses[contactID],
+		Due:       map[string]dueInvoice{},
+	}
+	for id, due := range a.dueInvoices[contactID] {
+		if due != nil {
+			doc.Due[id] = *due
+		}
+	}
+	return doc
+}
+
+// addMonth adds a stored month's totals.
+func (a *Analytics) addMonth(m *analyticsMonth) {
+	if len(m.Totals) > 0 {
+		a.Months[m.Month] = m.Totals
+	}
+}
+
+// addContact adds a stored contact's totals.
+func (a *Analytics) addContact(c *analyticsContact) {
+	if len(c.Totals) > 0 {
+		a.Contacts[c.ContactID] = c.Totals
+	}
+	for invoiceStatus, byCurrency := range c.Statuses {
+		for cur, s := range byCurrency {
+			addStatus(a.Statuses, invoiceStatus, cur, s.Amount, s.Invoices)
+		}
+	}
+	for _, due := range c.Due {
+		a.addDue(c.ContactID, due.Date, due.Currency, due.Amount)
+	}
+}
+
+// analyticsWrite is a change to an owner's analytics, to make in the same
+// write as the change to the invoices it counts.
+type analyticsWrite struct {
+	owner string
+	delta *Analytics
+}
+
+// changeAnalytics returns the write replacing before with after in the
+// owner's analytics. Either may be nil, for invoices being added or
+// deleted.
+func changeAnalytics(before, after *Invoice) analyticsWrite {
+	w := analyticsWrite{delta: NewAnalytics()}
+	if before != nil {
+		w.owner = before.OwnerID()
+		w.delta.AddInvoice(before, -1)
+	}
+	if after != nil {
+		w.owner = after.OwnerID()
+		w.delta.AddInvoice(after, 1)
+	}
+	return w
+}
+
+// analyticsDoc is a change to one of the documents analytics are stored
+// in, for setting with firestore.MergeAll.
+type analyticsDoc struct {
+	ref  *firestore.DocumentRef
+	data map[string]interface{}
+}
+
+// docs returns the changes the write makes to each document. Documents
+// that don't change are left out.
+func (w analyticsWrite) docs(app *App) []analyticsDoc {
+	if w.owner == "" {
+		return nil
+	}
+	var docs []analyticsDoc
+	for month, byCurrency := range w.delta.Months {
+		data := map[string]interface{}{}
+		for cur, m := range byCurrency {
+			increment(data, m.Invoiced, "totals", cur, "invoiced")
+			increment(data, m.Invoices, "totals", cur, "invoices")
+			increment(data, m.Received, "totals", cur, "received")
+			increment(data, m.Credited, "totals", cur, "credited")
+		}
+		if len(data) > 0 {
+			data["owner"], data["month"] = w.owner, month
+			docs = append(docs, analyticsDoc{ref: app.analyticsMonthRef(w.owner, month), data: data})
+		}
+	}
+
+	contactIDs := map[string]bool{}
+	for contactID := range w.delta.Contacts {
+		contactIDs[contactID] = true
+	}
+	for contactID := range w.delta.contactStatuses {
+		contactIDs[contactID] = true
+	}
+	for contactID := range w.delta.dueInvoices {
+		contactIDs[contactID] = true
+	}
+	for contactID := range contactIDs {
+		data := map[string]interface{}{}
+		for cur, c := range w.delta.Contacts[contactID] {
+			increment(data, c.Invoiced, "totals", cur, "invoiced")
+			increment(data, c.Invoices, "totals", cur, "invoices")
+			increment(data, c.Received, "totals", cur, "received")
+			increment(data, c.Outstanding, "totals", cur, "outstanding")
+			increment(data, c.Paid, "totals", cur, "paid")
+			increment(data, c.DaysToPay, "totals", cur, "days_to_pay")
+			increment(data, c.DaysLate, "totals", cur, "days_late")
+		}
+		for invoiceStatus, byCurrency := range w.delta.contactStatuses[contactID] {
+			for cur, s := range byCurrency {
+				increment(data, s.Amount, "statuses", invoiceStatus, cur, "amount")
+				increment(data, s.Invoices, "statuses", invoiceStatus, cur, "invoices")
+			}
+		}
+		if byInvoice := w.delta.dueInvoices[contactID]; len(byInvoice) > 0 {
+			due := map[string]interface{}{}
+			for id, d := range byInvoice {
+				if d == nil {
+					due[id] = firestore.Delete
+				} else {
+					due[id] = *d
+				}
+			}
+			data["due"] = due
+		}
+		if len(data) > 0 {
+			data["owner"], data["contact_id"] = w.owner, contactID
+			docs = append(docs, analyticsDoc{ref: app.analyticsContactRef(w.owner, contactID), data: data})
+		}
+	}
+	return docs
+}
+
+// inTransaction makes the write in tx.
+func (w analyticsWrite) inTransaction(app *App, tx *firestore.Transaction) error {
+	for _, doc := range w.docs(app) {
+		if err := tx.Set(doc.ref, doc.data, firestore.MergeAll); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// AnalyticsOwner says whose analytics to read. Exactly one of UserID and
+// OrganisationID must be set. A user's analytics don't count the invoices
+// they made for organisations.
+type AnalyticsOwner struct {
+	UserID         string
+	OrganisationID string
+}
+
+// id returns the owner's ID, and the field invoices and credit notes
+// record it in.
+func (o AnalyticsOwner) id() (string, string, error) {
+	switch {
+	case o.UserID != "" && o.OrganisationID == "":
+		return o.UserID, "user_id", nil
+	case o.OrganisationID != "" && o.UserID == "":
+		return o.OrganisationID, "organisation_id", nil
+	}
+	return "", "", errors.NotValidf("analytics without exactly one owner")
+}
+
+// Analytics returns the owner's analytics. The first time they're read
+// they are worked out from all the owner's invoices and credit notes.
+func (app *App) Analytics(ctx context.Context, owner AnalyticsOwner) (*Analytics, error) {
+	ownerID, field, err := owner.id()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var build analyticsBuild
+	doc, err := app.analyticsRef(ownerID).Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return nil, errors.Trace(err)
+	}
+	if err == nil {
+		if err := doc.DataTo(&build); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	if build.Version != analyticsVersion {
+		if err := app.buildAnalytics(ctx, ownerID, field); err != nil {
+			return nil, errors.Annotate(err, "cannot build analytics")
+		}
+	}
+
+	analytics := NewAnalytics()
+	months := app.firestoreClient.Collection(analyticsMonthsCollection).Where("owner", "==", ownerID)
+	err = forEachDoc(ctx, months, func(doc *firestore.DocumentSnapshot) error {
+		var m analyticsMonth
+		if err := doc.DataTo(&m); err != nil {
+			return errors.Trace(err)
+		}
+		analytics.addMonth(&m)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	contacts := app.firestoreClient.Collection(analyticsContactsCollection).Where("owner", "==", ownerID)
+	err = forEachDoc(ctx, contacts, func(doc *firestore.DocumentSnapshot) error {
+		var c analyticsContact
+		if err := doc.DataTo(&c); err != nil {
+			return errors.Trace(err)
+		}
+		analytics.addContact(&c)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return analytics, nil
+}
+
+// forEachDoc calls fn with each document q returns.
+func forEachDoc(ctx context.Context, q firestore.Query, fn func(*firestore.DocumentSnapshot) error) error {
+	iter := q.Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if err := fn(doc); err != nil {
+			return errors.Trace(err)
+		}
+	}
+}
+
+// buildAnalytics works out the owner's analytics from their invoices and
+// credit notes, one month and one contact at a time. Totals written for
+// invoices before now are replaced. Each month and contact is worked out
+// in a transaction that reads its stored totals, so any invoice written
+// meanwhile, which changes them too, makes it start again.
+func (app *App) buildAnalytics(ctx context.Context, ownerID, field string) error {
+	all := NewAnalytics()
+	invoices := app.firestoreClient.Collection(invoicesCollection).Where(field, "==", ownerID)
+	err := forEachDoc(ctx, invoices, func(doc *firestore.DocumentSnapshot) error {
+		var invoice Invoice
+		if err := doc.DataTo(&invoice); err != nil {
+			return errors.Trace(err)
+		}
+		if invoice.OwnerID() == ownerID {
+			all.AddInvoice(&invoice, 1)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	notes := app.firestoreClient.Collection(creditNotesCollection).Where(field, "==", ownerID)
+	err = forEachDoc(ctx, notes, func(doc *firestore.DocumentSnapshot) error {
+		var note CreditNote
+		if err := doc.DataTo(&note); err != nil {
+			return errors.Trace(err)
+		}
+		if note.OwnerID() == ownerID {
+			all.AddCreditNote(&note, 1)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	months := map[string]bool{}
+	for month := range all.Months {
+		months[month] = true
+	}
+	contactIDs := map[string]bool{}
+	for contactID := range all.contactStatuses {
+		contactIDs[contactID] = true
+	}
+	stored := app.firestoreClient.Collection(analyticsMonthsCollection).Where("owner", "==", ownerID)
+	err = forEachDoc(ctx, stored, func(doc *firestore.DocumentSnapshot) error {
+		var m analyticsMonth
+		if err := doc.DataTo(&m); err != nil {
+			return errors.Trace(err)
+		}
+		months[m.Month] = true
+		return nil
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	stored = app.firestoreClient.Collection(analyticsContactsCollection).Where("owner", "==", ownerID)
+	err = forEachDoc(ctx, stored, func(doc *firestore.DocumentSnapshot) error {
+		var c analyticsContact
+		if err := doc.DataTo(&c); err != nil {
+			return errors.Trace(err)
+		}
+		contactIDs[c.ContactID] = true
+		return nil
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	for month := range months {
+		if err := app.buildAnalyticsMonth(ctx, ownerID, field, month); err != nil {
+			return errors.Annotatef(err, "month %s", month)
+		}
+	}
+	for contactID := range contactIDs {
+		if err := app.buildAnalyticsContact(ctx, ownerID, field, contactID); err != nil {
+			return errors.Annotatef(err, "contact %s", contactID)
+		}
+	}
+	_, err = app.analyticsRef(ownerID).Set(ctx, analyticsBuild{Version: analyticsVersion})
+	return errors.Trace(err)
+}
+
+// buildAnalyticsMonth works out the owner's totals for the month from the
+// invoices issued or paid in it and the credit notes issued in it.
+func (app *App) buildAnalyticsMonth(ctx context.Context, ownerID, field, month string) error {
+	start, err := time.Parse(monthFormat, month)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	end := start.AddDate(0, 1, 0)
+	invoices := app.firestoreClient.Collection(invoicesCollection).Where(field, "==", ownerID)
+	queries := []firestore.Query{
+		invoices.Where("issue_date", ">=", start).Where("issue_date", "<", end),
+		invoices.Where("paid_date", ">=", start).Where("paid_date", "<", end),
+	}
+	notes := app.firestoreClient.Collection(creditNotesCollection).Where(field, "==", ownerID).
+		Where("issue_date", ">=", start).Where("issue_date", "<", end)
+
+	ref := app.analyticsMonthRef(ownerID, month)
+	return app.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if _, err := tx.Get(ref); err != nil && status.Code(err) != codes.NotFound {
+			return errors.Trace(err)
+		}
+		analytics := NewAnalytics()
+		// Invoices issued and paid in the month are in both queries.
+		seen := map[string]bool{}
+		for _, q := range queries {
+			docs, err := tx.Documents(q).GetAll()
+			if err != nil {
+				return errors.Trace(err)
+			}
+			for _, doc := range docs {
+				if seen[doc.Ref.ID] {
+					continue
+				}
+				seen[doc.Ref.ID] = true
+				var invoice Invoice
+				if err := doc.DataTo(&invoice); err != nil {
+					return errors.Trace(err)
+				}
+				if invoice.OwnerID() == ownerID {
+					analytics.AddInvoice(&invoice, 1)
+				}
+			}
+		}
+		docs, err := tx.Documents(notes).GetAll()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		for _, doc := range docs {
+			var note CreditNote
+			if err := doc.DataTo(&note); err != nil {
+				return errors.Trace(err)
+			}
+			if note.OwnerID() == ownerID {
+				analytics.AddCreditNote(&note, 1)
+			}
+		}
+
+		// Invoices paid in the month add to the month they were issued in
+		// too, which is built on its own.
+		m := analytics.monthDoc(ownerID, month)
+		if m == nil {
+			return errors.Trace(tx.Delete(ref))
+		}
+		return errors.Trace(tx.Set(ref, m))
+	})
+}
+
+// buildAnalyticsContact works out the owner's totals for the contact from
+// the invoices to them.
+func (app *App) buildAnalyticsContact(ctx context.Context, ownerID, field, contactID string) error {
+	id := contactID
+	if id == noContact {
+		id = ""
+	}
+	invoices := app.firestoreClient.Collection(invoicesCollection).
+		Where(field, "==", ownerID).Where("contact_id", "==", id)
+
+	ref := app.analyticsContactRef(ownerID, contactID)
+	return app.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if _, err := tx.Get(ref); err != nil && status.Code(err) != codes.NotFound {
+			return errors.Trace(err)
+		}
+		docs, err := tx.Documents(invoices).GetAll()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		analytics := NewAnalytics()
+		for _, doc := range docs {
+			var invoice Invoice
+			if err := doc.DataTo(&invoice); err != nil {
+				return errors.Trace(err)
+			}
+			invoice.ID = doc.Ref.ID
+			if invoice.OwnerID() == ownerID {
+				analytics.AddInvoice(&invoice, 1)
+			}
+		}
+
+		c := analytics.contactDoc(ownerID, contactID)
+		if c == nil {
+			return errors.Trace(tx.Delete(ref))
+		}
+		return errors.Trace(tx.Set(ref, c))
+	})
+}
+
+func (app *App) AnalyticsDeleteAll(ctx context.Context, batchSize int) error {
+	for _, collection := range []string{analyticsCollection, analyticsMonthsCollection, analyticsContactsCollection} {
+		if err := app.deleteCollection(ctx, collection, batchSize); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+const (
+	monthFormat = "2006-01"
+	dateFormat  = "2006-01-02"
+)
+
+// days returns how many calendar days after from to is.
+func days(from, to time.Time) int64 {
+	day := func(t time.Time) time.Time {
+		y, m, d := t.UTC().Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	}
+	return int64(math.Round(day(to).Sub(day(from)).Hours() / 24))
+}
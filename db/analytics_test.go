@@ -0,0 +1,110 @@
+package db_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/tests/setup"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type AnalyticsSuite struct {
+	setup.ApplicationSuiteCore
+
+	user *db.User
+}
+
+var _ = gc.Suite(&AnalyticsSuite{})
+
+func (s *AnalyticsSuite) SetUpTest(c *gc.C) {
+	s.user = s.AddUser(context.Background(), c)
+}
+
+func (s *AnalyticsSuite) addInvoice(c *gc.C, contactID string) *db.Invoice {
+	invoice := setup.CreateInvoice(s.user.ID)
+	invoice.ContactID = contactID
+	invoice.Hours, invoice.Rate = 1, 100
+	invoice.IssueDate = time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+	invoice.DueDate = time.Date(2022, 4, 21, 0, 0, 0, 0, time.UTC)
+	id, err := s.App.AddInvoice(context.Background(), invoice)
+	c.Assert(err, jc.ErrorIsNil)
+	invoice.ID = id
+	return invoice
+}
+
+func (s *AnalyticsSuite) analytics(c *gc.C) *db.Analytics {
+	a, err := s.App.Analytics(context.Background(), db.AnalyticsOwner{UserID: s.user.ID})
+	c.Assert(err, jc.ErrorIsNil)
+	return a
+}
+
+func (s *AnalyticsSuite) TestBuiltFromInvoices(c *gc.C) {
+	s.addInvoice(c, "jane")
+	s.addInvoice(c, "jane")
+
+	a := s.analytics(c)
+	c.Check(a.Months["2022-04"]["NZD"], gc.Equals, db.MonthTotals{Invoiced: 23000, Invoices: 2})
+	c.Check(a.Contacts["jane"]["NZD"].Outstanding, gc.Equals, int64(23000))
+	c.Check(a.Due["jane"]["2022-04-21"]["NZD"], gc.Equals, int64(23000))
+}
+
+func (s *AnalyticsSuite) TestKeptUpToDate(c *gc.C) {
+	ctx := context.Background()
+	first := s.addInvoice(c, "jane")
+	s.analytics(c)
+
+	second := s.addInvoice(c, "jane")
+	err := first.SetStatus(ctx, s.App, db.InvoiceStatusPaid, time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC), "paid-pdf")
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.App.AddCreditNote(ctx, &db.CreditNote{
+		InvoiceID: first.ID,
+		Amount:    10,
+		IssueDate: time.Date(2022, 5, 2, 0, 0, 0, 0, time.UTC),
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	a := s.analytics(c)
+	c.Check(a.Months["2022-04"]["NZD"].Invoiced, gc.Equals, int64(23000))
+	c.Check(a.Months["2022-05"]["NZD"], gc.Equals, db.MonthTotals{Received: 11500, Credited: 1150})
+	c.Check(a.Contacts["jane"]["NZD"], gc.Equals, db.ContactTotals{
+		Invoiced:    23000,
+		Invoices:    2,
+		Received:    11500,
+		Outstanding: 11500,
+		Paid:        1,
+		DaysToPay:   30,
+		DaysLate:    10,
+	})
+	c.Check(a.Statuses["paid"]["NZD"].Invoices, gc.Equals, int64(1))
+	c.Check(a.Statuses["issued"]["NZD"].Invoices, gc.Equals, int64(1))
+
+	c.Assert(second.Delete(ctx, s.App), jc.ErrorIsNil)
+	a = s.analytics(c)
+	c.Check(a.Contacts["jane"]["NZD"].Outstanding, gc.Equals, int64(0))
+	c.Check(a.Due["jane"], gc.HasLen, 0)
+	c.Check(a.Statuses["issued"]["NZD"].Invoices, gc.Equals, int64(0))
+}
+
+func (s *AnalyticsSuite) TestMergeContacts(c *gc.C) {
+	ctx := context.Background()
+	survivor := s.AddContact(ctx, c, s.user.ID)
+	duplicate := s.AddContact(ctx, c, s.user.ID)
+	s.addInvoice(c, duplicate.ID)
+	s.analytics(c)
+
+	_, err := s.App.MergeContacts(ctx, survivor.ID, []string{duplicate.ID})
+	c.Assert(err, jc.ErrorIsNil)
+
+	a := s.analytics(c)
+	c.Check(a.Contacts[survivor.ID]["NZD"].Invoices, gc.Equals, int64(1))
+	c.Check(a.Contacts[duplicate.ID]["NZD"].Invoices, gc.Equals, int64(0))
+}
+
+func (s *AnalyticsSuite) TestOwner(c *gc.C) {
+	_, err := s.App.Analytics(context.Background(), db.AnalyticsOwner{})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+}
@@ -0,0 +1,218 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/juju/errors"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var APIKeyNotFound = errors.New("api key not found")
+
+// APIKeyScope limits what an API key is allowed to do.
+type APIKeyScope string
+
+const (
+	// APIKeyScopeRead keys may only make read requests.
+	APIKeyScopeRead APIKeyScope = "read"
+	// APIKeyScopeWrite keys may make any request the user could.
+	APIKeyScopeWrite APIKeyScope = "write"
+)
+
+// apiKeyPrefix is prepended to every secret so keys are recognisable when
+// they leak into logs or config files.
+const apiKeyPrefix = "wham_"
+
+// APIKey is a personal access key used for scripted access. We only store
+// the SHA-256 hash of the secret; the secret itself is shown once on creation.
+type APIKey struct {
+	ID        string      `json:"id"`
+	UserID    string      `firestore:"user_id" json:"user_id"`
+	Label     string      `firestore:"label" json:"label"`
+	Scope     APIKeyScope `firestore:"scope" json:"scope"`
+	Prefix    string      `firestore:"prefix" json:"prefix"`
+	Hash      string      `firestore:"hash" json:"-"`
+	CreatedAt time.Time   `firestore:"created_at" json:"created_at"`
+	LastUsed  time.Time   `firestore:"last_used" json:"last_used"`
+	Revoked   bool        `firestore:"revoked" json:"revoked"`
+}
+
+const apiKeysCollection = "api_keys"
+
+// Valid returns true if s is a known scope.
+func (s APIKeyScope) Valid() bool {
+	return s == APIKeyScopeRead || s == APIKeyScopeWrite
+}
+
+// NewAPIKey creates an API key for the user and returns it along with the
+// plain text secret. The secret cannot be recovered later.
+func (app *App) NewAPIKey(
+	ctx context.Context,
+	userID, label string,
+	scope APIKeyScope,
+) (*APIKey, string, error) {
+	if !scope.Valid() {
+		return nil, "", errors.NotValidf("api key scope %q", scope)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", errors.Trace(err)
+	}
+	secret := apiKeyPrefix + hex.EncodeToString(raw)
+
+	key := &APIKey{
+		UserID:    userID,
+		Label:     label,
+		Scope:     scope,
+		Prefix:    secret[:len(apiKeyPrefix)+8],
+		Hash:      hashAPIKey(secret),
+		CreatedAt: time.Now(),
+	}
+
+	ref, _, err := app.firestoreClient.Collection(apiKeysCollection).Add(ctx, key)
+	if err != nil {
+		return nil, "", errors.Trace(err)
+	}
+	key.ID = ref.ID
+
+	return key, secret, nil
+}
+
+func (app *App) APIKey(ctx context.Context, id string) (*APIKey, error) {
+	var key = new(APIKey)
+
+	doc, err := app.firestoreClient.Collection(apiKeysCollection).Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return key, APIKeyNotFound
+	}
+	if err != nil {
+		return key, errors.Trace(err)
+	}
+
+	if err := doc.DataTo(&key); err != nil {
+		return key, errors.Trace(err)
+	}
+
+	key.ID = doc.Ref.ID
+
+	return key, nil
+}
+
+// APIKeyBySecret returns the unrevoked key matching the plain text secret.
+func (app *App) APIKeyBySecret(ctx context.Context, secret string) (*APIKey, error) {
+	if !strings.HasPrefix(secret, apiKeyPrefix) {
+		return nil, APIKeyNotFound
+	}
+
+	iter := app.firestoreClient.Collection(apiKeysCollection).
+		Where("hash", "==", hashAPIKey(secret)).
+		Limit(1).
+		Documents(ctx)
+	defer iter.Stop()
+
+	doc, err := iter.Next()
+	if err == iterator.Done {
+		return nil, APIKeyNotFound
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var key = new(APIKey)
+	if err := doc.DataTo(&key); err != nil {
+		return nil, errors.Trace(err)
+	}
+	key.ID = doc.Ref.ID
+
+	if key.Revoked {
+		return nil, APIKeyNotFound
+	}
+
+	return key, nil
+}
+
+// CanWrite returns true if the key may be used for requests that modify data.
+func (k *APIKey) CanWrite() bool {
+	return k.Scope == APIKeyScopeWrite
+}
+
+// Touch records that the key has just been used.
+func (k *APIKey) Touch(ctx context.Context, app *App) error {
+	k.LastUsed = time.Now()
+
+	return k.update(ctx, app, []firestore.Update{
+		{Path: "last_used", Value: k.LastUsed},
+	})
+}
+
+// SetLabel renames the key.
+func (k *APIKey) SetLabel(ctx context.Context, app *App, label string) error {
+	k.Label = label
+
+	return k.update(ctx, app, []firestore.Update{
+		{Path: "label", Value: label},
+	})
+}
+
+// Revoke stops the key from authenticating any further requests. The record
+// is kept so the user can still see when it was last used.
+func (k *APIKey) Revoke(ctx context.Context, app *App) error {
+	k.Revoked = true
+
+	return k.update(ctx, app, []firestore.Update{
+		{Path: "revoked", Value: true},
+	})
+}
+
+func (k *APIKey) update(ctx context.Context, app *App, updates []firestore.Update) error {
+	_, err := app.firestoreClient.Collection(apiKeysCollection).Doc(k.ID).Update(ctx, updates)
+	if status.Code(err) == codes.NotFound {
+		return APIKeyNotFound
+	}
+
+	return errors.Trace(err)
+}
+
+func (app *App) apiKeysForUser(ctx context.Context, userID string) ([]APIKey, error) {
+	keys := []APIKey{}
+
+	iter := app.firestoreClient.Collection(apiKeysCollection).Where("user_id", "==", userID).Documents(ctx)
+	for {
+		var key = new(APIKey)
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return keys, err
+		}
+
+		if err := doc.DataTo(&key); err != nil {
+			return keys, errors.Trace(err)
+		}
+
+		key.ID = doc.Ref.ID
+
+		keys = append(keys, *key)
+	}
+
+	return keys, nil
+}
+
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func (app *App) APIKeysDeleteAll(ctx context.Context, batchSize int) error {
+	return app.deleteCollection(ctx, apiKeysCollection, batchSize)
+}
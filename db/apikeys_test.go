@@ -0,0 +1,53 @@
+package db_test
+
+import (
+	"context"
+
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/tests/setup"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type APIKeysSuite struct {
+	setup.ApplicationSuiteCore
+
+	user *db.User
+}
+
+var _ = gc.Suite(&APIKeysSuite{})
+
+func (s *APIKeysSuite) SetUpTest(c *gc.C) {
+
+	s.user = s.AddUser(context.Background(), c)
+}
+
+func (s *APIKeysSuite) TestAPIKeyBySecret(c *gc.C) {
+	ctx := context.Background()
+	key, secret, err := s.App.NewAPIKey(ctx, s.user.ID, "timesheets", db.APIKeyScopeRead)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(secret, gc.Not(gc.Equals), key.Hash)
+
+	getKey, err := s.App.APIKeyBySecret(ctx, secret)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(getKey.ID, gc.Equals, key.ID)
+	c.Check(getKey.UserID, gc.Equals, s.user.ID)
+	c.Check(getKey.CanWrite(), jc.IsFalse)
+}
+
+func (s *APIKeysSuite) TestAPIKeyRevoke(c *gc.C) {
+	ctx := context.Background()
+	key, secret, err := s.App.NewAPIKey(ctx, s.user.ID, "timesheets", db.APIKeyScopeWrite)
+	c.Assert(err, jc.ErrorIsNil)
+
+	c.Assert(key.Revoke(ctx, s.App), jc.ErrorIsNil)
+
+	_, err = s.App.APIKeyBySecret(ctx, secret)
+	c.Check(err, gc.Equals, db.APIKeyNotFound)
+}
+
+func (s *APIKeysSuite) TestAPIKeyBadScope(c *gc.C) {
+	_, _, err := s.App.NewAPIKey(context.Background(), s.user.ID, "timesheets", "admin")
+	c.Check(err, gc.ErrorMatches, `api key scope "admin" not valid`)
+}
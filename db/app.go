@@ -5,25 +5,26 @@ import (
 
 	"cloud.google.com/go/firestore"
 	firebase "firebase.google.com/go/v4"
-	"firebase.google.com/go/v4/storage"
 	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/blob"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
 type App struct {
 	firestoreClient *firestore.Client
-	storageClient   *storage.Client
+	blobs           blob.BlobStore
+	search          *searchIndex
 }
 
+const credentialsFile = "/opt/firebase_service_account_key.json"
+
 // TODO DB config should be stored in config file.
 func Init(ctx context.Context) (*App, error) {
 	var app = new(App)
 
-	config := &firebase.Config{
-		StorageBucket: "wham-ad61b.appspot.com",
-	}
-	opt := option.WithCredentialsFile("/opt/firebase_service_account_key.json")
-	firebaseApp, err := firebase.NewApp(context.Background(), config, opt)
+	opt := option.WithCredentialsFile(credentialsFile)
+	firebaseApp, err := firebase.NewApp(context.Background(), nil, opt)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -34,15 +35,58 @@ func Init(ctx context.Context) (*App, error) {
 	}
 	app.firestoreClient = fs
 
-	storage, err := firebaseApp.Storage(ctx)
+	// Files live in the Firebase storage bucket unless configured otherwise.
+	blobs, err := blob.New(ctx, blob.ConfigFromEnv(blob.Config{
+		Backend:         blob.BackendGCS,
+		Bucket:          "wham-ad61b.appspot.com",
+		CredentialsFile: credentialsFile,
+	}))
 	if err != nil {
-		return nil, errors.Trace(err)
+		return nil, errors.Annotate(err, "cannot set up blob store")
 	}
-	app.storageClient = storage
+	app.blobs = blobs
+	app.search = newSearchIndex(fs)
 
 	return app, nil
 }
 
+// Blobs returns the store that holds PDFs, logos and other files.
+func (a *App) Blobs() blob.BlobStore {
+	return a.blobs
+}
+
 func (a *App) CloseDB() {
 	a.firestoreClient.Close()
 }
+
+// deleteCollection deletes every document in the collection, batchSize
+// documents at a time.
+func (a *App) deleteCollection(ctx context.Context, collection string, batchSize int) error {
+	for {
+		iter := a.firestoreClient.Collection(collection).Limit(batchSize).Documents(ctx)
+		numDeleted := 0
+
+		batch := a.firestoreClient.Batch()
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			batch.Delete(doc.Ref)
+			numDeleted++
+		}
+
+		if numDeleted == 0 {
+			return nil
+		}
+
+		_, err := batch.Commit(ctx)
+		if err != nil {
+			return err
+		}
+	}
+}
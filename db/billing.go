@@ -0,0 +1,199 @@
+package db
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// PaymentTerms say when an invoice falls due:
+//
+//	net_14  fourteen days after it is issued
+//	eom     at the end of the month it is issued in
+//	eom_20  on the 20th of the month after it is issued
+type PaymentTerms string
+
+var paymentTermsPattern = regexp.MustCompile(`^(net|eom)(?:_(\d{1,3}))?$`)
+
+// terms returns the kind of terms and their day count, which is 0 for plain
+// eom.
+func (t PaymentTerms) terms() (string, int, error) {
+	m := paymentTermsPattern.FindStringSubmatch(string(t))
+	if m == nil {
+		return "", 0, errors.NotValidf("payment terms %q", string(t))
+	}
+	kind := m[1]
+	if m[2] == "" {
+		if kind == "net" {
+			return "", 0, errors.NotValidf("payment terms %q without a number of days", string(t))
+		}
+		return kind, 0, nil
+	}
+	days, _ := strconv.Atoi(m[2])
+	switch {
+	case kind == "net" && days > 365:
+		return "", 0, errors.NotValidf("payment terms of more than 365 days")
+	case kind == "eom" && (days < 1 || days > 31):
+		return "", 0, errors.NotValidf("payment terms %q, not a day of the month,", string(t))
+	}
+	return kind, days, nil
+}
+
+// Validate returns a NotValid error unless t is one of the forms above.
+func (t PaymentTerms) Validate() error {
+	_, _, err := t.terms()
+	return errors.Trace(err)
+}
+
+// DueDate returns when an invoice issued at issued is due. Days past the end
+// of a short month move back to its last day.
+func (t PaymentTerms) DueDate(issued time.Time) (time.Time, error) {
+	kind, days, err := t.terms()
+	if err != nil {
+		return time.Time{}, errors.Trace(err)
+	}
+	year, month, day := issued.Date()
+	loc := issued.Location()
+
+	switch {
+	case kind == "net":
+		return time.Date(year, month, day+days, 0, 0, 0, 0, loc), nil
+	case days == 0:
+		return time.Date(year, month+1, 0, 0, 0, 0, 0, loc), nil
+	}
+	last := time.Date(year, month+2, 0, 0, 0, 0, 0, loc).Day()
+	if days > last {
+		days = last
+	}
+	return time.Date(year, month+1, days, 0, 0, 0, 0, loc), nil
+}
+
+// String describes the terms for people, e.g. "Net 14 days".
+func (t PaymentTerms) String() string {
+	kind, days, err := t.terms()
+	switch {
+	case err != nil:
+		return string(t)
+	case kind == "net":
+		return fmt.Sprintf("Net %d days", days)
+	case days == 0:
+		return "End of month"
+	}
+	return fmt.Sprintf("%s of the following month", ordinal(days))
+}
+
+// TaxTreatment says how GST applies to an invoice.
+type TaxTreatment string
+
+const (
+	// TaxStandard charges GST at 15%. Invoices without a treatment are
+	// standard rated.
+	TaxStandard TaxTreatment = "standard"
+	// TaxZeroRated charges GST at 0%, e.g. for services exported overseas.
+	TaxZeroRated TaxTreatment = "zero_rated"
+	// TaxExempt supplies are outside GST altogether.
+	TaxExempt TaxTreatment = "exempt"
+)
+
+// Valid returns true if t is blank or a known treatment.
+func (t TaxTreatment) Valid() bool {
+	switch t {
+	case "", TaxStandard, TaxZeroRated, TaxExempt:
+		return true
+	}
+	return false
+}
+
+// GSTRate returns the share of the subtotal charged as GST.
+func (t TaxTreatment) GSTRate() float32 {
+	if t == "" || t == TaxStandard {
+		return 0.15
+	}
+	return 0
+}
+
+// BillingDefaults are how a contact is usually invoiced. They fill in
+// whatever a new invoice for the contact leaves out.
+type BillingDefaults struct {
+	PaymentTerms PaymentTerms `firestore:"payment_terms" json:"payment_terms,omitempty"`
+	// Rate is the hourly rate charged.
+	Rate float32 `firestore:"rate" json:"rate,omitempty"`
+	// Currency is an ISO 4217 code such as "NZD".
+	Currency     string       `firestore:"currency" json:"currency,omitempty"`
+	TaxTreatment TaxTreatment `firestore:"tax_treatment" json:"tax_treatment,omitempty"`
+	// Recipients are who else invoices are emailed to, besides the
+	// contact.
+	Recipients []string `firestore:"recipients" json:"recipients,omitempty"`
+}
+
+// MaxBillingRecipients is the most extra recipients a contact can have.
+const MaxBillingRecipients = 10
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// NormaliseCurrency upper-cases an ISO 4217 currency code, returning a
+// NotValid error if it doesn't look like one. Blank stays blank.
+func NormaliseCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code != "" && !currencyPattern.MatchString(code) {
+		return "", errors.NotValidf("currency %q", code)
+	}
+	return code, nil
+}
+
+// Normalise checks the defaults, tidying the currency and recipients.
+func (d *BillingDefaults) Normalise() error {
+	if d.PaymentTerms != "" {
+		if err := d.PaymentTerms.Validate(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if d.Rate < 0 {
+		return errors.NotValidf("negative rate")
+	}
+	currency, err := NormaliseCurrency(d.Currency)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	d.Currency = currency
+	if !d.TaxTreatment.Valid() {
+		return errors.NotValidf("tax treatment %q", d.TaxTreatment)
+	}
+
+	if len(d.Recipients) > MaxBillingRecipients {
+		return errors.NotValidf("more than %d recipients", MaxBillingRecipients)
+	}
+	recipients := []string{}
+	for _, r := range d.Recipients {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		if addr, err := mail.ParseAddress(r); err != nil || addr.Address != r {
+			return errors.NotValidf("recipient %q", r)
+		}
+		recipients = append(recipients, r)
+	}
+	d.Recipients = recipients
+
+	return nil
+}
+
+func ordinal(n int) string {
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+	return fmt.Sprintf("%d%s", n, suffix)
+}
@@ -0,0 +1,75 @@
+package db_test
+
+import (
+	"time"
+
+	"github.com/wham-invoice/wham-platform/db"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type billingSuite struct{}
+
+var _ = gc.Suite(&billingSuite{})
+
+func (s *billingSuite) TestDueDate(c *gc.C) {
+	issued := time.Date(2022, 1, 31, 15, 4, 0, 0, time.UTC)
+	for _, t := range []struct {
+		terms db.PaymentTerms
+		due   string
+		text  string
+	}{
+		{"net_0", "2022-01-31", "Net 0 days"},
+		{"net_14", "2022-02-14", "Net 14 days"},
+		{"net_30", "2022-03-02", "Net 30 days"},
+		{"eom", "2022-01-31", "End of month"},
+		{"eom_20", "2022-02-20", "20th of the following month"},
+		// February has no 31st.
+		{"eom_31", "2022-02-28", "31st of the following month"},
+	} {
+		due, err := t.terms.DueDate(issued)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(due.Format("2006-01-02"), gc.Equals, t.due, gc.Commentf("%s", t.terms))
+		c.Check(t.terms.String(), gc.Equals, t.text)
+	}
+}
+
+func (s *billingSuite) TestInvalidTerms(c *gc.C) {
+	for _, terms := range []db.PaymentTerms{"", "net", "net_400", "eom_0", "eom_32", "Net 14"} {
+		c.Check(errors.IsNotValid(terms.Validate()), jc.IsTrue, gc.Commentf("%q", terms))
+	}
+}
+
+func (s *billingSuite) TestGST(c *gc.C) {
+	invoice := db.Invoice{Hours: 10, Rate: 100}
+	c.Check(invoice.GetGST(), gc.Equals, float32(150))
+
+	invoice.TaxTreatment = db.TaxZeroRated
+	c.Check(invoice.GetGST(), gc.Equals, float32(0))
+	c.Check(invoice.GetTotal(), gc.Equals, float32(1000))
+}
+
+func (s *billingSuite) TestNormalise(c *gc.C) {
+	defaults := db.BillingDefaults{
+		PaymentTerms: "eom_20",
+		Rate:         120,
+		Currency:     " aud",
+		TaxTreatment: db.TaxExempt,
+		Recipients:   []string{"accounts@acme.example", " "},
+	}
+	c.Assert(defaults.Normalise(), jc.ErrorIsNil)
+	c.Check(defaults.Currency, gc.Equals, "AUD")
+	c.Check(defaults.Recipients, jc.DeepEquals, []string{"accounts@acme.example"})
+
+	for _, bad := range []db.BillingDefaults{
+		{PaymentTerms: "net"},
+		{Rate: -1},
+		{Currency: "dollars"},
+		{TaxTreatment: "reverse_charge"},
+		{Recipients: []string{"Accounts <accounts@acme.example>"}},
+	} {
+		c.Check(errors.IsNotValid(bad.Normalise()), jc.IsTrue, gc.Commentf("%+v", bad))
+	}
+}
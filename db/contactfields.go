@@ -0,0 +1,225 @@
+package db
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/juju/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ContactFieldType says what a custom contact field holds.
+type ContactFieldType string
+
+const (
+	ContactFieldText   ContactFieldType = "text"
+	ContactFieldNumber ContactFieldType = "number"
+	// ContactFieldDate values are stored as YYYY-MM-DD.
+	ContactFieldDate ContactFieldType = "date"
+	// ContactFieldSelect values must be one of the field's options.
+	ContactFieldSelect ContactFieldType = "select"
+)
+
+const (
+	// MaxContactFields is the most custom fields an owner can define.
+	MaxContactFields = 50
+	// MaxContactTags is the most tags a contact can have.
+	MaxContactTags = 20
+
+	maxTagLength        = 40
+	maxFieldValueLength = 500
+)
+
+// contactFieldKey is what custom field keys look like, so they can be used
+// as {field.key} placeholders.
+var contactFieldKey = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+// ContactField defines a custom field that contacts can fill in.
+type ContactField struct {
+	Key      string           `firestore:"key" json:"key"`
+	Label    string           `firestore:"label" json:"label"`
+	Type     ContactFieldType `firestore:"type" json:"type"`
+	Options  []string         `firestore:"options" json:"options,omitempty"`
+	Required bool             `firestore:"required" json:"required,omitempty"`
+}
+
+// ContactFieldSet is the custom fields defined by a user, or by an
+// organisation, for its contacts.
+type ContactFieldSet struct {
+	// OwnerID is the ID of the user or organisation the fields belong to.
+	OwnerID string         `firestore:"owner_id" json:"owner_id"`
+	Fields  []ContactField `firestore:"fields" json:"fields"`
+}
+
+const contactFieldsCollection = "contact_fields"
+
+// ContactFields returns the custom fields defined by the user or
+// organisation ownerID. An owner that hasn't defined any has an empty set.
+func (app *App) ContactFields(ctx context.Context, ownerID string) (*ContactFieldSet, error) {
+	set := &ContactFieldSet{OwnerID: ownerID, Fields: []ContactField{}}
+
+	doc, err := app.firestoreClient.Collection(contactFieldsCollection).Doc(ownerID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return set, nil
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := doc.DataTo(set); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return set, nil
+}
+
+// SetContactFields checks and replaces the custom fields defined by the set's
+// owner. Values already stored on contacts are left alone, even for fields
+// that are removed.
+func (app *App) SetContactFields(ctx context.Context, set *ContactFieldSet) error {
+	if err := set.Validate(); err != nil {
+		return errors.Trace(err)
+	}
+
+	_, err := app.firestoreClient.Collection(contactFieldsCollection).Doc(set.OwnerID).Set(ctx, set)
+	return errors.Trace(err)
+}
+
+// Validate returns a NotValid error if the field definitions can't be used.
+func (s *ContactFieldSet) Validate() error {
+	if len(s.Fields) > MaxContactFields {
+		return errors.NotValidf("more than %d custom fields", MaxContactFields)
+	}
+
+	seen := map[string]bool{}
+	for _, f := range s.Fields {
+		if !contactFieldKey.MatchString(f.Key) {
+			return errors.NotValidf("custom field key %q", f.Key)
+		}
+		if seen[f.Key] {
+			return errors.NotValidf("custom field %q defined twice", f.Key)
+		}
+		seen[f.Key] = true
+		if strings.TrimSpace(f.Label) == "" {
+			return errors.NotValidf("custom field %q without a label", f.Key)
+		}
+
+		switch f.Type {
+		case ContactFieldText, ContactFieldNumber, ContactFieldDate:
+			if len(f.Options) > 0 {
+				return errors.NotValidf("options for %s field %q", f.Type, f.Key)
+			}
+		case ContactFieldSelect:
+			if len(f.Options) == 0 {
+				return errors.NotValidf("select field %q without options", f.Key)
+			}
+		default:
+			return errors.NotValidf("custom field type %q", f.Type)
+		}
+	}
+
+	return nil
+}
+
+// Normalise checks values, keyed by custom field key, against the field
+// definitions and returns them in a canonical form: numbers without
+// redundant digits and dates as YYYY-MM-DD. Blank values are dropped.
+func (s *ContactFieldSet) Normalise(values map[string]string) (map[string]string, error) {
+	fields := map[string]ContactField{}
+	for _, f := range s.Fields {
+		fields[f.Key] = f
+	}
+
+	normalised := map[string]string{}
+	for key, value := range values {
+		f, ok := fields[key]
+		if !ok {
+			return nil, errors.NotValidf("unknown custom field %q", key)
+		}
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		switch f.Type {
+		case ContactFieldText:
+			if utf8.RuneCountInString(value) > maxFieldValueLength {
+				return nil, errors.NotValidf("%s longer than %d characters", f.Label, maxFieldValueLength)
+			}
+		case ContactFieldNumber:
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, errors.NotValidf("%s %q, not a number,", f.Label, value)
+			}
+			value = strconv.FormatFloat(n, 'f', -1, 64)
+		case ContactFieldDate:
+			d, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				return nil, errors.NotValidf("%s %q, not a YYYY-MM-DD date,", f.Label, value)
+			}
+			value = d.Format("2006-01-02")
+		case ContactFieldSelect:
+			if !contains(f.Options, value) {
+				return nil, errors.NotValidf("%s %q", f.Label, value)
+			}
+		}
+		normalised[key] = value
+	}
+
+	for _, f := range s.Fields {
+		if f.Required && normalised[f.Key] == "" {
+			return nil, errors.NotValidf("missing %s", f.Label)
+		}
+	}
+
+	return normalised, nil
+}
+
+// NormaliseTags lower-cases and trims tags, collapsing inner whitespace, and
+// returns them sorted without blanks or repeats.
+func NormaliseTags(tags []string) ([]string, error) {
+	seen := map[string]bool{}
+	normalised := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.Join(strings.Fields(tag), " "))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, errors.NotValidf("tag %q longer than %d characters", tag, maxTagLength)
+		}
+		seen[tag] = true
+		normalised = append(normalised, tag)
+	}
+	if len(normalised) > MaxContactTags {
+		return nil, errors.NotValidf("more than %d tags", MaxContactTags)
+	}
+	sort.Strings(normalised)
+
+	return normalised, nil
+}
+
+// HasTags reports whether the contact has every one of tags, which must be
+// normalised.
+func (c Contact) HasTags(tags ...string) bool {
+	for _, tag := range tags {
+		if !contains(c.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
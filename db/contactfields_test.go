@@ -0,0 +1,116 @@
+package db_test
+
+import (
+	"context"
+
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/tests/setup"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type ContactFieldsSuite struct {
+	setup.ApplicationSuiteCore
+}
+
+var _ = gc.Suite(&ContactFieldsSuite{})
+
+func (s *ContactFieldsSuite) TestSetAndGet(c *gc.C) {
+	ctx := context.Background()
+	user := s.AddUser(ctx, c)
+
+	empty, err := s.App.ContactFields(ctx, user.ID)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(empty.Fields, gc.HasLen, 0)
+
+	set := &db.ContactFieldSet{OwnerID: user.ID, Fields: fixtureFields()}
+	c.Assert(s.App.SetContactFields(ctx, set), jc.ErrorIsNil)
+
+	got, err := s.App.ContactFields(ctx, user.ID)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(got, jc.DeepEquals, set)
+}
+
+func (s *ContactFieldsSuite) TestSetInvalid(c *gc.C) {
+	set := &db.ContactFieldSet{OwnerID: "u1", Fields: []db.ContactField{
+		{Key: "Bad Key", Label: "Bad", Type: db.ContactFieldText},
+	}}
+	err := s.App.SetContactFields(context.Background(), set)
+	c.Check(errors.IsNotValid(err), jc.IsTrue)
+}
+
+type contactFieldSetSuite struct{}
+
+var _ = gc.Suite(&contactFieldSetSuite{})
+
+func fixtureFields() []db.ContactField {
+	return []db.ContactField{
+		{Key: "po_number", Label: "PO number", Type: db.ContactFieldText, Required: true},
+		{Key: "hours", Label: "Retainer hours", Type: db.ContactFieldNumber},
+		{Key: "renewal", Label: "Renewal", Type: db.ContactFieldDate},
+		{Key: "sector", Label: "Sector", Type: db.ContactFieldSelect, Options: []string{"public", "private"}},
+	}
+}
+
+func (s *contactFieldSetSuite) TestValidate(c *gc.C) {
+	set := db.ContactFieldSet{Fields: fixtureFields()}
+	c.Check(set.Validate(), jc.ErrorIsNil)
+
+	for _, f := range []db.ContactField{
+		{Key: "1st", Label: "First", Type: db.ContactFieldText},
+		{Key: "po_number", Label: "Again", Type: db.ContactFieldText},
+		{Key: "blank", Type: db.ContactFieldText},
+		{Key: "colour", Label: "Colour", Type: db.ContactFieldSelect},
+		{Key: "size", Label: "Size", Type: db.ContactFieldNumber, Options: []string{"1"}},
+		{Key: "flag", Label: "Flag", Type: "boolean"},
+	} {
+		bad := db.ContactFieldSet{Fields: append(fixtureFields(), f)}
+		c.Check(errors.IsNotValid(bad.Validate()), jc.IsTrue, gc.Commentf("%+v", f))
+	}
+}
+
+func (s *contactFieldSetSuite) TestNormalise(c *gc.C) {
+	set := db.ContactFieldSet{Fields: fixtureFields()}
+
+	values, err := set.Normalise(map[string]string{
+		"po_number": " PO-7 ",
+		"hours":     "10.50",
+		"renewal":   "2022-03-01",
+		"sector":    "",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(values, jc.DeepEquals, map[string]string{
+		"po_number": "PO-7",
+		"hours":     "10.5",
+		"renewal":   "2022-03-01",
+	})
+
+	for _, bad := range []map[string]string{
+		{},
+		{"po_number": "PO-7", "unknown": "x"},
+		{"po_number": "PO-7", "hours": "ten"},
+		{"po_number": "PO-7", "renewal": "1/3/2022"},
+		{"po_number": "PO-7", "sector": "charity"},
+	} {
+		_, err := set.Normalise(bad)
+		c.Check(errors.IsNotValid(err), jc.IsTrue, gc.Commentf("%v", bad))
+	}
+}
+
+func (s *contactFieldSetSuite) TestNormaliseTags(c *gc.C) {
+	tags, err := db.NormaliseTags([]string{" Retainer", "one-off", "", "retainer", "Local  Government"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(tags, jc.DeepEquals, []string{"local government", "one-off", "retainer"})
+
+	_, err = db.NormaliseTags([]string{"a tag far too long to be any use when filtering"})
+	c.Check(errors.IsNotValid(err), jc.IsTrue)
+}
+
+func (s *contactFieldSetSuite) TestHasTags(c *gc.C) {
+	contact := db.Contact{Tags: []string{"government", "retainer"}}
+	c.Check(contact.HasTags(), jc.IsTrue)
+	c.Check(contact.HasTags("retainer"), jc.IsTrue)
+	c.Check(contact.HasTags("retainer", "one-off"), jc.IsFalse)
+}
@@ -3,9 +3,12 @@ package db
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 
 	"cloud.google.com/go/firestore"
 	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/search"
 	"google.golang.org/api/iterator"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -13,15 +16,37 @@ import (
 
 var ContactNotFound = errors.New("contact not found")
 
+// ContactHasInvoices is returned when deleting a contact that invoices are
+// addressed to. Archive it instead.
+var ContactHasInvoices = errors.New("contact has invoices")
+
 type Contact struct {
-	ID        string   `firestore:"id" json:"id"`
-	UserID    string   `firestore:"user_id" json:"user_id"`
-	FirstName string   `firestore:"first_name" json:"first_name"`
-	LastName  string   `firestore:"last_name" json:"last_name"`
-	Phone     string   `firestore:"phone" json:"phone"`
-	Email     string   `firestore:"email" json:"email"`
-	Company   string   `firestore:"company" json:"company"`
-	Address   *Address `firestore:"address" json:"address"`
+	ID             string   `firestore:"id" json:"id"`
+	UserID         string   `firestore:"user_id" json:"user_id"`
+	OrganisationID string   `firestore:"organisation_id" json:"organisation_id,omitempty"`
+	FirstName      string   `firestore:"first_name" json:"first_name"`
+	LastName       string   `firestore:"last_name" json:"last_name"`
+	Phone          string   `firestore:"phone" json:"phone"`
+	Email          string   `firestore:"email" json:"email"`
+	Company        string   `firestore:"company" json:"company"`
+	Address        *Address `firestore:"address" json:"address"`
+	// PeppolID is the contact's PEPPOL participant ID as "scheme:id", e.g.
+	// "0088:9429041234567", for sending them e-invoices.
+	PeppolID string `firestore:"peppol_id" json:"peppol_id,omitempty"`
+	// BuyerReference is a reference the contact wants quoted on invoices,
+	// such as a purchase order number.
+	BuyerReference string `firestore:"buyer_reference" json:"buyer_reference,omitempty"`
+	// Archived contacts are kept for the invoices addressed to them but
+	// hidden from contact lists.
+	Archived bool `firestore:"archived" json:"archived,omitempty"`
+	// Tags group contacts, e.g. "retainer" or "government". They are kept
+	// normalised by NormaliseTags.
+	Tags []string `firestore:"tags" json:"tags,omitempty"`
+	// CustomFields holds values for the owner's ContactFields, by key.
+	CustomFields map[string]string `firestore:"custom_fields" json:"custom_fields,omitempty"`
+	// Billing is how the contact is usually invoiced, if they have
+	// defaults.
+	Billing *BillingDefaults `firestore:"billing" json:"billing,omitempty"`
 }
 
 type Address struct {
@@ -41,6 +66,9 @@ func (app *App) AddContact(ctx context.Context, contact *Contact) (string, error
 	}
 
 	id := ref.ID
+	indexed := *contact
+	indexed.ID = id
+	app.search.put(ctx, contactDocument(&indexed))
 
 	return id, nil
 }
@@ -49,14 +77,13 @@ func (app *App) Contact(ctx context.Context, id string) (*Contact, error) {
 	var contact = new(Contact)
 
 	result, err := app.firestoreClient.Collection(contactsCollection).Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return contact, ContactNotFound
+	}
 	if err != nil {
 		return contact, errors.Trace(err)
 	}
 
-	if !result.Exists() {
-		return contact, errors.Errorf("contact with ID does not exist: %s" + id)
-	}
-
 	if err := result.DataTo(&contact); err != nil {
 		return contact, errors.Trace(err)
 	}
@@ -66,20 +93,162 @@ func (app *App) Contact(ctx context.Context, id string) (*Contact, error) {
 	return contact, nil
 }
 
-// TODO: test
+// Contacts returns the contacts with the given IDs, by ID. Those that don't
+// exist are left out.
+func (app *App) Contacts(ctx context.Context, ids []string) (map[string]*Contact, error) {
+	contacts := map[string]*Contact{}
+	if len(ids) == 0 {
+		return contacts, nil
+	}
+	refs := make([]*firestore.DocumentRef, len(ids))
+	for i, id := range ids {
+		refs[i] = app.firestoreClient.Collection(contactsCollection).Doc(id)
+	}
+	docs, err := app.firestoreClient.GetAll(ctx, refs)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	for _, doc := range docs {
+		if !doc.Exists() {
+			continue
+		}
+		contact := new(Contact)
+		if err := doc.DataTo(contact); err != nil {
+			return nil, errors.Trace(err)
+		}
+		contact.ID = doc.Ref.ID
+		contacts[contact.ID] = contact
+	}
+
+	return contacts, nil
+}
+
+// Delete deletes the contact, unless any invoice is addressed to it, when it
+// returns ContactHasInvoices.
 func (c *Contact) Delete(ctx context.Context, app *App) error {
-	_, err := app.firestoreClient.Collection(contactsCollection).Doc(c.ID).Delete(ctx)
+	ref := app.firestoreClient.Collection(contactsCollection).Doc(c.ID)
+	invoices := app.firestoreClient.Collection(invoicesCollection).
+		Where("contact_id", "==", c.ID).Limit(1)
+
+	err := app.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if _, err := tx.Get(ref); status.Code(err) == codes.NotFound {
+			return ContactNotFound
+		} else if err != nil {
+			return errors.Trace(err)
+		}
+		docs, err := tx.Documents(invoices).GetAll()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if len(docs) > 0 {
+			return ContactHasInvoices
+		}
+		return tx.Delete(ref)
+	})
+	if err == ContactNotFound || err == ContactHasInvoices {
+		return err
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	app.search.delete(ctx, c.OwnerID(), search.KindContact, c.ID)
+
+	return nil
+}
+
+// SetArchived archives or restores the contact.
+func (c *Contact) SetArchived(ctx context.Context, app *App, archived bool) error {
+	_, err := app.firestoreClient.Collection(contactsCollection).Doc(c.ID).Update(ctx, []firestore.Update{
+		{Path: "archived", Value: archived},
+	})
 	if status.Code(err) == codes.NotFound {
 		return ContactNotFound
 	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	c.Archived = archived
 
-	return errors.Trace(err)
+	return nil
+}
+
+// Snapshot returns a copy of the contact to keep with an invoice, so the
+// invoice shows who it was billed to even after the contact changes.
+func (c Contact) Snapshot() *Contact {
+	if c.Address != nil {
+		address := *c.Address
+		c.Address = &address
+	}
+	c.Tags = append([]string(nil), c.Tags...)
+	if c.CustomFields != nil {
+		fields := make(map[string]string, len(c.CustomFields))
+		for k, v := range c.CustomFields {
+			fields[k] = v
+		}
+		c.CustomFields = fields
+	}
+	if c.Billing != nil {
+		billing := *c.Billing
+		billing.Recipients = append([]string(nil), billing.Recipients...)
+		c.Billing = &billing
+	}
+	return &c
+}
+
+// listName is what lists sort the contact's invoices by: the last name then
+// the first, as contacts are sorted.
+func (c Contact) listName() string {
+	return strings.TrimSpace(c.LastName + " " + c.FirstName)
+}
+
+// OwnerID returns the ID of the organisation the contact belongs to or, for
+// a personal contact, of its user.
+func (c Contact) OwnerID() string {
+	if c.OrganisationID != "" {
+		return c.OrganisationID
+	}
+	return c.UserID
+}
+
+// Save replaces the stored contact with c, and updates the name its
+// invoices are sorted by.
+func (c *Contact) Save(ctx context.Context, app *App) error {
+	ref := app.firestoreClient.Collection(contactsCollection).Doc(c.ID)
+	err := app.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if _, err := tx.Get(ref); status.Code(err) == codes.NotFound {
+			return ContactNotFound
+		} else if err != nil {
+			return errors.Trace(err)
+		}
+		return tx.Set(ref, c)
+	})
+	if err == ContactNotFound {
+		return err
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	app.search.put(ctx, contactDocument(c))
+	if err := app.updateContactName(ctx, c); err != nil {
+		return errors.Annotate(err, "cannot update invoices' contact name")
+	}
+
+	return nil
 }
 
 func (app *App) contactsForUser(ctx context.Context, userID string) ([]Contact, error) {
+	return app.contactsWhere(ctx, "user_id", userID)
+}
+
+func (app *App) contactsForOrganisation(ctx context.Context, orgID string) ([]Contact, error) {
+	return app.contactsWhere(ctx, "organisation_id", orgID)
+}
+
+func (app *App) contactsWhere(ctx context.Context, field, value string) ([]Contact, error) {
 	contacts := []Contact{}
 
-	iter := app.firestoreClient.Collection(contactsCollection).Where("user_id", "==", userID).Documents(ctx)
+	iter := app.firestoreClient.Collection(contactsCollection).Where(field, "==", value).Documents(ctx)
 	for {
 		var contact = new(Contact)
 		doc, err := iter.Next()
@@ -103,6 +272,204 @@ func (app *App) contactsForUser(ctx context.Context, userID string) ([]Contact,
 	return contacts, nil
 }
 
+// ContactFilter chooses the contacts ForEachContact visits. Exactly one of
+// UserID and OrganisationID must be set.
+type ContactFilter struct {
+	UserID         string
+	OrganisationID string
+	// IncludeArchived visits archived contacts too.
+	IncludeArchived bool
+}
+
+// query returns a query for the filter's owner, leaving out archived
+// contacts unless it includes them. Contacts from before archiving need
+// BackfillContacts to be found by it.
+func (f ContactFilter) query(app *App) (firestore.Query, error) {
+	q := app.firestoreClient.Collection(contactsCollection).Query
+	switch {
+	case f.UserID != "" && f.OrganisationID == "":
+		q = q.Where("user_id", "==", f.UserID)
+	case f.OrganisationID != "" && f.UserID == "":
+		q = q.Where("organisation_id", "==", f.OrganisationID)
+	default:
+		return q, errors.NotValidf("contact filter without exactly one owner")
+	}
+	if !f.IncludeArchived {
+		q = q.Where("archived", "==", false)
+	}
+	return q, nil
+}
+
+// ForEachContact calls fn with each contact matching filter, reading them as
+// it goes rather than loading them all. It stops at the first error fn
+// returns, and returns it.
+func (app *App) ForEachContact(ctx context.Context, filter ContactFilter, fn func(*Contact) error) error {
+	q, err := filter.query(app)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	iter := q.Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		var contact = new(Contact)
+		if err := doc.DataTo(&contact); err != nil {
+			return errors.Trace(err)
+		}
+		contact.ID = doc.Ref.ID
+
+		if err := fn(contact); err != nil {
+			return errors.Trace(err)
+		}
+	}
+}
+
+// ContactSort is what a list of contacts is ordered by.
+type ContactSort string
+
+const (
+	// ContactSortName orders by last name, then first name.
+	ContactSortName    ContactSort = "name"
+	ContactSortCompany ContactSort = "company"
+	ContactSortEmail   ContactSort = "email"
+)
+
+func (s ContactSort) fields() []string {
+	switch s {
+	case ContactSortName:
+		return []string{"last_name", "first_name"}
+	case ContactSortCompany:
+		return []string{"company"}
+	case ContactSortEmail:
+		return []string{"email"}
+	}
+	return nil
+}
+
+// ContactList is a page of contacts to read.
+type ContactList struct {
+	ContactFilter
+	// Tags, if set, keeps only contacts with every one of them. They must
+	// be normalised.
+	Tags []string
+	// Sort defaults to ContactSortName.
+	Sort       ContactSort
+	Descending bool
+	// Cursor is the NextCursor of the previous page, if this isn't the
+	// first.
+	Cursor string
+	// Limit defaults to DefaultPageSize and is capped at MaxPageSize.
+	Limit int
+}
+
+// ContactPage is a page of a list of contacts. NextCursor is empty on the
+// last page.
+type ContactPage struct {
+	Items      []Contact `json:"items"`
+	NextCursor string    `json:"next_cursor"`
+}
+
+// ListContacts returns a page of the contacts matching l, in its order.
+func (app *App) ListContacts(ctx context.Context, l ContactList) (*ContactPage, error) {
+	if l.Sort == "" {
+		l.Sort = ContactSortName
+	}
+	fields := l.Sort.fields()
+	if fields == nil {
+		return nil, errors.NotValidf("contact sort %q", string(l.Sort))
+	}
+	q, err := l.query(app)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(l.Tags) > 0 {
+		// Firestore matches one tag; the rest are checked as contacts are
+		// read.
+		q = q.Where("tags", "array-contains", l.Tags[0])
+	}
+
+	read := listing{
+		query:      q,
+		sort:       listSort(string(l.Sort), l.Descending),
+		fields:     fields,
+		descending: l.Descending,
+		cursor:     l.Cursor,
+		limit:      l.Limit,
+	}
+	if len(l.Tags) > 1 {
+		read.keep = func(doc *firestore.DocumentSnapshot) (bool, error) {
+			var contact Contact
+			if err := doc.DataTo(&contact); err != nil {
+				return false, errors.Trace(err)
+			}
+			return contact.HasTags(l.Tags...), nil
+		}
+	}
+	docs, next, err := read.page(ctx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	page := &ContactPage{Items: []Contact{}, NextCursor: next}
+	for _, doc := range docs {
+		var contact Contact
+		if err := doc.DataTo(&contact); err != nil {
+			return nil, errors.Trace(err)
+		}
+		contact.ID = doc.Ref.ID
+		page.Items = append(page.Items, contact)
+	}
+
+	return page, nil
+}
+
+// BackfillContacts stores archived as false on contacts from before they
+// could be archived, so queries for unarchived contacts find them. It
+// leaves contacts that have it alone, so it is safe to run more than once.
+func (app *App) BackfillContacts(ctx context.Context) error {
+	batch := app.firestoreClient.Batch()
+	writes := 0
+
+	iter := app.firestoreClient.Collection(contactsCollection).Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if _, ok := doc.Data()["archived"]; ok {
+			continue
+		}
+
+		batch.Update(doc.Ref, []firestore.Update{{Path: "archived", Value: false}})
+		// Firestore allows 500 writes in a batch.
+		if writes++; writes == 500 {
+			if _, err := batch.Commit(ctx); err != nil {
+				return errors.Trace(err)
+			}
+			batch, writes = app.firestoreClient.Batch(), 0
+		}
+	}
+	if writes > 0 {
+		if _, err := batch.Commit(ctx); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return nil
+}
+
 func addressfromUserDoc(doc *firestore.DocumentSnapshot) (*Address, error) {
 	var address = new(Address)
 	if err := doc.DataTo(&address); err != nil {
@@ -136,6 +503,7 @@ func (app *App) ContactsDeleteAll(ctx context.Context, batchSize int) error {
 		}
 
 		if numDeleted == 0 {
+			app.search.reset()
 			return nil
 		}
 
@@ -145,3 +513,213 @@ func (app *App) ContactsDeleteAll(ctx context.Context, batchSize int) error {
 		}
 	}
 }
+
+// MaxContactBatch is the most contacts AddContacts can create at once.
+const MaxContactBatch = 500
+
+// AddContacts creates all the contacts or, if any fails, none of them, and
+// returns their IDs in order.
+func (app *App) AddContacts(ctx context.Context, contacts []*Contact) ([]string, error) {
+	if len(contacts) > MaxContactBatch {
+		return nil, errors.NotValidf("more than %d contacts", MaxContactBatch)
+	}
+	if len(contacts) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(contacts))
+	batch := app.firestoreClient.Batch()
+	for i, contact := range contacts {
+		ref := app.firestoreClient.Collection(contactsCollection).NewDoc()
+		batch.Create(ref, contact)
+		ids[i] = ref.ID
+	}
+	if _, err := batch.Commit(ctx); err != nil {
+		return nil, errors.Trace(err)
+	}
+	docs := make([]search.Document, len(contacts))
+	for i, contact := range contacts {
+		indexed := *contact
+		indexed.ID = ids[i]
+		docs[i] = contactDocument(&indexed)
+	}
+	app.search.put(ctx, docs...)
+
+	return ids, nil
+}
+
+// MaxMergeContacts is the most duplicates MergeContacts takes at once,
+// Firestore's limit on values in an "in" query.
+const MaxMergeContacts = 10
+
+// MergeContacts folds the duplicates into the survivor: every invoice and
+// credit note addressed to a duplicate is moved to the survivor, blank
+// survivor fields
+// are filled from the duplicates in order, and the duplicates are deleted.
+// It all happens in one transaction. Invoice PDFs already rendered keep the
+// duplicate's details.
+func (app *App) MergeContacts(ctx context.Context, survivorID string, duplicateIDs []string) (*Contact, error) {
+	if len(duplicateIDs) == 0 || len(duplicateIDs) > MaxMergeContacts {
+		return nil, errors.NotValidf("merging %d contacts", len(duplicateIDs))
+	}
+	contacts := app.firestoreClient.Collection(contactsCollection)
+	refs := []*firestore.DocumentRef{contacts.Doc(survivorID)}
+	seen := map[string]bool{survivorID: true}
+	for _, id := range duplicateIDs {
+		if seen[id] {
+			return nil, errors.NotValidf("merging contact %s into itself", id)
+		}
+		seen[id] = true
+		refs = append(refs, contacts.Doc(id))
+	}
+
+	var survivor *Contact
+	var moved []*firestore.DocumentSnapshot
+	err := app.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docs, err := tx.GetAll(refs)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		merged := make([]*Contact, len(docs))
+		for i, doc := range docs {
+			if !doc.Exists() {
+				return ContactNotFound
+			}
+			merged[i] = new(Contact)
+			if err := doc.DataTo(merged[i]); err != nil {
+				return errors.Trace(err)
+			}
+			merged[i].ID = doc.Ref.ID
+		}
+		survivor = merged[0]
+		for _, dup := range merged[1:] {
+			if dup.UserID != survivor.UserID || dup.OrganisationID != survivor.OrganisationID {
+				return errors.NotValidf("merging contacts with different owners")
+			}
+			survivor.fillFrom(dup)
+		}
+
+		invoices, err := tx.Documents(app.firestoreClient.Collection(invoicesCollection).
+			Where("contact_id", "in", duplicateIDs)).GetAll()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		moved = invoices
+		notes, err := tx.Documents(app.firestoreClient.Collection(creditNotesCollection).
+			Where("contact_id", "in", duplicateIDs)).GetAll()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		// Firestore allows 500 writes in a transaction. Besides the invoices,
+		// credit notes and contacts, each contact's analytics may change.
+		if writes := len(invoices) + len(notes) + 2*len(refs); writes > 500 {
+			return errors.NotValidf("merging contacts with %d invoices and %d credit notes", len(invoices), len(notes))
+		}
+
+		analytics := analyticsWrite{owner: survivor.OwnerID(), delta: NewAnalytics()}
+		for _, doc := range invoices {
+			var invoice Invoice
+			if err := doc.DataTo(&invoice); err != nil {
+				return errors.Trace(err)
+			}
+			invoice.ID = doc.Ref.ID
+			// Only invoices the contacts' owner made are in their analytics.
+			if invoice.OwnerID() == analytics.owner {
+				analytics.delta.AddInvoice(&invoice, -1)
+				invoice.ContactID = survivorID
+				analytics.delta.AddInvoice(&invoice, 1)
+			}
+			updates := []firestore.Update{{Path: "contact_id", Value: survivorID}}
+			if invoice.BillTo == nil {
+				updates = append(updates, firestore.Update{Path: "contact_name", Value: survivor.listName()})
+			}
+			if err := tx.Update(doc.Ref, updates); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		// Credit notes are counted in the month they're issued, whoever
+		// they're to, so moving them doesn't change the analytics.
+		for _, doc := range notes {
+			if err := tx.Update(doc.Ref, []firestore.Update{{Path: "contact_id", Value: survivorID}}); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		if err := analytics.inTransaction(app, tx); err != nil {
+			return errors.Trace(err)
+		}
+		if err := tx.Set(refs[0], survivor); err != nil {
+			return errors.Trace(err)
+		}
+		for _, ref := range refs[1:] {
+			if err := tx.Delete(ref); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	app.search.delete(ctx, survivor.OwnerID(), search.KindContact, duplicateIDs...)
+	docs := []search.Document{contactDocument(survivor)}
+	// Invoices without a BillTo are found by the contact they're addressed
+	// to, which is now the survivor.
+	for _, doc := range moved {
+		invoice := new(Invoice)
+		if err := doc.DataTo(invoice); err != nil {
+			// The merge is done; the owner is indexed afresh instead.
+			app.search.forget(survivor.OwnerID())
+			continue
+		}
+		invoice.ID = doc.Ref.ID
+		invoice.ContactID = survivorID
+		docs = append(docs, invoiceDocument(invoice, survivor))
+	}
+	app.search.put(ctx, docs...)
+	// Filling in the survivor's name changes it for its own invoices too.
+	if err := app.updateContactName(ctx, survivor); err != nil {
+		return nil, errors.Annotate(err, "cannot update invoices' contact name")
+	}
+
+	return survivor, nil
+}
+
+// fillFrom copies other's details into c where c has none.
+func (c *Contact) fillFrom(other *Contact) {
+	for _, f := range []struct{ to, from *string }{
+		{&c.FirstName, &other.FirstName},
+		{&c.LastName, &other.LastName},
+		{&c.Phone, &other.Phone},
+		{&c.Email, &other.Email},
+		{&c.Company, &other.Company},
+		{&c.PeppolID, &other.PeppolID},
+		{&c.BuyerReference, &other.BuyerReference},
+	} {
+		if *f.to == "" {
+			*f.to = *f.from
+		}
+	}
+	if (c.Address == nil || *c.Address == Address{}) && other.Address != nil {
+		address := *other.Address
+		c.Address = &address
+	}
+	for _, tag := range other.Tags {
+		if !contains(c.Tags, tag) {
+			c.Tags = append(c.Tags, tag)
+		}
+	}
+	sort.Strings(c.Tags)
+	for key, value := range other.CustomFields {
+		if c.CustomFields[key] != "" {
+			continue
+		}
+		if c.CustomFields == nil {
+			c.CustomFields = map[string]string{}
+		}
+		c.CustomFields[key] = value
+	}
+	if c.Billing == nil && other.Billing != nil {
+		c.Billing = other.Snapshot().Billing
+	}
+}
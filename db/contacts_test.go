@@ -6,6 +6,7 @@ import (
 	"github.com/wham-invoice/wham-platform/db"
 	"github.com/wham-invoice/wham-platform/tests/setup"
 
+	"github.com/juju/errors"
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
 )
@@ -31,3 +32,179 @@ func (s *ContactsSuite) TestContactInsertAndGet(c *gc.C) {
 	c.Assert(err, jc.ErrorIsNil)
 	c.Check(getContact, jc.DeepEquals, contact)
 }
+
+func (s *ContactsSuite) TestAddContacts(c *gc.C) {
+	ctx := context.Background()
+	first := setup.CreateContact(s.user.ID)
+	second := setup.CreateContact(s.user.ID)
+
+	ids, err := s.App.AddContacts(ctx, []*db.Contact{&first, &second})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(ids, gc.HasLen, 2)
+
+	for i, want := range []db.Contact{first, second} {
+		want.ID = ids[i]
+		got, err := s.App.Contact(ctx, ids[i])
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(*got, jc.DeepEquals, want)
+	}
+}
+
+func (s *ContactsSuite) TestAddTooManyContacts(c *gc.C) {
+	contacts := make([]*db.Contact, db.MaxContactBatch+1)
+	_, err := s.App.AddContacts(context.Background(), contacts)
+	c.Check(err, gc.ErrorMatches, "more than 500 contacts not valid")
+}
+
+func (s *ContactsSuite) TestMergeContacts(c *gc.C) {
+	ctx := context.Background()
+	survivor := setup.CreateContact(s.user.ID)
+	survivor.Phone = ""
+	survivor.Address = nil
+	survivor.Tags = []string{"retainer"}
+	survivor.CustomFields = map[string]string{"po_number": "PO-1"}
+	dup := setup.CreateContact(s.user.ID)
+	dup.Tags = []string{"government", "retainer"}
+	dup.CustomFields = map[string]string{"po_number": "PO-2", "region": "north"}
+	ids, err := s.App.AddContacts(ctx, []*db.Contact{&survivor, &dup})
+	c.Assert(err, jc.ErrorIsNil)
+
+	invoice := setup.CreateInvoice(s.user.ID)
+	invoice.ContactID = ids[1]
+	invoice.Hours, invoice.Rate = 1, 100
+	invoiceID, err := s.App.AddInvoice(ctx, invoice)
+	c.Assert(err, jc.ErrorIsNil)
+	noteID, err := s.App.AddCreditNote(ctx, &db.CreditNote{InvoiceID: invoiceID, Amount: 10})
+	c.Assert(err, jc.ErrorIsNil)
+
+	merged, err := s.App.MergeContacts(ctx, ids[0], ids[1:])
+	c.Assert(err, jc.ErrorIsNil)
+	// The survivor keeps its details and gains the ones it lacked.
+	c.Check(merged.Email, gc.Equals, survivor.Email)
+	c.Check(merged.Phone, gc.Equals, dup.Phone)
+	c.Check(merged.Address, jc.DeepEquals, dup.Address)
+	c.Check(merged.Tags, jc.DeepEquals, []string{"government", "retainer"})
+	c.Check(merged.CustomFields, jc.DeepEquals, map[string]string{"po_number": "PO-1", "region": "north"})
+
+	got, err := s.App.Contact(ctx, ids[0])
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(got, jc.DeepEquals, merged)
+
+	moved, err := s.App.Invoice(ctx, invoiceID)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(moved.ContactID, gc.Equals, ids[0])
+	note, err := s.App.CreditNote(ctx, noteID)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(note.ContactID, gc.Equals, ids[0])
+
+	_, err = s.App.Contact(ctx, ids[1])
+	c.Check(err, gc.Equals, db.ContactNotFound)
+}
+
+func (s *ContactsSuite) TestMergeContactsOtherOwner(c *gc.C) {
+	ctx := context.Background()
+	survivor := s.AddContact(ctx, c, s.user.ID)
+	other := s.AddUser(ctx, c)
+	dup := s.AddContact(ctx, c, other.ID)
+
+	_, err := s.App.MergeContacts(ctx, survivor.ID, []string{dup.ID})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+
+	_, err = s.App.MergeContacts(ctx, survivor.ID, []string{survivor.ID})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (s *ContactsSuite) TestContactNotFound(c *gc.C) {
+	_, err := s.App.Contact(context.Background(), "missing")
+	c.Check(err, gc.Equals, db.ContactNotFound)
+}
+
+func (s *ContactsSuite) TestDeleteContact(c *gc.C) {
+	ctx := context.Background()
+	contact := s.AddContact(ctx, c, s.user.ID)
+
+	c.Assert(contact.Delete(ctx, s.App), jc.ErrorIsNil)
+	_, err := s.App.Contact(ctx, contact.ID)
+	c.Check(err, gc.Equals, db.ContactNotFound)
+	c.Check(contact.Delete(ctx, s.App), gc.Equals, db.ContactNotFound)
+}
+
+func (s *ContactsSuite) TestDeleteContactWithInvoices(c *gc.C) {
+	ctx := context.Background()
+	contact := s.AddContact(ctx, c, s.user.ID)
+	invoice := setup.CreateInvoice(s.user.ID)
+	invoice.ContactID = contact.ID
+	_, err := s.App.AddInvoice(ctx, invoice)
+	c.Assert(err, jc.ErrorIsNil)
+
+	c.Check(contact.Delete(ctx, s.App), gc.Equals, db.ContactHasInvoices)
+	_, err = s.App.Contact(ctx, contact.ID)
+	c.Check(err, jc.ErrorIsNil)
+}
+
+func (s *ContactsSuite) TestArchivedContactsHidden(c *gc.C) {
+	ctx := context.Background()
+	archived := s.AddContact(ctx, c, s.user.ID)
+	active := s.AddContact(ctx, c, s.user.ID)
+	c.Assert(archived.SetArchived(ctx, s.App, true), jc.ErrorIsNil)
+	c.Check(archived.Archived, jc.IsTrue)
+
+	visit := func(filter db.ContactFilter) []string {
+		var ids []string
+		err := s.App.ForEachContact(ctx, filter, func(contact *db.Contact) error {
+			ids = append(ids, contact.ID)
+			return nil
+		})
+		c.Assert(err, jc.ErrorIsNil)
+		return ids
+	}
+	c.Check(visit(db.ContactFilter{UserID: s.user.ID}), jc.DeepEquals, []string{active.ID})
+	c.Check(visit(db.ContactFilter{UserID: s.user.ID, IncludeArchived: true}), jc.SameContents,
+		[]string{active.ID, archived.ID})
+
+	page, err := s.App.ListContacts(ctx, db.ContactList{ContactFilter: db.ContactFilter{UserID: s.user.ID}, Limit: 1})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(page.Items, gc.HasLen, 1)
+	c.Check(page.Items[0].ID, gc.Equals, active.ID)
+	c.Check(page.NextCursor, gc.Equals, "")
+
+	got, err := s.App.Contact(ctx, archived.ID)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(got.Archived, jc.IsTrue)
+}
+
+func (s *ContactsSuite) TestSnapshot(c *gc.C) {
+	contact := setup.CreateContact(s.user.ID)
+	contact.Tags = []string{"retainer"}
+	contact.CustomFields = map[string]string{"po_number": "PO-1"}
+	snapshot := contact.Snapshot()
+	c.Check(*snapshot, jc.DeepEquals, contact)
+
+	// Later changes to the contact don't reach the snapshot.
+	contact.Address.FirstLine = "moved"
+	contact.Tags[0] = "one-off"
+	contact.CustomFields["po_number"] = "PO-2"
+	c.Check(snapshot.Address.FirstLine, gc.Not(gc.Equals), "moved")
+	c.Check(snapshot.Tags, jc.DeepEquals, []string{"retainer"})
+	c.Check(snapshot.CustomFields["po_number"], gc.Equals, "PO-1")
+}
+
+func (s *ContactsSuite) TestSave(c *gc.C) {
+	ctx := context.Background()
+	contact := s.AddContact(ctx, c, s.user.ID)
+
+	contact.Company = "Renamed Ltd"
+	contact.Tags = []string{"retainer"}
+	contact.CustomFields = map[string]string{"po_number": "PO-1"}
+	c.Assert(contact.Save(ctx, s.App), jc.ErrorIsNil)
+
+	got, err := s.App.Contact(ctx, contact.ID)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(got, jc.DeepEquals, contact)
+}
+
+func (s *ContactsSuite) TestSaveMissing(c *gc.C) {
+	contact := setup.CreateContact(s.user.ID)
+	contact.ID = "missing"
+	c.Check(contact.Save(context.Background(), s.App), gc.Equals, db.ContactNotFound)
+}
@@ -0,0 +1,245 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/juju/errors"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var CreditNoteNotFound = errors.New("credit note not found")
+
+// CreditNote takes back some or all of what an invoice charged, e.g. for a
+// refund or a discount agreed after it was issued. It keeps its own copy of
+// the invoice's owner, contact, currency and tax treatment, so it still
+// counts in GST returns whatever later happens to the invoice.
+type CreditNote struct {
+	ID             string `json:"id"`
+	UserID         string `firestore:"user_id" json:"user_id"`
+	OrganisationID string `firestore:"organisation_id" json:"organisation_id,omitempty"`
+	InvoiceID      string `firestore:"invoice_id" json:"invoice_id"`
+	InvoiceNumber  int    `firestore:"invoice_number" json:"invoice_number"`
+	ContactID      string `firestore:"contact_id" json:"contact_id"`
+	// IssueDate is when the credit was given, which decides the GST period
+	// it is claimed in.
+	IssueDate time.Time `firestore:"issue_date" json:"issue_date"`
+	// Amount is credited excluding GST; GetGST is credited on top of it at
+	// the invoice's rate.
+	Amount       float32      `firestore:"amount" json:"amount"`
+	Reason       string       `firestore:"reason" json:"reason,omitempty"`
+	Currency     string       `firestore:"currency" json:"currency,omitempty"`
+	TaxTreatment TaxTreatment `firestore:"tax_treatment" json:"tax_treatment,omitempty"`
+	BillTo       *Contact     `firestore:"bill_to" json:"bill_to,omitempty"`
+}
+
+const creditNotesCollection = "credit_notes"
+
+// AddCreditNote credits note.Amount against note.InvoiceID, filling in the
+// rest of the note from the invoice. It returns InvoiceNotFound if there is
+// no such invoice, and an error satisfying errors.IsNotValid if the invoice
+// was never issued or the note would credit more than the invoice charged.
+func (app *App) AddCreditNote(ctx context.Context, note *CreditNote) (string, error) {
+	if note.Amount <= 0 {
+		return "", errors.NotValidf("credit of %v", note.Amount)
+	}
+	if note.IssueDate.IsZero() {
+		note.IssueDate = time.Now()
+	}
+
+	invoiceRef := app.firestoreClient.Collection(invoicesCollection).Doc(note.InvoiceID)
+	ref := app.firestoreClient.Collection(creditNotesCollection).NewDoc()
+	existing := app.firestoreClient.Collection(creditNotesCollection).Where("invoice_id", "==", note.InvoiceID)
+	err := app.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		invoice, err := getInvoice(tx, invoiceRef)
+		if err != nil {
+			return err
+		}
+		switch invoice.CurrentStatus() {
+		case InvoiceStatusDraft, InvoiceStatusVoid:
+			return errors.NotValidf("credit note for a %s invoice", invoice.CurrentStatus())
+		}
+
+		docs, err := tx.Documents(existing).GetAll()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		credited := Cents(note.Amount)
+		for _, doc := range docs {
+			var other CreditNote
+			if err := doc.DataTo(&other); err != nil {
+				return errors.Trace(err)
+			}
+			credited += Cents(other.Amount)
+		}
+		if credited > Cents(invoice.GetSubtotal()) {
+			return errors.NotValidf("crediting more than invoice %d charged", invoice.Number)
+		}
+
+		note.UserID = invoice.UserID
+		note.OrganisationID = invoice.OrganisationID
+		note.InvoiceNumber = invoice.Number
+		note.ContactID = invoice.ContactID
+		note.Currency = invoice.Currency
+		note.TaxTreatment = invoice.TaxTreatment
+		note.BillTo = invoice.BillTo
+		if err := tx.Create(ref, note); err != nil {
+			return errors.Trace(err)
+		}
+		credit := analyticsWrite{owner: invoice.OwnerID(), delta: NewAnalytics()}
+		credit.delta.AddCreditNote(note, 1)
+		return credit.inTransaction(app, tx)
+	})
+	if err == InvoiceNotFound {
+		return "", err
+	}
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	return ref.ID, nil
+}
+
+func (app *App) CreditNote(ctx context.Context, id string) (*CreditNote, error) {
+	var note = new(CreditNote)
+
+	doc, err := app.firestoreClient.Collection(creditNotesCollection).Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return note, CreditNoteNotFound
+	}
+	if err != nil {
+		return note, errors.Trace(err)
+	}
+
+	if err := doc.DataTo(note); err != nil {
+		return note, errors.Trace(err)
+	}
+	note.ID = doc.Ref.ID
+
+	return note, nil
+}
+
+// CreditNotes returns the notes crediting the invoice, oldest first.
+func (i *Invoice) CreditNotes(ctx context.Context, app *App) ([]CreditNote, error) {
+	notes := []CreditNote{}
+
+	iter := app.firestoreClient.Collection(creditNotesCollection).
+		Where("invoice_id", "==", i.ID).
+		OrderBy("issue_date", firestore.Asc).
+		Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return notes, nil
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		var note CreditNote
+		if err := doc.DataTo(&note); err != nil {
+			return nil, errors.Trace(err)
+		}
+		note.ID = doc.Ref.ID
+		notes = append(notes, note)
+	}
+}
+
+// MaxCreditNoteInvoices is the most invoices a CreditNoteFilter can keep
+// the credit notes of, Firestore's limit on values in an "in" query.
+const MaxCreditNoteInvoices = 10
+
+// CreditNoteFilter chooses the credit notes ForEachCreditNote visits.
+// Exactly one of UserID and OrganisationID must be set.
+type CreditNoteFilter struct {
+	UserID         string
+	OrganisationID string
+	// InvoiceIDs, if set, keeps only credit notes against those invoices, of
+	// which there can be up to MaxCreditNoteInvoices.
+	InvoiceIDs []string
+	// IssuedFrom and IssuedBefore bound the issue date as they do for
+	// InvoiceFilter.
+	IssuedFrom   time.Time
+	IssuedBefore time.Time
+}
+
+func (f CreditNoteFilter) query(app *App) (firestore.Query, error) {
+	q := app.firestoreClient.Collection(creditNotesCollection).Query
+	switch {
+	case f.UserID != "" && f.OrganisationID == "":
+		q = q.Where("user_id", "==", f.UserID)
+	case f.OrganisationID != "" && f.UserID == "":
+		q = q.Where("organisation_id", "==", f.OrganisationID)
+	default:
+		return q, errors.NotValidf("credit note filter without exactly one owner")
+	}
+	switch n := len(f.InvoiceIDs); {
+	case n > MaxCreditNoteInvoices:
+		return q, errors.NotValidf("credit note filter with %d invoices", n)
+	case n > 0:
+		q = q.Where("invoice_id", "in", f.InvoiceIDs)
+	}
+	if !f.IssuedFrom.IsZero() {
+		q = q.Where("issue_date", ">=", f.IssuedFrom)
+	}
+	if !f.IssuedBefore.IsZero() {
+		q = q.Where("issue_date", "<", f.IssuedBefore)
+	}
+	return q.OrderBy("issue_date", firestore.Asc), nil
+}
+
+// ForEachCreditNote calls fn with each credit note matching filter, oldest
+// first. It stops at the first error fn returns, and returns it.
+func (app *App) ForEachCreditNote(ctx context.Context, filter CreditNoteFilter, fn func(*CreditNote) error) error {
+	q, err := filter.query(app)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	iter := q.Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		var note = new(CreditNote)
+		if err := doc.DataTo(note); err != nil {
+			return errors.Trace(err)
+		}
+		note.ID = doc.Ref.ID
+
+		if err := fn(note); err != nil {
+			return errors.Trace(err)
+		}
+	}
+}
+
+// OwnerID returns the ID of the organisation the note belongs to or, for a
+// personal invoice's note, of its user.
+func (n CreditNote) OwnerID() string {
+	if n.OrganisationID != "" {
+		return n.OrganisationID
+	}
+	return n.UserID
+}
+
+func (n *CreditNote) GetGST() float32 {
+	return n.Amount * n.TaxTreatment.GSTRate()
+}
+
+func (n *CreditNote) GetTotal() float32 {
+	return n.Amount + n.GetGST()
+}
+
+func (app *App) CreditNotesDeleteAll(ctx context.Context, batchSize int) error {
+	return app.deleteCollection(ctx, creditNotesCollection, batchSize)
+}
@@ -0,0 +1,143 @@
+package db_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/tests/setup"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type CreditNotesSuite struct {
+	setup.ApplicationSuiteCore
+
+	user *db.User
+}
+
+var _ = gc.Suite(&CreditNotesSuite{})
+
+func (s *CreditNotesSuite) SetUpTest(c *gc.C) {
+	s.user = s.AddUser(context.Background(), c)
+}
+
+func (s *CreditNotesSuite) addInvoice(c *gc.C) *db.Invoice {
+	invoice := setup.CreateInvoice(s.user.ID)
+	invoice.Hours, invoice.Rate = 2, 50
+	id, err := s.App.AddInvoice(context.Background(), invoice)
+	c.Assert(err, jc.ErrorIsNil)
+	invoice.ID = id
+	return invoice
+}
+
+func (s *CreditNotesSuite) TestAddCreditNote(c *gc.C) {
+	ctx := context.Background()
+	invoice := s.addInvoice(c)
+
+	issued := time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+	note := &db.CreditNote{InvoiceID: invoice.ID, Amount: 60, IssueDate: issued, Reason: "refund"}
+	id, err := s.App.AddCreditNote(ctx, note)
+	c.Assert(err, jc.ErrorIsNil)
+
+	got, err := s.App.CreditNote(ctx, id)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(got.UserID, gc.Equals, s.user.ID)
+	c.Check(got.InvoiceNumber, gc.Equals, invoice.Number)
+	c.Check(got.ContactID, gc.Equals, invoice.ContactID)
+	c.Check(got.GetTotal(), gc.Equals, float32(69))
+
+	// Only 40 of the invoice's 100 is left to credit.
+	_, err = s.App.AddCreditNote(ctx, &db.CreditNote{InvoiceID: invoice.ID, Amount: 40.01})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	_, err = s.App.AddCreditNote(ctx, &db.CreditNote{InvoiceID: invoice.ID, Amount: 40})
+	c.Assert(err, jc.ErrorIsNil)
+
+	notes, err := invoice.CreditNotes(ctx, s.App)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(notes, gc.HasLen, 2)
+	c.Check(notes[0].ID, gc.Equals, id)
+
+	_, err = s.App.AddCreditNote(ctx, &db.CreditNote{InvoiceID: "missing", Amount: 1})
+	c.Check(err, gc.Equals, db.InvoiceNotFound)
+	_, err = s.App.CreditNote(ctx, "missing")
+	c.Check(err, gc.Equals, db.CreditNoteNotFound)
+}
+
+func (s *CreditNotesSuite) TestAddCreditNoteDraft(c *gc.C) {
+	invoice := setup.CreateInvoice(s.user.ID)
+	invoice.Status = db.InvoiceStatusDraft
+	id, err := s.App.AddInvoice(context.Background(), invoice)
+	c.Assert(err, jc.ErrorIsNil)
+
+	_, err = s.App.AddCreditNote(context.Background(), &db.CreditNote{InvoiceID: id, Amount: 0.01})
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (s *CreditNotesSuite) TestDeleteCreditedInvoice(c *gc.C) {
+	ctx := context.Background()
+	invoice := s.addInvoice(c)
+	_, err := s.App.AddCreditNote(ctx, &db.CreditNote{InvoiceID: invoice.ID, Amount: 10})
+	c.Assert(err, jc.ErrorIsNil)
+
+	err = invoice.Delete(ctx, s.App)
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	_, err = s.App.Invoice(ctx, invoice.ID)
+	c.Check(err, jc.ErrorIsNil)
+}
+
+func (s *CreditNotesSuite) TestForEachCreditNote(c *gc.C) {
+	ctx := context.Background()
+	invoice := s.addInvoice(c)
+	for _, month := range []time.Month{3, 4, 5} {
+		_, err := s.App.AddCreditNote(ctx, &db.CreditNote{
+			InvoiceID: invoice.ID,
+			Amount:    10,
+			IssueDate: time.Date(2022, month, 10, 0, 0, 0, 0, time.UTC),
+		})
+		c.Assert(err, jc.ErrorIsNil)
+	}
+
+	var months []time.Month
+	err := s.App.ForEachCreditNote(ctx, db.CreditNoteFilter{
+		UserID:       s.user.ID,
+		IssuedFrom:   time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC),
+		IssuedBefore: time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC),
+	}, func(note *db.CreditNote) error {
+		months = append(months, note.IssueDate.Month())
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(months, jc.DeepEquals, []time.Month{4, 5})
+
+	// They can be found by their invoice, and none of them were against
+	// another.
+	count := 0
+	err = s.App.ForEachCreditNote(ctx, db.CreditNoteFilter{
+		UserID:     s.user.ID,
+		InvoiceIDs: []string{invoice.ID},
+	}, func(note *db.CreditNote) error {
+		count++
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(count, gc.Equals, 3)
+	err = s.App.ForEachCreditNote(ctx, db.CreditNoteFilter{
+		UserID:     s.user.ID,
+		InvoiceIDs: []string{invoice.ID + "-other"},
+	}, func(note *db.CreditNote) error {
+		c.Errorf("unexpected credit note %s", note.ID)
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	err = s.App.ForEachCreditNote(ctx, db.CreditNoteFilter{
+		UserID:     s.user.ID,
+		InvoiceIDs: make([]string, db.MaxCreditNoteInvoices+1),
+	}, nil)
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+
+	err = s.App.ForEachCreditNote(ctx, db.CreditNoteFilter{}, nil)
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+}
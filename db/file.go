@@ -1,58 +1,71 @@
 package db
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"io"
-	"io/ioutil"
-	"os"
-	"time"
 
 	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/blob"
 	"github.com/wham-invoice/wham-platform/util"
 )
 
-func (app *App) StorePDF(ctx context.Context, fileName, filePath string) error {
-	// NOTE when cancel is called all resources using ctx are released.
-	ctx, cancel := context.WithTimeout(ctx, time.Second*50)
-	defer cancel()
+var FileNotFound = blob.NotFound
 
-	bucket, err := app.storageClient.Bucket("wham-ad61b.appspot.com")
-	if err != nil {
-		return errors.Trace(err)
-	}
+// StorePDF streams the PDF read from r into the blob store.
+func (app *App) StorePDF(ctx context.Context, fileName string, r io.Reader) error {
+	return errors.Trace(app.blobs.Put(ctx, fileName, r, "application/pdf"))
+}
+
+// PDF returns the PDF file from the blob store.
+func (app *App) PDF(ctx context.Context, fileName string) ([]byte, error) {
+	return app.readObject(ctx, fileName)
+}
 
-	f, err := os.Open(filePath)
+// OpenPDF returns the PDF file from the blob store, ready to stream.
+func (app *App) OpenPDF(ctx context.Context, fileName string) (*blob.Object, error) {
+	obj, err := blob.Open(ctx, app.blobs, fileName)
+	if errors.Cause(err) == blob.NotFound {
+		return nil, FileNotFound
+	}
 	if err != nil {
-		return errors.Trace(err)
+		return nil, errors.Trace(err)
 	}
-	defer f.Close()
+	return obj, nil
+}
 
-	writer := bucket.Object(fileName).NewWriter(ctx)
-	if _, err = io.Copy(writer, f); err != nil {
-		return errors.Trace(err)
+// DeletePDF removes the PDF file from the blob store.
+func (app *App) DeletePDF(ctx context.Context, fileName string) error {
+	err := app.blobs.Delete(ctx, fileName)
+	if err == blob.NotFound {
+		return FileNotFound
 	}
-	if err := writer.Close(); err != nil {
-		return errors.Trace(err)
+	return errors.Trace(err)
+}
+
+// StoreLogo stores a user's logo image and returns its storage ID. Each user
+// has a single logo, so uploading a new one replaces the old.
+func (app *App) StoreLogo(ctx context.Context, userID string, data []byte, contentType string) (string, error) {
+	logoID := fmt.Sprintf("logos/%s", userID)
+	if err := app.blobs.Put(ctx, logoID, bytes.NewReader(data), contentType); err != nil {
+		return "", errors.Trace(err)
 	}
 
-	return nil
+	return logoID, nil
 }
 
-// PDF returns the PDF file from the storage bucket.
-func (app *App) PDF(ctx context.Context, fileName string) ([]byte, error) {
-
-	bucket, err := app.storageClient.Bucket("wham-ad61b.appspot.com")
-	if err != nil {
-		return nil, errors.Trace(err)
-	}
+// Logo returns the logo image from the blob store.
+func (app *App) Logo(ctx context.Context, logoID string) ([]byte, error) {
+	return app.readObject(ctx, logoID)
+}
 
-	util.Logger.Infof("attempting to read file %s", fileName)
-	rc, err := bucket.Object(fileName).NewReader(ctx)
-	if err != nil {
-		return nil, errors.Trace(err)
+func (app *App) readObject(ctx context.Context, name string) ([]byte, error) {
+	util.Logger.Infof("attempting to read file %s", name)
+	body, err := blob.ReadAll(ctx, app.blobs, name)
+	if errors.Cause(err) == blob.NotFound {
+		return nil, FileNotFound
 	}
-	defer rc.Close()
-	body, err := ioutil.ReadAll(rc)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -2,9 +2,14 @@ package db
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"strconv"
 	"time"
 
+	"cloud.google.com/go/firestore"
 	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/search"
 	"google.golang.org/api/iterator"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -13,18 +18,73 @@ import (
 var InvoiceNotFound = errors.New("invoice not found")
 
 type Invoice struct {
-	ID          string    `json:"id"`
-	UserID      string    `firestore:"user_id" json:"user_id"`
-	ContactID   string    `firestore:"contact_id" json:"contact_id"`
-	PDFID       string    `firestore:"pdf_id" json:"pdf_id"`
-	Number      int       `firestore:"number" json:"number"`
-	Rate        float32   `firestore:"rate" json:"rate"`
-	Hours       float32   `firestore:"hours" json:"hours"`
-	Description string    `firestore:"description" json:"description"`
-	IssueDate   time.Time `firestore:"issue_date" json:"issue_date"`
-	DueDate     time.Time `firestore:"due_date" json:"due_date"`
-	Paid        bool      `firestore:"paid" json:"paid"`
-	URLCode     string    `firestore:"url_code" json:"url_code"`
+	ID             string    `json:"id"`
+	UserID         string    `firestore:"user_id" json:"user_id"`
+	OrganisationID string    `firestore:"organisation_id" json:"organisation_id,omitempty"`
+	ContactID      string    `firestore:"contact_id" json:"contact_id"`
+	PDFID          string    `firestore:"pdf_id" json:"pdf_id"`
+	Number         int       `firestore:"number" json:"number"`
+	Rate           float32   `firestore:"rate" json:"rate"`
+	Hours          float32   `firestore:"hours" json:"hours"`
+	Description    string    `firestore:"description" json:"description"`
+	IssueDate      time.Time `firestore:"issue_date" json:"issue_date"`
+	DueDate        time.Time `firestore:"due_date" json:"due_date"`
+	Paid           bool      `firestore:"paid" json:"paid"`
+	URLCode        string    `firestore:"url_code" json:"url_code"`
+	Template       string    `firestore:"template" json:"template,omitempty"`
+	// Status is empty for invoices created before statuses existed; use
+	// CurrentStatus to read it.
+	Status   InvoiceStatus `firestore:"status" json:"status,omitempty"`
+	PaidDate time.Time     `firestore:"paid_date" json:"paid_date"`
+	// OriginalPDFID is the PDF as first issued. It is set once the PDF is
+	// regenerated to show a later status.
+	OriginalPDFID string `firestore:"original_pdf_id" json:"original_pdf_id,omitempty"`
+	// BillTo is the contact as it was when the invoice was issued. Invoices
+	// from before it was kept don't have one.
+	BillTo *Contact `firestore:"bill_to" json:"bill_to,omitempty"`
+	// Currency is an ISO 4217 code. Invoices without one are in
+	// DefaultCurrency.
+	Currency     string       `firestore:"currency" json:"currency,omitempty"`
+	TaxTreatment TaxTreatment `firestore:"tax_treatment" json:"tax_treatment,omitempty"`
+	// PaymentTerms are what the due date was worked out from, if it wasn't
+	// given.
+	PaymentTerms PaymentTerms `firestore:"payment_terms" json:"payment_terms,omitempty"`
+	// Total and ContactName are kept for lists to sort and filter by.
+	// ContactName is the last name then the first, as contacts are sorted,
+	// of BillTo or, without one, of the contact as it is now.
+	Total       float32 `firestore:"total" json:"total"`
+	ContactName string  `firestore:"contact_name" json:"-"`
+}
+
+// DefaultCurrency is the currency of invoices that don't have one.
+const DefaultCurrency = "NZD"
+
+// Cents rounds an amount to cents, going by the number the user typed
+// rather than its nearest float32.
+func Cents(f float32) int64 {
+	v, _ := strconv.ParseFloat(strconv.FormatFloat(float64(f), 'f', -1, 32), 64)
+	return int64(math.Round(v * 100))
+}
+
+// InvoiceStatus is where an invoice is in its life.
+type InvoiceStatus string
+
+const (
+	InvoiceStatusDraft   InvoiceStatus = "draft"
+	InvoiceStatusIssued  InvoiceStatus = "issued"
+	InvoiceStatusOverdue InvoiceStatus = "overdue"
+	InvoiceStatusPaid    InvoiceStatus = "paid"
+	InvoiceStatusVoid    InvoiceStatus = "void"
+)
+
+// Valid reports whether s is a known status.
+func (s InvoiceStatus) Valid() bool {
+	switch s {
+	case InvoiceStatusDraft, InvoiceStatusIssued, InvoiceStatusOverdue,
+		InvoiceStatusPaid, InvoiceStatusVoid:
+		return true
+	}
+	return false
 }
 
 type InvoiceDetail struct {
@@ -38,21 +98,172 @@ type InvoiceDetail struct {
 	IssueDate   time.Time
 	DueDate     time.Time
 	Paid        bool
+	// Currency and TaxTreatment are as on Invoice.
+	Currency     string
+	TaxTreatment TaxTreatment
 }
 
 const invoicesCollection = "invoices"
 
 func (app *App) AddInvoice(ctx context.Context, invoice *Invoice) (string, error) {
-	ref, _, err := app.firestoreClient.Collection(invoicesCollection).Add(ctx, invoice)
+	contact, err := invoice.Contact(ctx, app)
+	if err == ContactNotFound {
+		// It can still be found and listed by everything else.
+		contact = nil
+	} else if err != nil {
+		return "", errors.Trace(err)
+	}
+	invoice.setListFields(contact)
+
+	ref := app.firestoreClient.Collection(invoicesCollection).NewDoc()
+	number := invoice.Number
+	err = app.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		// Retries start again from what the caller asked for.
+		added := *invoice
+		if added.Number == 0 {
+			counter := app.invoiceNumberRef(added.OwnerID())
+			last, err := lastInvoiceNumber(tx, counter)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			added.Number = last + 1
+			if err := tx.Set(counter, invoiceNumber{Last: added.Number}); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		if err := tx.Create(ref, &added); err != nil {
+			return errors.Trace(err)
+		}
+		number = added.Number
+		counted := added
+		counted.ID = ref.ID
+		return changeAnalytics(nil, &counted).inTransaction(app, tx)
+	})
 	if err != nil {
 		return "", errors.Trace(err)
 	}
+	invoice.Number = number
 
 	id := ref.ID
+	indexed := *invoice
+	indexed.ID = id
+	app.search.put(ctx, invoiceDocument(&indexed, contact))
 
 	return id, nil
 }
 
+const invoiceNumbersCollection = "invoice_numbers"
+
+// invoiceNumber is the last number given to one of an owner's invoices.
+type invoiceNumber struct {
+	Last int `firestore:"last"`
+}
+
+func (app *App) invoiceNumberRef(ownerID string) *firestore.DocumentRef {
+	return app.firestoreClient.Collection(invoiceNumbersCollection).Doc(ownerID)
+}
+
+// lastInvoiceNumber reads the last number given to the owner of counter's
+// invoices, or zero if they have none.
+func lastInvoiceNumber(tx *firestore.Transaction, counter *firestore.DocumentRef) (int, error) {
+	doc, err := tx.Get(counter)
+	if status.Code(err) == codes.NotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	var n invoiceNumber
+	if err := doc.DataTo(&n); err != nil {
+		return 0, errors.Trace(err)
+	}
+	return n.Last, nil
+}
+
+// NextInvoiceNumber reserves the next number for one of the owner's
+// invoices, a user or organisation ID. Each owner's invoices are numbered
+// from 1, so their numbers are unique. AddInvoice numbers invoices that
+// don't have one itself; this is for when the number is needed before the
+// invoice is added, e.g. to print on its PDF. A number reserved for an
+// invoice that is never added is skipped.
+func (app *App) NextInvoiceNumber(ctx context.Context, ownerID string) (int, error) {
+	counter := app.invoiceNumberRef(ownerID)
+	var number int
+	err := app.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		last, err := lastInvoiceNumber(tx, counter)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		number = last + 1
+		return errors.Trace(tx.Set(counter, invoiceNumber{Last: number}))
+	})
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return number, nil
+}
+
+// InvoiceNumbersDeleteAll forgets every owner's invoice numbers.
+func (app *App) InvoiceNumbersDeleteAll(ctx context.Context, batchSize int) error {
+	return app.deleteCollection(ctx, invoiceNumbersCollection, batchSize)
+}
+
+// setListFields fills in the fields lists sort and filter by.
+func (i *Invoice) setListFields(contact *Contact) {
+	i.Total = i.GetTotal()
+	if i.Status == "" {
+		i.Status = i.CurrentStatus()
+	}
+	i.ContactName = ""
+	if contact != nil {
+		i.ContactName = contact.listName()
+	}
+}
+
+// updateContactName sets the contact name that lists sort by on the
+// invoices that show the contact as it is now, after it has changed. The
+// invoices are updated in batches, separately from the contact; anything
+// missed is put right the next time the contact is saved.
+func (app *App) updateContactName(ctx context.Context, contact *Contact) error {
+	name := contact.listName()
+	iter := app.firestoreClient.Collection(invoicesCollection).
+		Where("contact_id", "==", contact.ID).
+		Where("contact_name", "!=", name).Documents(ctx)
+	defer iter.Stop()
+
+	batch := app.firestoreClient.Batch()
+	writes := 0
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+		// Invoices with a BillTo keep the name they were billed to.
+		if doc.Data()["bill_to"] != nil {
+			continue
+		}
+
+		batch.Update(doc.Ref, []firestore.Update{{Path: "contact_name", Value: name}})
+		// Firestore allows 500 writes in a batch.
+		if writes++; writes == 500 {
+			if _, err := batch.Commit(ctx); err != nil {
+				return errors.Trace(err)
+			}
+			batch, writes = app.firestoreClient.Batch(), 0
+		}
+	}
+	if writes > 0 {
+		if _, err := batch.Commit(ctx); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return nil
+}
+
 func (app *App) Invoice(ctx context.Context, id string) (*Invoice, error) {
 	var invoice = new(Invoice)
 
@@ -74,13 +285,67 @@ func (app *App) Invoice(ctx context.Context, id string) (*Invoice, error) {
 	return invoice, nil
 }
 
+// Delete deletes the invoice. Invoices with credit notes can't be deleted,
+// as the notes have been counted in GST returns; it returns an error
+// satisfying errors.IsNotValid for them, and they should be voided instead.
 func (i *Invoice) Delete(ctx context.Context, app *App) error {
-	_, err := app.firestoreClient.Collection(invoicesCollection).Doc(i.ID).Delete(ctx)
+	ref := app.firestoreClient.Collection(invoicesCollection).Doc(i.ID)
+	credits := app.firestoreClient.Collection(creditNotesCollection).Where("invoice_id", "==", i.ID).Limit(1)
+	var owner string
+	err := app.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		stored, err := getInvoice(tx, ref)
+		if err != nil {
+			return err
+		}
+		docs, err := tx.Documents(credits).GetAll()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if len(docs) > 0 {
+			return errors.NotValidf("deleting invoice %d, which has credit notes", stored.Number)
+		}
+		owner = stored.OwnerID()
+		if err := tx.Delete(ref); err != nil {
+			return errors.Trace(err)
+		}
+		return changeAnalytics(stored, nil).inTransaction(app, tx)
+	})
+	if err == InvoiceNotFound {
+		return err
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	app.search.delete(ctx, owner, search.KindInvoice, i.ID)
+
+	return nil
+}
+
+// getInvoice reads the invoice at ref in tx, returning InvoiceNotFound if
+// there is none.
+func getInvoice(tx *firestore.Transaction, ref *firestore.DocumentRef) (*Invoice, error) {
+	doc, err := tx.Get(ref)
 	if status.Code(err) == codes.NotFound {
-		return InvoiceNotFound
+		return nil, InvoiceNotFound
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	invoice := new(Invoice)
+	if err := doc.DataTo(invoice); err != nil {
+		return nil, errors.Trace(err)
 	}
+	invoice.ID = doc.Ref.ID
+	return invoice, nil
+}
 
-	return errors.Trace(err)
+// OwnerID returns the ID of the organisation the invoice belongs to or, for
+// a personal invoice, of its user.
+func (i Invoice) OwnerID() string {
+	if i.OrganisationID != "" {
+		return i.OrganisationID
+	}
+	return i.UserID
 }
 
 func (i *Invoice) Detail(ctx context.Context, app *App) (*InvoiceDetail, error) {
@@ -98,23 +363,153 @@ func (i *Invoice) Detail(ctx context.Context, app *App) (*InvoiceDetail, error)
 	}
 
 	return &InvoiceDetail{
-		PDFID:       i.PDFID,
-		User:        &userSafe,
-		Contact:     contact,
-		Number:      i.Number,
-		Rate:        i.Rate,
-		Hours:       i.Hours,
-		Description: i.Description,
-		IssueDate:   i.IssueDate,
-		DueDate:     i.DueDate,
-		Paid:        i.Paid,
+		PDFID:        i.PDFID,
+		User:         &userSafe,
+		Contact:      contact,
+		Number:       i.Number,
+		Rate:         i.Rate,
+		Hours:        i.Hours,
+		Description:  i.Description,
+		IssueDate:    i.IssueDate,
+		DueDate:      i.DueDate,
+		Paid:         i.Paid,
+		Currency:     i.Currency,
+		TaxTreatment: i.TaxTreatment,
 	}, nil
 }
 
+// defaultReferencePrefix starts payment references when the user hasn't
+// chosen a prefix.
+const defaultReferencePrefix = "INV"
+
+const (
+	// MaxPaymentReference is the most characters NZ banks carry in a
+	// payment reference.
+	MaxPaymentReference = 12
+	// MaxReferencePrefix leaves room after the prefix for a dash and six
+	// digits of invoice number.
+	MaxReferencePrefix = MaxPaymentReference - 7
+)
+
+// PaymentReference returns the reference clients should quote when paying
+// the invoice. It is never longer than MaxPaymentReference: once numbers
+// outgrow six digits they take room from the end of the prefix.
+func (i *Invoice) PaymentReference(settings *PaymentSettings) string {
+	prefix := defaultReferencePrefix
+	if settings != nil && settings.ReferencePrefix != "" {
+		prefix = settings.ReferencePrefix
+	}
+	number := fmt.Sprintf("%06d", i.Number)
+	room := MaxPaymentReference - len(number) - 1
+	if room <= 0 {
+		return number
+	}
+	if r := []rune(prefix); len(r) > room {
+		prefix = string(r[:room])
+	}
+	return prefix + "-" + number
+}
+
+// CurrentStatus returns the invoice's status, working it out from Paid for
+// invoices that predate statuses.
+func (i *Invoice) CurrentStatus() InvoiceStatus {
+	switch {
+	case i.Status != "":
+		return i.Status
+	case i.Paid:
+		return InvoiceStatusPaid
+	}
+	return InvoiceStatusIssued
+}
+
+// SetStatus moves the invoice to a new status, now showing in the PDF
+// pdfID. The PDF the invoice was first issued with is kept as
+// OriginalPDFID. Paid invoices record paidDate; it is ignored otherwise.
+func (i *Invoice) SetStatus(
+	ctx context.Context,
+	app *App,
+	to InvoiceStatus,
+	paidDate time.Time,
+	pdfID string,
+) error {
+	if err := i.CheckStatus(to); err != nil {
+		return errors.Trace(err)
+	}
+	if to != InvoiceStatusPaid {
+		paidDate = time.Time{}
+	}
+
+	originalPDFID := i.OriginalPDFID
+	if originalPDFID == "" {
+		originalPDFID = i.PDFID
+	}
+
+	ref := app.firestoreClient.Collection(invoicesCollection).Doc(i.ID)
+	err := app.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		stored, err := getInvoice(tx, ref)
+		if err != nil {
+			return err
+		}
+		updated := *stored
+		updated.Status = to
+		updated.Paid = to == InvoiceStatusPaid
+		updated.PaidDate = paidDate
+		if err := tx.Update(ref, []firestore.Update{
+			{Path: "status", Value: to},
+			{Path: "paid", Value: to == InvoiceStatusPaid},
+			{Path: "paid_date", Value: paidDate},
+			{Path: "pdf_id", Value: pdfID},
+			{Path: "original_pdf_id", Value: originalPDFID},
+		}); err != nil {
+			return errors.Trace(err)
+		}
+		return changeAnalytics(stored, &updated).inTransaction(app, tx)
+	})
+	if err == InvoiceNotFound {
+		return err
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	i.Status = to
+	i.Paid = to == InvoiceStatusPaid
+	i.PaidDate = paidDate
+	i.PDFID = pdfID
+	i.OriginalPDFID = originalPDFID
+
+	return nil
+}
+
+// CheckStatus returns an error satisfying errors.IsNotValid if the invoice
+// can't move to the given status.
+func (i *Invoice) CheckStatus(to InvoiceStatus) error {
+	from := i.CurrentStatus()
+	switch {
+	case !to.Valid():
+		return errors.NotValidf("invoice status %q", to)
+	case from == InvoiceStatusVoid:
+		return errors.NotValidf("changing the status of a void invoice")
+	case to == InvoiceStatusDraft && from != InvoiceStatusDraft:
+		return errors.NotValidf("returning an issued invoice to draft")
+	case to == InvoiceStatusOverdue && !time.Now().After(i.DueDate):
+		return errors.NotValidf("marking an invoice overdue before it is due")
+	}
+	return nil
+}
+
 func (app *App) invoicesForUser(ctx context.Context, userID string) ([]Invoice, error) {
+	return app.invoicesWhere(ctx, "user_id", userID)
+}
+
+func (app *App) invoicesForOrganisation(ctx context.Context, orgID string) ([]Invoice, error) {
+	return app.invoicesWhere(ctx, "organisation_id", orgID)
+}
+
+func (app *App) invoicesWhere(ctx context.Context, field, value string) ([]Invoice, error) {
 	invoices := []Invoice{}
 
-	iter := app.firestoreClient.Collection(invoicesCollection).Where("user_id", "==", userID).Documents(ctx)
+	iter := app.firestoreClient.Collection(invoicesCollection).Where(field, "==", value).Documents(ctx)
 	for {
 		var invoice = new(Invoice)
 		doc, err := iter.Next()
@@ -137,6 +532,309 @@ func (app *App) invoicesForUser(ctx context.Context, userID string) ([]Invoice,
 	return invoices, nil
 }
 
+// InvoiceFilter chooses the invoices ForEachInvoice visits. Exactly one of
+// UserID and OrganisationID must be set.
+type InvoiceFilter struct {
+	UserID         string
+	OrganisationID string
+	// ContactID, if set, keeps only invoices addressed to that contact.
+	ContactID string
+	// IssuedFrom and IssuedBefore bound the issue date; the zero time leaves
+	// that end open. IssuedBefore is exclusive.
+	IssuedFrom   time.Time
+	IssuedBefore time.Time
+	// Statuses, if set, keeps only invoices whose CurrentStatus is one of
+	// them.
+	Statuses []InvoiceStatus
+	// MinTotal and MaxTotal, if set, bound the total, inclusive.
+	MinTotal *float32
+	MaxTotal *float32
+}
+
+// where returns a query for the filter's owner and contact.
+func (f InvoiceFilter) where(app *App) (firestore.Query, error) {
+	q := app.firestoreClient.Collection(invoicesCollection).Query
+	switch {
+	case f.UserID != "" && f.OrganisationID == "":
+		q = q.Where("user_id", "==", f.UserID)
+	case f.OrganisationID != "" && f.UserID == "":
+		q = q.Where("organisation_id", "==", f.OrganisationID)
+	default:
+		return q, errors.NotValidf("invoice filter without exactly one owner")
+	}
+	if f.ContactID != "" {
+		q = q.Where("contact_id", "==", f.ContactID)
+	}
+	return q, nil
+}
+
+func (f InvoiceFilter) query(app *App) (firestore.Query, error) {
+	q, err := f.where(app)
+	if err != nil {
+		return q, errors.Trace(err)
+	}
+	if !f.IssuedFrom.IsZero() {
+		q = q.Where("issue_date", ">=", f.IssuedFrom)
+	}
+	if !f.IssuedBefore.IsZero() {
+		q = q.Where("issue_date", "<", f.IssuedBefore)
+	}
+	return q.OrderBy("issue_date", firestore.Asc), nil
+}
+
+func (f InvoiceFilter) keep(i *Invoice) bool {
+	if !f.IssuedFrom.IsZero() && i.IssueDate.Before(f.IssuedFrom) {
+		return false
+	}
+	if !f.IssuedBefore.IsZero() && !i.IssueDate.Before(f.IssuedBefore) {
+		return false
+	}
+	if f.MinTotal != nil && i.GetTotal() < *f.MinTotal {
+		return false
+	}
+	if f.MaxTotal != nil && i.GetTotal() > *f.MaxTotal {
+		return false
+	}
+	if len(f.Statuses) == 0 {
+		return true
+	}
+	// Statuses are filtered here rather than in the query because legacy
+	// invoices have none stored.
+	for _, s := range f.Statuses {
+		if i.CurrentStatus() == s {
+			return true
+		}
+	}
+	return false
+}
+
+// InvoiceSort is what a list of invoices is ordered by.
+type InvoiceSort string
+
+const (
+	InvoiceSortIssueDate   InvoiceSort = "issue_date"
+	InvoiceSortDueDate     InvoiceSort = "due_date"
+	InvoiceSortTotal       InvoiceSort = "total"
+	InvoiceSortContactName InvoiceSort = "contact_name"
+)
+
+// Valid reports whether s is a known sort.
+func (s InvoiceSort) Valid() bool {
+	switch s {
+	case InvoiceSortIssueDate, InvoiceSortDueDate, InvoiceSortTotal, InvoiceSortContactName:
+		return true
+	}
+	return false
+}
+
+// InvoiceList is a page of invoices to read.
+type InvoiceList struct {
+	InvoiceFilter
+	// Sort defaults to InvoiceSortIssueDate.
+	Sort       InvoiceSort
+	Descending bool
+	// Cursor is the NextCursor of the previous page, if this isn't the
+	// first.
+	Cursor string
+	// Limit defaults to DefaultPageSize and is capped at MaxPageSize.
+	Limit int
+}
+
+// InvoicePage is a page of a list of invoices. NextCursor is empty on the
+// last page.
+type InvoicePage struct {
+	Items      []Invoice `json:"items"`
+	NextCursor string    `json:"next_cursor"`
+}
+
+// ListInvoices returns a page of the invoices matching l, in its order.
+func (app *App) ListInvoices(ctx context.Context, l InvoiceList) (*InvoicePage, error) {
+	if l.Sort == "" {
+		l.Sort = InvoiceSortIssueDate
+	}
+	if !l.Sort.Valid() {
+		return nil, errors.NotValidf("invoice sort %q", string(l.Sort))
+	}
+	q, err := l.where(app)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(l.Statuses) > 0 {
+		// Invoices are given a status when they're added or backfilled.
+		q = q.Where("status", "in", l.Statuses)
+	}
+
+	// Firestore can only bound the field it sorts by, so other bounds are
+	// checked as invoices are read.
+	rest := InvoiceFilter{}
+	switch l.Sort {
+	case InvoiceSortIssueDate:
+		if !l.IssuedFrom.IsZero() {
+			q = q.Where("issue_date", ">=", l.IssuedFrom)
+		}
+		if !l.IssuedBefore.IsZero() {
+			q = q.Where("issue_date", "<", l.IssuedBefore)
+		}
+		rest.MinTotal, rest.MaxTotal = l.MinTotal, l.MaxTotal
+	case InvoiceSortTotal:
+		if l.MinTotal != nil {
+			q = q.Where("total", ">=", *l.MinTotal)
+		}
+		if l.MaxTotal != nil {
+			q = q.Where("total", "<=", *l.MaxTotal)
+		}
+		rest.IssuedFrom, rest.IssuedBefore = l.IssuedFrom, l.IssuedBefore
+	default:
+		rest.IssuedFrom, rest.IssuedBefore = l.IssuedFrom, l.IssuedBefore
+		rest.MinTotal, rest.MaxTotal = l.MinTotal, l.MaxTotal
+	}
+
+	page := &InvoicePage{Items: []Invoice{}}
+	read := listing{
+		query:      q,
+		sort:       listSort(string(l.Sort), l.Descending),
+		fields:     []string{string(l.Sort)},
+		descending: l.Descending,
+		cursor:     l.Cursor,
+		limit:      l.Limit,
+	}
+	if !rest.IssuedFrom.IsZero() || !rest.IssuedBefore.IsZero() ||
+		rest.MinTotal != nil || rest.MaxTotal != nil {
+		read.keep = func(doc *firestore.DocumentSnapshot) (bool, error) {
+			var invoice Invoice
+			if err := doc.DataTo(&invoice); err != nil {
+				return false, errors.Trace(err)
+			}
+			return rest.keep(&invoice), nil
+		}
+	}
+	docs, next, err := read.page(ctx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for _, doc := range docs {
+		var invoice Invoice
+		if err := doc.DataTo(&invoice); err != nil {
+			return nil, errors.Trace(err)
+		}
+		invoice.ID = doc.Ref.ID
+		page.Items = append(page.Items, invoice)
+	}
+	page.NextCursor = next
+
+	return page, nil
+}
+
+// listSort names a list's order for its cursors.
+func listSort(sort string, descending bool) string {
+	if descending {
+		return "-" + sort
+	}
+	return sort
+}
+
+// BackfillInvoices gives invoices from before lists could sort and filter
+// them the fields they need: their total, contact name and status. It
+// leaves invoices that have them alone, so it is safe to run more than
+// once.
+func (app *App) BackfillInvoices(ctx context.Context) error {
+	contacts := map[string]*Contact{}
+	batch := app.firestoreClient.Batch()
+	writes := 0
+
+	iter := app.firestoreClient.Collection(invoicesCollection).Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+		data := doc.Data()
+		_, hasTotal := data["total"]
+		_, hasName := data["contact_name"]
+		if status, _ := data["status"].(string); hasTotal && hasName && status != "" {
+			continue
+		}
+
+		var invoice Invoice
+		if err := doc.DataTo(&invoice); err != nil {
+			return errors.Trace(err)
+		}
+		contact := invoice.BillTo
+		if contact == nil {
+			var ok bool
+			if contact, ok = contacts[invoice.ContactID]; !ok {
+				contact, err = app.Contact(ctx, invoice.ContactID)
+				if err == ContactNotFound {
+					contact = nil
+				} else if err != nil {
+					return errors.Trace(err)
+				}
+				contacts[invoice.ContactID] = contact
+			}
+		}
+		invoice.setListFields(contact)
+
+		batch.Update(doc.Ref, []firestore.Update{
+			{Path: "total", Value: invoice.Total},
+			{Path: "contact_name", Value: invoice.ContactName},
+			{Path: "status", Value: invoice.Status},
+		})
+		// Firestore allows 500 writes in a batch.
+		if writes++; writes == 500 {
+			if _, err := batch.Commit(ctx); err != nil {
+				return errors.Trace(err)
+			}
+			batch, writes = app.firestoreClient.Batch(), 0
+		}
+	}
+	if writes > 0 {
+		if _, err := batch.Commit(ctx); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return nil
+}
+
+// ForEachInvoice calls fn with each invoice matching filter, oldest first,
+// reading them as it goes rather than loading them all. It stops at the
+// first error fn returns, and returns it.
+func (app *App) ForEachInvoice(ctx context.Context, filter InvoiceFilter, fn func(*Invoice) error) error {
+	q, err := filter.query(app)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	iter := q.Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		var invoice = new(Invoice)
+		if err := doc.DataTo(&invoice); err != nil {
+			return errors.Trace(err)
+		}
+		invoice.ID = doc.Ref.ID
+
+		if !filter.keep(invoice) {
+			continue
+		}
+		if err := fn(invoice); err != nil {
+			return errors.Trace(err)
+		}
+	}
+}
+
 func (app *App) invoiceTotalsForUser(ctx context.Context, userID string) (float32, float32, error) {
 	var total, paid float32
 
@@ -159,7 +857,12 @@ func (i *Invoice) User(ctx context.Context, app *App) (*User, error) {
 	return app.User(ctx, i.UserID)
 }
 
+// Contact returns who the invoice is billed to: the details it was issued
+// with if it has them, and otherwise the contact as it is now.
 func (i *Invoice) Contact(ctx context.Context, app *App) (*Contact, error) {
+	if i.BillTo != nil {
+		return i.BillTo, nil
+	}
 	return app.Contact(ctx, i.ContactID)
 }
 
@@ -168,8 +871,7 @@ func (i *Invoice) GetSubtotal() float32 {
 }
 
 func (i *Invoice) GetGST() float32 {
-	const gstRate = 0.15
-	return i.Hours * i.Rate * gstRate
+	return i.Hours * i.Rate * i.TaxTreatment.GSTRate()
 }
 
 func (i *Invoice) GetTotal() float32 {
@@ -196,6 +898,7 @@ func (app *App) InvoicesDeleteAll(ctx context.Context, batchSize int) error {
 		}
 
 		if numDeleted == 0 {
+			app.search.reset()
 			return nil
 		}
 
@@ -2,10 +2,12 @@ package db_test
 
 import (
 	"context"
+	"time"
 
 	"github.com/wham-invoice/wham-platform/db"
 	"github.com/wham-invoice/wham-platform/tests/setup"
 
+	"github.com/juju/errors"
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
 )
@@ -30,3 +32,156 @@ func (s *InvoicesSuite) TestInvoiceInsertAndGet(c *gc.C) {
 	c.Assert(err, jc.ErrorIsNil)
 	c.Check(getInvoice, jc.DeepEquals, inv)
 }
+
+func (s *InvoicesSuite) TestInvoiceSetStatus(c *gc.C) {
+	ctx := context.Background()
+	inv := s.AddInvoice(c, s.user.ID)
+	issuedPDFID := inv.PDFID
+	c.Check(inv.CurrentStatus(), gc.Equals, db.InvoiceStatusIssued)
+
+	paidDate := time.Date(2022, 3, 10, 0, 0, 0, 0, time.UTC)
+	err := inv.SetStatus(ctx, s.App, db.InvoiceStatusPaid, paidDate, "paid-pdf")
+	c.Assert(err, jc.ErrorIsNil)
+
+	getInvoice, err := s.App.Invoice(ctx, inv.ID)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(getInvoice.CurrentStatus(), gc.Equals, db.InvoiceStatusPaid)
+	c.Check(getInvoice.Paid, jc.IsTrue)
+	c.Check(getInvoice.PaidDate.Equal(paidDate), jc.IsTrue)
+	c.Check(getInvoice.PDFID, gc.Equals, "paid-pdf")
+	c.Check(getInvoice.OriginalPDFID, gc.Equals, issuedPDFID)
+
+	// The original survives further changes.
+	err = inv.SetStatus(ctx, s.App, db.InvoiceStatusVoid, paidDate, "void-pdf")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(inv.OriginalPDFID, gc.Equals, issuedPDFID)
+	c.Check(inv.Paid, jc.IsFalse)
+	c.Check(inv.PaidDate.IsZero(), jc.IsTrue)
+}
+
+func (s *InvoicesSuite) TestInvoiceCheckStatus(c *gc.C) {
+	inv := setup.CreateInvoice(s.user.ID)
+
+	c.Check(inv.CheckStatus(db.InvoiceStatusPaid), jc.ErrorIsNil)
+	c.Check(inv.CheckStatus("lost"), jc.Satisfies, errors.IsNotValid)
+	c.Check(inv.CheckStatus(db.InvoiceStatusDraft), jc.Satisfies, errors.IsNotValid)
+	// Not due for another ten days.
+	c.Check(inv.CheckStatus(db.InvoiceStatusOverdue), jc.Satisfies, errors.IsNotValid)
+
+	inv.DueDate = time.Now().AddDate(0, 0, -1)
+	c.Check(inv.CheckStatus(db.InvoiceStatusOverdue), jc.ErrorIsNil)
+
+	inv.Status = db.InvoiceStatusVoid
+	c.Check(inv.CheckStatus(db.InvoiceStatusPaid), jc.Satisfies, errors.IsNotValid)
+}
+
+func (s *InvoicesSuite) TestInvoicePaymentReference(c *gc.C) {
+	invoice := &db.Invoice{Number: 42}
+	c.Check(invoice.PaymentReference(nil), gc.Equals, "INV-000042")
+	c.Check(invoice.PaymentReference(&db.PaymentSettings{}), gc.Equals, "INV-000042")
+	c.Check(invoice.PaymentReference(&db.PaymentSettings{ReferencePrefix: "DD"}), gc.Equals, "DD-000042")
+
+	// Longer numbers eat into the prefix rather than the bank's limit.
+	invoice.Number = 12345678
+	c.Check(invoice.PaymentReference(&db.PaymentSettings{ReferencePrefix: "ACME"}), gc.Equals, "AC-12345678")
+	invoice.Number = 1234567890
+	c.Check(invoice.PaymentReference(nil), gc.Equals, "I-1234567890")
+	invoice.Number = 123456789012
+	c.Check(invoice.PaymentReference(nil), gc.Equals, "123456789012")
+}
+
+func (s *InvoicesSuite) TestAddInvoiceNumbers(c *gc.C) {
+	ctx := context.Background()
+	other := s.AddUser(ctx, c)
+	add := func(userID string) int {
+		invoice := setup.CreateInvoice(userID)
+		invoice.Number = 0
+		id, err := s.App.AddInvoice(ctx, invoice)
+		c.Assert(err, jc.ErrorIsNil)
+		got, err := s.App.Invoice(ctx, id)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(got.Number, gc.Equals, invoice.Number)
+		return got.Number
+	}
+
+	c.Check(add(s.user.ID), gc.Equals, 1)
+	c.Check(add(s.user.ID), gc.Equals, 2)
+	c.Check(add(other.ID), gc.Equals, 1)
+
+	// A reserved number is never handed out again.
+	reserved, err := s.App.NextInvoiceNumber(ctx, s.user.ID)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(reserved, gc.Equals, 3)
+	c.Check(add(s.user.ID), gc.Equals, 4)
+}
+
+func (s *InvoicesSuite) TestForEachInvoice(c *gc.C) {
+	ctx := context.Background()
+	issue := func(day int, status db.InvoiceStatus) *db.Invoice {
+		inv := setup.CreateInvoice(s.user.ID)
+		inv.ContactID = "contact"
+		inv.IssueDate = time.Date(2022, 3, day, 0, 0, 0, 0, time.UTC)
+		inv.Status = status
+		id, err := s.App.AddInvoice(ctx, inv)
+		c.Assert(err, jc.ErrorIsNil)
+		inv.ID = id
+		return inv
+	}
+	first := issue(1, db.InvoiceStatusIssued)
+	second := issue(10, db.InvoiceStatusVoid)
+	issue(20, db.InvoiceStatusIssued)
+	s.AddInvoice(c, s.user.ID)
+
+	var ids []string
+	err := s.App.ForEachInvoice(ctx, db.InvoiceFilter{
+		UserID:       s.user.ID,
+		ContactID:    "contact",
+		IssuedFrom:   time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC),
+		IssuedBefore: time.Date(2022, 3, 20, 0, 0, 0, 0, time.UTC),
+	}, func(inv *db.Invoice) error {
+		ids = append(ids, inv.ID)
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(ids, jc.DeepEquals, []string{first.ID, second.ID})
+
+	ids = nil
+	err = s.App.ForEachInvoice(ctx, db.InvoiceFilter{
+		UserID:    s.user.ID,
+		ContactID: "contact",
+		Statuses:  []db.InvoiceStatus{db.InvoiceStatusVoid},
+	}, func(inv *db.Invoice) error {
+		ids = append(ids, inv.ID)
+		return nil
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(ids, jc.DeepEquals, []string{second.ID})
+
+	err = s.App.ForEachInvoice(ctx, db.InvoiceFilter{}, nil)
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (s *InvoicesSuite) TestInvoiceContactBillTo(c *gc.C) {
+	ctx := context.Background()
+	contact := s.AddContact(ctx, c, s.user.ID)
+	invoice := setup.CreateInvoice(s.user.ID)
+	invoice.ContactID = contact.ID
+	invoice.BillTo = contact.Snapshot()
+	id, err := s.App.AddInvoice(ctx, invoice)
+	c.Assert(err, jc.ErrorIsNil)
+
+	// The contact changing, or going, doesn't change who was billed.
+	c.Assert(contact.SetArchived(ctx, s.App, true), jc.ErrorIsNil)
+	saved, err := s.App.Invoice(ctx, id)
+	c.Assert(err, jc.ErrorIsNil)
+	billed, err := saved.Contact(ctx, s.App)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(billed.Archived, jc.IsFalse)
+	c.Check(billed.Email, gc.Equals, contact.Email)
+
+	// Invoices without a snapshot read the contact as it is.
+	saved.BillTo = nil
+	current, err := saved.Contact(ctx, s.App)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(current.Archived, jc.IsTrue)
+}
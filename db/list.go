@@ -0,0 +1,177 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/juju/errors"
+	"google.golang.org/api/iterator"
+)
+
+// DefaultPageSize and MaxPageSize bound how many items a page of a list
+// holds.
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+// listing reads a collection in order a page at a time, carrying on from
+// where the last page stopped. Each page ends with a cursor holding the
+// sort values of its last document, so documents added or deleted between
+// pages don't shift later pages.
+type listing struct {
+	// query has the list's filters but no order.
+	query firestore.Query
+	// sort names the order, so a cursor from one order can't be used with
+	// another.
+	sort string
+	// fields are the paths ordered by. Ties are broken by document ID.
+	fields     []string
+	descending bool
+	cursor     string
+	limit      int
+	// keep, if set, drops documents for filters the query can't express.
+	keep func(*firestore.DocumentSnapshot) (bool, error)
+}
+
+// page returns the next page of documents, and the cursor for the page after
+// it, which is empty if there is none.
+func (l listing) page(ctx context.Context) ([]*firestore.DocumentSnapshot, string, error) {
+	limit := l.limit
+	switch {
+	case limit <= 0:
+		limit = DefaultPageSize
+	case limit > MaxPageSize:
+		limit = MaxPageSize
+	}
+	direction := firestore.Asc
+	if l.descending {
+		direction = firestore.Desc
+	}
+
+	q := l.query
+	for _, field := range l.fields {
+		q = q.OrderBy(field, direction)
+	}
+	q = q.OrderBy(firestore.DocumentID, direction)
+	if l.cursor != "" {
+		values, err := decodeCursor(l.cursor, l.sort, len(l.fields))
+		if err != nil {
+			return nil, "", errors.Trace(err)
+		}
+		q = q.StartAfter(values...)
+	}
+	if l.keep == nil {
+		// One more than a page tells us whether there's another.
+		q = q.Limit(limit + 1)
+	}
+
+	iter := q.Documents(ctx)
+	defer iter.Stop()
+	docs := []*firestore.DocumentSnapshot{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return docs, "", nil
+		}
+		if err != nil {
+			return nil, "", errors.Trace(err)
+		}
+		if l.keep != nil {
+			ok, err := l.keep(doc)
+			if err != nil {
+				return nil, "", errors.Trace(err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		if len(docs) == limit {
+			next, err := encodeCursor(l.sort, l.fields, docs[limit-1])
+			return docs, next, errors.Trace(err)
+		}
+		docs = append(docs, doc)
+	}
+}
+
+// cursor is where a page ended, as it's given to clients: base64 encoded
+// JSON, which they should treat as opaque.
+type cursor struct {
+	Sort   string        `json:"s"`
+	Values []cursorValue `json:"v"`
+	ID     string        `json:"id"`
+}
+
+// cursorValue is a sort value, keeping its type through JSON.
+type cursorValue struct {
+	Time   *time.Time `json:"t,omitempty"`
+	Number *float64   `json:"n,omitempty"`
+	String *string    `json:"s,omitempty"`
+}
+
+func encodeCursor(sort string, fields []string, doc *firestore.DocumentSnapshot) (string, error) {
+	c := cursor{Sort: sort, ID: doc.Ref.ID}
+	for _, field := range fields {
+		value, err := doc.DataAt(field)
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		var v cursorValue
+		switch value := value.(type) {
+		case time.Time:
+			v.Time = &value
+		case float64:
+			v.Number = &value
+		case int64:
+			n := float64(value)
+			v.Number = &n
+		case string:
+			v.String = &value
+		case nil:
+		default:
+			return "", errors.Errorf("cannot sort by %s of type %T", field, value)
+		}
+		c.Values = append(c.Values, v)
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeCursor returns the values to start after, ending with the document
+// ID. It returns an error satisfying errors.IsNotValid if the cursor isn't
+// one encodeCursor made for this sort.
+func decodeCursor(s, sort string, fields int) ([]interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.NotValidf("cursor")
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, errors.NotValidf("cursor")
+	}
+	if c.Sort != sort || len(c.Values) != fields || c.ID == "" {
+		return nil, errors.NotValidf("cursor for another list")
+	}
+
+	values := make([]interface{}, 0, fields+1)
+	for _, v := range c.Values {
+		switch {
+		case v.Time != nil:
+			values = append(values, *v.Time)
+		case v.Number != nil:
+			values = append(values, *v.Number)
+		case v.String != nil:
+			values = append(values, *v.String)
+		default:
+			values = append(values, nil)
+		}
+	}
+	return append(values, c.ID), nil
+}
@@ -0,0 +1,123 @@
+package db_test
+
+import (
+	"context"
+
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/tests/setup"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type ListSuite struct {
+	setup.ApplicationSuiteCore
+
+	user *db.User
+}
+
+var _ = gc.Suite(&ListSuite{})
+
+func (s *ListSuite) SetUpTest(c *gc.C) {
+	s.user = s.AddUser(context.Background(), c)
+}
+
+func (s *ListSuite) TestListInvoices(c *gc.C) {
+	ctx := context.Background()
+	contact := setup.CreateContact(s.user.ID)
+	contact.FirstName, contact.LastName = "Jane", "Smith"
+	contactID, err := s.App.AddContact(ctx, &contact)
+	c.Assert(err, jc.ErrorIsNil)
+
+	invoice := setup.CreateInvoice(s.user.ID)
+	invoice.ContactID = contactID
+	invoice.Hours, invoice.Rate = 2, 50
+	_, err = s.App.AddInvoice(ctx, invoice)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(invoice.Total, gc.Equals, float32(115))
+	c.Check(invoice.ContactName, gc.Equals, "Smith Jane")
+	c.Check(invoice.Status, gc.Equals, db.InvoiceStatusIssued)
+
+	paid := setup.CreateInvoice(s.user.ID)
+	paid.Status = db.InvoiceStatusPaid
+	paidID, err := s.App.AddInvoice(ctx, paid)
+	c.Assert(err, jc.ErrorIsNil)
+
+	page, err := s.App.ListInvoices(ctx, db.InvoiceList{
+		InvoiceFilter: db.InvoiceFilter{UserID: s.user.ID, Statuses: []db.InvoiceStatus{db.InvoiceStatusPaid}},
+		Sort:          db.InvoiceSortDueDate,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(page.Items, gc.HasLen, 1)
+	c.Check(page.Items[0].ID, gc.Equals, paidID)
+
+	page, err = s.App.ListInvoices(ctx, db.InvoiceList{
+		InvoiceFilter: db.InvoiceFilter{UserID: s.user.ID, ContactID: contactID},
+		Sort:          db.InvoiceSortContactName,
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(page.Items, gc.HasLen, 1)
+	c.Check(page.Items[0].Total, gc.Equals, float32(115))
+}
+
+func (s *ListSuite) TestContactNameFollowsContact(c *gc.C) {
+	ctx := context.Background()
+	contact := setup.CreateContact(s.user.ID)
+	contact.FirstName, contact.LastName = "Jane", "Smith"
+	contactID, err := s.App.AddContact(ctx, &contact)
+	c.Assert(err, jc.ErrorIsNil)
+	contact.ID = contactID
+
+	legacy := setup.CreateInvoice(s.user.ID)
+	legacy.ContactID = contactID
+	legacyID, err := s.App.AddInvoice(ctx, legacy)
+	c.Assert(err, jc.ErrorIsNil)
+	billed := setup.CreateInvoice(s.user.ID)
+	billed.ContactID = contactID
+	billed.BillTo = contact.Snapshot()
+	billedID, err := s.App.AddInvoice(ctx, billed)
+	c.Assert(err, jc.ErrorIsNil)
+
+	contact.LastName = "Jones"
+	c.Assert(contact.Save(ctx, s.App), jc.ErrorIsNil)
+
+	names := func() map[string]string {
+		page, err := s.App.ListInvoices(ctx, db.InvoiceList{
+			InvoiceFilter: db.InvoiceFilter{UserID: s.user.ID},
+			Sort:          db.InvoiceSortContactName,
+		})
+		c.Assert(err, jc.ErrorIsNil)
+		names := map[string]string{}
+		for _, invoice := range page.Items {
+			names[invoice.ID] = invoice.ContactName
+		}
+		return names
+	}
+	// Only the invoice without a BillTo shows the contact as it is now.
+	c.Check(names(), jc.DeepEquals, map[string]string{
+		legacyID: "Jones Jane",
+		billedID: "Smith Jane",
+	})
+
+	other := setup.CreateContact(s.user.ID)
+	other.FirstName, other.LastName = "Janet", "Brown"
+	otherID, err := s.App.AddContact(ctx, &other)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.App.MergeContacts(ctx, otherID, []string{contactID})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(names(), jc.DeepEquals, map[string]string{
+		legacyID: "Brown Janet",
+		billedID: "Smith Jane",
+	})
+}
+
+func (s *ListSuite) TestInvalid(c *gc.C) {
+	ctx := context.Background()
+	_, err := s.App.ListInvoices(ctx, db.InvoiceList{InvoiceFilter: db.InvoiceFilter{UserID: s.user.ID}, Sort: "number"})
+	c.Check(errors.IsNotValid(err), jc.IsTrue)
+	_, err = s.App.ListInvoices(ctx, db.InvoiceList{})
+	c.Check(errors.IsNotValid(err), jc.IsTrue)
+	_, err = s.App.ListContacts(ctx, db.ContactList{ContactFilter: db.ContactFilter{UserID: s.user.ID}, Cursor: "e30"})
+	c.Check(errors.IsNotValid(err), jc.IsTrue)
+}
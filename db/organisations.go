@@ -0,0 +1,392 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/juju/errors"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	OrganisationNotFound = errors.New("organisation not found")
+	MemberNotFound       = errors.New("member not found")
+	InvitationNotFound   = errors.New("invitation not found")
+)
+
+// Role is a member's role within an organisation.
+type Role string
+
+const (
+	RoleOwner      Role = "owner"
+	RoleAdmin      Role = "admin"
+	RoleBookkeeper Role = "bookkeeper"
+	RoleReadOnly   Role = "read_only"
+)
+
+// Permission is something a Role may or may not allow.
+type Permission int
+
+const (
+	// PermissionRead allows viewing contacts, invoices and members.
+	PermissionRead Permission = iota
+	// PermissionWrite allows creating, changing and sending contacts and invoices.
+	PermissionWrite
+	// PermissionManageMembers allows inviting, removing and changing the
+	// role of members.
+	PermissionManageMembers
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleOwner:      {PermissionRead, PermissionWrite, PermissionManageMembers},
+	RoleAdmin:      {PermissionRead, PermissionWrite, PermissionManageMembers},
+	RoleBookkeeper: {PermissionRead, PermissionWrite},
+	RoleReadOnly:   {PermissionRead},
+}
+
+// Valid returns true if r is a known role.
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can returns true if the role grants p.
+func (r Role) Can(p Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Organisation owns contacts and invoices on behalf of its members.
+type Organisation struct {
+	ID        string    `json:"id"`
+	Name      string    `firestore:"name" json:"name"`
+	OwnerID   string    `firestore:"owner_id" json:"owner_id"`
+	CreatedAt time.Time `firestore:"created_at" json:"created_at"`
+}
+
+// Member records a user's role in an organisation.
+type Member struct {
+	OrganisationID string    `firestore:"organisation_id" json:"organisation_id"`
+	UserID         string    `firestore:"user_id" json:"user_id"`
+	Email          string    `firestore:"email" json:"email"`
+	Name           string    `firestore:"name" json:"name"`
+	Role           Role      `firestore:"role" json:"role"`
+	JoinedAt       time.Time `firestore:"joined_at" json:"joined_at"`
+}
+
+// Invitation asks the holder of Email to join an organisation. The
+// invitation ID is the secret sent in the email.
+type Invitation struct {
+	ID             string    `json:"id"`
+	OrganisationID string    `firestore:"organisation_id" json:"organisation_id"`
+	Email          string    `firestore:"email" json:"email"`
+	Role           Role      `firestore:"role" json:"role"`
+	InvitedBy      string    `firestore:"invited_by" json:"invited_by"`
+	CreatedAt      time.Time `firestore:"created_at" json:"created_at"`
+	Accepted       bool      `firestore:"accepted" json:"accepted"`
+}
+
+const (
+	organisationsCollection = "organisations"
+	membersCollection       = "members"
+	invitationsCollection   = "invitations"
+)
+
+// NewOrganisation creates an organisation with owner as its only member.
+func (app *App) NewOrganisation(ctx context.Context, name string, owner *User) (*Organisation, error) {
+	org := &Organisation{
+		Name:      name,
+		OwnerID:   owner.ID,
+		CreatedAt: time.Now(),
+	}
+
+	ref := app.firestoreClient.Collection(organisationsCollection).NewDoc()
+	org.ID = ref.ID
+
+	batch := app.firestoreClient.Batch()
+	batch.Create(ref, org)
+	batch.Create(app.memberRef(org.ID, owner.ID), newMember(org.ID, owner, RoleOwner))
+	if _, err := batch.Commit(ctx); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return org, nil
+}
+
+func (app *App) Organisation(ctx context.Context, id string) (*Organisation, error) {
+	var org = new(Organisation)
+
+	doc, err := app.firestoreClient.Collection(organisationsCollection).Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return org, OrganisationNotFound
+	}
+	if err != nil {
+		return org, errors.Trace(err)
+	}
+
+	if err := doc.DataTo(&org); err != nil {
+		return org, errors.Trace(err)
+	}
+
+	org.ID = doc.Ref.ID
+
+	return org, nil
+}
+
+// Member returns the user's membership of the organisation.
+func (app *App) Member(ctx context.Context, orgID, userID string) (*Member, error) {
+	var member = new(Member)
+
+	doc, err := app.memberRef(orgID, userID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return member, MemberNotFound
+	}
+	if err != nil {
+		return member, errors.Trace(err)
+	}
+
+	if err := doc.DataTo(&member); err != nil {
+		return member, errors.Trace(err)
+	}
+
+	return member, nil
+}
+
+func (o *Organisation) Members(ctx context.Context, app *App) ([]Member, error) {
+	members := []Member{}
+
+	iter := app.firestoreClient.Collection(membersCollection).Where("organisation_id", "==", o.ID).Documents(ctx)
+	for {
+		var member = new(Member)
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return members, err
+		}
+
+		if err := doc.DataTo(&member); err != nil {
+			return members, errors.Trace(err)
+		}
+
+		members = append(members, *member)
+	}
+
+	return members, nil
+}
+
+func (o *Organisation) Invoices(ctx context.Context, app *App) ([]Invoice, error) {
+	return app.invoicesForOrganisation(ctx, o.ID)
+}
+
+func (o *Organisation) Contacts(ctx context.Context, app *App) ([]Contact, error) {
+	return app.contactsForOrganisation(ctx, o.ID)
+}
+
+// Invite creates an invitation for email to join the organisation. Nobody can
+// be invited as an owner.
+func (o *Organisation) Invite(
+	ctx context.Context,
+	app *App,
+	email string,
+	role Role,
+	invitedBy string,
+) (*Invitation, error) {
+	if !role.Valid() || role == RoleOwner {
+		return nil, errors.NotValidf("invitation role %q", role)
+	}
+
+	invitation := &Invitation{
+		OrganisationID: o.ID,
+		Email:          strings.ToLower(strings.TrimSpace(email)),
+		Role:           role,
+		InvitedBy:      invitedBy,
+		CreatedAt:      time.Now(),
+	}
+
+	ref, _, err := app.firestoreClient.Collection(invitationsCollection).Add(ctx, invitation)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	invitation.ID = ref.ID
+
+	return invitation, nil
+}
+
+func (app *App) Invitation(ctx context.Context, id string) (*Invitation, error) {
+	var invitation = new(Invitation)
+
+	doc, err := app.firestoreClient.Collection(invitationsCollection).Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return invitation, InvitationNotFound
+	}
+	if err != nil {
+		return invitation, errors.Trace(err)
+	}
+
+	if err := doc.DataTo(&invitation); err != nil {
+		return invitation, errors.Trace(err)
+	}
+
+	invitation.ID = doc.Ref.ID
+
+	return invitation, nil
+}
+
+// Accept makes user a member of the invitation's organisation. The user must
+// be signed in with the address the invitation was sent to.
+func (i *Invitation) Accept(ctx context.Context, app *App, user *User) (*Member, error) {
+	if i.Accepted {
+		return nil, InvitationNotFound
+	}
+	if !strings.EqualFold(strings.TrimSpace(user.Email), i.Email) {
+		return nil, errors.Unauthorizedf("invitation for %s", i.Email)
+	}
+
+	member := newMember(i.OrganisationID, user, i.Role)
+	invitationRef := app.firestoreClient.Collection(invitationsCollection).Doc(i.ID)
+	memberRef := app.memberRef(i.OrganisationID, user.ID)
+
+	err := app.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(invitationRef)
+		if status.Code(err) == codes.NotFound {
+			return InvitationNotFound
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if accepted, _ := doc.DataAt("accepted"); accepted == true {
+			return InvitationNotFound
+		}
+
+		// Existing members keep their role rather than being silently
+		// demoted or promoted by a stale invitation.
+		if _, err := tx.Get(memberRef); err == nil {
+			return errors.AlreadyExistsf("member %s", user.ID)
+		} else if status.Code(err) != codes.NotFound {
+			return errors.Trace(err)
+		}
+
+		if err := tx.Update(invitationRef, []firestore.Update{
+			{Path: "accepted", Value: true},
+		}); err != nil {
+			return errors.Trace(err)
+		}
+		return tx.Create(memberRef, member)
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	i.Accepted = true
+
+	return member, nil
+}
+
+// SetRole changes the member's role. The owner's role is fixed and nobody
+// else can be made owner.
+func (m *Member) SetRole(ctx context.Context, app *App, role Role) error {
+	if !role.Valid() || role == RoleOwner {
+		return errors.NotValidf("member role %q", role)
+	}
+	if m.Role == RoleOwner {
+		return errors.NotValidf("changing the owner's role")
+	}
+
+	_, err := app.memberRef(m.OrganisationID, m.UserID).Update(ctx, []firestore.Update{
+		{Path: "role", Value: role},
+	})
+	if status.Code(err) == codes.NotFound {
+		return MemberNotFound
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	m.Role = role
+
+	return nil
+}
+
+// Remove takes the member out of the organisation. The owner cannot be removed.
+func (m *Member) Remove(ctx context.Context, app *App) error {
+	if m.Role == RoleOwner {
+		return errors.NotValidf("removing the owner")
+	}
+
+	_, err := app.memberRef(m.OrganisationID, m.UserID).Delete(ctx)
+	if status.Code(err) == codes.NotFound {
+		return MemberNotFound
+	}
+
+	return errors.Trace(err)
+}
+
+func (app *App) organisationsForUser(ctx context.Context, userID string) ([]Organisation, error) {
+	organisations := []Organisation{}
+
+	iter := app.firestoreClient.Collection(membersCollection).Where("user_id", "==", userID).Documents(ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return organisations, err
+		}
+
+		orgID, err := doc.DataAt("organisation_id")
+		if err != nil {
+			return organisations, errors.Trace(err)
+		}
+
+		org, err := app.Organisation(ctx, fmt.Sprint(orgID))
+		if err == OrganisationNotFound {
+			continue
+		}
+		if err != nil {
+			return organisations, errors.Trace(err)
+		}
+
+		organisations = append(organisations, *org)
+	}
+
+	return organisations, nil
+}
+
+func (app *App) memberRef(orgID, userID string) *firestore.DocumentRef {
+	return app.firestoreClient.Collection(membersCollection).Doc(orgID + "_" + userID)
+}
+
+func newMember(orgID string, user *User, role Role) *Member {
+	return &Member{
+		OrganisationID: orgID,
+		UserID:         user.ID,
+		Email:          user.Email,
+		Name:           user.FullName(),
+		Role:           role,
+		JoinedAt:       time.Now(),
+	}
+}
+
+func (app *App) OrganisationsDeleteAll(ctx context.Context, batchSize int) error {
+	for _, collection := range []string{
+		organisationsCollection,
+		membersCollection,
+		invitationsCollection,
+	} {
+		if err := app.deleteCollection(ctx, collection, batchSize); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package db_test
+
+import (
+	"context"
+
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/tests/setup"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type OrganisationsSuite struct {
+	setup.ApplicationSuiteCore
+
+	user *db.User
+}
+
+var _ = gc.Suite(&OrganisationsSuite{})
+
+func (s *OrganisationsSuite) SetUpTest(c *gc.C) {
+
+	s.user = s.AddUser(context.Background(), c)
+}
+
+func (s *OrganisationsSuite) TestNewOrganisationAddsOwner(c *gc.C) {
+	ctx := context.Background()
+	org, err := s.App.NewOrganisation(ctx, "Acme", s.user)
+	c.Assert(err, jc.ErrorIsNil)
+
+	getOrg, err := s.App.Organisation(ctx, org.ID)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(getOrg.Name, gc.Equals, "Acme")
+
+	member, err := s.App.Member(ctx, org.ID, s.user.ID)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(member.Role, gc.Equals, db.RoleOwner)
+}
+
+func (s *OrganisationsSuite) TestInviteAndAccept(c *gc.C) {
+	ctx := context.Background()
+	org, err := s.App.NewOrganisation(ctx, "Acme", s.user)
+	c.Assert(err, jc.ErrorIsNil)
+
+	invitee := s.AddUser(ctx, c)
+	invitation, err := org.Invite(ctx, s.App, invitee.Email, db.RoleBookkeeper, s.user.ID)
+	c.Assert(err, jc.ErrorIsNil)
+
+	member, err := invitation.Accept(ctx, s.App, invitee)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(member.Role, gc.Equals, db.RoleBookkeeper)
+
+	members, err := org.Members(ctx, s.App)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(members, gc.HasLen, 2)
+
+	_, err = invitation.Accept(ctx, s.App, invitee)
+	c.Check(err, gc.Equals, db.InvitationNotFound)
+}
+
+func (s *OrganisationsSuite) TestAcceptWrongEmail(c *gc.C) {
+	ctx := context.Background()
+	org, err := s.App.NewOrganisation(ctx, "Acme", s.user)
+	c.Assert(err, jc.ErrorIsNil)
+
+	invitation, err := org.Invite(ctx, s.App, "someone@example.com", db.RoleAdmin, s.user.ID)
+	c.Assert(err, jc.ErrorIsNil)
+
+	other := s.AddUser(ctx, c)
+	_, err = invitation.Accept(ctx, s.App, other)
+	c.Check(err, jc.Satisfies, errors.IsUnauthorized)
+}
+
+func (s *OrganisationsSuite) TestRolePermissions(c *gc.C) {
+	c.Check(db.RoleOwner.Can(db.PermissionManageMembers), jc.IsTrue)
+	c.Check(db.RoleAdmin.Can(db.PermissionManageMembers), jc.IsTrue)
+	c.Check(db.RoleBookkeeper.Can(db.PermissionWrite), jc.IsTrue)
+	c.Check(db.RoleBookkeeper.Can(db.PermissionManageMembers), jc.IsFalse)
+	c.Check(db.RoleReadOnly.Can(db.PermissionRead), jc.IsTrue)
+	c.Check(db.RoleReadOnly.Can(db.PermissionWrite), jc.IsFalse)
+	c.Check(db.Role("guest").Valid(), jc.IsFalse)
+}
@@ -0,0 +1,155 @@
+package db
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+	"github.com/juju/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var BusinessProfileNotFound = errors.New("business profile not found")
+
+// BusinessProfile describes the business that issues a user's invoices. It is
+// stored under the user's ID, so each user has at most one.
+type BusinessProfile struct {
+	UserID              string           `firestore:"user_id" json:"user_id"`
+	TradingName         string           `firestore:"trading_name" json:"trading_name"`
+	LegalName           string           `firestore:"legal_name" json:"legal_name"`
+	TaxNumber           string           `firestore:"tax_number" json:"tax_number"`
+	Address             *Address         `firestore:"address" json:"address"`
+	Phone               string           `firestore:"phone" json:"phone"`
+	Email               string           `firestore:"email" json:"email"`
+	BankAccount         string           `firestore:"bank_account" json:"bank_account"`
+	PaymentInstructions string           `firestore:"payment_instructions" json:"payment_instructions"`
+	LogoID              string           `firestore:"logo_id" json:"logo_id"`
+	Theme               *Theme           `firestore:"theme" json:"theme"`
+	DefaultTemplate     string           `firestore:"default_template" json:"default_template"`
+	Payment             *PaymentSettings `firestore:"payment" json:"payment"`
+	// PeppolID is the business's PEPPOL participant ID as "scheme:id".
+	PeppolID string `firestore:"peppol_id" json:"peppol_id"`
+}
+
+// QRCodeKind is the kind of payment QR code printed on invoices.
+type QRCodeKind string
+
+const (
+	QRCodeNone QRCodeKind = ""
+	// QRCodeEPC is the European Payments Council credit transfer code read
+	// by SEPA banking apps. It needs an IBAN and is always in euros.
+	QRCodeEPC QRCodeKind = "epc"
+	// QRCodeLink encodes PaymentLink, e.g. a card payment page.
+	QRCodeLink QRCodeKind = "link"
+)
+
+// PaymentSettings say how clients should pay the user's invoices.
+type PaymentSettings struct {
+	QRCode QRCodeKind `firestore:"qr_code" json:"qr_code"`
+	IBAN   string     `firestore:"iban" json:"iban"`
+	BIC    string     `firestore:"bic" json:"bic"`
+	// PaymentLink is a URL in which {reference} and {amount} are replaced
+	// with the invoice's payment reference and total.
+	PaymentLink string `firestore:"payment_link" json:"payment_link"`
+	// ReferencePrefix starts every payment reference; it defaults to "INV".
+	ReferencePrefix string `firestore:"reference_prefix" json:"reference_prefix"`
+}
+
+// Theme is the user's choice of colours and font for their PDFs. Colours are
+// "#rrggbb" hex strings; blank values mean the default.
+type Theme struct {
+	AccentColor string `firestore:"accent_color" json:"accent_color"`
+	StripeColor string `firestore:"stripe_color" json:"stripe_color"`
+	HeaderColor string `firestore:"header_color" json:"header_color"`
+	Font        string `firestore:"font" json:"font"`
+}
+
+const profilesCollection = "profiles"
+
+// SetBusinessProfile creates or replaces the profile for profile.UserID.
+func (app *App) SetBusinessProfile(ctx context.Context, profile *BusinessProfile) error {
+	_, err := app.firestoreClient.Collection(profilesCollection).Doc(
+		profile.UserID).Set(ctx, profile)
+
+	return errors.Trace(err)
+}
+
+func (app *App) BusinessProfile(ctx context.Context, userID string) (*BusinessProfile, error) {
+	var profile = new(BusinessProfile)
+
+	doc, err := app.firestoreClient.Collection(profilesCollection).Doc(userID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return profile, BusinessProfileNotFound
+	}
+	if err != nil {
+		return profile, errors.Trace(err)
+	}
+
+	if err := doc.DataTo(&profile); err != nil {
+		return profile, errors.Trace(err)
+	}
+
+	return profile, nil
+}
+
+func (p *BusinessProfile) Delete(ctx context.Context, app *App) error {
+	_, err := app.firestoreClient.Collection(profilesCollection).Doc(p.UserID).Delete(ctx)
+	if status.Code(err) == codes.NotFound {
+		return BusinessProfileNotFound
+	}
+
+	return errors.Trace(err)
+}
+
+// DisplayName returns the name the business trades under, falling back to
+// its legal name.
+func (p BusinessProfile) DisplayName() string {
+	if p.TradingName != "" {
+		return p.TradingName
+	}
+	return p.LegalName
+}
+
+// SetLogo records the storage ID of the profile's logo.
+func (p *BusinessProfile) SetLogo(ctx context.Context, app *App, logoID string) error {
+	p.LogoID = logoID
+
+	return p.update(ctx, app, []firestore.Update{
+		{Path: "logo_id", Value: logoID},
+	})
+}
+
+// SetTheme replaces the profile's theme.
+func (p *BusinessProfile) SetTheme(ctx context.Context, app *App, theme *Theme) error {
+	p.Theme = theme
+
+	return p.update(ctx, app, []firestore.Update{
+		{Path: "theme", Value: theme},
+	})
+}
+
+// SetPaymentSettings replaces the profile's payment settings.
+func (p *BusinessProfile) SetPaymentSettings(ctx context.Context, app *App, settings *PaymentSettings) error {
+	p.Payment = settings
+
+	return p.update(ctx, app, []firestore.Update{
+		{Path: "payment", Value: settings},
+	})
+}
+
+func (p *BusinessProfile) update(ctx context.Context, app *App, updates []firestore.Update) error {
+	_, err := app.firestoreClient.Collection(profilesCollection).Doc(p.UserID).Update(ctx, updates)
+	if status.Code(err) == codes.NotFound {
+		return BusinessProfileNotFound
+	}
+
+	return errors.Trace(err)
+}
+
+func (u User) BusinessProfile(ctx context.Context, app *App) (*BusinessProfile, error) {
+	return app.BusinessProfile(ctx, u.ID)
+}
+
+func (app *App) ProfilesDeleteAll(ctx context.Context, batchSize int) error {
+	return app.deleteCollection(ctx, profilesCollection, batchSize)
+}
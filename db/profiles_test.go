@@ -0,0 +1,43 @@
+package db_test
+
+import (
+	"context"
+
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/tests/setup"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type ProfilesSuite struct {
+	setup.ApplicationSuiteCore
+
+	user *db.User
+}
+
+var _ = gc.Suite(&ProfilesSuite{})
+
+func (s *ProfilesSuite) SetUpTest(c *gc.C) {
+
+	s.user = s.AddUser(context.Background(), c)
+}
+
+func (s *ProfilesSuite) TestProfileSetAndGet(c *gc.C) {
+	ctx := context.Background()
+	profile := s.SetBusinessProfile(ctx, c, s.user.ID)
+
+	getProfile, err := s.App.BusinessProfile(ctx, s.user.ID)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(getProfile, jc.DeepEquals, profile)
+}
+
+func (s *ProfilesSuite) TestProfileDelete(c *gc.C) {
+	ctx := context.Background()
+	profile := s.SetBusinessProfile(ctx, c, s.user.ID)
+
+	c.Assert(profile.Delete(ctx, s.App), jc.ErrorIsNil)
+
+	_, err := s.App.BusinessProfile(ctx, s.user.ID)
+	c.Check(err, gc.Equals, db.BusinessProfileNotFound)
+}
@@ -0,0 +1,391 @@
+package db
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/firestore"
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/search"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Weights of the fields invoices and contacts are found by. A match on an
+// invoice number is almost certainly what was wanted; one in a description
+// might not be.
+const (
+	weightNumber      = 3
+	weightContact     = 2
+	weightDescription = 1
+)
+
+// searchVersionsCollection holds a counter for each owner, bumped whenever
+// anything they can search for changes. Each instance of the platform keeps
+// its own index in memory, and only trusts what it has of an owner while
+// their counter is where it left it, so changes made through other instances
+// are picked up on the next search.
+const searchVersionsCollection = "search_versions"
+
+type searchVersion struct {
+	Version int64 `firestore:"version"`
+}
+
+// searchIndex holds invoices and contacts for Search. It starts empty, and
+// each owner's documents are loaded the first time they search, and again
+// whenever their version shows another instance has changed them; in
+// between, the writes App makes keep it up to date.
+type searchIndex struct {
+	client *firestore.Client
+
+	mu    sync.Mutex
+	index search.Index
+	// versions holds, for each owner whose documents are all in the index,
+	// the version they were loaded at plus the changes made here since.
+	versions map[string]int64
+}
+
+func newSearchIndex(client *firestore.Client) *searchIndex {
+	return &searchIndex{
+		client:   client,
+		index:    search.NewMemory(),
+		versions: map[string]int64{},
+	}
+}
+
+func (s *searchIndex) versionRef(owner string) *firestore.DocumentRef {
+	return s.client.Collection(searchVersionsCollection).Doc(owner)
+}
+
+// version returns the owner's version as stored, which is 0 until anything
+// of theirs changes.
+func (s *searchIndex) version(ctx context.Context, owner string) (int64, error) {
+	doc, err := s.versionRef(owner).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	var v searchVersion
+	if err := doc.DataTo(&v); err != nil {
+		return 0, errors.Trace(err)
+	}
+	return v.Version, nil
+}
+
+// isLoaded reports whether the index has all the owner's documents as of
+// version.
+func (s *searchIndex) isLoaded(owner string, version int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loaded, ok := s.versions[owner]
+	return ok && loaded == version
+}
+
+func (s *searchIndex) setLoaded(owner string, version int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.versions[owner] = version
+}
+
+// forget has the owner loaded afresh on their next search.
+func (s *searchIndex) forget(owner string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.versions, owner)
+}
+
+// changed bumps the owner's version, and the one the index expects if it
+// has them loaded. Should that fail, other instances won't see the change
+// until they next load the owner for another reason.
+func (s *searchIndex) changed(ctx context.Context, owner string) {
+	_, err := s.versionRef(owner).Set(ctx, map[string]interface{}{
+		"version": firestore.Increment(1),
+	}, firestore.MergeAll)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.versions[owner]; ok && err == nil {
+		s.versions[owner] = v + 1
+	} else {
+		delete(s.versions, owner)
+	}
+}
+
+// reset empties the index, for when everything in the database is deleted.
+func (s *searchIndex) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.index = search.NewMemory()
+	s.versions = map[string]int64{}
+}
+
+func (s *searchIndex) current() search.Index {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.index
+}
+
+// put indexes the documents and bumps their owners' versions. Should
+// indexing fail, the owner is loaded afresh on their next search rather than
+// failing the write that has already been made.
+func (s *searchIndex) put(ctx context.Context, docs ...search.Document) {
+	var owners []string
+	seen := map[string]bool{}
+	for _, doc := range docs {
+		if !seen[doc.OwnerID] {
+			seen[doc.OwnerID] = true
+			owners = append(owners, doc.OwnerID)
+		}
+		if err := s.current().Put(ctx, doc); err != nil {
+			s.forget(doc.OwnerID)
+		}
+	}
+	for _, owner := range owners {
+		s.changed(ctx, owner)
+	}
+}
+
+// delete removes the owner's documents and bumps their version, on failure
+// leaving them to be dropped when they next turn up in a search.
+func (s *searchIndex) delete(ctx context.Context, owner, kind string, ids ...string) {
+	for _, id := range ids {
+		_ = s.current().Delete(ctx, kind, id)
+	}
+	s.changed(ctx, owner)
+}
+
+// SearchVersionsDeleteAll deletes every owner's search version.
+func (app *App) SearchVersionsDeleteAll(ctx context.Context, batchSize int) error {
+	return app.deleteCollection(ctx, searchVersionsCollection, batchSize)
+}
+
+func contactDocument(c *Contact) search.Document {
+	return search.Document{
+		Kind:    search.KindContact,
+		ID:      c.ID,
+		OwnerID: c.OwnerID(),
+		Fields:  contactFields(c),
+	}
+}
+
+func contactFields(c *Contact) []search.Field {
+	if c == nil {
+		return nil
+	}
+	return []search.Field{
+		{Name: "name", Text: c.FirstName + " " + c.LastName, Weight: weightContact},
+		{Name: "company", Text: c.Company, Weight: weightContact},
+		{Name: "email", Text: c.Email, Weight: weightContact},
+	}
+}
+
+// invoiceDocument indexes the invoice under who it was billed to, or, for
+// invoices from before that was kept, contact.
+func invoiceDocument(i *Invoice, contact *Contact) search.Document {
+	if i.BillTo != nil {
+		contact = i.BillTo
+	}
+	fields := []search.Field{
+		{
+			Name:   "number",
+			Text:   strconv.Itoa(i.Number) + " " + i.PaymentReference(nil),
+			Weight: weightNumber,
+		},
+		{Name: "description", Text: i.Description, Weight: weightDescription},
+	}
+	return search.Document{
+		Kind:    search.KindInvoice,
+		ID:      i.ID,
+		OwnerID: i.OwnerID(),
+		Fields:  append(fields, contactFields(contact)...),
+	}
+}
+
+// SearchQuery is what App.Search looks for. Exactly one of UserID and
+// OrganisationID must be set.
+type SearchQuery struct {
+	UserID         string
+	OrganisationID string
+	Text           string
+	// Kinds, if set, keeps only search.KindContact or search.KindInvoice
+	// results.
+	Kinds []string
+	// Limit defaults to search.DefaultLimit and is capped at
+	// search.MaxLimit.
+	Limit int
+	// IncludeArchived finds archived contacts too.
+	IncludeArchived bool
+}
+
+func (q SearchQuery) owner() (string, error) {
+	switch {
+	case q.UserID != "" && q.OrganisationID == "":
+		return q.UserID, nil
+	case q.OrganisationID != "" && q.UserID == "":
+		return q.OrganisationID, nil
+	}
+	return "", errors.NotValidf("search without exactly one owner")
+}
+
+// SearchResult is an invoice or contact that matched a search.
+type SearchResult struct {
+	Kind  string  `json:"kind"`
+	Score float64 `json:"score"`
+	// Fields names the fields that matched.
+	Fields  []string `json:"fields"`
+	Contact *Contact `json:"contact,omitempty"`
+	Invoice *Invoice `json:"invoice,omitempty"`
+}
+
+// Search finds the owner's invoices and contacts by invoice number,
+// description, and contact name, company and email, best match first.
+func (app *App) Search(ctx context.Context, q SearchQuery) ([]SearchResult, error) {
+	owner, err := q.owner()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := app.loadSearch(ctx, q); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	kinds, err := normaliseKinds(q.Kinds)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = search.DefaultLimit
+	} else if limit > search.MaxLimit {
+		limit = search.MaxLimit
+	}
+	query := search.Query{OwnerID: owner, Text: q.Text, Kinds: kinds, Limit: limit}
+	if !q.IncludeArchived {
+		// Leave room for the archived contacts dropped below.
+		query.Limit = search.MaxLimit
+	}
+	hits, err := app.search.current().Search(ctx, query)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	results := []SearchResult{}
+	if len(hits) == 0 {
+		return results, nil
+	}
+
+	refs := make([]*firestore.DocumentRef, len(hits))
+	for i, hit := range hits {
+		collection := invoicesCollection
+		if hit.Kind == search.KindContact {
+			collection = contactsCollection
+		}
+		refs[i] = app.firestoreClient.Collection(collection).Doc(hit.ID)
+	}
+	docs, err := app.firestoreClient.GetAll(ctx, refs)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	for i, doc := range docs {
+		hit := hits[i]
+		if !doc.Exists() {
+			// Deleted without the index hearing of it.
+			_ = app.search.current().Delete(ctx, hit.Kind, hit.ID)
+			continue
+		}
+		result := SearchResult{Kind: hit.Kind, Score: hit.Score, Fields: hit.Fields}
+		switch hit.Kind {
+		case search.KindContact:
+			result.Contact = new(Contact)
+			if err := doc.DataTo(result.Contact); err != nil {
+				return nil, errors.Trace(err)
+			}
+			result.Contact.ID = doc.Ref.ID
+			if result.Contact.Archived && !q.IncludeArchived {
+				continue
+			}
+		case search.KindInvoice:
+			result.Invoice = new(Invoice)
+			if err := doc.DataTo(result.Invoice); err != nil {
+				return nil, errors.Trace(err)
+			}
+			result.Invoice.ID = doc.Ref.ID
+		}
+		results = append(results, result)
+		if len(results) == limit {
+			break
+		}
+	}
+
+	return results, nil
+}
+
+// loadSearch indexes all the owner's contacts and invoices, unless they
+// already are.
+func (app *App) loadSearch(ctx context.Context, q SearchQuery) error {
+	owner, err := q.owner()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// The version is read first, so that anything changed while loading
+	// has the owner loaded again next time.
+	version, err := app.search.version(ctx, owner)
+	if err != nil {
+		return errors.Annotate(err, "cannot get search version")
+	}
+	if app.search.isLoaded(owner, version) {
+		return nil
+	}
+
+	// Querying by user also finds what they made for organisations, which
+	// is indexed under the organisation instead.
+	contacts := map[string]*Contact{}
+	err = app.ForEachContact(ctx, ContactFilter{
+		UserID:          q.UserID,
+		OrganisationID:  q.OrganisationID,
+		IncludeArchived: true,
+	}, func(c *Contact) error {
+		if c.OwnerID() != owner {
+			return nil
+		}
+		contacts[c.ID] = c
+		return errors.Trace(app.search.current().Put(ctx, contactDocument(c)))
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	err = app.ForEachInvoice(ctx, InvoiceFilter{
+		UserID:         q.UserID,
+		OrganisationID: q.OrganisationID,
+	}, func(i *Invoice) error {
+		if i.OwnerID() != owner {
+			return nil
+		}
+		return errors.Trace(app.search.current().Put(ctx, invoiceDocument(i, contacts[i.ContactID])))
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	app.search.setLoaded(owner, version)
+	return nil
+}
+
+// normaliseKinds checks kinds are ones Search knows.
+func normaliseKinds(kinds []string) ([]string, error) {
+	var normalised []string
+	for _, kind := range kinds {
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		switch kind {
+		case "":
+			continue
+		case search.KindContact, search.KindInvoice:
+			normalised = append(normalised, kind)
+		default:
+			return nil, errors.NotValidf("search kind %q", kind)
+		}
+	}
+	return normalised, nil
+}
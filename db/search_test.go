@@ -0,0 +1,156 @@
+package db_test
+
+import (
+	"context"
+
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/search"
+	"github.com/wham-invoice/wham-platform/tests/setup"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type SearchSuite struct {
+	setup.ApplicationSuiteCore
+
+	user *db.User
+}
+
+var _ = gc.Suite(&SearchSuite{})
+
+func (s *SearchSuite) SetUpTest(c *gc.C) {
+	s.user = s.AddUser(context.Background(), c)
+}
+
+func (s *SearchSuite) search(c *gc.C, q db.SearchQuery) []db.SearchResult {
+	q.UserID = s.user.ID
+	results, err := s.App.Search(context.Background(), q)
+	c.Assert(err, jc.ErrorIsNil)
+	return results
+}
+
+func (s *SearchSuite) addContact(c *gc.C, first, last, company string) *db.Contact {
+	contact := setup.CreateContact(s.user.ID)
+	contact.FirstName, contact.LastName, contact.Company = first, last, company
+	id, err := s.App.AddContact(context.Background(), &contact)
+	c.Assert(err, jc.ErrorIsNil)
+	contact.ID = id
+	return &contact
+}
+
+func (s *SearchSuite) TestSearch(c *gc.C) {
+	ctx := context.Background()
+	contact := s.addContact(c, "Jane", "Smith", "Smithworks")
+	invoice := setup.CreateInvoice(s.user.ID)
+	invoice.Number = 42
+	invoice.Description = "Website redesign"
+	invoice.ContactID = contact.ID
+	invoice.BillTo = contact.Snapshot()
+	id, err := s.App.AddInvoice(ctx, invoice)
+	c.Assert(err, jc.ErrorIsNil)
+
+	results := s.search(c, db.SearchQuery{Text: "smith"})
+	c.Assert(results, gc.HasLen, 2)
+	kinds := map[string]string{}
+	for _, r := range results {
+		if r.Contact != nil {
+			kinds[r.Kind] = r.Contact.ID
+		} else {
+			kinds[r.Kind] = r.Invoice.ID
+		}
+	}
+	c.Check(kinds, jc.DeepEquals, map[string]string{
+		search.KindContact: contact.ID,
+		search.KindInvoice: id,
+	})
+
+	results = s.search(c, db.SearchQuery{Text: "INV-000042"})
+	c.Assert(results, gc.HasLen, 1)
+	c.Check(results[0].Invoice.Description, gc.Equals, "Website redesign")
+
+	results = s.search(c, db.SearchQuery{Text: "jane", Kinds: []string{"contact"}})
+	c.Assert(results, gc.HasLen, 1)
+	c.Check(results[0].Contact.ID, gc.Equals, contact.ID)
+}
+
+func (s *SearchSuite) TestKeptInSync(c *gc.C) {
+	ctx := context.Background()
+	contact := s.addContact(c, "Jane", "Smith", "")
+	// Load the index before changing anything.
+	c.Assert(s.search(c, db.SearchQuery{Text: "jane"}), gc.HasLen, 1)
+
+	added := s.addContact(c, "Bob", "Brown", "")
+	c.Assert(s.search(c, db.SearchQuery{Text: "bob"}), gc.HasLen, 1)
+
+	contact.LastName = "Jones"
+	c.Assert(contact.Save(ctx, s.App), jc.ErrorIsNil)
+	c.Check(s.search(c, db.SearchQuery{Text: "smith"}), gc.HasLen, 0)
+	c.Check(s.search(c, db.SearchQuery{Text: "jones"}), gc.HasLen, 1)
+
+	c.Assert(added.Delete(ctx, s.App), jc.ErrorIsNil)
+	c.Check(s.search(c, db.SearchQuery{Text: "bob"}), gc.HasLen, 0)
+
+	c.Assert(contact.SetArchived(ctx, s.App, true), jc.ErrorIsNil)
+	c.Check(s.search(c, db.SearchQuery{Text: "jones"}), gc.HasLen, 0)
+	c.Check(s.search(c, db.SearchQuery{Text: "jones", IncludeArchived: true}), gc.HasLen, 1)
+}
+
+// TestOtherInstances checks changes made through another instance of the
+// platform, with its own index, turn up in searches here.
+func (s *SearchSuite) TestOtherInstances(c *gc.C) {
+	ctx := context.Background()
+	contact := s.addContact(c, "Jane", "Smith", "")
+	c.Assert(s.search(c, db.SearchQuery{Text: "jane"}), gc.HasLen, 1)
+
+	other, err := db.Init(ctx)
+	c.Assert(err, jc.ErrorIsNil)
+	defer other.CloseDB()
+	added := setup.CreateContact(s.user.ID)
+	added.FirstName, added.LastName = "Bob", "Brown"
+	_, err = other.AddContact(ctx, &added)
+	c.Assert(err, jc.ErrorIsNil)
+	contact.LastName = "Jones"
+	c.Assert(contact.Save(ctx, other), jc.ErrorIsNil)
+
+	c.Check(s.search(c, db.SearchQuery{Text: "bob"}), gc.HasLen, 1)
+	c.Check(s.search(c, db.SearchQuery{Text: "jones"}), gc.HasLen, 1)
+	c.Check(s.search(c, db.SearchQuery{Text: "smith"}), gc.HasLen, 0)
+}
+
+func (s *SearchSuite) TestMerge(c *gc.C) {
+	ctx := context.Background()
+	survivor := s.addContact(c, "Jane", "Smith", "")
+	duplicate := s.addContact(c, "Jane", "Smith", "Smithworks")
+	invoice := setup.CreateInvoice(s.user.ID)
+	invoice.ContactID = duplicate.ID
+	_, err := s.App.AddInvoice(ctx, invoice)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.search(c, db.SearchQuery{Text: "smithworks"}), gc.HasLen, 2)
+
+	_, err = s.App.MergeContacts(ctx, survivor.ID, []string{duplicate.ID})
+	c.Assert(err, jc.ErrorIsNil)
+
+	results := s.search(c, db.SearchQuery{Text: "smithworks"})
+	c.Assert(results, gc.HasLen, 2)
+	for _, r := range results {
+		if r.Contact != nil {
+			c.Check(r.Contact.ID, gc.Equals, survivor.ID)
+		} else {
+			c.Check(r.Invoice.ContactID, gc.Equals, survivor.ID)
+		}
+	}
+}
+
+func (s *SearchSuite) TestInvalid(c *gc.C) {
+	_, err := s.App.Search(context.Background(), db.SearchQuery{Text: "jane"})
+	c.Check(errors.IsNotValid(err), jc.IsTrue)
+
+	_, err = s.App.Search(context.Background(), db.SearchQuery{
+		UserID: s.user.ID,
+		Text:   "jane",
+		Kinds:  []string{"user"},
+	})
+	c.Check(errors.IsNotValid(err), jc.IsTrue)
+}
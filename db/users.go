@@ -68,6 +68,14 @@ func (u User) Contacts(ctx context.Context, app *App) ([]Contact, error) {
 	return app.contactsForUser(ctx, u.ID)
 }
 
+func (u User) Organisations(ctx context.Context, app *App) ([]Organisation, error) {
+	return app.organisationsForUser(ctx, u.ID)
+}
+
+func (u User) APIKeys(ctx context.Context, app *App) ([]APIKey, error) {
+	return app.apiKeysForUser(ctx, u.ID)
+}
+
 func (u User) Summary(ctx context.Context, app *App) (UserSummary, error) {
 	var summary UserSummary
 	total, paid, err := app.invoiceTotalsForUser(ctx, u.ID)
@@ -0,0 +1,229 @@
+// Package dedupe finds contacts that are probably the same client entered
+// more than once.
+package dedupe
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/wham-invoice/wham-platform/db"
+)
+
+// Reasons two contacts can match.
+const (
+	SameEmail   = "same email"
+	SamePhone   = "same phone"
+	SameCompany = "same company"
+	SimilarName = "similar name"
+)
+
+// NameSimilarity is how alike two names must be, from 0 to 1, to count as
+// the same person.
+const NameSimilarity = 0.8
+
+// Match returns why a and b look like the same contact, or nothing if they
+// don't. A shared email or phone is enough. Names are compared loosely, so
+// "Jon Smith" matches "John Smith" and "Smith, John", but only when the
+// contacts don't give different companies. Contacts that are just a company
+// match on the company name.
+func Match(a, b *db.Contact) []string {
+	var reasons []string
+	if ea := email(a); ea != "" && ea == email(b) {
+		reasons = append(reasons, SameEmail)
+	}
+	if pa := phone(a); pa != "" && pa == phone(b) {
+		reasons = append(reasons, SamePhone)
+	}
+
+	ca, cb := company(a), company(b)
+	na, nb := name(a), name(b)
+	switch {
+	case ca != "" && cb != "" && ca != cb:
+		// Different companies: namesakes aren't enough.
+	case na != "" && nb != "":
+		if similar(na, nb) {
+			if ca != "" && ca == cb {
+				reasons = append(reasons, SameCompany)
+			}
+			reasons = append(reasons, SimilarName)
+		}
+	case na == "" && nb == "" && ca != "" && ca == cb:
+		reasons = append(reasons, SameCompany)
+	}
+	return reasons
+}
+
+// Group is a set of contacts that are probably all the same client.
+type Group struct {
+	Contacts []*db.Contact `json:"contacts"`
+	Matches  []Pair        `json:"matches"`
+}
+
+// Pair says why two contacts in a Group match.
+type Pair struct {
+	A       string   `json:"a"`
+	B       string   `json:"b"`
+	Reasons []string `json:"reasons"`
+}
+
+// Groups compares every pair of contacts and joins matching ones into
+// groups, so a matching b and b matching c puts all three together. Groups
+// are in the order of their first contact, and contacts that match nothing
+// are left out.
+func Groups(contacts []*db.Contact) []Group {
+	parent := make([]int, len(contacts))
+	for i := range parent {
+		parent[i] = i
+	}
+	var root func(int) int
+	root = func(i int) int {
+		if parent[i] != i {
+			parent[i] = root(parent[i])
+		}
+		return parent[i]
+	}
+
+	type match struct {
+		a, b    int
+		reasons []string
+	}
+	var matches []match
+	for i := range contacts {
+		for j := i + 1; j < len(contacts); j++ {
+			reasons := Match(contacts[i], contacts[j])
+			if len(reasons) == 0 {
+				continue
+			}
+			matches = append(matches, match{i, j, reasons})
+			if ri, rj := root(i), root(j); ri != rj {
+				if ri < rj {
+					parent[rj] = ri
+				} else {
+					parent[ri] = rj
+				}
+			}
+		}
+	}
+
+	byRoot := map[int]*Group{}
+	var roots []int
+	for _, m := range matches {
+		r := root(m.a)
+		g, ok := byRoot[r]
+		if !ok {
+			g = &Group{}
+			byRoot[r] = g
+			roots = append(roots, r)
+		}
+		g.Matches = append(g.Matches, Pair{contacts[m.a].ID, contacts[m.b].ID, m.reasons})
+	}
+	for i, c := range contacts {
+		if g, ok := byRoot[root(i)]; ok {
+			g.Contacts = append(g.Contacts, c)
+		}
+	}
+
+	sort.Ints(roots)
+	groups := make([]Group, len(roots))
+	for i, r := range roots {
+		groups[i] = *byRoot[r]
+	}
+	return groups
+}
+
+func email(c *db.Contact) string {
+	return strings.ToLower(strings.TrimSpace(c.Email))
+}
+
+// phone keeps the last eight digits, enough to tell numbers apart while
+// matching +64 9 555 0100 with 09 555 0100. Numbers shorter than six
+// digits are too likely to be placeholders to compare.
+func phone(c *db.Contact) string {
+	var digits []rune
+	for _, r := range c.Phone {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, r)
+		}
+	}
+	if len(digits) < 6 {
+		return ""
+	}
+	if len(digits) > 8 {
+		digits = digits[len(digits)-8:]
+	}
+	return string(digits)
+}
+
+// companySuffixes are left off company names before comparing them.
+var companySuffixes = map[string]bool{
+	"ltd": true, "limited": true, "inc": true, "llc": true, "pty": true,
+	"co": true, "company": true, "corp": true, "gmbh": true, "plc": true,
+}
+
+func company(c *db.Contact) string {
+	words := words(c.Company)
+	for len(words) > 0 && companySuffixes[words[len(words)-1]] {
+		words = words[:len(words)-1]
+	}
+	return strings.Join(words, " ")
+}
+
+// name is the contact's name words sorted, so the same name written
+// "Smith, John" still compares equal.
+func name(c *db.Contact) string {
+	words := words(c.FirstName + " " + c.LastName)
+	sort.Strings(words)
+	return strings.Join(words, " ")
+}
+
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// similar reports whether a and b are within NameSimilarity of each other,
+// as one less the edit distance over the longer length.
+func similar(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	return 1-float64(distance(ra, rb))/float64(longest) >= NameSimilarity
+}
+
+// distance is the Levenshtein distance between a and b.
+func distance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
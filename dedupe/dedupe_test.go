@@ -0,0 +1,91 @@
+package dedupe_test
+
+import (
+	"testing"
+
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/dedupe"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+type dedupeSuite struct{}
+
+var _ = gc.Suite(&dedupeSuite{})
+
+func (s *dedupeSuite) TestMatch(c *gc.C) {
+	for i, test := range []struct {
+		a, b db.Contact
+		want []string
+	}{{
+		a:    db.Contact{FirstName: "Jane", Email: "Jane@Smith.example "},
+		b:    db.Contact{FirstName: "Bob", Email: "jane@smith.example"},
+		want: []string{dedupe.SameEmail},
+	}, {
+		a:    db.Contact{FirstName: "Jane", Phone: "+64 21 555 0100"},
+		b:    db.Contact{FirstName: "Bob", Phone: "021-555-0100"},
+		want: []string{dedupe.SamePhone},
+	}, {
+		a: db.Contact{FirstName: "Jane", Phone: "0"},
+		b: db.Contact{FirstName: "Bob", Phone: "0"},
+	}, {
+		a:    db.Contact{FirstName: "Jon", LastName: "Smith"},
+		b:    db.Contact{FirstName: "John", LastName: "Smith"},
+		want: []string{dedupe.SimilarName},
+	}, {
+		a:    db.Contact{FirstName: "Smith,", LastName: "John"},
+		b:    db.Contact{FirstName: "John", LastName: "Smith", Company: "Acme"},
+		want: []string{dedupe.SimilarName},
+	}, {
+		a:    db.Contact{FirstName: "John", LastName: "Smith", Company: "Acme Ltd"},
+		b:    db.Contact{FirstName: "Jon", LastName: "Smith", Company: "ACME Limited"},
+		want: []string{dedupe.SameCompany, dedupe.SimilarName},
+	}, {
+		a: db.Contact{FirstName: "John", LastName: "Smith", Company: "Acme"},
+		b: db.Contact{FirstName: "John", LastName: "Smith", Company: "Globex"},
+	}, {
+		a: db.Contact{FirstName: "Jane", LastName: "Smith", Company: "Acme"},
+		b: db.Contact{FirstName: "Bob", LastName: "Brown", Company: "Acme"},
+	}, {
+		a:    db.Contact{Company: "Acme Ltd."},
+		b:    db.Contact{Company: "acme"},
+		want: []string{dedupe.SameCompany},
+	}, {
+		a: db.Contact{FirstName: "Ann", LastName: "Lee"},
+		b: db.Contact{FirstName: "Al", LastName: "Lee"},
+	}} {
+		c.Logf("test %d", i)
+		c.Check(dedupe.Match(&test.a, &test.b), jc.DeepEquals, test.want)
+		c.Check(dedupe.Match(&test.b, &test.a), jc.DeepEquals, test.want)
+	}
+}
+
+func (s *dedupeSuite) TestGroups(c *gc.C) {
+	contacts := []*db.Contact{
+		{ID: "a", FirstName: "Jane", LastName: "Smith", Email: "jane@smith.example"},
+		{ID: "b", FirstName: "Bob", LastName: "Brown"},
+		{ID: "c", FirstName: "J", LastName: "Smith", Email: "JANE@smith.example", Phone: "09 555 0100"},
+		{ID: "d", FirstName: "Robert", LastName: "Brown"},
+		{ID: "e", Company: "Smith & Co", Phone: "+64 9 555 0100"},
+		{ID: "f", FirstName: "Bob", LastName: "Browne"},
+	}
+
+	groups := dedupe.Groups(contacts)
+	c.Check(groups, jc.DeepEquals, []dedupe.Group{{
+		Contacts: []*db.Contact{contacts[0], contacts[2], contacts[4]},
+		Matches: []dedupe.Pair{
+			{"a", "c", []string{dedupe.SameEmail}},
+			{"c", "e", []string{dedupe.SamePhone}},
+		},
+	}, {
+		Contacts: []*db.Contact{contacts[1], contacts[5]},
+		Matches:  []dedupe.Pair{{"b", "f", []string{dedupe.SimilarName}}},
+	}})
+
+	c.Check(dedupe.Groups(contacts[:2]), gc.HasLen, 0)
+}
@@ -0,0 +1,96 @@
+package einvoice
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/wham-invoice/wham-platform/db"
+)
+
+// GSTPercent is the rate of GST charged on standard rated invoices.
+const GSTPercent = 15
+
+// exemptionReason explains, as BR-E-10 requires, why an exempt invoice
+// carries no GST.
+const exemptionReason = "Exempt supply under the Goods and Services Tax Act 1985"
+
+// amounts are an invoice's figures in cents, worked out the way EN 16931
+// requires: the line is quantity times the rounded price, and tax is charged
+// on the rounded line. They can differ by a cent from the float totals on
+// db.Invoice, but always add up.
+type amounts struct {
+	// category and percent are the invoice's tax category and rate.
+	category string
+	percent  int
+	quantity string
+	price    int64
+	line     int64
+	tax      int64
+	total    int64
+}
+
+func invoiceAmounts(i *db.Invoice) amounts {
+	quantity := strconv.FormatFloat(float64(i.Hours), 'f', -1, 32)
+	q := float32ToDecimal(i.Hours)
+	price := db.Cents(i.Rate)
+	line := int64(math.Round(q * float64(price)))
+	category, percent := taxCategory(i.TaxTreatment)
+	tax := int64(math.Round(float64(line) * float64(percent) / 100))
+
+	return amounts{
+		category: category,
+		percent:  percent,
+		quantity: quantity,
+		price:    price,
+		line:     line,
+		tax:      tax,
+		total:    line + tax,
+	}
+}
+
+// taxCategory returns the EN 16931 tax category for a tax treatment, and its
+// rate in percent.
+func taxCategory(t db.TaxTreatment) (string, int) {
+	switch t {
+	case db.TaxZeroRated:
+		return taxCategoryZeroRated, 0
+	case db.TaxExempt:
+		return taxCategoryExempt, 0
+	}
+	return taxCategoryStandard, GSTPercent
+}
+
+// float32ToDecimal returns the number the user typed in, rather than its
+// nearest float32, so 33.335 rounds up to 33.34 as they'd expect.
+func float32ToDecimal(f float32) float64 {
+	v, _ := strconv.ParseFloat(strconv.FormatFloat(float64(f), 'f', -1, 32), 64)
+	return v
+}
+
+// formatCents writes an amount with two decimal places, as both UBL and CII
+// expect.
+func formatCents(c int64) string {
+	sign := ""
+	if c < 0 {
+		sign, c = "-", -c
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, c/100, c%100)
+}
+
+// parseCents is the inverse of formatCents, for validation.
+func parseCents(s string) (int64, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(math.Round(v * 100)), nil
+}
+
+func isoDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
@@ -0,0 +1,397 @@
+package einvoice
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+)
+
+const (
+	ciiRSMNS = "urn:un:unece:uncefact:data:standard:CrossIndustryInvoice:100"
+	ciiRAMNS = "urn:un:unece:uncefact:data:standard:ReusableAggregateBusinessInformationEntity:100"
+	ciiUDTNS = "urn:un:unece:uncefact:data:standard:UnqualifiedDataType:100"
+
+	// ciiDateFormat is UN/CEFACT date format 102, CCYYMMDD.
+	ciiDateFormat = "102"
+
+	// Tax registration schemes: a GST number is a fiscal number, not a VAT
+	// identifier.
+	taxRegistrationFiscal = "FC"
+	electronicAddressMail = "EM"
+)
+
+// Profile is a Factur-X (ZUGFeRD 2) conformance level. Each includes
+// everything in the ones before it.
+type Profile string
+
+const (
+	// ProfileMinimum carries just the totals and parties, for booking.
+	ProfileMinimum Profile = "MINIMUM"
+	// ProfileBasicWL adds addresses, tax breakdown and payment details but
+	// still no lines.
+	ProfileBasicWL Profile = "BASIC WL"
+	// ProfileBasic adds invoice lines.
+	ProfileBasic Profile = "BASIC"
+	// ProfileEN16931 is a complete EN 16931 invoice.
+	ProfileEN16931 Profile = "EN 16931"
+)
+
+var profiles = []Profile{ProfileMinimum, ProfileBasicWL, ProfileBasic, ProfileEN16931}
+
+var profileGuidelines = map[Profile]string{
+	ProfileMinimum: "urn:factur-x.eu:1p0:minimum",
+	ProfileBasicWL: "urn:factur-x.eu:1p0:basicwl",
+	ProfileBasic:   "urn:cen.eu:en16931:2017#compliant#urn:factur-x.eu:1p0:basic",
+	ProfileEN16931: "urn:cen.eu:en16931:2017",
+}
+
+// ParseProfile accepts a profile name in any case, with or without spaces,
+// dashes or underscores, so "basic-wl" and "en16931" both work.
+func ParseProfile(s string) (Profile, error) {
+	key := strings.NewReplacer(" ", "", "-", "", "_", "").Replace(strings.ToUpper(s))
+	for _, p := range profiles {
+		if strings.ReplaceAll(string(p), " ", "") == key {
+			return p, nil
+		}
+	}
+	return "", errors.NotValidf("Factur-X profile %q", s)
+}
+
+// GuidelineID identifies the profile in the CII document context.
+func (p Profile) GuidelineID() string {
+	return profileGuidelines[p]
+}
+
+// atLeast reports whether p includes everything in q.
+func (p Profile) atLeast(q Profile) bool {
+	return p.rank() >= q.rank()
+}
+
+func (p Profile) rank() int {
+	for i, q := range profiles {
+		if p == q {
+			return i
+		}
+	}
+	return -1
+}
+
+func profileForGuideline(id string) (Profile, bool) {
+	for p, g := range profileGuidelines {
+		if g == id {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// CIIInvoice is a UN/CEFACT Cross Industry Invoice as Factur-X uses it,
+// restricted to the parts we can fill in. Fields are in schema order.
+type CIIInvoice struct {
+	XMLName     xml.Name       `xml:"rsm:CrossIndustryInvoice"`
+	XMLNSRSM    string         `xml:"xmlns:rsm,attr"`
+	XMLNSRAM    string         `xml:"xmlns:ram,attr"`
+	XMLNSUDT    string         `xml:"xmlns:udt,attr"`
+	GuidelineID string         `xml:"rsm:ExchangedDocumentContext>ram:GuidelineSpecifiedDocumentContextParameter>ram:ID"`
+	Document    CIIDocument    `xml:"rsm:ExchangedDocument"`
+	Transaction CIITransaction `xml:"rsm:SupplyChainTradeTransaction"`
+}
+
+type CIIDate struct {
+	Format string `xml:"format,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type CIIAmount struct {
+	Currency string `xml:"currencyID,attr,omitempty"`
+	Value    string `xml:",chardata"`
+}
+
+type CIIQuantity struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type CIIIdentifier struct {
+	Scheme string `xml:"schemeID,attr,omitempty"`
+	Value  string `xml:",chardata"`
+}
+
+type CIIDocument struct {
+	ID        string  `xml:"ram:ID"`
+	TypeCode  string  `xml:"ram:TypeCode"`
+	IssueDate CIIDate `xml:"ram:IssueDateTime>udt:DateTimeString"`
+}
+
+type CIITransaction struct {
+	Lines      []CIILineItem `xml:"ram:IncludedSupplyChainTradeLineItem"`
+	Agreement  CIIAgreement  `xml:"ram:ApplicableHeaderTradeAgreement"`
+	Delivery   struct{}      `xml:"ram:ApplicableHeaderTradeDelivery"`
+	Settlement CIISettlement `xml:"ram:ApplicableHeaderTradeSettlement"`
+}
+
+type CIILineItem struct {
+	LineID    string      `xml:"ram:AssociatedDocumentLineDocument>ram:LineID"`
+	Name      string      `xml:"ram:SpecifiedTradeProduct>ram:Name"`
+	NetPrice  string      `xml:"ram:SpecifiedLineTradeAgreement>ram:NetPriceProductTradePrice>ram:ChargeAmount"`
+	Quantity  CIIQuantity `xml:"ram:SpecifiedLineTradeDelivery>ram:BilledQuantity"`
+	Tax       CIITradeTax `xml:"ram:SpecifiedLineTradeSettlement>ram:ApplicableTradeTax"`
+	LineTotal string      `xml:"ram:SpecifiedLineTradeSettlement>ram:SpecifiedTradeSettlementLineMonetarySummation>ram:LineTotalAmount"`
+}
+
+type CIIAgreement struct {
+	BuyerReference string   `xml:"ram:BuyerReference,omitempty"`
+	Seller         CIIParty `xml:"ram:SellerTradeParty"`
+	Buyer          CIIParty `xml:"ram:BuyerTradeParty"`
+}
+
+type CIIParty struct {
+	Name              string         `xml:"ram:Name"`
+	Contact           *CIIContact    `xml:"ram:DefinedTradeContact,omitempty"`
+	Address           *CIIAddress    `xml:"ram:PostalTradeAddress,omitempty"`
+	ElectronicAddress *CIIIdentifier `xml:"ram:URIUniversalCommunication>ram:URIID,omitempty"`
+	TaxRegistration   *CIIIdentifier `xml:"ram:SpecifiedTaxRegistration>ram:ID,omitempty"`
+}
+
+type CIIContact struct {
+	PersonName string  `xml:"ram:PersonName,omitempty"`
+	Telephone  *string `xml:"ram:TelephoneUniversalCommunication>ram:CompleteNumber"`
+	Email      *string `xml:"ram:EmailURIUniversalCommunication>ram:URIID"`
+}
+
+type CIIAddress struct {
+	Postcode  string `xml:"ram:PostcodeCode,omitempty"`
+	LineOne   string `xml:"ram:LineOne,omitempty"`
+	LineTwo   string `xml:"ram:LineTwo,omitempty"`
+	CityName  string `xml:"ram:CityName,omitempty"`
+	CountryID string `xml:"ram:CountryID"`
+}
+
+type CIISettlement struct {
+	PaymentReference string               `xml:"ram:PaymentReference,omitempty"`
+	Currency         string               `xml:"ram:InvoiceCurrencyCode"`
+	PaymentMeans     *CIIPaymentMeans     `xml:"ram:SpecifiedTradeSettlementPaymentMeans,omitempty"`
+	Taxes            []CIITradeTax        `xml:"ram:ApplicableTradeTax"`
+	PaymentTerms     *CIIPaymentTerms     `xml:"ram:SpecifiedTradePaymentTerms,omitempty"`
+	Summation        CIIMonetarySummation `xml:"ram:SpecifiedTradeSettlementHeaderMonetarySummation"`
+}
+
+type CIIPaymentMeans struct {
+	TypeCode string `xml:"ram:TypeCode"`
+	Account  string `xml:"ram:PayeePartyCreditorFinancialAccount>ram:ProprietaryID,omitempty"`
+}
+
+// CIITradeTax is a tax breakdown. Lines leave out the amounts.
+type CIITradeTax struct {
+	CalculatedAmount string `xml:"ram:CalculatedAmount,omitempty"`
+	TypeCode         string `xml:"ram:TypeCode"`
+	ExemptionReason  string `xml:"ram:ExemptionReason,omitempty"`
+	BasisAmount      string `xml:"ram:BasisAmount,omitempty"`
+	CategoryCode     string `xml:"ram:CategoryCode"`
+	RatePercent      string `xml:"ram:RateApplicablePercent"`
+}
+
+type CIIPaymentTerms struct {
+	Description string   `xml:"ram:Description,omitempty"`
+	DueDate     *CIIDate `xml:"ram:DueDateDateTime>udt:DateTimeString,omitempty"`
+}
+
+type CIIMonetarySummation struct {
+	LineTotal     string    `xml:"ram:LineTotalAmount,omitempty"`
+	TaxBasisTotal string    `xml:"ram:TaxBasisTotalAmount"`
+	TaxTotal      CIIAmount `xml:"ram:TaxTotalAmount"`
+	GrandTotal    string    `xml:"ram:GrandTotalAmount"`
+	DuePayable    string    `xml:"ram:DuePayableAmount"`
+}
+
+// CII describes the document as a Cross Industry Invoice with as much detail
+// as profile allows. It doesn't check the result; see ValidateCII.
+func CII(d Document, profile Profile) (*CIIInvoice, error) {
+	if d.Invoice == nil || d.Contact == nil || d.User == nil {
+		return nil, errors.NotValidf("document without invoice, user and contact")
+	}
+	if d.Profile == nil {
+		return nil, errors.NotFoundf("business profile")
+	}
+	if profile.rank() < 0 {
+		return nil, errors.NotValidf("Factur-X profile %q", profile)
+	}
+
+	inv, p, contact := d.Invoice, d.Profile, d.Contact
+	currency := d.currency()
+	figures := invoiceAmounts(inv)
+	lineTax := CIITradeTax{
+		TypeCode:     "VAT",
+		CategoryCode: figures.category,
+		RatePercent:  strconv.Itoa(figures.percent),
+	}
+
+	seller := CIIParty{Name: p.LegalName}
+	if seller.Name == "" {
+		seller.Name = p.DisplayName()
+	}
+	if p.TaxNumber != "" {
+		seller.TaxRegistration = &CIIIdentifier{Scheme: taxRegistrationFiscal, Value: p.TaxNumber}
+	}
+	customerName := contact.Company
+	if customerName == "" {
+		customerName = contact.GetFullName()
+	}
+	buyer := CIIParty{Name: customerName}
+
+	doc := &CIIInvoice{
+		XMLNSRSM:    ciiRSMNS,
+		XMLNSRAM:    ciiRAMNS,
+		XMLNSUDT:    ciiUDTNS,
+		GuidelineID: profile.GuidelineID(),
+		Document: CIIDocument{
+			ID:        d.number(),
+			TypeCode:  invoiceTypeCommercial,
+			IssueDate: ciiDate(inv.IssueDate),
+		},
+		Transaction: CIITransaction{
+			Agreement: CIIAgreement{BuyerReference: contact.BuyerReference},
+			Settlement: CIISettlement{
+				Currency: currency,
+				Summation: CIIMonetarySummation{
+					TaxBasisTotal: formatCents(figures.line),
+					TaxTotal:      CIIAmount{Currency: currency, Value: formatCents(figures.tax)},
+					GrandTotal:    formatCents(figures.total),
+					DuePayable:    formatCents(figures.total),
+				},
+			},
+		},
+	}
+
+	if !profile.atLeast(ProfileBasicWL) {
+		// MINIMUM only has room for the seller's country.
+		if address := ciiAddress(p.Address); address != nil {
+			seller.Address = &CIIAddress{CountryID: address.CountryID}
+		}
+		doc.Transaction.Agreement.Seller, doc.Transaction.Agreement.Buyer = seller, buyer
+		return doc, nil
+	}
+
+	seller.Address = ciiAddress(p.Address)
+	seller.ElectronicAddress = electronicAddress(p.PeppolID, p.Email)
+	buyer.Address = ciiAddress(contact.Address)
+	buyer.ElectronicAddress = electronicAddress(contact.PeppolID, contact.Email)
+	if profile.atLeast(ProfileEN16931) {
+		if p.Phone != "" || p.Email != "" {
+			seller.Contact = &CIIContact{Telephone: optional(p.Phone), Email: optional(p.Email)}
+		}
+		buyer.Contact = &CIIContact{
+			PersonName: contact.GetFullName(),
+			Telephone:  optional(contact.Phone),
+			Email:      optional(contact.Email),
+		}
+	}
+	doc.Transaction.Agreement.Seller, doc.Transaction.Agreement.Buyer = seller, buyer
+
+	settlement := &doc.Transaction.Settlement
+	settlement.PaymentReference = inv.PaymentReference(p.Payment)
+	if p.BankAccount != "" {
+		settlement.PaymentMeans = &CIIPaymentMeans{
+			TypeCode: paymentMeansTransfer,
+			Account:  strings.ReplaceAll(p.BankAccount, " ", ""),
+		}
+	}
+	headerTax := lineTax
+	if figures.category == taxCategoryExempt {
+		headerTax.ExemptionReason = exemptionReason
+	}
+	headerTax.CalculatedAmount = formatCents(figures.tax)
+	headerTax.BasisAmount = formatCents(figures.line)
+	settlement.Taxes = []CIITradeTax{headerTax}
+	if terms := paymentTerms(inv, p); !inv.DueDate.IsZero() || terms != "" {
+		settlement.PaymentTerms = &CIIPaymentTerms{Description: terms}
+		if !inv.DueDate.IsZero() {
+			due := ciiDate(inv.DueDate)
+			settlement.PaymentTerms.DueDate = &due
+		}
+	}
+	settlement.Summation.LineTotal = formatCents(figures.line)
+
+	if profile.atLeast(ProfileBasic) {
+		doc.Transaction.Lines = []CIILineItem{{
+			LineID:    "1",
+			Name:      inv.Description,
+			NetPrice:  formatCents(figures.price),
+			Quantity:  CIIQuantity{UnitCode: unitHour, Value: figures.quantity},
+			Tax:       lineTax,
+			LineTotal: formatCents(figures.line),
+		}}
+	}
+
+	return doc, nil
+}
+
+// WriteCII writes the document to w as CII XML for the given Factur-X
+// profile, after checking it follows the rules we know about. A
+// *ValidationError lists any that it breaks.
+func WriteCII(w io.Writer, d Document, profile Profile) error {
+	doc, err := CII(d, profile)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := ValidateCII(doc); err != nil {
+		return errors.Trace(err)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return errors.Trace(err)
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return errors.Annotate(err, "cannot encode CII")
+	}
+	return errors.Trace(enc.Flush())
+}
+
+func ciiDate(t time.Time) CIIDate {
+	if t.IsZero() {
+		return CIIDate{Format: ciiDateFormat}
+	}
+	return CIIDate{Format: ciiDateFormat, Value: t.Format("20060102")}
+}
+
+func ciiAddress(a *db.Address) *CIIAddress {
+	if a == nil {
+		return nil
+	}
+	country, _ := CountryCode(a.Country)
+	return &CIIAddress{
+		Postcode:  a.Postcode,
+		LineOne:   a.FirstLine,
+		LineTwo:   a.SecondLine,
+		CityName:  a.Suburb,
+		CountryID: country,
+	}
+}
+
+// electronicAddress prefers the PEPPOL ID and falls back to email, which
+// Factur-X accepts where PEPPOL does not.
+func electronicAddress(peppolID, email string) *CIIIdentifier {
+	if id, err := ParseParticipantID(peppolID); err == nil {
+		return &CIIIdentifier{Scheme: id.Scheme, Value: id.ID}
+	}
+	if email != "" {
+		return &CIIIdentifier{Scheme: electronicAddressMail, Value: email}
+	}
+	return nil
+}
+
+// optional returns nil for an empty string. encoding/xml only leaves out
+// the parents of nested elements for nil pointers.
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
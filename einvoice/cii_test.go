@@ -0,0 +1,178 @@
+package einvoice_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/einvoice"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type ciiSuite struct{}
+
+var _ = gc.Suite(&ciiSuite{})
+
+var allProfiles = []einvoice.Profile{
+	einvoice.ProfileMinimum,
+	einvoice.ProfileBasicWL,
+	einvoice.ProfileBasic,
+	einvoice.ProfileEN16931,
+}
+
+func (s *ciiSuite) TestGolden(c *gc.C) {
+	for _, profile := range allProfiles {
+		var buf bytes.Buffer
+		c.Assert(einvoice.WriteCII(&buf, fixtureDocument(), profile), jc.ErrorIsNil)
+
+		name := strings.ToLower(strings.ReplaceAll(string(profile), " ", ""))
+		golden := filepath.Join("testdata", "cii-"+name+".golden.xml")
+		if *update {
+			c.Assert(ioutil.WriteFile(golden, buf.Bytes(), 0644), jc.ErrorIsNil)
+		}
+		want, err := ioutil.ReadFile(golden)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(buf.String(), gc.Equals, string(want), gc.Commentf("profile %s", profile))
+	}
+}
+
+func (s *ciiSuite) TestProfileContents(c *gc.C) {
+	minimum, err := einvoice.CII(fixtureDocument(), einvoice.ProfileMinimum)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(minimum.GuidelineID, gc.Equals, "urn:factur-x.eu:1p0:minimum")
+	c.Check(minimum.Transaction.Lines, gc.HasLen, 0)
+	c.Check(minimum.Transaction.Settlement.Taxes, gc.HasLen, 0)
+	c.Check(minimum.Transaction.Agreement.Buyer.Address, gc.IsNil)
+	c.Check(minimum.Transaction.Agreement.Seller.Address, jc.DeepEquals, &einvoice.CIIAddress{CountryID: "NZ"})
+	c.Check(minimum.Transaction.Settlement.Summation.DuePayable, gc.Equals, "1035.00")
+
+	basicWL, err := einvoice.CII(fixtureDocument(), einvoice.ProfileBasicWL)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(basicWL.Transaction.Lines, gc.HasLen, 0)
+	c.Check(basicWL.Transaction.Settlement.Taxes, gc.HasLen, 1)
+	c.Check(basicWL.Transaction.Settlement.PaymentReference, gc.Equals, "INV-000042")
+	c.Check(basicWL.Transaction.Agreement.Buyer.Address.CountryID, gc.Equals, "NZ")
+
+	basic, err := einvoice.CII(fixtureDocument(), einvoice.ProfileBasic)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(basic.Transaction.Lines, gc.HasLen, 1)
+	c.Check(basic.Transaction.Lines[0].LineTotal, gc.Equals, "900.00")
+	c.Check(basic.Transaction.Agreement.Buyer.Contact, gc.IsNil)
+
+	full, err := einvoice.CII(fixtureDocument(), einvoice.ProfileEN16931)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(full.GuidelineID, gc.Equals, "urn:cen.eu:en16931:2017")
+	c.Check(full.Transaction.Agreement.Buyer.Contact.PersonName, gc.Equals, "John Smith")
+}
+
+func (s *ciiSuite) TestElectronicAddressFallsBackToEmail(c *gc.C) {
+	d := fixtureDocument()
+	d.Contact.PeppolID = ""
+
+	doc, err := einvoice.CII(d, einvoice.ProfileEN16931)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(doc.Transaction.Agreement.Buyer.ElectronicAddress, jc.DeepEquals,
+		&einvoice.CIIIdentifier{Scheme: "EM", Value: "john@smith.example"})
+	c.Check(einvoice.ValidateCII(doc), jc.ErrorIsNil)
+}
+
+func (s *ciiSuite) TestValidateTotals(c *gc.C) {
+	for _, profile := range allProfiles {
+		doc, err := einvoice.CII(fixtureDocument(), profile)
+		c.Assert(err, jc.ErrorIsNil)
+		doc.Transaction.Settlement.Summation.GrandTotal = "1000.00"
+
+		err = einvoice.ValidateCII(doc)
+		verr, ok := errors.Cause(err).(*einvoice.ValidationError)
+		c.Assert(ok, jc.IsTrue, gc.Commentf("profile %s: %v", profile, err))
+		c.Check(rules(verr), jc.SameContents, []string{"BR-CO-15", "BR-CO-16"})
+	}
+}
+
+func (s *ciiSuite) TestTaxTreatments(c *gc.C) {
+	for _, treatment := range []db.TaxTreatment{db.TaxZeroRated, db.TaxExempt} {
+		d := fixtureDocument()
+		d.Invoice.TaxTreatment = treatment
+		for _, profile := range allProfiles {
+			doc, err := einvoice.CII(d, profile)
+			c.Assert(err, jc.ErrorIsNil)
+			c.Check(einvoice.ValidateCII(doc), jc.ErrorIsNil, gc.Commentf("%s %s", treatment, profile))
+			c.Check(doc.Transaction.Settlement.Summation.TaxTotal.Value, gc.Equals, "0.00")
+		}
+	}
+}
+
+func (s *ciiSuite) TestValidateLines(c *gc.C) {
+	doc, err := einvoice.CII(fixtureDocument(), einvoice.ProfileBasic)
+	c.Assert(err, jc.ErrorIsNil)
+	doc.Transaction.Lines[0].NetPrice = "100.00"
+
+	verr, ok := einvoice.ValidateCII(doc).(*einvoice.ValidationError)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(rules(verr), jc.SameContents, []string{"BR-24"})
+
+	doc.Transaction.Lines = nil
+	verr, ok = einvoice.ValidateCII(doc).(*einvoice.ValidationError)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(rules(verr), jc.SameContents, []string{"BR-16", "BR-CO-10"})
+}
+
+func (s *ciiSuite) TestMinimumNeedsNoAddresses(c *gc.C) {
+	d := fixtureDocument()
+	d.Contact.Address = nil
+
+	doc, err := einvoice.CII(d, einvoice.ProfileMinimum)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(einvoice.ValidateCII(doc), jc.ErrorIsNil)
+
+	err = einvoice.WriteCII(ioutil.Discard, d, einvoice.ProfileBasicWL)
+	verr, ok := errors.Cause(err).(*einvoice.ValidationError)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(rules(verr), jc.SameContents, []string{"BR-10", "BR-11"})
+}
+
+func (s *ciiSuite) TestUnnumbered(c *gc.C) {
+	d := fixtureDocument()
+	d.Invoice.Number = 0
+
+	err := einvoice.WriteCII(ioutil.Discard, d, einvoice.ProfileMinimum)
+	verr, ok := errors.Cause(err).(*einvoice.ValidationError)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(rules(verr), jc.DeepEquals, []string{"BR-02"})
+}
+
+func (s *ciiSuite) TestValidateUnknownProfile(c *gc.C) {
+	doc, err := einvoice.CII(fixtureDocument(), einvoice.ProfileBasic)
+	c.Assert(err, jc.ErrorIsNil)
+	doc.GuidelineID = "urn:factur-x.eu:1p0:extended"
+
+	verr, ok := einvoice.ValidateCII(doc).(*einvoice.ValidationError)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(rules(verr), jc.DeepEquals, []string{"BR-01"})
+}
+
+func (s *ciiSuite) TestParseProfile(c *gc.C) {
+	for in, want := range map[string]einvoice.Profile{
+		"minimum":  einvoice.ProfileMinimum,
+		"basic-wl": einvoice.ProfileBasicWL,
+		"BASIC WL": einvoice.ProfileBasicWL,
+		"basic":    einvoice.ProfileBasic,
+		"en16931":  einvoice.ProfileEN16931,
+		"EN 16931": einvoice.ProfileEN16931,
+	} {
+		got, err := einvoice.ParseProfile(in)
+		c.Check(err, jc.ErrorIsNil)
+		c.Check(got, gc.Equals, want, gc.Commentf("%q", in))
+	}
+
+	_, err := einvoice.ParseProfile("extended")
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+
+	_, err = einvoice.CII(fixtureDocument(), einvoice.Profile("extended"))
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+}
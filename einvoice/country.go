@@ -0,0 +1,39 @@
+package einvoice
+
+import (
+	"strings"
+)
+
+// countryCodes maps the country names our users type into addresses to ISO
+// 3166-1 alpha-2 codes.
+var countryCodes = map[string]string{
+	"new zealand":    "NZ",
+	"aotearoa":       "NZ",
+	"australia":      "AU",
+	"united kingdom": "GB",
+	"uk":             "GB",
+	"united states":  "US",
+	"usa":            "US",
+	"canada":         "CA",
+	"ireland":        "IE",
+	"germany":        "DE",
+	"france":         "FR",
+	"netherlands":    "NL",
+	"belgium":        "BE",
+	"norway":         "NO",
+	"sweden":         "SE",
+	"denmark":        "DK",
+	"singapore":      "SG",
+	"japan":          "JP",
+}
+
+// CountryCode returns the ISO 3166-1 alpha-2 code for a country written as a
+// name or already as a code, and false if it isn't one we know.
+func CountryCode(country string) (string, bool) {
+	country = strings.TrimSpace(country)
+	if len(country) == 2 {
+		return strings.ToUpper(country), true
+	}
+	code, ok := countryCodes[strings.ToLower(country)]
+	return code, ok
+}
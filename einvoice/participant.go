@@ -0,0 +1,50 @@
+package einvoice
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// ParticipantID identifies a sender or receiver on the PEPPOL network.
+type ParticipantID struct {
+	// Scheme is the ISO 6523 ICD code of the identifier's issuing agency,
+	// e.g. "0088" for GLN, which NZBNs are.
+	Scheme string
+	ID     string
+}
+
+// schemes are the ICD codes PEPPOL accepts for endpoint IDs that our users
+// are likely to have.
+var schemes = map[string]string{
+	"0060": "DUNS",
+	"0088": "GLN / NZBN",
+	"0151": "Australian Business Number",
+	"0192": "Norwegian organisation number",
+	"0208": "Belgian enterprise number",
+	"9930": "German VAT number",
+	"9957": "French VAT number",
+}
+
+var participantIDPattern = regexp.MustCompile(`^[A-Za-z0-9.\-_]{1,50}$`)
+
+// ParseParticipantID parses an ID written as "scheme:id".
+func ParseParticipantID(s string) (ParticipantID, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), ":", 2)
+	if len(parts) != 2 {
+		return ParticipantID{}, errors.NotValidf("PEPPOL ID %q without scheme", s)
+	}
+	if _, ok := schemes[parts[0]]; !ok {
+		return ParticipantID{}, errors.NotValidf("PEPPOL ID scheme %q", parts[0])
+	}
+	if !participantIDPattern.MatchString(parts[1]) {
+		return ParticipantID{}, errors.NotValidf("PEPPOL ID %q", s)
+	}
+	return ParticipantID{Scheme: parts[0], ID: parts[1]}, nil
+}
+
+// String returns the ID as "scheme:id".
+func (p ParticipantID) String() string {
+	return p.Scheme + ":" + p.ID
+}
@@ -0,0 +1,41 @@
+package einvoice_test
+
+import (
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/einvoice"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type participantSuite struct{}
+
+var _ = gc.Suite(&participantSuite{})
+
+func (s *participantSuite) TestParseParticipantID(c *gc.C) {
+	id, err := einvoice.ParseParticipantID("0088:9429041234567")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(id, gc.Equals, einvoice.ParticipantID{Scheme: "0088", ID: "9429041234567"})
+	c.Check(id.String(), gc.Equals, "0088:9429041234567")
+}
+
+func (s *participantSuite) TestParseParticipantIDInvalid(c *gc.C) {
+	for _, id := range []string{"", "9429041234567", "1234:9429041234567", "0088:", "0088:has spaces"} {
+		_, err := einvoice.ParseParticipantID(id)
+		c.Check(err, jc.Satisfies, errors.IsNotValid, gc.Commentf("id %q", id))
+	}
+}
+
+func (s *participantSuite) TestCountryCode(c *gc.C) {
+	for country, want := range map[string]string{
+		"New Zealand": "NZ",
+		" australia ": "AU",
+		"nz":          "NZ",
+	} {
+		code, ok := einvoice.CountryCode(country)
+		c.Check(ok, jc.IsTrue)
+		c.Check(code, gc.Equals, want)
+	}
+	_, ok := einvoice.CountryCode("Atlantis")
+	c.Check(ok, jc.IsFalse)
+}
@@ -0,0 +1,108 @@
+package einvoice_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+// schemaSuite validates the golden files with the published schemas, which
+// cover far more than Validate and ValidateCII do. The schemas aren't
+// vendored, so each test is skipped unless its tools and files are set:
+//
+//	UBL_XSD          the UBL 2.1 maindoc/UBL-Invoice-2.1.xsd
+//	FACTURX_XSD_DIR  the Factur-X XSDs, named *_MINIMUM.xsd, *_BASICWL.xsd and so on
+//	PEPPOL_XSLT      the PEPPOL BIS Billing 3.0 schematrons compiled to XSLT,
+//	                 separated like PATH, e.g. CEN-EN16931-UBL.xslt and PEPPOL-EN16931-UBL.xslt
+//	SAXON_JAR        a Saxon HE jar to run them with
+type schemaSuite struct{}
+
+var _ = gc.Suite(&schemaSuite{})
+
+// schemaFile returns the file named by env, skipping the test if there
+// isn't one.
+func schemaFile(c *gc.C, env string) string {
+	path := os.Getenv(env)
+	if path == "" {
+		c.Skip(env + " not set")
+	}
+	if _, err := os.Stat(path); err != nil {
+		c.Skip(env + " not found: " + err.Error())
+	}
+	return path
+}
+
+func xmllint(c *gc.C, xsd, file string) {
+	if _, err := exec.LookPath("xmllint"); err != nil {
+		c.Skip("xmllint not installed")
+	}
+	out, err := exec.Command("xmllint", "--noout", "--schema", xsd, file).CombinedOutput()
+	c.Check(err, jc.ErrorIsNil, gc.Commentf("%s", out))
+}
+
+func (s *schemaSuite) TestUBLSchema(c *gc.C) {
+	xmllint(c, schemaFile(c, "UBL_XSD"), filepath.Join("testdata", "invoice.golden.xml"))
+}
+
+func (s *schemaSuite) TestFacturXSchemas(c *gc.C) {
+	dir := schemaFile(c, "FACTURX_XSD_DIR")
+	for _, profile := range allProfiles {
+		name := strings.ReplaceAll(string(profile), " ", "")
+		xsds, err := filepath.Glob(filepath.Join(dir, "*_"+name+".xsd"))
+		c.Assert(err, jc.ErrorIsNil)
+		if !c.Check(xsds, gc.HasLen, 1, gc.Commentf("profile %s", profile)) {
+			continue
+		}
+		golden := filepath.Join("testdata", "cii-"+strings.ToLower(name)+".golden.xml")
+		xmllint(c, xsds[0], golden)
+	}
+}
+
+// svrlAssert is a failed assertion in a schematron report.
+type svrlAssert struct {
+	ID       string `xml:"id,attr"`
+	Flag     string `xml:"flag,attr"`
+	Location string `xml:"location,attr"`
+	Text     string `xml:"text"`
+}
+
+func (s *schemaSuite) TestPeppolSchematron(c *gc.C) {
+	if _, err := exec.LookPath("java"); err != nil {
+		c.Skip("java not installed")
+	}
+	saxon := schemaFile(c, "SAXON_JAR")
+	if os.Getenv("PEPPOL_XSLT") == "" {
+		c.Skip("PEPPOL_XSLT not set")
+	}
+	golden := filepath.Join("testdata", "invoice.golden.xml")
+
+	for _, xslt := range filepath.SplitList(os.Getenv("PEPPOL_XSLT")) {
+		out, err := exec.Command("java", "-jar", saxon, "-s:"+golden, "-xsl:"+xslt).Output()
+		c.Assert(err, jc.ErrorIsNil, gc.Commentf("running %s", xslt))
+
+		// Only fatal assertions make an invoice invalid; warnings are advice.
+		dec := xml.NewDecoder(bytes.NewReader(out))
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				break
+			}
+			start, ok := tok.(xml.StartElement)
+			if !ok || start.Name.Local != "failed-assert" {
+				continue
+			}
+			var failed svrlAssert
+			c.Assert(dec.DecodeElement(&failed, &start), jc.ErrorIsNil)
+			if failed.Flag == "fatal" {
+				c.Errorf("%s: [%s] %s at %s", filepath.Base(xslt), failed.ID,
+					strings.TrimSpace(failed.Text), failed.Location)
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package einvoice_test
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/einvoice"
+
+	gc "gopkg.in/check.v1"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+// fixtureDocument returns an invoice with everything PEPPOL needs.
+func fixtureDocument() einvoice.Document {
+	issued := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	return einvoice.Document{
+		Invoice: &db.Invoice{
+			Number:      42,
+			Rate:        120,
+			Hours:       7.5,
+			Description: "Website maintenance",
+			IssueDate:   issued,
+			DueDate:     issued.AddDate(0, 0, 14),
+		},
+		User: &db.User{
+			FirstName: "Jane",
+			LastName:  "Doe",
+		},
+		Profile: &db.BusinessProfile{
+			TradingName:         "Doe Digital",
+			LegalName:           "Doe Digital Limited",
+			TaxNumber:           "123-456-789",
+			Phone:               "021 555 0100",
+			Email:               "jane@doe.example",
+			BankAccount:         "12-3456-7890123-00",
+			PaymentInstructions: "Please use the invoice number as the reference.",
+			PeppolID:            "0088:9429041234567",
+			Address: &db.Address{
+				FirstLine: "1 Queen Street",
+				Suburb:    "Auckland CBD",
+				Postcode:  "1010",
+				Country:   "New Zealand",
+			},
+		},
+		Contact: &db.Contact{
+			FirstName:      "John",
+			LastName:       "Smith",
+			Company:        "Smith & Co",
+			Email:          "john@smith.example",
+			PeppolID:       "0088:9429047654321",
+			BuyerReference: "PO-1234",
+			Address: &db.Address{
+				FirstLine:  "99 Cuba Street",
+				SecondLine: "Level 2",
+				Suburb:     "Te Aro",
+				Postcode:   "6011",
+				Country:    "NZ",
+			},
+		},
+	}
+}
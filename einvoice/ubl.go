@@ -0,0 +1,342 @@
+// Package einvoice turns invoices into structured e-invoices: UBL 2.1 for
+// PEPPOL BIS Billing 3.0 and UN/CEFACT Cross Industry Invoice for Factur-X.
+package einvoice
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+)
+
+const (
+	ublInvoiceNS = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+	ublCACNS     = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	ublCBCNS     = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+
+	// PeppolCustomizationID and PeppolProfileID identify PEPPOL BIS Billing
+	// 3.0 documents.
+	PeppolCustomizationID = "urn:cen.eu:en16931:2017#compliant#urn:fdc:peppol.eu:2017:poacc:billing:3.0"
+	PeppolProfileID       = "urn:fdc:peppol.eu:2017:poacc:billing:01:1.0"
+
+	// Codes from the UNCL and UN/ECE code lists.
+	invoiceTypeCommercial = "380"
+	paymentMeansTransfer  = "30"
+	taxCategoryStandard   = "S"
+	taxCategoryZeroRated  = "Z"
+	taxCategoryExempt     = "E"
+	unitHour              = "HUR"
+)
+
+// Document is everything needed to describe an invoice electronically.
+type Document struct {
+	Invoice *db.Invoice
+	User    *db.User
+	// Profile is required: e-invoices need the issuer's legal details.
+	Profile *db.BusinessProfile
+	Contact *db.Contact
+	// Currency defaults to the invoice's, and then to db.DefaultCurrency.
+	Currency string
+}
+
+// paymentTerms describes when and how the invoice is to be paid: its terms,
+// if it has them, then the issuer's instructions.
+func paymentTerms(inv *db.Invoice, p *db.BusinessProfile) string {
+	var parts []string
+	if inv.PaymentTerms != "" {
+		parts = append(parts, inv.PaymentTerms.String()+".")
+	}
+	if p.PaymentInstructions != "" {
+		parts = append(parts, p.PaymentInstructions)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (d Document) currency() string {
+	switch {
+	case d.Currency != "":
+		return d.Currency
+	case d.Invoice != nil && d.Invoice.Currency != "":
+		return d.Invoice.Currency
+	}
+	return db.DefaultCurrency
+}
+
+// number returns the invoice's number as its document ID. Invoices from
+// before they were numbered have none, which breaks BR-02 rather than
+// sending every one of them as "0".
+func (d Document) number() string {
+	if d.Invoice == nil || d.Invoice.Number <= 0 {
+		return ""
+	}
+	return strconv.Itoa(d.Invoice.Number)
+}
+
+// UBLInvoice is a UBL 2.1 Invoice, restricted to the parts PEPPOL BIS
+// Billing 3.0 uses and we can fill in. Fields are in schema order.
+type UBLInvoice struct {
+	XMLName              xml.Name         `xml:"Invoice"`
+	XMLNS                string           `xml:"xmlns,attr"`
+	XMLNSCAC             string           `xml:"xmlns:cac,attr"`
+	XMLNSCBC             string           `xml:"xmlns:cbc,attr"`
+	CustomizationID      string           `xml:"cbc:CustomizationID"`
+	ProfileID            string           `xml:"cbc:ProfileID"`
+	ID                   string           `xml:"cbc:ID"`
+	IssueDate            string           `xml:"cbc:IssueDate"`
+	DueDate              string           `xml:"cbc:DueDate,omitempty"`
+	InvoiceTypeCode      string           `xml:"cbc:InvoiceTypeCode"`
+	Note                 string           `xml:"cbc:Note,omitempty"`
+	DocumentCurrencyCode string           `xml:"cbc:DocumentCurrencyCode"`
+	BuyerReference       string           `xml:"cbc:BuyerReference,omitempty"`
+	AccountingSupplier   UBLParty         `xml:"cac:AccountingSupplierParty>cac:Party"`
+	AccountingCustomer   UBLParty         `xml:"cac:AccountingCustomerParty>cac:Party"`
+	PaymentMeans         *UBLPaymentMeans `xml:"cac:PaymentMeans,omitempty"`
+	PaymentTerms         string           `xml:"cac:PaymentTerms>cbc:Note,omitempty"`
+	TaxTotal             UBLTaxTotal      `xml:"cac:TaxTotal"`
+	LegalMonetaryTotal   UBLMonetaryTotal `xml:"cac:LegalMonetaryTotal"`
+	InvoiceLines         []UBLInvoiceLine `xml:"cac:InvoiceLine"`
+}
+
+type UBLAmount struct {
+	Currency string `xml:"currencyID,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type UBLQuantity struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type UBLIdentifier struct {
+	Scheme string `xml:"schemeID,attr,omitempty"`
+	Value  string `xml:",chardata"`
+}
+
+type UBLParty struct {
+	EndpointID    *UBLIdentifier     `xml:"cbc:EndpointID,omitempty"`
+	Name          string             `xml:"cac:PartyName>cbc:Name,omitempty"`
+	PostalAddress UBLAddress         `xml:"cac:PostalAddress"`
+	TaxScheme     *UBLPartyTaxScheme `xml:"cac:PartyTaxScheme,omitempty"`
+	LegalName     string             `xml:"cac:PartyLegalEntity>cbc:RegistrationName"`
+	Contact       *UBLContact        `xml:"cac:Contact,omitempty"`
+}
+
+type UBLAddress struct {
+	StreetName           string `xml:"cbc:StreetName,omitempty"`
+	AdditionalStreetName string `xml:"cbc:AdditionalStreetName,omitempty"`
+	CityName             string `xml:"cbc:CityName,omitempty"`
+	PostalZone           string `xml:"cbc:PostalZone,omitempty"`
+	Country              string `xml:"cac:Country>cbc:IdentificationCode"`
+}
+
+type UBLPartyTaxScheme struct {
+	CompanyID string `xml:"cbc:CompanyID"`
+	TaxScheme string `xml:"cac:TaxScheme>cbc:ID"`
+}
+
+type UBLContact struct {
+	Name      string `xml:"cbc:Name,omitempty"`
+	Telephone string `xml:"cbc:Telephone,omitempty"`
+	Email     string `xml:"cbc:ElectronicMail,omitempty"`
+}
+
+type UBLPaymentMeans struct {
+	Code    string `xml:"cbc:PaymentMeansCode"`
+	ID      string `xml:"cbc:PaymentID,omitempty"`
+	Account string `xml:"cac:PayeeFinancialAccount>cbc:ID,omitempty"`
+}
+
+type UBLTaxCategory struct {
+	ID              string `xml:"cbc:ID"`
+	Percent         string `xml:"cbc:Percent"`
+	ExemptionReason string `xml:"cbc:TaxExemptionReason,omitempty"`
+	TaxScheme       string `xml:"cac:TaxScheme>cbc:ID"`
+}
+
+type UBLTaxSubtotal struct {
+	TaxableAmount UBLAmount      `xml:"cbc:TaxableAmount"`
+	TaxAmount     UBLAmount      `xml:"cbc:TaxAmount"`
+	Category      UBLTaxCategory `xml:"cac:TaxCategory"`
+}
+
+type UBLTaxTotal struct {
+	TaxAmount UBLAmount        `xml:"cbc:TaxAmount"`
+	Subtotals []UBLTaxSubtotal `xml:"cac:TaxSubtotal"`
+}
+
+type UBLMonetaryTotal struct {
+	LineExtensionAmount UBLAmount `xml:"cbc:LineExtensionAmount"`
+	TaxExclusiveAmount  UBLAmount `xml:"cbc:TaxExclusiveAmount"`
+	TaxInclusiveAmount  UBLAmount `xml:"cbc:TaxInclusiveAmount"`
+	PayableAmount       UBLAmount `xml:"cbc:PayableAmount"`
+}
+
+type UBLInvoiceLine struct {
+	ID                  string         `xml:"cbc:ID"`
+	InvoicedQuantity    UBLQuantity    `xml:"cbc:InvoicedQuantity"`
+	LineExtensionAmount UBLAmount      `xml:"cbc:LineExtensionAmount"`
+	ItemName            string         `xml:"cac:Item>cbc:Name"`
+	ItemTaxCategory     UBLTaxCategory `xml:"cac:Item>cac:ClassifiedTaxCategory"`
+	Price               UBLAmount      `xml:"cac:Price>cbc:PriceAmount"`
+}
+
+// UBL describes the document as a UBL invoice. It doesn't check the result;
+// see Validate.
+func UBL(d Document) (*UBLInvoice, error) {
+	if d.Invoice == nil || d.Contact == nil || d.User == nil {
+		return nil, errors.NotValidf("document without invoice, user and contact")
+	}
+	if d.Profile == nil {
+		return nil, errors.NotFoundf("business profile")
+	}
+
+	inv, p, contact := d.Invoice, d.Profile, d.Contact
+	currency := d.currency()
+	amount := func(c int64) UBLAmount {
+		return UBLAmount{Currency: currency, Value: formatCents(c)}
+	}
+	figures := invoiceAmounts(inv)
+	lineCategory := UBLTaxCategory{
+		ID:        figures.category,
+		Percent:   strconv.Itoa(figures.percent),
+		TaxScheme: "VAT",
+	}
+	// Exemption reasons belong in the breakdown, not on lines.
+	category := lineCategory
+	if figures.category == taxCategoryExempt {
+		category.ExemptionReason = exemptionReason
+	}
+
+	reference := inv.PaymentReference(p.Payment)
+	buyerReference := contact.BuyerReference
+	if buyerReference == "" {
+		buyerReference = reference
+	}
+
+	supplier := UBLParty{
+		EndpointID:    endpointID(p.PeppolID),
+		Name:          p.DisplayName(),
+		PostalAddress: ublAddress(p.Address),
+		LegalName:     p.LegalName,
+	}
+	if p.TaxNumber != "" {
+		// A GST number is a tax registration (BT-32), not an EU VAT ID.
+		supplier.TaxScheme = &UBLPartyTaxScheme{CompanyID: p.TaxNumber, TaxScheme: "TAX"}
+	}
+	if p.Phone != "" || p.Email != "" {
+		supplier.Contact = &UBLContact{Telephone: p.Phone, Email: p.Email}
+	}
+
+	customerName := contact.Company
+	if customerName == "" {
+		customerName = contact.GetFullName()
+	}
+	customer := UBLParty{
+		EndpointID:    endpointID(contact.PeppolID),
+		Name:          customerName,
+		PostalAddress: ublAddress(contact.Address),
+		LegalName:     customerName,
+		Contact: &UBLContact{
+			Name:      contact.GetFullName(),
+			Telephone: contact.Phone,
+			Email:     contact.Email,
+		},
+	}
+
+	var payment *UBLPaymentMeans
+	if p.BankAccount != "" {
+		payment = &UBLPaymentMeans{
+			Code:    paymentMeansTransfer,
+			ID:      reference,
+			Account: strings.ReplaceAll(p.BankAccount, " ", ""),
+		}
+	}
+
+	return &UBLInvoice{
+		XMLNS:                ublInvoiceNS,
+		XMLNSCAC:             ublCACNS,
+		XMLNSCBC:             ublCBCNS,
+		CustomizationID:      PeppolCustomizationID,
+		ProfileID:            PeppolProfileID,
+		ID:                   d.number(),
+		IssueDate:            isoDate(inv.IssueDate),
+		DueDate:              isoDate(inv.DueDate),
+		InvoiceTypeCode:      invoiceTypeCommercial,
+		DocumentCurrencyCode: currency,
+		BuyerReference:       buyerReference,
+		AccountingSupplier:   supplier,
+		AccountingCustomer:   customer,
+		PaymentMeans:         payment,
+		PaymentTerms:         paymentTerms(inv, p),
+		TaxTotal: UBLTaxTotal{
+			TaxAmount: amount(figures.tax),
+			Subtotals: []UBLTaxSubtotal{{
+				TaxableAmount: amount(figures.line),
+				TaxAmount:     amount(figures.tax),
+				Category:      category,
+			}},
+		},
+		LegalMonetaryTotal: UBLMonetaryTotal{
+			LineExtensionAmount: amount(figures.line),
+			TaxExclusiveAmount:  amount(figures.line),
+			TaxInclusiveAmount:  amount(figures.total),
+			PayableAmount:       amount(figures.total),
+		},
+		InvoiceLines: []UBLInvoiceLine{{
+			ID:                  "1",
+			InvoicedQuantity:    UBLQuantity{UnitCode: unitHour, Value: figures.quantity},
+			LineExtensionAmount: amount(figures.line),
+			ItemName:            inv.Description,
+			ItemTaxCategory:     lineCategory,
+			Price:               amount(figures.price),
+		}},
+	}, nil
+}
+
+// WriteUBL writes the document to w as UBL XML, after checking it follows
+// the PEPPOL rules we know about. A *ValidationError lists any that it
+// breaks.
+func WriteUBL(w io.Writer, d Document) error {
+	doc, err := UBL(d)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := Validate(doc); err != nil {
+		return errors.Trace(err)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return errors.Trace(err)
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return errors.Annotate(err, "cannot encode UBL")
+	}
+	return errors.Trace(enc.Flush())
+}
+
+func endpointID(peppolID string) *UBLIdentifier {
+	id, err := ParseParticipantID(peppolID)
+	if err != nil {
+		return nil
+	}
+	return &UBLIdentifier{Scheme: id.Scheme, Value: id.ID}
+}
+
+func ublAddress(a *db.Address) UBLAddress {
+	if a == nil {
+		return UBLAddress{}
+	}
+	country, _ := CountryCode(a.Country)
+	return UBLAddress{
+		StreetName:           a.FirstLine,
+		AdditionalStreetName: a.SecondLine,
+		CityName:             a.Suburb,
+		PostalZone:           a.Postcode,
+		Country:              country,
+	}
+}
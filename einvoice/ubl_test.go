@@ -0,0 +1,205 @@
+package einvoice_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/einvoice"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type ublSuite struct{}
+
+var _ = gc.Suite(&ublSuite{})
+
+func (s *ublSuite) TestGolden(c *gc.C) {
+	var buf bytes.Buffer
+	c.Assert(einvoice.WriteUBL(&buf, fixtureDocument()), jc.ErrorIsNil)
+
+	golden := filepath.Join("testdata", "invoice.golden.xml")
+	if *update {
+		c.Assert(ioutil.WriteFile(golden, buf.Bytes(), 0644), jc.ErrorIsNil)
+	}
+	want, err := ioutil.ReadFile(golden)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(buf.String(), gc.Equals, string(want))
+}
+
+func (s *ublSuite) TestTotals(c *gc.C) {
+	doc, err := einvoice.UBL(fixtureDocument())
+	c.Assert(err, jc.ErrorIsNil)
+
+	totals := doc.LegalMonetaryTotal
+	c.Check(totals.LineExtensionAmount.Value, gc.Equals, "900.00")
+	c.Check(doc.TaxTotal.TaxAmount.Value, gc.Equals, "135.00")
+	c.Check(totals.PayableAmount, gc.Equals, einvoice.UBLAmount{Currency: "NZD", Value: "1035.00"})
+	c.Check(doc.BuyerReference, gc.Equals, "PO-1234")
+}
+
+func (s *ublSuite) TestRoundsLikeEN16931(c *gc.C) {
+	d := fixtureDocument()
+	d.Invoice.Hours = 1.333
+	d.Invoice.Rate = 33.335
+
+	doc, err := einvoice.UBL(d)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(einvoice.Validate(doc), jc.ErrorIsNil)
+	c.Check(doc.InvoiceLines[0].Price.Value, gc.Equals, "33.34")
+	c.Check(doc.InvoiceLines[0].LineExtensionAmount.Value, gc.Equals, "44.44")
+}
+
+func (s *ublSuite) TestBuyerReferenceDefaultsToPaymentReference(c *gc.C) {
+	d := fixtureDocument()
+	d.Contact.BuyerReference = ""
+
+	doc, err := einvoice.UBL(d)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(doc.BuyerReference, gc.Equals, "INV-000042")
+}
+
+func (s *ublSuite) TestMissingPeppolIDs(c *gc.C) {
+	d := fixtureDocument()
+	d.Profile.PeppolID = ""
+	d.Contact.PeppolID = ""
+	d.Contact.Address.Country = "Atlantis"
+
+	err := einvoice.WriteUBL(ioutil.Discard, d)
+	c.Assert(err, gc.NotNil)
+	verr, ok := errors.Cause(err).(*einvoice.ValidationError)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(rules(verr), jc.SameContents, []string{
+		"PEPPOL-EN16931-R020", "PEPPOL-EN16931-R010", "BR-11",
+	})
+}
+
+func (s *ublSuite) TestValidateTotals(c *gc.C) {
+	doc, err := einvoice.UBL(fixtureDocument())
+	c.Assert(err, jc.ErrorIsNil)
+	doc.LegalMonetaryTotal.TaxInclusiveAmount.Value = "1000.00"
+	doc.LegalMonetaryTotal.PayableAmount.Value = "1000.00"
+	doc.InvoiceLines[0].Price.Currency = "AUD"
+
+	verr, ok := einvoice.Validate(doc).(*einvoice.ValidationError)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(rules(verr), jc.SameContents, []string{"BR-CO-15", "BR-CL-03"})
+}
+
+func (s *ublSuite) TestTaxTreatments(c *gc.C) {
+	d := fixtureDocument()
+	d.Invoice.TaxTreatment = db.TaxZeroRated
+	d.Invoice.Currency = "AUD"
+	d.Invoice.PaymentTerms = "net_14"
+
+	doc, err := einvoice.UBL(d)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(einvoice.Validate(doc), jc.ErrorIsNil)
+	c.Check(doc.DocumentCurrencyCode, gc.Equals, "AUD")
+	c.Check(doc.TaxTotal.TaxAmount, gc.Equals, einvoice.UBLAmount{Currency: "AUD", Value: "0.00"})
+	c.Check(doc.TaxTotal.Subtotals[0].Category.ID, gc.Equals, "Z")
+	c.Check(doc.InvoiceLines[0].ItemTaxCategory.Percent, gc.Equals, "0")
+	c.Check(doc.PaymentTerms, jc.HasPrefix, "Net 14 days. ")
+
+	d.Invoice.TaxTreatment = db.TaxExempt
+	doc, err = einvoice.UBL(d)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(einvoice.Validate(doc), jc.ErrorIsNil)
+	c.Check(doc.TaxTotal.Subtotals[0].Category.ID, gc.Equals, "E")
+	c.Check(doc.InvoiceLines[0].ItemTaxCategory.ExemptionReason, gc.Equals, "")
+
+	doc.TaxTotal.Subtotals[0].Category.ExemptionReason = ""
+	doc.TaxTotal.Subtotals[0].TaxAmount.Value = "1.00"
+	verr, ok := einvoice.Validate(doc).(*einvoice.ValidationError)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(rules(verr), jc.SameContents, []string{"BR-E-09", "BR-E-10", "BR-CO-14"})
+}
+
+func (s *ublSuite) TestUnnumbered(c *gc.C) {
+	d := fixtureDocument()
+	d.Invoice.Number = 0
+
+	doc, err := einvoice.UBL(d)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(doc.ID, gc.Equals, "")
+	verr, ok := einvoice.Validate(doc).(*einvoice.ValidationError)
+	c.Assert(ok, jc.IsTrue)
+	c.Check(rules(verr), jc.DeepEquals, []string{"BR-02"})
+}
+
+func (s *ublSuite) TestValidateRequired(c *gc.C) {
+	verr, ok := einvoice.Validate(&einvoice.UBLInvoice{}).(*einvoice.ValidationError)
+	c.Assert(ok, jc.IsTrue)
+	got := make(map[string]bool)
+	for _, rule := range rules(verr) {
+		got[rule] = true
+	}
+	for _, rule := range []string{"BR-01", "BR-02", "BR-03", "BR-05", "BR-06", "BR-07", "BR-16"} {
+		c.Check(got[rule], jc.IsTrue, gc.Commentf("rule %s", rule))
+	}
+}
+
+// ublInvoiceOrder is the order of the Invoice children we use, from the UBL
+// 2.1 Invoice schema.
+var ublInvoiceOrder = []string{
+	"CustomizationID", "ProfileID", "ID", "IssueDate", "DueDate", "InvoiceTypeCode",
+	"Note", "DocumentCurrencyCode", "BuyerReference", "AccountingSupplierParty",
+	"AccountingCustomerParty", "PaymentMeans", "PaymentTerms", "TaxTotal",
+	"LegalMonetaryTotal", "InvoiceLine",
+}
+
+// TestSchemaOrder checks the document is namespaced and ordered as the UBL
+// schema demands, which the Go structs can't enforce.
+func (s *ublSuite) TestSchemaOrder(c *gc.C) {
+	var buf bytes.Buffer
+	c.Assert(einvoice.WriteUBL(&buf, fixtureDocument()), jc.ErrorIsNil)
+
+	dec := xml.NewDecoder(&buf)
+	depth, last := 0, -1
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, jc.ErrorIsNil)
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 1 {
+				c.Check(t.Name.Space, gc.Equals, "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2")
+				continue
+			}
+			if depth != 2 {
+				continue
+			}
+			pos := indexOf(ublInvoiceOrder, t.Name.Local)
+			c.Assert(pos, gc.Not(gc.Equals), -1, gc.Commentf("unexpected element %s", t.Name.Local))
+			c.Check(pos >= last, jc.IsTrue, gc.Commentf("%s out of order", t.Name.Local))
+			last = pos
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+func rules(err *einvoice.ValidationError) []string {
+	var rules []string
+	for _, v := range err.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
@@ -0,0 +1,309 @@
+package einvoice
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Violation is a broken business rule, identified as in EN 16931 and the
+// PEPPOL BIS Billing 3.0 schematron.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every rule an e-invoice breaks.
+type ValidationError struct {
+	Violations []Violation
+}
+
+// Error is part of the error interface.
+func (e *ValidationError) Error() string {
+	rules := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		rules[i] = fmt.Sprintf("[%s] %s", v.Rule, v.Message)
+	}
+	return "invalid e-invoice: " + strings.Join(rules, "; ")
+}
+
+// Validate checks doc against the subset of the EN 16931 and PEPPOL BIS
+// Billing 3.0 rules that apply to the invoices we produce: mandatory fields,
+// totals that add up and standard rated, zero rated or exempt tax. It returns a *ValidationError
+// if any are broken. It is not a substitute for the UBL schema and the
+// PEPPOL schematron, which the golden files are checked against in tests.
+func Validate(doc *UBLInvoice) error {
+	v := validator{}
+
+	v.require("BR-01", doc.CustomizationID, "specification identifier")
+	v.check("PEPPOL-EN16931-R004", doc.ProfileID == PeppolProfileID,
+		"business process must be %s", PeppolProfileID)
+	v.require("BR-02", doc.ID, "invoice number")
+	v.require("BR-03", doc.IssueDate, "issue date")
+	v.require("BR-04", doc.InvoiceTypeCode, "invoice type code")
+	v.require("BR-05", doc.DocumentCurrencyCode, "currency code")
+	v.check("PEPPOL-EN16931-R003", doc.BuyerReference != "",
+		"a buyer reference or purchase order reference must be provided")
+
+	seller, buyer := doc.AccountingSupplier, doc.AccountingCustomer
+	v.require("BR-06", seller.LegalName, "seller name")
+	v.check("BR-08", seller.PostalAddress != UBLAddress{}, "seller postal address is required")
+	v.check("BR-09", len(seller.PostalAddress.Country) == 2,
+		"seller country code must be an ISO 3166-1 alpha-2 code")
+	v.check("PEPPOL-EN16931-R020", seller.EndpointID != nil, "seller electronic address is required")
+	v.require("BR-07", buyer.LegalName, "buyer name")
+	v.check("BR-10", buyer.PostalAddress != UBLAddress{}, "buyer postal address is required")
+	v.check("BR-11", len(buyer.PostalAddress.Country) == 2,
+		"buyer country code must be an ISO 3166-1 alpha-2 code")
+	v.check("PEPPOL-EN16931-R010", buyer.EndpointID != nil, "buyer electronic address is required")
+
+	v.check("BR-16", len(doc.InvoiceLines) > 0, "at least one invoice line is required")
+	var lineTotal int64
+	for _, line := range doc.InvoiceLines {
+		v.require("BR-21", line.ID, "invoice line identifier")
+		v.require("BR-22", line.InvoicedQuantity.Value, "invoiced quantity")
+		v.require("BR-23", line.InvoicedQuantity.UnitCode, "invoiced quantity unit of measure")
+		v.require("BR-25", line.ItemName, "item name")
+		v.require("BR-26", line.Price.Value, "item net price")
+
+		net := v.amount("BR-24", line.LineExtensionAmount, doc.DocumentCurrencyCode)
+		price := v.amount("BR-26", line.Price, doc.DocumentCurrencyCode)
+		quantity, err := strconv.ParseFloat(line.InvoicedQuantity.Value, 64)
+		if err == nil {
+			v.check("PEPPOL-EN16931-R120", int64(math.Round(quantity*float64(price))) == net,
+				"line %s net amount must be quantity times price", line.ID)
+		}
+		lineTotal += net
+	}
+
+	totals := doc.LegalMonetaryTotal
+	lineExtension := v.amount("BR-12", totals.LineExtensionAmount, doc.DocumentCurrencyCode)
+	taxExclusive := v.amount("BR-13", totals.TaxExclusiveAmount, doc.DocumentCurrencyCode)
+	taxInclusive := v.amount("BR-14", totals.TaxInclusiveAmount, doc.DocumentCurrencyCode)
+	payable := v.amount("BR-15", totals.PayableAmount, doc.DocumentCurrencyCode)
+	tax := v.amount("BR-CO-14", doc.TaxTotal.TaxAmount, doc.DocumentCurrencyCode)
+
+	v.check("BR-CO-10", lineExtension == lineTotal, "sum of line net amounts must equal the line total")
+	v.check("BR-CO-13", taxExclusive == lineExtension,
+		"total without tax must equal the line total, as there are no allowances or charges")
+	v.check("BR-CO-15", taxInclusive == taxExclusive+tax,
+		"total with tax must equal total without tax plus tax")
+	v.check("BR-CO-16", payable == taxInclusive,
+		"amount due must equal total with tax, as nothing is prepaid")
+	v.check("BR-CO-25", payable <= 0 || doc.DueDate != "" || doc.PaymentTerms != "",
+		"a due date or payment terms are required when an amount is due")
+
+	v.check("PEPPOL-EN16931-R053", len(doc.TaxTotal.Subtotals) > 0, "tax breakdown is required")
+	var subtotalTax int64
+	for _, sub := range doc.TaxTotal.Subtotals {
+		taxable := v.amount("BR-45", sub.TaxableAmount, doc.DocumentCurrencyCode)
+		amount := v.amount("BR-46", sub.TaxAmount, doc.DocumentCurrencyCode)
+		subtotalTax += amount
+
+		v.taxBreakdown(taxBreakdown{
+			category:        sub.Category.ID,
+			percent:         sub.Category.Percent,
+			exemptionReason: sub.Category.ExemptionReason,
+			taxable:         taxable,
+			amount:          amount,
+			lineTotal:       lineTotal,
+			sellerTaxID:     seller.TaxScheme != nil,
+		})
+	}
+	v.check("BR-CO-14", tax == subtotalTax, "total tax must equal the sum of tax subtotals")
+
+	if len(v.violations) > 0 {
+		return &ValidationError{Violations: v.violations}
+	}
+	return nil
+}
+
+type validator struct {
+	violations []Violation
+}
+
+func (v *validator) violate(rule, format string, args ...interface{}) {
+	v.violations = append(v.violations, Violation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) check(rule string, ok bool, format string, args ...interface{}) {
+	if !ok {
+		v.violate(rule, format, args...)
+	}
+}
+
+func (v *validator) require(rule, value, what string) {
+	v.check(rule, strings.TrimSpace(value) != "", "%s is required", what)
+}
+
+// amount returns a in cents, recording a violation of rule if it is missing
+// or malformed and of BR-CL-03 if it isn't in the document currency.
+func (v *validator) amount(rule string, a UBLAmount, currency string) int64 {
+	c, err := parseCents(a.Value)
+	if err != nil {
+		v.violate(rule, "amount %q is not a number", a.Value)
+		return 0
+	}
+	if a.Currency != currency {
+		v.violate("BR-CL-03", "amount in %q, not the invoice currency", a.Currency)
+	}
+	return c
+}
+
+// ValidateCII checks a Factur-X document against the EN 16931 rules that
+// its profile carries: MINIMUM and BASIC WL have no lines and MINIMUM no
+// addresses or tax breakdown, so the rules about those only apply from the
+// profile that introduces them. It returns a *ValidationError if any are
+// broken.
+func ValidateCII(doc *CIIInvoice) error {
+	v := validator{}
+
+	profile, ok := profileForGuideline(doc.GuidelineID)
+	if !ok {
+		v.violate("BR-01", "specification identifier %q is not a Factur-X profile", doc.GuidelineID)
+		return &ValidationError{Violations: v.violations}
+	}
+
+	v.require("BR-02", doc.Document.ID, "invoice number")
+	v.require("BR-03", doc.Document.IssueDate.Value, "issue date")
+	v.require("BR-04", doc.Document.TypeCode, "invoice type code")
+
+	settlement := doc.Transaction.Settlement
+	currency := settlement.Currency
+	v.require("BR-05", currency, "currency code")
+
+	seller, buyer := doc.Transaction.Agreement.Seller, doc.Transaction.Agreement.Buyer
+	v.require("BR-06", seller.Name, "seller name")
+	v.require("BR-07", buyer.Name, "buyer name")
+	v.check("BR-09", seller.Address != nil && len(seller.Address.CountryID) == 2,
+		"seller country code must be an ISO 3166-1 alpha-2 code")
+
+	totals := settlement.Summation
+	taxBasis := v.cents("BR-13", totals.TaxBasisTotal)
+	tax := v.cents("BR-CO-14", totals.TaxTotal.Value)
+	grand := v.cents("BR-14", totals.GrandTotal)
+	payable := v.cents("BR-15", totals.DuePayable)
+	v.check("BR-CL-03", totals.TaxTotal.Currency == currency,
+		"tax total in %q, not the invoice currency", totals.TaxTotal.Currency)
+	v.check("BR-CO-15", grand == taxBasis+tax, "total with tax must equal total without tax plus tax")
+	v.check("BR-CO-16", payable == grand, "amount due must equal total with tax, as nothing is prepaid")
+
+	if !profile.atLeast(ProfileBasicWL) {
+		if len(v.violations) > 0 {
+			return &ValidationError{Violations: v.violations}
+		}
+		return nil
+	}
+
+	v.check("BR-08", seller.Address != nil, "seller postal address is required")
+	v.check("BR-10", buyer.Address != nil, "buyer postal address is required")
+	v.check("BR-11", buyer.Address != nil && len(buyer.Address.CountryID) == 2,
+		"buyer country code must be an ISO 3166-1 alpha-2 code")
+
+	lineTotal := v.cents("BR-12", totals.LineTotal)
+	v.check("BR-CO-13", taxBasis == lineTotal,
+		"total without tax must equal the line total, as there are no allowances or charges")
+	terms := settlement.PaymentTerms
+	v.check("BR-CO-25", payable <= 0 || (terms != nil && (terms.DueDate != nil || terms.Description != "")),
+		"a due date or payment terms are required when an amount is due")
+
+	v.check("BR-CO-18", len(settlement.Taxes) > 0, "tax breakdown is required")
+	var breakdownTax int64
+	for _, t := range settlement.Taxes {
+		basis := v.cents("BR-45", t.BasisAmount)
+		amount := v.cents("BR-46", t.CalculatedAmount)
+		breakdownTax += amount
+
+		v.taxBreakdown(taxBreakdown{
+			category:        t.CategoryCode,
+			percent:         t.RatePercent,
+			exemptionReason: t.ExemptionReason,
+			taxable:         basis,
+			amount:          amount,
+			lineTotal:       lineTotal,
+			sellerTaxID:     seller.TaxRegistration != nil,
+		})
+	}
+	v.check("BR-CO-14", tax == breakdownTax, "total tax must equal the sum of the tax breakdown")
+
+	if profile.atLeast(ProfileBasic) {
+		v.check("BR-16", len(doc.Transaction.Lines) > 0, "at least one invoice line is required")
+		var sum int64
+		for _, line := range doc.Transaction.Lines {
+			v.require("BR-21", line.LineID, "invoice line identifier")
+			v.require("BR-22", line.Quantity.Value, "invoiced quantity")
+			v.require("BR-23", line.Quantity.UnitCode, "invoiced quantity unit of measure")
+			v.require("BR-25", line.Name, "item name")
+
+			net := v.cents("BR-24", line.LineTotal)
+			price := v.cents("BR-26", line.NetPrice)
+			if quantity, err := strconv.ParseFloat(line.Quantity.Value, 64); err == nil {
+				v.check("BR-24", int64(math.Round(quantity*float64(price))) == net,
+					"line %s net amount must be quantity times price", line.LineID)
+			}
+			sum += net
+		}
+		v.check("BR-CO-10", lineTotal == sum, "sum of line net amounts must equal the line total")
+	} else {
+		v.check("BR-16", len(doc.Transaction.Lines) == 0, "%s documents carry no lines", profile)
+	}
+
+	if len(v.violations) > 0 {
+		return &ValidationError{Violations: v.violations}
+	}
+	return nil
+}
+
+// taxBreakdown is one tax subtotal of an invoice, in either syntax. As every
+// invoice has a single line, its category covers the whole line total.
+type taxBreakdown struct {
+	category        string
+	percent         string
+	exemptionReason string
+	taxable         int64
+	amount          int64
+	lineTotal       int64
+	sellerTaxID     bool
+}
+
+// taxBreakdown checks t against the rules for its tax category: BR-S-* for
+// standard rated, BR-Z-* for zero rated and BR-E-* for exempt.
+func (v *validator) taxBreakdown(t taxBreakdown) {
+	percent, err := strconv.ParseFloat(t.percent, 64)
+	switch t.category {
+	case taxCategoryStandard:
+		v.check("BR-S-02", t.sellerTaxID, "seller tax registration is required for standard rated invoices")
+		v.check("BR-S-05", err == nil && percent > 0, "standard rate must be greater than zero")
+		v.check("BR-S-08", t.taxable == t.lineTotal,
+			"taxable amount must equal the sum of standard rated lines")
+		v.check("BR-S-09", t.amount == int64(math.Round(float64(t.taxable)*percent/100)),
+			"tax amount must be the taxable amount times the rate")
+	case taxCategoryZeroRated:
+		v.check("BR-Z-02", t.sellerTaxID, "seller tax registration is required for zero rated invoices")
+		v.check("BR-Z-05", err == nil && percent == 0, "zero rate must be zero")
+		v.check("BR-Z-08", t.taxable == t.lineTotal,
+			"taxable amount must equal the sum of zero rated lines")
+		v.check("BR-Z-09", t.amount == 0, "zero rated tax amount must be zero")
+	case taxCategoryExempt:
+		v.check("BR-E-02", t.sellerTaxID, "seller tax registration is required for exempt invoices")
+		v.check("BR-E-05", err == nil && percent == 0, "exempt rate must be zero")
+		v.check("BR-E-08", t.taxable == t.lineTotal,
+			"taxable amount must equal the sum of exempt lines")
+		v.check("BR-E-09", t.amount == 0, "exempt tax amount must be zero")
+		v.require("BR-E-10", t.exemptionReason, "tax exemption reason")
+	default:
+		v.violate("BR-CL-18", "tax category %q is not supported", t.category)
+	}
+}
+
+// cents parses a CII amount, which carries no currency of its own,
+// recording a violation of rule if it is missing or malformed.
+func (v *validator) cents(rule, s string) int64 {
+	c, err := parseCents(s)
+	if err != nil {
+		v.violate(rule, "amount %q is not a number", s)
+		return 0
+	}
+	return c
+}
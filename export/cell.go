@@ -0,0 +1,91 @@
+// Package export writes invoices and contacts as spreadsheets, one row at a
+// time, in CSV or XLSX.
+package export
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// Kind says how a Cell should be written.
+type Kind int
+
+const (
+	KindText Kind = iota
+	// KindNumber is a plain number, written with as few decimals as it
+	// needs.
+	KindNumber
+	// KindMoney is always written with two decimals.
+	KindMoney
+	// KindDate is a calendar date; the time of day is dropped.
+	KindDate
+)
+
+// Cell is one value in a row. The zero Cell is empty text.
+type Cell struct {
+	Kind   Kind
+	Text   string
+	Number float64
+	Date   time.Time
+}
+
+// Text returns a text cell.
+func Text(s string) Cell {
+	return Cell{Kind: KindText, Text: s}
+}
+
+// Number returns a number cell. It takes a float32 because that's what we
+// store, and rounds it to the number the user typed rather than its nearest
+// float32 so 7.3 doesn't export as 7.300000190734863.
+func Number(f float32) Cell {
+	return Cell{Kind: KindNumber, Number: decimal(f)}
+}
+
+// Integer returns a whole number cell.
+func Integer(n int) Cell {
+	return Cell{Kind: KindNumber, Number: float64(n)}
+}
+
+// Money returns an amount rounded to cents.
+func Money(f float32) Cell {
+	return Cell{Kind: KindMoney, Number: math.Round(decimal(f)*100) / 100}
+}
+
+// Date returns a date cell, or an empty one for the zero time.
+func Date(t time.Time) Cell {
+	if t.IsZero() {
+		return Cell{}
+	}
+	return Cell{Kind: KindDate, Date: t}
+}
+
+// Bool returns "yes" or "no".
+func Bool(b bool) Cell {
+	if b {
+		return Text("yes")
+	}
+	return Text("no")
+}
+
+// DateFormat is how dates are written as text, and shown in XLSX.
+const DateFormat = "2006-01-02"
+
+// String formats the cell the same way for every export format that needs
+// text.
+func (c Cell) String() string {
+	switch c.Kind {
+	case KindNumber:
+		return strconv.FormatFloat(c.Number, 'f', -1, 64)
+	case KindMoney:
+		return strconv.FormatFloat(c.Number, 'f', 2, 64)
+	case KindDate:
+		return c.Date.Format(DateFormat)
+	}
+	return c.Text
+}
+
+func decimal(f float32) float64 {
+	v, _ := strconv.ParseFloat(strconv.FormatFloat(float64(f), 'f', -1, 32), 64)
+	return v
+}
@@ -0,0 +1,186 @@
+package export
+
+import (
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+)
+
+// InvoiceRow is an invoice with the contact it is addressed to, which may be
+// nil if the contact has gone.
+type InvoiceRow struct {
+	Invoice *db.Invoice
+	Contact *db.Contact
+}
+
+// InvoiceColumn is a column that can be exported for invoices.
+type InvoiceColumn struct {
+	Key    string
+	Header string
+	value  func(InvoiceRow) Cell
+}
+
+// ContactColumn is a column that can be exported for contacts.
+type ContactColumn struct {
+	Key    string
+	Header string
+	value  func(*db.Contact) Cell
+}
+
+// InvoiceColumns are every invoice column, in the default order.
+var InvoiceColumns = []InvoiceColumn{
+	{"number", "Number", func(r InvoiceRow) Cell { return Integer(r.Invoice.Number) }},
+	{"issue_date", "Issue date", func(r InvoiceRow) Cell { return Date(r.Invoice.IssueDate) }},
+	{"due_date", "Due date", func(r InvoiceRow) Cell { return Date(r.Invoice.DueDate) }},
+	{"status", "Status", func(r InvoiceRow) Cell { return Text(string(r.Invoice.CurrentStatus())) }},
+	{"paid_date", "Paid date", func(r InvoiceRow) Cell { return Date(r.Invoice.PaidDate) }},
+	{"contact", "Contact", func(r InvoiceRow) Cell {
+		if r.Contact == nil {
+			return Text("")
+		}
+		return Text(strings.TrimSpace(r.Contact.GetFullName()))
+	}},
+	{"company", "Company", func(r InvoiceRow) Cell {
+		if r.Contact == nil {
+			return Text("")
+		}
+		return Text(r.Contact.Company)
+	}},
+	{"description", "Description", func(r InvoiceRow) Cell { return Text(r.Invoice.Description) }},
+	{"hours", "Hours", func(r InvoiceRow) Cell { return Number(r.Invoice.Hours) }},
+	{"rate", "Rate", func(r InvoiceRow) Cell { return Money(r.Invoice.Rate) }},
+	{"subtotal", "Subtotal", func(r InvoiceRow) Cell { return Money(r.Invoice.GetSubtotal()) }},
+	{"gst", "GST", func(r InvoiceRow) Cell { return Money(r.Invoice.GetGST()) }},
+	{"total", "Total", func(r InvoiceRow) Cell { return Money(r.Invoice.GetTotal()) }},
+	{"currency", "Currency", func(r InvoiceRow) Cell {
+		if r.Invoice.Currency == "" {
+			return Text(db.DefaultCurrency)
+		}
+		return Text(r.Invoice.Currency)
+	}},
+	{"id", "ID", func(r InvoiceRow) Cell { return Text(r.Invoice.ID) }},
+}
+
+// ContactColumns are every contact column, in the default order.
+var ContactColumns = []ContactColumn{
+	{"first_name", "First name", func(c *db.Contact) Cell { return Text(c.FirstName) }},
+	{"last_name", "Last name", func(c *db.Contact) Cell { return Text(c.LastName) }},
+	{"company", "Company", func(c *db.Contact) Cell { return Text(c.Company) }},
+	{"email", "Email", func(c *db.Contact) Cell { return Text(c.Email) }},
+	{"phone", "Phone", func(c *db.Contact) Cell { return Text(c.Phone) }},
+	{"address_first_line", "Address", func(c *db.Contact) Cell { return Text(address(c).FirstLine) }},
+	{"address_second_line", "Address line 2", func(c *db.Contact) Cell { return Text(address(c).SecondLine) }},
+	{"address_suburb", "Suburb", func(c *db.Contact) Cell { return Text(address(c).Suburb) }},
+	{"address_postcode", "Postcode", func(c *db.Contact) Cell { return Text(address(c).Postcode) }},
+	{"address_country", "Country", func(c *db.Contact) Cell { return Text(address(c).Country) }},
+	{"peppol_id", "PEPPOL ID", func(c *db.Contact) Cell { return Text(c.PeppolID) }},
+	{"buyer_reference", "Buyer reference", func(c *db.Contact) Cell { return Text(c.BuyerReference) }},
+	{"tags", "Tags", func(c *db.Contact) Cell { return Text(strings.Join(c.Tags, ", ")) }},
+	{"id", "ID", func(c *db.Contact) Cell { return Text(c.ID) }},
+}
+
+func address(c *db.Contact) db.Address {
+	if c.Address == nil {
+		return db.Address{}
+	}
+	return *c.Address
+}
+
+// SelectInvoiceColumns returns the named columns in the order given, or all
+// of them if keys is empty.
+func SelectInvoiceColumns(keys []string) ([]InvoiceColumn, error) {
+	if len(keys) == 0 {
+		return InvoiceColumns, nil
+	}
+	columns := make([]InvoiceColumn, len(keys))
+	for i, key := range keys {
+		found := false
+		for _, column := range InvoiceColumns {
+			if column.Key == key {
+				columns[i], found = column, true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.NotValidf("invoice column %q", key)
+		}
+	}
+	return columns, nil
+}
+
+// SelectContactColumns returns the named columns in the order given, or all
+// of them if keys is empty.
+func SelectContactColumns(keys []string) ([]ContactColumn, error) {
+	if len(keys) == 0 {
+		return ContactColumns, nil
+	}
+	columns := make([]ContactColumn, len(keys))
+	for i, key := range keys {
+		found := false
+		for _, column := range ContactColumns {
+			if column.Key == key {
+				columns[i], found = column, true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.NotValidf("contact column %q", key)
+		}
+	}
+	return columns, nil
+}
+
+// InvoiceTable writes invoices to a RowWriter as the chosen columns.
+type InvoiceTable struct {
+	w       RowWriter
+	columns []InvoiceColumn
+}
+
+// NewInvoiceTable writes the header row and returns a table ready for rows.
+func NewInvoiceTable(w RowWriter, columns []InvoiceColumn) (*InvoiceTable, error) {
+	header := make([]Cell, len(columns))
+	for i, column := range columns {
+		header[i] = Text(column.Header)
+	}
+	if err := w.WriteRow(header); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &InvoiceTable{w: w, columns: columns}, nil
+}
+
+// Write writes one invoice.
+func (t *InvoiceTable) Write(r InvoiceRow) error {
+	cells := make([]Cell, len(t.columns))
+	for i, column := range t.columns {
+		cells[i] = column.value(r)
+	}
+	return errors.Trace(t.w.WriteRow(cells))
+}
+
+// ContactTable writes contacts to a RowWriter as the chosen columns.
+type ContactTable struct {
+	w       RowWriter
+	columns []ContactColumn
+}
+
+// NewContactTable writes the header row and returns a table ready for rows.
+func NewContactTable(w RowWriter, columns []ContactColumn) (*ContactTable, error) {
+	header := make([]Cell, len(columns))
+	for i, column := range columns {
+		header[i] = Text(column.Header)
+	}
+	if err := w.WriteRow(header); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &ContactTable{w: w, columns: columns}, nil
+}
+
+// Write writes one contact.
+func (t *ContactTable) Write(c *db.Contact) error {
+	cells := make([]Cell, len(t.columns))
+	for i, column := range t.columns {
+		cells[i] = column.value(c)
+	}
+	return errors.Trace(t.w.WriteRow(cells))
+}
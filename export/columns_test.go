@@ -0,0 +1,77 @@
+package export_test
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/export"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type columnsSuite struct{}
+
+var _ = gc.Suite(&columnsSuite{})
+
+func (s *columnsSuite) TestInvoiceTable(c *gc.C) {
+	columns, err := export.SelectInvoiceColumns([]string{"number", "issue_date", "contact", "status", "total"})
+	c.Assert(err, jc.ErrorIsNil)
+
+	var buf bytes.Buffer
+	table, err := export.NewInvoiceTable(export.NewCSV(&buf), columns)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(table.Write(export.InvoiceRow{
+		Invoice: &db.Invoice{
+			Number:    42,
+			Rate:      120,
+			Hours:     7.5,
+			IssueDate: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC),
+			Status:    db.InvoiceStatusIssued,
+		},
+		Contact: &db.Contact{FirstName: "John", LastName: "Smith"},
+	}), jc.ErrorIsNil)
+	c.Assert(table.Write(export.InvoiceRow{
+		Invoice: &db.Invoice{Number: 43, Paid: true},
+	}), jc.ErrorIsNil)
+
+	c.Check(buf.String(), gc.Equals, ""+
+		"Number,Issue date,Contact,Status,Total\n"+
+		"42,2022-03-01,John Smith,issued,1035.00\n"+
+		"43,,,paid,0.00\n")
+}
+
+func (s *columnsSuite) TestContactTable(c *gc.C) {
+	var buf bytes.Buffer
+	table, err := export.NewContactTable(export.NewCSV(&buf), export.ContactColumns)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(table.Write(&db.Contact{
+		ID:        "c1",
+		FirstName: "John",
+		Email:     "john@smith.example",
+		Address:   &db.Address{Country: "New Zealand"},
+		Tags:      []string{"government", "retainer"},
+	}), jc.ErrorIsNil)
+	c.Assert(table.Write(&db.Contact{ID: "c2", FirstName: "Jane"}), jc.ErrorIsNil)
+
+	c.Check(buf.String(), gc.Equals, ""+
+		"First name,Last name,Company,Email,Phone,Address,Address line 2,Suburb,Postcode,Country,PEPPOL ID,Buyer reference,Tags,ID\n"+
+		"John,,,john@smith.example,,,,,,New Zealand,,,\"government, retainer\",c1\n"+
+		"Jane,,,,,,,,,,,,,c2\n")
+}
+
+func (s *columnsSuite) TestSelectColumns(c *gc.C) {
+	all, err := export.SelectInvoiceColumns(nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(all, gc.HasLen, len(export.InvoiceColumns))
+
+	some, err := export.SelectContactColumns([]string{"email", "first_name"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check([]string{some[0].Key, some[1].Key}, jc.DeepEquals, []string{"email", "first_name"})
+
+	_, err = export.SelectInvoiceColumns([]string{"number", "secret"})
+	c.Check(err, gc.ErrorMatches, `invoice column "secret" not valid`)
+	_, err = export.SelectContactColumns([]string{"oauth"})
+	c.Check(err, gc.ErrorMatches, `contact column "oauth" not valid`)
+}
@@ -0,0 +1,50 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+// NewCSV returns a RowWriter writing RFC 4180 CSV to w. Rows are flushed as
+// they're written, so a long export starts arriving straight away.
+func NewCSV(w io.Writer) RowWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+// WriteRow is part of the RowWriter interface.
+func (w *csvWriter) WriteRow(cells []Cell) error {
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		record[i] = cell.String()
+		if cell.Kind == KindText {
+			record[i] = defuse(record[i])
+		}
+	}
+	if err := w.w.Write(record); err != nil {
+		return errors.Trace(err)
+	}
+	w.w.Flush()
+	return errors.Trace(w.w.Error())
+}
+
+// Close is part of the RowWriter interface.
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	return errors.Trace(w.w.Error())
+}
+
+// defuse stops spreadsheets treating text that came from users, like a
+// contact named "=HYPERLINK(...)", as a formula.
+func defuse(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,65 @@
+package export_test
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/wham-invoice/wham-platform/export"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type csvSuite struct{}
+
+var _ = gc.Suite(&csvSuite{})
+
+func (s *csvSuite) TestFormatting(c *gc.C) {
+	var buf bytes.Buffer
+	w := export.NewCSV(&buf)
+	c.Assert(w.WriteRow([]export.Cell{
+		export.Text("Smith, John"),
+		export.Number(7.3),
+		export.Money(33.335),
+		export.Money(12),
+		export.Date(time.Date(2022, 3, 1, 15, 4, 5, 0, time.UTC)),
+		export.Date(time.Time{}),
+		export.Integer(42),
+	}), jc.ErrorIsNil)
+	c.Assert(w.Close(), jc.ErrorIsNil)
+
+	c.Check(buf.String(), gc.Equals, "\"Smith, John\",7.3,33.34,12.00,2022-03-01,,42\n")
+}
+
+func (s *csvSuite) TestStreams(c *gc.C) {
+	var buf bytes.Buffer
+	w := export.NewCSV(&buf)
+	c.Assert(w.WriteRow([]export.Cell{export.Text("a")}), jc.ErrorIsNil)
+
+	// The row is out before Close.
+	c.Check(buf.String(), gc.Equals, "a\n")
+}
+
+func (s *csvSuite) TestDefusesFormulas(c *gc.C) {
+	var buf bytes.Buffer
+	w := export.NewCSV(&buf)
+	c.Assert(w.WriteRow([]export.Cell{
+		export.Text("=HYPERLINK(\"http://evil\")"),
+		export.Text("@SUM(A1)"),
+		export.Money(-5),
+	}), jc.ErrorIsNil)
+	c.Assert(w.Close(), jc.ErrorIsNil)
+
+	// Only text is touched; negative amounts stay numbers.
+	c.Check(buf.String(), gc.Equals, "\"'=HYPERLINK(\"\"http://evil\"\")\",'@SUM(A1),-5.00\n")
+}
+
+func (s *csvSuite) TestParseFormat(c *gc.C) {
+	for in, want := range map[string]export.Format{"": export.CSV, "CSV": export.CSV, "xlsx": export.XLSX} {
+		got, err := export.ParseFormat(in)
+		c.Check(err, jc.ErrorIsNil)
+		c.Check(got, gc.Equals, want)
+	}
+	_, err := export.ParseFormat("ods")
+	c.Check(err, gc.ErrorMatches, `export format "ods" not valid`)
+}
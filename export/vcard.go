@@ -0,0 +1,34 @@
+package export
+
+import (
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/vcard"
+)
+
+// VCardContentType is the MIME type of vCard files.
+const VCardContentType = "text/vcard; charset=utf-8"
+
+// VCard returns the contact as a vCard.
+func VCard(c *db.Contact) vcard.Card {
+	card := vcard.Card{
+		GivenName:    c.FirstName,
+		FamilyName:   c.LastName,
+		Organisation: c.Company,
+	}
+	if c.Email != "" {
+		card.Emails = []string{c.Email}
+	}
+	if c.Phone != "" {
+		card.Phones = []string{c.Phone}
+	}
+	if c.Address != nil && *c.Address != (db.Address{}) {
+		card.Addresses = []vcard.Address{{
+			Street:     c.Address.FirstLine,
+			Extended:   c.Address.SecondLine,
+			Locality:   c.Address.Suburb,
+			PostalCode: c.Address.Postcode,
+			Country:    c.Address.Country,
+		}}
+	}
+	return card
+}
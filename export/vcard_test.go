@@ -0,0 +1,48 @@
+package export_test
+
+import (
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/export"
+	"github.com/wham-invoice/wham-platform/vcard"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type vcardSuite struct{}
+
+var _ = gc.Suite(&vcardSuite{})
+
+func (s *vcardSuite) TestVCard(c *gc.C) {
+	c.Check(export.VCard(&db.Contact{
+		FirstName: "Jane",
+		LastName:  "Smith",
+		Company:   "Smith & Co",
+		Email:     "jane@smith.example",
+		Phone:     "+64 9 555 0100",
+		Address: &db.Address{
+			FirstLine:  "1 Queen St",
+			SecondLine: "Level 2",
+			Suburb:     "Auckland",
+			Postcode:   "1010",
+			Country:    "New Zealand",
+		},
+	}), jc.DeepEquals, vcard.Card{
+		GivenName:    "Jane",
+		FamilyName:   "Smith",
+		Organisation: "Smith & Co",
+		Emails:       []string{"jane@smith.example"},
+		Phones:       []string{"+64 9 555 0100"},
+		Addresses: []vcard.Address{{
+			Street:     "1 Queen St",
+			Extended:   "Level 2",
+			Locality:   "Auckland",
+			PostalCode: "1010",
+			Country:    "New Zealand",
+		}},
+	})
+
+	c.Check(export.VCard(&db.Contact{Company: "Acme", Address: &db.Address{}}), jc.DeepEquals, vcard.Card{
+		Organisation: "Acme",
+	})
+}
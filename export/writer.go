@@ -0,0 +1,54 @@
+package export
+
+import (
+	"io"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// RowWriter writes a table one row at a time. Nothing is complete until
+// Close returns without error.
+type RowWriter interface {
+	WriteRow(cells []Cell) error
+	Close() error
+}
+
+// Format is a spreadsheet file format.
+type Format string
+
+const (
+	CSV  Format = "csv"
+	XLSX Format = "xlsx"
+)
+
+// ParseFormat returns the format named s, defaulting to CSV.
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(s)) {
+	case "", CSV:
+		return CSV, nil
+	case XLSX:
+		return XLSX, nil
+	}
+	return "", errors.NotValidf("export format %q", s)
+}
+
+// ContentType is the MIME type of files in the format.
+func (f Format) ContentType() string {
+	if f == XLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// NewWriter returns a RowWriter for the format writing to w. sheet names
+// the worksheet, in formats that have them.
+func NewWriter(f Format, w io.Writer, sheet string) (RowWriter, error) {
+	switch f {
+	case CSV:
+		return NewCSV(w), nil
+	case XLSX:
+		return NewXLSX(w, sheet)
+	}
+	return nil, errors.NotValidf("export format %q", f)
+}
@@ -0,0 +1,105 @@
+package export_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"time"
+
+	"github.com/wham-invoice/wham-platform/export"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type xlsxSuite struct{}
+
+var _ = gc.Suite(&xlsxSuite{})
+
+type xlsxSheet struct {
+	Rows []struct {
+		R     string `xml:"r,attr"`
+		Cells []struct {
+			Ref    string `xml:"r,attr"`
+			Type   string `xml:"t,attr"`
+			Style  string `xml:"s,attr"`
+			Value  string `xml:"v"`
+			Inline string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func readXLSX(c *gc.C, data []byte) (map[string][]byte, xlsxSheet) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	c.Assert(err, jc.ErrorIsNil)
+	parts := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		c.Assert(err, jc.ErrorIsNil)
+		parts[f.Name], err = ioutil.ReadAll(rc)
+		c.Assert(err, jc.ErrorIsNil)
+		rc.Close()
+	}
+
+	var sheet xlsxSheet
+	c.Assert(xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &sheet), jc.ErrorIsNil)
+	return parts, sheet
+}
+
+func (s *xlsxSuite) TestWorkbook(c *gc.C) {
+	var buf bytes.Buffer
+	w, err := export.NewXLSX(&buf, "Invoices")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(w.WriteRow([]export.Cell{export.Text("Number"), export.Text("Total"), export.Text("Issued")}), jc.ErrorIsNil)
+	c.Assert(w.WriteRow([]export.Cell{
+		export.Integer(42),
+		export.Money(1035),
+		export.Date(time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)),
+		export.Text("Smith & Co <ltd>"),
+	}), jc.ErrorIsNil)
+	c.Assert(w.Close(), jc.ErrorIsNil)
+
+	parts, sheet := readXLSX(c, buf.Bytes())
+	for _, name := range []string{
+		"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml",
+		"xl/_rels/workbook.xml.rels", "xl/styles.xml",
+	} {
+		c.Check(parts[name], gc.NotNil, gc.Commentf("missing %s", name))
+	}
+	c.Check(string(parts["xl/workbook.xml"]), jc.Contains, `<sheet name="Invoices"`)
+
+	c.Assert(sheet.Rows, gc.HasLen, 2)
+	c.Check(sheet.Rows[0].Cells[1].Inline, gc.Equals, "Total")
+	row := sheet.Rows[1]
+	c.Check(row.R, gc.Equals, "2")
+	c.Check(row.Cells[0].Value, gc.Equals, "42")
+	c.Check(row.Cells[1].Value, gc.Equals, "1035.00")
+	c.Check(row.Cells[1].Style, gc.Equals, "1")
+	// 1 March 2022 is day 44621 counting from 30 December 1899.
+	c.Check(row.Cells[2].Value, gc.Equals, "44621")
+	c.Check(row.Cells[2].Style, gc.Equals, "2")
+	c.Check(row.Cells[3].Ref, gc.Equals, "D2")
+	c.Check(row.Cells[3].Type, gc.Equals, "inlineStr")
+	c.Check(row.Cells[3].Inline, gc.Equals, "Smith & Co <ltd>")
+}
+
+func (s *xlsxSuite) TestManyColumns(c *gc.C) {
+	cells := make([]export.Cell, 30)
+	for i := range cells {
+		cells[i] = export.Integer(i)
+	}
+
+	var buf bytes.Buffer
+	w, err := export.NewXLSX(&buf, "Sheet: [1]")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(w.WriteRow(cells), jc.ErrorIsNil)
+	c.Assert(w.Close(), jc.ErrorIsNil)
+
+	parts, sheet := readXLSX(c, buf.Bytes())
+	c.Check(string(parts["xl/workbook.xml"]), jc.Contains, `<sheet name="Sheet 1"`)
+	refs := sheet.Rows[0].Cells
+	c.Check(refs[25].Ref, gc.Equals, "Z1")
+	c.Check(refs[26].Ref, gc.Equals, "AA1")
+	c.Check(refs[29].Ref, gc.Equals, "AD1")
+}
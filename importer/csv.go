@@ -0,0 +1,216 @@
+package importer
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+)
+
+// Field is a contact field a CSV column can be mapped to.
+type Field struct {
+	Key string
+	// aliases are other headers, normalised, that mean this field.
+	aliases []string
+	set     func(c *db.Contact, v string)
+}
+
+// Fields are every field a column can be mapped to. The keys match the
+// contact export's columns, so an exported file imports without a mapping.
+var Fields = []Field{
+	{"first_name", []string{"firstname", "givenname", "forename"}, func(c *db.Contact, v string) { c.FirstName = v }},
+	{"last_name", []string{"lastname", "surname", "familyname"}, func(c *db.Contact, v string) { c.LastName = v }},
+	{"name", []string{"fullname", "contactname", "contact"}, setName},
+	{"company", []string{"companyname", "organisation", "organization", "business", "businessname"}, func(c *db.Contact, v string) { c.Company = v }},
+	{"email", []string{"emailaddress", "email1"}, func(c *db.Contact, v string) { c.Email = v }},
+	{"phone", []string{"phonenumber", "telephone", "mobile", "tel"}, func(c *db.Contact, v string) { c.Phone = v }},
+	{"address_first_line", []string{"address", "address1", "addressline1", "street"}, func(c *db.Contact, v string) { c.Address.FirstLine = v }},
+	{"address_second_line", []string{"address2", "addressline2"}, func(c *db.Contact, v string) { c.Address.SecondLine = v }},
+	{"address_suburb", []string{"suburb", "city", "town"}, func(c *db.Contact, v string) { c.Address.Suburb = v }},
+	{"address_postcode", []string{"postcode", "postalcode", "zip", "zipcode"}, func(c *db.Contact, v string) { c.Address.Postcode = v }},
+	{"address_country", []string{"country"}, func(c *db.Contact, v string) { c.Address.Country = v }},
+	{"peppol_id", []string{"peppol", "peppolid"}, func(c *db.Contact, v string) { c.PeppolID = v }},
+	{"buyer_reference", []string{"buyerreference", "reference", "ponumber"}, func(c *db.Contact, v string) { c.BuyerReference = v }},
+	{"tags", []string{"tag", "groups", "group", "categories"}, setTags},
+}
+
+// setTags reads tags separated by commas or semicolons. They are normalised
+// when the row is checked.
+func setTags(c *db.Contact, v string) {
+	c.Tags = append(c.Tags, strings.FieldsFunc(v, func(r rune) bool {
+		return r == ',' || r == ';'
+	})...)
+}
+
+// setName splits a full name into first and last names at the last space,
+// unless they have their own columns.
+func setName(c *db.Contact, v string) {
+	if c.FirstName != "" || c.LastName != "" {
+		return
+	}
+	if i := strings.LastIndexByte(v, ' '); i >= 0 {
+		c.FirstName, c.LastName = strings.TrimSpace(v[:i]), v[i+1:]
+		return
+	}
+	c.FirstName = v
+}
+
+func field(key string) (Field, bool) {
+	for _, f := range Fields {
+		if f.Key == key {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// Mapping maps CSV headers to field keys. Columns it doesn't mention are
+// ignored.
+type Mapping map[string]string
+
+// GuessMapping maps the headers that look like a field's key or one of its
+// usual names, ignoring case, spaces and punctuation.
+func GuessMapping(header []string) Mapping {
+	known := map[string]string{}
+	for _, f := range Fields {
+		known[normalise(f.Key)] = f.Key
+		for _, alias := range f.aliases {
+			known[alias] = f.Key
+		}
+	}
+
+	mapping := Mapping{}
+	used := map[string]bool{}
+	for _, h := range header {
+		key, ok := known[normalise(h)]
+		if !ok || used[key] {
+			continue
+		}
+		mapping[h] = key
+		used[key] = true
+	}
+	return mapping
+}
+
+func normalise(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
+
+// ReadCSV reads contacts from CSV with a header row. A nil mapping is
+// guessed from the header. Each data row becomes a Row, checked but not yet
+// compared with existing contacts.
+func ReadCSV(r io.Reader, mapping Mapping) ([]Row, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.NotValidf("empty CSV file")
+	}
+	if err != nil {
+		return nil, errors.NewNotValid(err, "cannot read CSV header")
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	if mapping == nil {
+		mapping = GuessMapping(header)
+	}
+
+	columns, err := mapColumns(header, mapping)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var rows []Row
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, errors.NewNotValid(err, "cannot read CSV")
+		}
+		line, _ := cr.FieldPos(0)
+		if blank(record) {
+			continue
+		}
+		if len(rows) == MaxRows {
+			return nil, errors.NotValidf("more than %d contacts", MaxRows)
+		}
+
+		row := Row{Line: line, Contact: &db.Contact{Address: &db.Address{}}}
+		for _, col := range columns {
+			if col.index < len(record) {
+				if v := strings.TrimSpace(record[col.index]); v != "" {
+					col.field.set(row.Contact, v)
+				}
+			}
+		}
+		if !hasAddress(row.Contact.Address) {
+			row.Contact.Address = nil
+		}
+		row.check()
+		rows = append(rows, row)
+	}
+}
+
+type column struct {
+	index int
+	field Field
+}
+
+// mapColumns works out which field each column fills, refusing mappings
+// that name headers or fields that don't exist.
+func mapColumns(header []string, mapping Mapping) ([]column, error) {
+	index := map[string]int{}
+	for i, h := range header {
+		if _, ok := index[h]; !ok {
+			index[h] = i
+		}
+	}
+
+	var columns []column
+	for h, key := range mapping {
+		i, ok := index[h]
+		if !ok {
+			return nil, errors.NotValidf("mapped column %q not in file", h)
+		}
+		f, ok := field(key)
+		if !ok {
+			return nil, errors.NotValidf("contact field %q", key)
+		}
+		columns = append(columns, column{i, f})
+	}
+	if len(columns) == 0 {
+		return nil, errors.NotValidf("no columns mapped to contact fields")
+	}
+	// Full names go last so they don't override first and last names.
+	sort.Slice(columns, func(i, j int) bool {
+		iName, jName := columns[i].field.Key == "name", columns[j].field.Key == "name"
+		if iName != jName {
+			return jName
+		}
+		return columns[i].index < columns[j].index
+	})
+	return columns, nil
+}
+
+func blank(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
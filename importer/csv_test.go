@@ -0,0 +1,144 @@
+package importer_test
+
+import (
+	"strings"
+
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/dedupe"
+	"github.com/wham-invoice/wham-platform/importer"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type csvSuite struct{}
+
+var _ = gc.Suite(&csvSuite{})
+
+func (s *csvSuite) TestGuessedMapping(c *gc.C) {
+	rows, err := importer.ReadCSV(strings.NewReader("\ufeff"+
+		"Full Name,E-mail Address,Company Name,Street,City,Zip,Notes\n"+
+		"Jane Q. Smith,jane@smith.example,Smith & Co,1 Queen St,Auckland,1010,ignored\n"+
+		",,,,,,\n"+
+		"\"Bob\",,,,,,\n",
+	), nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(rows, jc.DeepEquals, []importer.Row{{
+		Line: 2,
+		Contact: &db.Contact{
+			FirstName: "Jane Q.",
+			LastName:  "Smith",
+			Email:     "jane@smith.example",
+			Company:   "Smith & Co",
+			Address: &db.Address{
+				FirstLine: "1 Queen St",
+				Suburb:    "Auckland",
+				Postcode:  "1010",
+			},
+		},
+	}, {
+		Line:    4,
+		Contact: &db.Contact{FirstName: "Bob"},
+	}})
+}
+
+func (s *csvSuite) TestExplicitMapping(c *gc.C) {
+	rows, err := importer.ReadCSV(strings.NewReader(""+
+		"Given,Family,Who,Mail\n"+
+		"Jane,Smith,Jane Smith,jane@smith.example\n"+
+		",,Bob Brown,bob@brown.example\n",
+	), importer.Mapping{"Given": "first_name", "Family": "last_name", "Who": "name", "Mail": "email"})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(rows, gc.HasLen, 2)
+	// The full name only fills in when there are no separate names.
+	c.Check(rows[0].Contact.FirstName, gc.Equals, "Jane")
+	c.Check(rows[0].Contact.LastName, gc.Equals, "Smith")
+	c.Check(rows[1].Contact.FirstName, gc.Equals, "Bob")
+	c.Check(rows[1].Contact.LastName, gc.Equals, "Brown")
+}
+
+func (s *csvSuite) TestTags(c *gc.C) {
+	rows, err := importer.ReadCSV(strings.NewReader(""+
+		"Name,Groups\n"+
+		"Jane Smith,\"Retainer; government, retainer\"\n",
+	), nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(rows, gc.HasLen, 1)
+	c.Check(rows[0].Valid(), jc.IsTrue)
+	c.Check(rows[0].Contact.Tags, jc.DeepEquals, []string{"government", "retainer"})
+}
+
+func (s *csvSuite) TestRowErrors(c *gc.C) {
+	rows, err := importer.ReadCSV(strings.NewReader(""+
+		"email,phone,peppol_id,company\n"+
+		"not an email,555,,\n"+
+		",,9999:123,Acme\n"+
+		"ok@acme.example,,0088:9429041234567,Acme\n",
+	), nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(rows, gc.HasLen, 3)
+	c.Check(rows[0].Errors, jc.DeepEquals, []string{"no name or company", "email address not valid"})
+	c.Check(rows[1].Errors, jc.DeepEquals, []string{`PEPPOL ID scheme "9999" not valid`})
+	c.Check(rows[2].Valid(), jc.IsTrue)
+}
+
+func (s *csvSuite) TestBadFiles(c *gc.C) {
+	for _, test := range []struct {
+		in      string
+		mapping importer.Mapping
+		err     string
+	}{{
+		in:  "",
+		err: "empty CSV file not valid",
+	}, {
+		in:  "colour,size\nred,big\n",
+		err: "no columns mapped to contact fields not valid",
+	}, {
+		in:      "a,b\n",
+		mapping: importer.Mapping{"c": "email"},
+		err:     `mapped column "c" not in file not valid`,
+	}, {
+		in:      "a,b\n",
+		mapping: importer.Mapping{"a": "password"},
+		err:     `contact field "password" not valid`,
+	}, {
+		in:  "email\n\"unterminated\n",
+		err: `cannot read CSV: .*`,
+	}} {
+		_, err := importer.ReadCSV(strings.NewReader(test.in), test.mapping)
+		c.Check(err, gc.ErrorMatches, test.err)
+		c.Check(err, jc.Satisfies, errors.IsNotValid)
+	}
+}
+
+func (s *csvSuite) TestTooManyRows(c *gc.C) {
+	in := "email\n" + strings.Repeat("a@b.example\n", importer.MaxRows+1)
+	_, err := importer.ReadCSV(strings.NewReader(in), nil)
+	c.Check(err, gc.ErrorMatches, "more than 500 contacts not valid")
+}
+
+func (s *csvSuite) TestMarkDuplicates(c *gc.C) {
+	rows, err := importer.ReadCSV(strings.NewReader(""+
+		"first_name,last_name,company,email\n"+
+		"Jane,Smith,,JANE@smith.example\n"+
+		"Bob,Brown,Acme,bob@acme.example\n"+
+		"bob,  brown,ACME,\n"+
+		"Bob,Brown,Other,\n",
+	), nil)
+	c.Assert(err, jc.ErrorIsNil)
+
+	importer.MarkDuplicates(rows, []*db.Contact{
+		{ID: "jane", FirstName: "Jane", LastName: "Smith", Email: "jane@smith.example"},
+	})
+	c.Check(rows[0].Duplicates, jc.DeepEquals, []importer.Duplicate{{
+		ContactID: "jane",
+		Reasons:   []string{dedupe.SameEmail, dedupe.SimilarName},
+	}})
+	c.Check(rows[1].Duplicates, gc.HasLen, 0)
+	c.Check(rows[2].Duplicates, jc.DeepEquals, []importer.Duplicate{{
+		Line:    3,
+		Reasons: []string{dedupe.SameCompany, dedupe.SimilarName},
+	}})
+	c.Check(rows[3].Duplicates, gc.HasLen, 0)
+}
@@ -0,0 +1,87 @@
+// Package importer reads contacts from CSV and vCard files, checks them and
+// spots ones we probably have already, so they can be reviewed before any
+// are created.
+package importer
+
+import (
+	"net/mail"
+
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/dedupe"
+	"github.com/wham-invoice/wham-platform/einvoice"
+)
+
+// MaxRows is the most contacts one import can create. All of them are
+// written in a single batch, which Firestore caps at 500 writes.
+const MaxRows = db.MaxContactBatch
+
+// Row is one contact read from a file.
+type Row struct {
+	// Line is where the contact starts in the file, counting from 1.
+	Line    int         `json:"line"`
+	Contact *db.Contact `json:"contact"`
+	// Errors say why the contact can't be imported as it is.
+	Errors []string `json:"errors,omitempty"`
+	// Duplicates are contacts this one probably repeats.
+	Duplicates []Duplicate `json:"duplicates,omitempty"`
+}
+
+// Valid reports whether the row can be imported.
+func (r Row) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+// Duplicate is a contact that a Row looks like. Exactly one of ContactID, for
+// a contact we already have, and Line, for an earlier row in the same file,
+// is set.
+type Duplicate struct {
+	ContactID string   `json:"contact_id,omitempty"`
+	Line      int      `json:"line,omitempty"`
+	Reasons   []string `json:"reasons"`
+}
+
+// check records what's wrong with the row's contact.
+func (r *Row) check() {
+	c := r.Contact
+	if c.FirstName == "" && c.LastName == "" && c.Company == "" {
+		r.Errors = append(r.Errors, "no name or company")
+	}
+	if c.Email != "" {
+		if addr, err := mail.ParseAddress(c.Email); err != nil || addr.Address != c.Email {
+			r.Errors = append(r.Errors, "email address not valid")
+		}
+	}
+	if c.PeppolID != "" {
+		if _, err := einvoice.ParseParticipantID(c.PeppolID); err != nil {
+			r.Errors = append(r.Errors, err.Error())
+		}
+	}
+	if tags, err := db.NormaliseTags(c.Tags); err != nil {
+		r.Errors = append(r.Errors, err.Error())
+	} else {
+		c.Tags = tags
+	}
+}
+
+// MarkDuplicates records, for each row, the existing contacts and earlier
+// rows it probably repeats.
+func MarkDuplicates(rows []Row, existing []*db.Contact) {
+	for i := range rows {
+		row := &rows[i]
+		for _, c := range existing {
+			if reasons := dedupe.Match(row.Contact, c); len(reasons) > 0 {
+				row.Duplicates = append(row.Duplicates, Duplicate{ContactID: c.ID, Reasons: reasons})
+			}
+		}
+		for _, earlier := range rows[:i] {
+			if reasons := dedupe.Match(row.Contact, earlier.Contact); len(reasons) > 0 {
+				row.Duplicates = append(row.Duplicates, Duplicate{Line: earlier.Line, Reasons: reasons})
+			}
+		}
+	}
+}
+
+// hasAddress reports whether any part of a is filled in.
+func hasAddress(a *db.Address) bool {
+	return *a != db.Address{}
+}
@@ -0,0 +1,75 @@
+package importer
+
+import (
+	"io"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/vcard"
+)
+
+// ReadVCard reads contacts from a vCard 3.0 or 4.0 file, taking each card's
+// preferred, or else first, email, phone and address.
+func ReadVCard(r io.Reader) ([]Row, error) {
+	cards, err := vcard.Parse(r)
+	if errors.IsNotValid(err) || errors.IsNotSupported(err) {
+		return nil, errors.NewNotValid(err, "cannot read vCard")
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(cards) > MaxRows {
+		return nil, errors.NotValidf("more than %d contacts", MaxRows)
+	}
+
+	rows := make([]Row, len(cards))
+	for i, card := range cards {
+		rows[i] = Row{Line: card.Line, Contact: contactFromCard(card)}
+		rows[i].check()
+	}
+	return rows, nil
+}
+
+func contactFromCard(card vcard.Card) *db.Contact {
+	c := &db.Contact{
+		FirstName: card.GivenName,
+		LastName:  card.FamilyName,
+		Company:   card.Organisation,
+	}
+	if c.FirstName == "" && c.LastName == "" && card.FormattedName != card.Organisation {
+		setName(c, card.FormattedName)
+	}
+	if len(card.Emails) > 0 {
+		c.Email = card.Emails[0]
+	}
+	if len(card.Phones) > 0 {
+		c.Phone = card.Phones[0]
+	}
+	if len(card.Addresses) > 0 {
+		a := card.Addresses[0]
+		c.Address = &db.Address{
+			FirstLine:  firstNonEmpty(a.Street, a.POBox),
+			SecondLine: a.Extended,
+			Suburb:     firstNonEmpty(a.Locality, a.Region),
+			Postcode:   a.PostalCode,
+			Country:    a.Country,
+		}
+		if a.Street != "" && a.POBox != "" {
+			c.Address.SecondLine = strings.TrimSpace(a.POBox + " " + a.Extended)
+		}
+		if !hasAddress(c.Address) {
+			c.Address = nil
+		}
+	}
+	return c
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,63 @@
+package importer_test
+
+import (
+	"strings"
+
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/importer"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type vcardSuite struct{}
+
+var _ = gc.Suite(&vcardSuite{})
+
+func (s *vcardSuite) TestReadVCard(c *gc.C) {
+	rows, err := importer.ReadVCard(strings.NewReader("" +
+		"BEGIN:VCARD\nVERSION:3.0\nN:Smith;Jane;;;\nORG:Smith & Co\n" +
+		"EMAIL:jane@home.example\nEMAIL;TYPE=pref:jane@smith.example\n" +
+		"ADR:PO Box 12;Level 2;1 Queen St;Auckland;;1010;New Zealand\nEND:VCARD\n" +
+		"BEGIN:VCARD\nVERSION:4.0\nFN:Bob Brown\nEND:VCARD\n" +
+		"BEGIN:VCARD\nVERSION:4.0\nFN:Acme Ltd\nORG:Acme Ltd\nADR:PO Box 1;;;Wellington;;6011;\nEND:VCARD\n" +
+		"BEGIN:VCARD\nVERSION:4.0\nEMAIL:nobody@example.com\nEND:VCARD\n",
+	))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(rows, jc.DeepEquals, []importer.Row{{
+		Line: 1,
+		Contact: &db.Contact{
+			FirstName: "Jane",
+			LastName:  "Smith",
+			Company:   "Smith & Co",
+			Email:     "jane@smith.example",
+			Address: &db.Address{
+				FirstLine:  "1 Queen St",
+				SecondLine: "PO Box 12 Level 2",
+				Suburb:     "Auckland",
+				Postcode:   "1010",
+				Country:    "New Zealand",
+			},
+		},
+	}, {
+		Line:    9,
+		Contact: &db.Contact{FirstName: "Bob", LastName: "Brown"},
+	}, {
+		Line: 13,
+		Contact: &db.Contact{
+			Company: "Acme Ltd",
+			Address: &db.Address{FirstLine: "PO Box 1", Suburb: "Wellington", Postcode: "6011"},
+		},
+	}, {
+		Line:    19,
+		Contact: &db.Contact{Email: "nobody@example.com"},
+		Errors:  []string{"no name or company"},
+	}})
+}
+
+func (s *vcardSuite) TestBadVCard(c *gc.C) {
+	_, err := importer.ReadVCard(strings.NewReader("BEGIN:VCARD\nVERSION:2.1\nEND:VCARD\n"))
+	c.Check(err, gc.ErrorMatches, `cannot read vCard: line 1: vCard version "2.1" not supported`)
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+}
@@ -2,16 +2,22 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
 
+	"github.com/wham-invoice/wham-platform/db"
 	"github.com/wham-invoice/wham-platform/server"
 	"github.com/wham-invoice/wham-platform/util"
 
 	"github.com/juju/errors"
 )
 
+var backfill = flag.Bool("backfill", false,
+	"give invoices and contacts from before lists could sort and filter them the fields they need, then exit")
+
 func main() {
+	flag.Parse()
 	ctx := context.Background()
 
 	// TODO config file has env - set this to prod Logger depending on env
@@ -20,7 +26,33 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *backfill {
+		if err := runBackfill(ctx); err != nil {
+			util.Logger.Fatal(errors.ErrorStack(err))
+		}
+		return
+	}
+
 	if err := server.Run(ctx); err != nil {
 		util.Logger.Fatal(errors.ErrorStack(err))
 	}
 }
+
+// runBackfill fills in what documents from older versions of the platform
+// are missing. It only needs running once, before the lists that need the
+// fields are used.
+func runBackfill(ctx context.Context) error {
+	app, err := db.Init(ctx)
+	if err != nil {
+		return errors.Annotate(err, "cannot set up application DB")
+	}
+	defer app.CloseDB()
+
+	if err := app.BackfillInvoices(ctx); err != nil {
+		return errors.Annotate(err, "cannot backfill invoices")
+	}
+	if err := app.BackfillContacts(ctx); err != nil {
+		return errors.Annotate(err, "cannot backfill contacts")
+	}
+	return nil
+}
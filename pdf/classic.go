@@ -0,0 +1,43 @@
+package pdf
+
+import (
+	"github.com/johnfercher/maroto/pkg/pdf"
+)
+
+func init() {
+	Register(classic{})
+}
+
+// classic is the original layout: issuer in the header, bill-to and invoice
+// details side by side, a striped table and payment details in the footer.
+type classic struct{}
+
+// Name is part of the Template interface.
+func (classic) Name() string {
+	return "classic"
+}
+
+// Render is part of the Template interface.
+func (classic) Render(m pdf.Maroto, b Builder, theme Theme) {
+	m.SetPageMargins(10, 15, 10)
+
+	m.RegisterHeader(func() {
+		m.Row(20, func() {
+			getIssuer(m, b, theme)
+		})
+	})
+	m.RegisterFooter(func() {
+		getPaymentDetails(m, b.Profile, theme)
+	})
+
+	m.Row(30, func() {
+		getBillTo(m, b.Contact)
+		m.ColSpace(6)
+		getInvoiceDetails(m, b.Invoice)
+	})
+
+	getTable(m, b.Invoice, theme)
+
+	getTotals(m, b.Invoice, theme)
+	getPaymentSection(m, b, theme)
+}
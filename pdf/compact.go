@@ -0,0 +1,117 @@
+package pdf
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/johnfercher/maroto/pkg/consts"
+	"github.com/johnfercher/maroto/pkg/pdf"
+	"github.com/johnfercher/maroto/pkg/props"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/util"
+)
+
+func init() {
+	Register(compact{})
+}
+
+// compact fits everything into as little space as possible, with small type
+// and the payment details straight after the totals rather than in a footer.
+type compact struct{}
+
+// Name is part of the Template interface.
+func (compact) Name() string {
+	return "compact"
+}
+
+// Render is part of the Template interface.
+func (compact) Render(m pdf.Maroto, b Builder, theme Theme) {
+	m.SetPageMargins(10, 10, 10)
+
+	m.Row(8, func() {
+		m.Col(5, func() {
+			m.Text(issuerName(b), props.Text{
+				Size:  10,
+				Style: consts.Bold,
+				Align: consts.Left,
+				Color: theme.Accent,
+			})
+		})
+		m.Col(7, func() {
+			m.Text(invoiceSummary(b.Invoice), props.Text{
+				Top:   1,
+				Size:  7,
+				Align: consts.Right,
+			})
+		})
+	})
+	m.Row(6, func() {
+		m.Col(12, func() {
+			m.Text(fmt.Sprintf("Bill to: %s", billToLine(b.Contact)), props.Text{
+				Size:  7,
+				Align: consts.Left,
+			})
+		})
+	})
+
+	stripeColor := theme.Stripe
+	m.TableList(getHeader(b.Invoice), getContents(b.Invoice), props.TableList{
+		HeaderProp: props.TableListContent{
+			Size:      7,
+			GridSizes: []uint{8, 2, 2},
+		},
+		ContentProp: props.TableListContent{
+			Size:      7,
+			GridSizes: []uint{8, 2, 2},
+		},
+		Align:                consts.Left,
+		AlternatedBackground: &stripeColor,
+		HeaderContentSpace:   1,
+	})
+
+	m.Row(6, func() {
+		m.Col(12, func() {
+			m.Text(fmt.Sprintf(
+				"Subtotal %s   %s %s   Total %s",
+				money(b.Invoice, b.Invoice.GetSubtotal()),
+				gstLabel(b.Invoice),
+				money(b.Invoice, b.Invoice.GetGST()),
+				money(b.Invoice, b.Invoice.GetTotal()),
+			), props.Text{
+				Top:   2,
+				Size:  8,
+				Style: consts.Bold,
+				Align: consts.Right,
+			})
+		})
+	})
+
+	getPaymentSection(m, b, theme)
+	getPaymentDetails(m, b.Profile, theme)
+}
+
+// billToLine returns the contact's name, company and address on one line.
+func billToLine(client *db.Contact) string {
+	parts := []string{client.GetFullName(), client.Company}
+	if a := client.Address; a != nil {
+		parts = append(parts, a.FirstLine, a.SecondLine, a.Suburb, a.Postcode, a.Country)
+	}
+
+	var nonEmpty []string
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+
+	return strings.Join(nonEmpty, ", ")
+}
+
+// invoiceSummary returns the invoice number and dates on one line.
+func invoiceSummary(i *db.Invoice) string {
+	return fmt.Sprintf("Invoice %d  Issued %s  Due %s",
+		i.Number,
+		util.ToFormattedDate(i.IssueDate),
+		util.ToFormattedDate(i.DueDate),
+	)
+}
@@ -0,0 +1,3 @@
+package pdf
+
+var PaymentQRCode = paymentQRCode
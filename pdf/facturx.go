@@ -0,0 +1,134 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/einvoice"
+)
+
+// FacturXFileName is what Factur-X readers look for in the PDF.
+const FacturXFileName = "factur-x.xml"
+
+// facturXAttachment describes the invoice as CII XML at the given profile,
+// ready to embed.
+func facturXAttachment(b Builder, profile einvoice.Profile) (attachment, error) {
+	var xmlData bytes.Buffer
+	err := einvoice.WriteCII(&xmlData, einvoice.Document{
+		Invoice: b.Invoice,
+		User:    b.User,
+		Profile: b.Profile,
+		Contact: b.Contact,
+	}, profile)
+	if err != nil {
+		return attachment{}, errors.Trace(err)
+	}
+
+	// MINIMUM and BASIC WL aren't complete invoices, so the PDF stays the
+	// legal document and the XML is only data drawn from it.
+	relationship := "Alternative"
+	if profile == einvoice.ProfileMinimum || profile == einvoice.ProfileBasicWL {
+		relationship = "Data"
+	}
+
+	title := fmt.Sprintf("Invoice %d", b.Invoice.Number)
+	return attachment{
+		Name:         FacturXFileName,
+		Description:  "Factur-X invoice",
+		MimeType:     "text/xml",
+		Relationship: relationship,
+		Data:         xmlData.Bytes(),
+		Metadata: func(producer string, created time.Time) []byte {
+			return facturXMetadata(title, producer, created, profile)
+		},
+	}, nil
+}
+
+// facturXMetadata is the XMP packet identifying the document as PDF/A-3b and
+// Factur-X, including the extension schema PDF/A needs to accept the fx
+// properties.
+func facturXMetadata(title, producer string, created time.Time, profile einvoice.Profile) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, xmpTemplate,
+		xmlEscape(title),
+		xmlEscape(producer),
+		created.Format("2006-01-02T15:04:05"),
+		FacturXFileName,
+		xmlEscape(string(profile)),
+	)
+	return buf.Bytes()
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+const xmpTemplate = `<?xpacket begin="` + "\ufeff" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/">
+<pdfaid:part>3</pdfaid:part>
+<pdfaid:conformance>B</pdfaid:conformance>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:title><rdf:Alt><rdf:li xml:lang="x-default">%s</rdf:li></rdf:Alt></dc:title>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:pdf="http://ns.adobe.com/pdf/1.3/">
+<pdf:Producer>%s</pdf:Producer>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/">
+<xmp:CreateDate>%s</xmp:CreateDate>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:fx="urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#">
+<fx:DocumentType>INVOICE</fx:DocumentType>
+<fx:DocumentFileName>%s</fx:DocumentFileName>
+<fx:Version>1.0</fx:Version>
+<fx:ConformanceLevel>%s</fx:ConformanceLevel>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:pdfaExtension="http://www.aiim.org/pdfa/ns/extension/" xmlns:pdfaSchema="http://www.aiim.org/pdfa/ns/schema#" xmlns:pdfaProperty="http://www.aiim.org/pdfa/ns/property#">
+<pdfaExtension:schemas>
+<rdf:Bag>
+<rdf:li rdf:parseType="Resource">
+<pdfaSchema:schema>Factur-X PDFA Extension Schema</pdfaSchema:schema>
+<pdfaSchema:namespaceURI>urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#</pdfaSchema:namespaceURI>
+<pdfaSchema:prefix>fx</pdfaSchema:prefix>
+<pdfaSchema:property>
+<rdf:Seq>
+<rdf:li rdf:parseType="Resource">
+<pdfaProperty:name>DocumentFileName</pdfaProperty:name>
+<pdfaProperty:valueType>Text</pdfaProperty:valueType>
+<pdfaProperty:category>external</pdfaProperty:category>
+<pdfaProperty:description>name of the embedded XML invoice file</pdfaProperty:description>
+</rdf:li>
+<rdf:li rdf:parseType="Resource">
+<pdfaProperty:name>DocumentType</pdfaProperty:name>
+<pdfaProperty:valueType>Text</pdfaProperty:valueType>
+<pdfaProperty:category>external</pdfaProperty:category>
+<pdfaProperty:description>INVOICE</pdfaProperty:description>
+</rdf:li>
+<rdf:li rdf:parseType="Resource">
+<pdfaProperty:name>Version</pdfaProperty:name>
+<pdfaProperty:valueType>Text</pdfaProperty:valueType>
+<pdfaProperty:category>external</pdfaProperty:category>
+<pdfaProperty:description>The actual version of the Factur-X XML schema</pdfaProperty:description>
+</rdf:li>
+<rdf:li rdf:parseType="Resource">
+<pdfaProperty:name>ConformanceLevel</pdfaProperty:name>
+<pdfaProperty:valueType>Text</pdfaProperty:valueType>
+<pdfaProperty:category>external</pdfaProperty:category>
+<pdfaProperty:description>The conformance level of the embedded Factur-X data</pdfaProperty:description>
+</rdf:li>
+</rdf:Seq>
+</pdfaSchema:property>
+</rdf:li>
+</rdf:Bag>
+</pdfaExtension:schemas>
+</rdf:Description>
+</rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
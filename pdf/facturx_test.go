@@ -0,0 +1,278 @@
+package pdf_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/einvoice"
+	"github.com/wham-invoice/wham-platform/pdf"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type facturXSuite struct {
+	// templates pins gofpdf's output and compares it with golden files. It
+	// isn't embedded, so its tests don't run twice.
+	templates templateSuite
+}
+
+var _ = gc.Suite(&facturXSuite{})
+
+func (s *facturXSuite) SetUpSuite(c *gc.C) {
+	s.templates.SetUpSuite(c)
+}
+
+func (s *facturXSuite) TearDownSuite(c *gc.C) {
+	s.templates.TearDownSuite(c)
+}
+
+func (s *facturXSuite) TestGolden(c *gc.C) {
+	b := fixtureBuilder()
+	b.FacturX = einvoice.ProfileEN16931
+
+	s.templates.checkGolden(c, b, "classic-facturx")
+}
+
+// TestEmbeddedXML checks every profile embeds the same CII that einvoice
+// writes, which has passed its validation, and that the metadata agrees.
+func (s *facturXSuite) TestEmbeddedXML(c *gc.C) {
+	for _, profile := range []einvoice.Profile{
+		einvoice.ProfileMinimum,
+		einvoice.ProfileBasicWL,
+		einvoice.ProfileBasic,
+		einvoice.ProfileEN16931,
+	} {
+		c.Logf("profile %s", profile)
+		b := fixtureBuilder()
+		b.FacturX = profile
+
+		var buf bytes.Buffer
+		c.Assert(pdf.Render(&buf, b), jc.ErrorIsNil)
+		doc := readPDF(c, buf.Bytes())
+
+		embedded := doc.attachment(c, pdf.FacturXFileName)
+		var want bytes.Buffer
+		c.Assert(einvoice.WriteCII(&want, einvoice.Document{
+			Invoice: b.Invoice,
+			User:    b.User,
+			Profile: b.Profile,
+			Contact: b.Contact,
+		}, profile), jc.ErrorIsNil)
+		c.Check(string(embedded), gc.Equals, want.String())
+
+		var cii struct {
+			XMLName     xml.Name
+			GuidelineID string `xml:"ExchangedDocumentContext>GuidelineSpecifiedDocumentContextParameter>ID"`
+		}
+		c.Assert(xml.Unmarshal(embedded, &cii), jc.ErrorIsNil)
+		c.Check(cii.XMLName.Space, gc.Equals, "urn:un:unece:uncefact:data:standard:CrossIndustryInvoice:100")
+		c.Check(cii.GuidelineID, gc.Equals, profile.GuidelineID())
+
+		var xmp struct {
+			Descriptions []struct {
+				Part             string `xml:"part"`
+				Conformance      string `xml:"conformance"`
+				DocumentFileName string `xml:"DocumentFileName"`
+				ConformanceLevel string `xml:"ConformanceLevel"`
+				CreateDate       string `xml:"CreateDate"`
+			} `xml:"RDF>Description"`
+		}
+		c.Assert(xml.Unmarshal(doc.metadata(c), &xmp), jc.ErrorIsNil)
+		got := map[string]string{}
+		for _, d := range xmp.Descriptions {
+			for k, v := range map[string]string{
+				"part": d.Part, "conformance": d.Conformance, "file": d.DocumentFileName,
+				"level": d.ConformanceLevel, "created": d.CreateDate,
+			} {
+				if v != "" {
+					got[k] = v
+				}
+			}
+		}
+		c.Check(got, jc.DeepEquals, map[string]string{
+			"part":        "3",
+			"conformance": "B",
+			"file":        "factur-x.xml",
+			"level":       string(profile),
+			"created":     "2022-03-01T00:00:00",
+		})
+	}
+}
+
+func (s *facturXSuite) TestStructure(c *gc.C) {
+	b := fixtureBuilder()
+	b.FacturX = einvoice.ProfileBasic
+
+	var buf bytes.Buffer
+	c.Assert(pdf.Render(&buf, b), jc.ErrorIsNil)
+	data := buf.Bytes()
+	doc := readPDF(c, data)
+
+	c.Check(bytes.HasPrefix(data, []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")), jc.IsTrue)
+	c.Check(doc.trailer, gc.Matches, `(?s).*/ID \[<[0-9a-f]{32}> <[0-9a-f]{32}>\].*`)
+
+	catalog := doc.object(c, doc.ref(c, doc.trailer, "Root"))
+	c.Check(catalog, gc.Matches, `(?s).*/Type /Catalog.*`)
+	spec := doc.object(c, doc.ref(c, catalog, "AF \\["))
+	c.Check(spec, gc.Matches, `(?s).*/AFRelationship /Alternative.*`)
+
+	intent := doc.object(c, doc.ref(c, catalog, "OutputIntents \\["))
+	c.Check(intent, gc.Matches, `(?s).*/S /GTS_PDFA1.*`)
+	icc := doc.stream(c, doc.ref(c, intent, "DestOutputProfile"))
+	c.Assert(len(icc) > 128, jc.IsTrue)
+	c.Check(int(binary.BigEndian.Uint32(icc)), gc.Equals, len(icc))
+	c.Check(string(icc[36:40]), gc.Equals, "acsp")
+	c.Check(string(icc[16:20]), gc.Equals, "RGB ")
+}
+
+// TestEmbeddedFonts checks the text is set in TrueType fonts embedded in
+// the PDF, as PDF/A requires, rather than the standard fonts.
+func (s *facturXSuite) TestEmbeddedFonts(c *gc.C) {
+	b := fixtureBuilder()
+	b.FacturX = einvoice.ProfileEN16931
+
+	var buf bytes.Buffer
+	c.Assert(pdf.Render(&buf, b), jc.ErrorIsNil)
+	c.Check(bytes.Count(buf.Bytes(), []byte("/FontFile2 ")), gc.Equals, 4)
+	c.Check(bytes.Contains(buf.Bytes(), []byte("/BaseFont /Helvetica /")), jc.IsFalse)
+}
+
+// TestVeraPDF checks the PDF with veraPDF, the PDF/A reference validator,
+// if it's installed.
+func (s *facturXSuite) TestVeraPDF(c *gc.C) {
+	if _, err := exec.LookPath("verapdf"); err != nil {
+		c.Skip("verapdf not installed")
+	}
+	b := fixtureBuilder()
+	b.FacturX = einvoice.ProfileEN16931
+
+	var buf bytes.Buffer
+	c.Assert(pdf.Render(&buf, b), jc.ErrorIsNil)
+	path := filepath.Join(c.MkDir(), "invoice.pdf")
+	c.Assert(ioutil.WriteFile(path, buf.Bytes(), 0644), jc.ErrorIsNil)
+
+	// veraPDF exits non-zero for non-compliant files, so the report is the
+	// verdict.
+	out, _ := exec.Command("verapdf", "--flavour", "3b", "--format", "text", path).Output()
+	c.Check(string(out), gc.Matches, `(?s)PASS .*`, gc.Commentf("%s", out))
+}
+
+func (s *facturXSuite) TestMinimumIsData(c *gc.C) {
+	b := fixtureBuilder()
+	b.FacturX = einvoice.ProfileMinimum
+
+	var buf bytes.Buffer
+	c.Assert(pdf.Render(&buf, b), jc.ErrorIsNil)
+	doc := readPDF(c, buf.Bytes())
+	catalog := doc.object(c, doc.ref(c, doc.trailer, "Root"))
+	spec := doc.object(c, doc.ref(c, catalog, "AF \\["))
+	c.Check(spec, gc.Matches, `(?s).*/AFRelationship /Data.*`)
+}
+
+func (s *facturXSuite) TestNeedsBusinessProfile(c *gc.C) {
+	b := fixtureBuilder()
+	b.FacturX = einvoice.ProfileEN16931
+	b.Profile = nil
+
+	err := pdf.Render(ioutil.Discard, b)
+	c.Check(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *facturXSuite) TestInvalidInvoice(c *gc.C) {
+	b := fixtureBuilder()
+	b.FacturX = einvoice.ProfileBasicWL
+	b.Profile.TaxNumber = ""
+
+	err := pdf.Render(ioutil.Discard, b)
+	_, ok := errors.Cause(err).(*einvoice.ValidationError)
+	c.Check(ok, jc.IsTrue, gc.Commentf("%v", err))
+}
+
+// pdfReader finds objects through the xref table, as a reader would.
+type pdfReader struct {
+	data    []byte
+	offsets map[int]int
+	trailer string
+}
+
+var startxrefRE = regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`)
+
+func readPDF(c *gc.C, data []byte) *pdfReader {
+	m := startxrefRE.FindSubmatch(data)
+	c.Assert(m, gc.NotNil)
+	at, err := strconv.Atoi(string(m[1]))
+	c.Assert(err, jc.ErrorIsNil)
+
+	r := &pdfReader{data: data, offsets: map[int]int{}}
+	var count int
+	_, err = fmt.Sscanf(string(data[at:]), "xref\n0 %d\n", &count)
+	c.Assert(err, jc.ErrorIsNil)
+	entries := data[at+bytes.Index(data[at:], []byte("0000000000 65535 f \n")):]
+	for n := 1; n < count; n++ {
+		offset, err := strconv.Atoi(string(entries[n*20 : n*20+10]))
+		c.Assert(err, jc.ErrorIsNil)
+		r.offsets[n] = offset
+		c.Assert(bytes.HasPrefix(data[offset:], []byte(fmt.Sprintf("%d 0 obj\n", n))), jc.IsTrue,
+			gc.Commentf("xref offset for object %d", n))
+	}
+	r.trailer = string(entries[count*20:])
+	return r
+}
+
+func (r *pdfReader) object(c *gc.C, n int) string {
+	offset, ok := r.offsets[n]
+	c.Assert(ok, jc.IsTrue, gc.Commentf("object %d", n))
+	end := bytes.Index(r.data[offset:], []byte("endobj"))
+	c.Assert(end, gc.Not(gc.Equals), -1)
+	return string(r.data[offset : offset+end])
+}
+
+func (r *pdfReader) ref(c *gc.C, dict, key string) int {
+	m := regexp.MustCompile(`/` + key + ` ?(\d+) 0 R`).FindStringSubmatch(dict)
+	c.Assert(m, gc.NotNil, gc.Commentf("no /%s in %s", key, dict))
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
+
+var lengthRE = regexp.MustCompile(`/Length (\d+)`)
+
+func (r *pdfReader) stream(c *gc.C, n int) []byte {
+	object := r.object(c, n)
+	m := lengthRE.FindStringSubmatch(object)
+	c.Assert(m, gc.NotNil)
+	length, _ := strconv.Atoi(m[1])
+	start := r.offsets[n] + bytes.Index(r.data[r.offsets[n]:], []byte("stream\n")) + len("stream\n")
+	data := r.data[start : start+length]
+	if !bytes.Contains([]byte(object), []byte("/FlateDecode")) {
+		return data
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	c.Assert(err, jc.ErrorIsNil)
+	out, err := ioutil.ReadAll(zr)
+	c.Assert(err, jc.ErrorIsNil)
+	return out
+}
+
+func (r *pdfReader) attachment(c *gc.C, name string) []byte {
+	catalog := r.object(c, r.ref(c, r.trailer, "Root"))
+	spec := r.object(c, r.ref(c, catalog, `EmbeddedFiles << /Names \[\(`+regexp.QuoteMeta(name)+`\)`))
+	c.Check(spec, gc.Matches, `(?s).*/F \(`+regexp.QuoteMeta(name)+`\).*`)
+	file := r.ref(c, spec, "EF << /F")
+	c.Check(r.object(c, file), gc.Matches, `(?s).*/Subtype /text#2Fxml.*`)
+	return r.stream(c, file)
+}
+
+func (r *pdfReader) metadata(c *gc.C) []byte {
+	catalog := r.object(c, r.ref(c, r.trailer, "Root"))
+	return r.stream(c, r.ref(c, catalog, "Metadata"))
+}
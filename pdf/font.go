@@ -0,0 +1,83 @@
+package pdf
+
+import (
+	"embed"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/johnfercher/maroto/pkg/consts"
+	"github.com/johnfercher/maroto/pkg/pdf"
+	"github.com/juju/errors"
+)
+
+// embeddedFont is the family PDF/A documents are set in. PDF/A needs every
+// font embedded, which the standard PDF fonts never are, so Factur-X
+// invoices use DejaVu Sans Condensed instead of the theme's font.
+const embeddedFont = "dejavu"
+
+//go:embed fonts/*.ttf
+var fontFiles embed.FS
+
+// embeddedFontFiles are in the order they're registered, which fixes how
+// gofpdf numbers them.
+var embeddedFontFiles = []struct {
+	style consts.Style
+	name  string
+}{
+	{consts.Normal, "DejaVuSansCondensed.ttf"},
+	{consts.Bold, "DejaVuSansCondensed-Bold.ttf"},
+	{consts.Italic, "DejaVuSansCondensed-Oblique.ttf"},
+	{consts.BoldItalic, "DejaVuSansCondensed-BoldOblique.ttf"},
+}
+
+var (
+	fontDirOnce sync.Once
+	fontDir     string
+	fontDirErr  error
+)
+
+// fontDirectory returns a directory holding the embedded fonts, writing
+// them out the first time, as gofpdf only reads fonts from files.
+func fontDirectory() (string, error) {
+	fontDirOnce.Do(func() {
+		dir, err := ioutil.TempDir("", "wham-fonts")
+		if err != nil {
+			fontDirErr = errors.Annotate(err, "cannot create font directory")
+			return
+		}
+		for _, f := range embeddedFontFiles {
+			data, err := fontFiles.ReadFile("fonts/" + f.name)
+			if err != nil {
+				fontDirErr = errors.Trace(err)
+				return
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, f.name), data, 0644); err != nil {
+				os.RemoveAll(dir)
+				fontDirErr = errors.Annotatef(err, "cannot write font %s", f.name)
+				return
+			}
+		}
+		fontDir = dir
+	})
+	return fontDir, fontDirErr
+}
+
+// useEmbeddedFont registers embeddedFont with m in every style. gofpdf
+// embeds the glyphs a document uses, as PDF/A requires.
+func useEmbeddedFont(m pdf.Maroto) error {
+	pm, ok := m.(*pdf.PdfMaroto)
+	if !ok {
+		return errors.NotSupportedf("embedding fonts in %T", m)
+	}
+	dir, err := fontDirectory()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	pm.Pdf.SetFontLocation(dir)
+	for _, f := range embeddedFontFiles {
+		m.AddUTF8Font(embeddedFont, f.style, f.name)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// sRGBProfile builds an ICC v2 display profile for sRGB, which PDF/A needs
+// as the output intent for the device RGB colours our templates use. It is
+// generated rather than shipped so there's no binary to keep track of.
+func sRGBProfile() []byte {
+	// Primaries and white point adapted to the D50 profile connection
+	// space, as in the profile IEC 61966-2-1 publishes.
+	xyz := func(x, y, z float64) []byte {
+		return concat([]byte("XYZ \x00\x00\x00\x00"), s15Fixed16(x), s15Fixed16(y), s15Fixed16(z))
+	}
+	tags := []struct {
+		sig  string
+		data []byte
+	}{
+		{"desc", iccDescription("sRGB IEC61966-2.1")},
+		{"cprt", iccText("No copyright, use freely")},
+		{"wtpt", xyz(0.9642, 1.0, 0.8249)},
+		{"rXYZ", xyz(0.4360747, 0.2225045, 0.0139322)},
+		{"gXYZ", xyz(0.3850649, 0.7168786, 0.0971045)},
+		{"bXYZ", xyz(0.1430804, 0.0606169, 0.7141733)},
+		{"rTRC", sRGBCurve()},
+		{"gTRC", nil},
+		{"bTRC", nil},
+	}
+
+	const headerSize = 128
+	offset := headerSize + 4 + 12*len(tags)
+	var table, data bytes.Buffer
+	binary.Write(&table, binary.BigEndian, uint32(len(tags)))
+	var shared, sharedSize int
+	for _, tag := range tags {
+		if tag.data == nil {
+			// The green and blue curves are the same as the red.
+			table.WriteString(tag.sig)
+			binary.Write(&table, binary.BigEndian, uint32(shared))
+			binary.Write(&table, binary.BigEndian, uint32(sharedSize))
+			continue
+		}
+		shared, sharedSize = offset+data.Len(), len(tag.data)
+		table.WriteString(tag.sig)
+		binary.Write(&table, binary.BigEndian, uint32(shared))
+		binary.Write(&table, binary.BigEndian, uint32(sharedSize))
+		data.Write(tag.data)
+		for data.Len()%4 != 0 {
+			data.WriteByte(0)
+		}
+	}
+
+	header := make([]byte, headerSize)
+	binary.BigEndian.PutUint32(header[0:], uint32(headerSize+table.Len()+data.Len()))
+	binary.BigEndian.PutUint32(header[8:], 0x02100000)
+	copy(header[12:], "mntr")
+	copy(header[16:], "RGB ")
+	copy(header[20:], "XYZ ")
+	for i, v := range []uint16{2022, 3, 1, 0, 0, 0} {
+		binary.BigEndian.PutUint16(header[24+2*i:], v)
+	}
+	copy(header[36:], "acsp")
+	copy(header[68:], concat(s15Fixed16(0.9642), s15Fixed16(1.0), s15Fixed16(0.8249)))
+
+	return concat(header, table.Bytes(), data.Bytes())
+}
+
+// sRGBCurve samples the sRGB transfer function, which a v2 profile can't
+// describe parametrically.
+func sRGBCurve() []byte {
+	const points = 1024
+	curve := concat([]byte("curv\x00\x00\x00\x00"), make([]byte, 4+2*points))
+	binary.BigEndian.PutUint32(curve[8:], points)
+	for i := 0; i < points; i++ {
+		v := float64(i) / (points - 1)
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		binary.BigEndian.PutUint16(curve[12+2*i:], uint16(math.Round(v*65535)))
+	}
+	return curve
+}
+
+func iccDescription(s string) []byte {
+	var b bytes.Buffer
+	b.WriteString("desc\x00\x00\x00\x00")
+	binary.Write(&b, binary.BigEndian, uint32(len(s)+1))
+	b.WriteString(s)
+	b.WriteByte(0)
+	// No Unicode or ScriptCode descriptions: language, count, code, count
+	// and the 67 byte ScriptCode buffer.
+	b.Write(make([]byte, 4+4+2+1+67))
+	return b.Bytes()
+}
+
+func iccText(s string) []byte {
+	return concat([]byte("text\x00\x00\x00\x00"), []byte(s), []byte{0})
+}
+
+func s15Fixed16(v float64) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(int32(math.Round(v*65536))))
+	return b
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
@@ -0,0 +1,96 @@
+package pdf
+
+import (
+	"github.com/johnfercher/maroto/pkg/color"
+	"github.com/johnfercher/maroto/pkg/consts"
+	"github.com/johnfercher/maroto/pkg/pdf"
+	"github.com/johnfercher/maroto/pkg/props"
+	"github.com/wham-invoice/wham-platform/util"
+)
+
+func init() {
+	Register(modern{})
+}
+
+// modern puts the issuer in a solid accent band across the top of the page
+// and uses a ruled, unstriped table.
+type modern struct{}
+
+// Name is part of the Template interface.
+func (modern) Name() string {
+	return "modern"
+}
+
+// Render is part of the Template interface.
+func (modern) Render(m pdf.Maroto, b Builder, theme Theme) {
+	m.SetPageMargins(15, 15, 15)
+
+	m.RegisterHeader(func() {
+		m.SetBackgroundColor(theme.Accent)
+		m.Row(25, func() {
+			m.Col(8, func() {
+				m.Text(issuerName(b), props.Text{
+					Top:   7,
+					Size:  16,
+					Style: consts.Bold,
+					Align: consts.Left,
+					Color: color.NewWhite(),
+				})
+			})
+			m.Col(4, func() {
+				m.Text("INVOICE", props.Text{
+					Top:   7,
+					Size:  16,
+					Align: consts.Right,
+					Color: color.NewWhite(),
+				})
+			})
+		})
+		m.SetBackgroundColor(color.NewWhite())
+		m.Row(5, func() {
+			m.ColSpace(12)
+		})
+	})
+	m.RegisterFooter(func() {
+		getPaymentDetails(m, b.Profile, theme)
+	})
+
+	if len(b.Logo) > 0 {
+		if logo, ext, err := logoImage(b.Logo); err != nil {
+			util.Logger.Warnf("ignoring invalid logo: %v", err)
+		} else {
+			m.Row(15, func() {
+				m.Col(2, func() {
+					if err := m.Base64Image(logo, ext, props.Rect{Percent: 100}); err != nil {
+						util.Logger.Warnf("cannot render logo: %v", err)
+					}
+				})
+				m.ColSpace(10)
+			})
+		}
+	}
+
+	m.Row(30, func() {
+		getBillTo(m, b.Contact)
+		m.ColSpace(6)
+		getInvoiceDetails(m, b.Invoice)
+	})
+
+	m.TableList(getHeader(b.Invoice), getContents(b.Invoice), props.TableList{
+		HeaderProp: props.TableListContent{
+			Size:      9,
+			Style:     consts.Bold,
+			GridSizes: []uint{7, 2, 3},
+		},
+		ContentProp: props.TableListContent{
+			Size:      9,
+			GridSizes: []uint{7, 2, 3},
+		},
+		Align:              consts.Left,
+		HeaderContentSpace: 2,
+		Line:               true,
+	})
+
+	getTotals(m, b.Invoice, theme)
+	getPaymentSection(m, b, theme)
+}
@@ -0,0 +1,74 @@
+package pdf
+
+import (
+	"fmt"
+
+	"github.com/johnfercher/maroto/pkg/color"
+	"github.com/johnfercher/maroto/pkg/pdf"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/util"
+)
+
+// Overlay is a large translucent stamp drawn diagonally across every page,
+// such as PAID or VOID.
+type Overlay struct {
+	Label string
+	// Detail is printed smaller, under the label.
+	Detail string
+	Color  color.Color
+}
+
+// StatusOverlay returns the overlay showing the invoice's status, or nil if
+// an invoice in that status should look as issued.
+func StatusOverlay(i *db.Invoice) *Overlay {
+	switch i.CurrentStatus() {
+	case db.InvoiceStatusDraft:
+		return &Overlay{Label: "DRAFT", Color: getDarkGrayColor()}
+	case db.InvoiceStatusOverdue:
+		return &Overlay{Label: "OVERDUE", Color: getRedColor()}
+	case db.InvoiceStatusVoid:
+		return &Overlay{Label: "VOID", Color: getRedColor()}
+	case db.InvoiceStatusPaid:
+		o := &Overlay{Label: "PAID", Color: getGreenColor()}
+		if !i.PaidDate.IsZero() {
+			o.Detail = fmt.Sprintf("Paid %s", util.ToFormattedDate(i.PaidDate))
+		}
+		return o
+	}
+	return nil
+}
+
+// drawOverlay stamps o across every page rendered so far.
+func drawOverlay(m pdf.Maroto, o *Overlay, font string) {
+	pm, ok := m.(*pdf.PdfMaroto)
+	if !ok {
+		util.Logger.Warnf("cannot draw %s overlay on %T", o.Label, m)
+		return
+	}
+	p := pm.Pdf
+
+	width, height := p.GetPageSize()
+	cx, cy := width/2, height/2
+	p.SetTextColor(o.Color.Red, o.Color.Green, o.Color.Blue)
+
+	pages := p.PageCount()
+	for page := 1; page <= pages; page++ {
+		p.SetPage(page)
+		p.TransformBegin()
+		p.SetAlpha(0.25, "Normal")
+		p.TransformRotate(35, cx, cy)
+
+		p.SetFont(font, "B", 96)
+		p.Text(cx-p.GetStringWidth(o.Label)/2, cy, o.Label)
+		if o.Detail != "" {
+			p.SetFont(font, "B", 24)
+			p.Text(cx-p.GetStringWidth(o.Detail)/2, cy+14, o.Detail)
+		}
+
+		p.SetAlpha(1, "Normal")
+		p.TransformEnd()
+	}
+	// Anything drawn after this, like the footer, belongs on the last page.
+	p.SetPage(pages)
+	p.SetTextColor(0, 0, 0)
+}
@@ -0,0 +1,70 @@
+package pdf_test
+
+import (
+	"time"
+
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/pdf"
+
+	gc "gopkg.in/check.v1"
+)
+
+type overlaySuite struct{}
+
+var _ = gc.Suite(&overlaySuite{})
+
+func (s *overlaySuite) TestStatusOverlay(c *gc.C) {
+	for _, test := range []struct {
+		invoice db.Invoice
+		label   string
+		detail  string
+	}{{
+		invoice: db.Invoice{},
+	}, {
+		invoice: db.Invoice{Status: db.InvoiceStatusIssued},
+	}, {
+		invoice: db.Invoice{Status: db.InvoiceStatusDraft},
+		label:   "DRAFT",
+	}, {
+		invoice: db.Invoice{Status: db.InvoiceStatusOverdue},
+		label:   "OVERDUE",
+	}, {
+		invoice: db.Invoice{Status: db.InvoiceStatusVoid},
+		label:   "VOID",
+	}, {
+		invoice: db.Invoice{Paid: true},
+		label:   "PAID",
+	}, {
+		invoice: db.Invoice{
+			Status:   db.InvoiceStatusPaid,
+			PaidDate: time.Date(2022, 3, 10, 0, 0, 0, 0, time.UTC),
+		},
+		label:  "PAID",
+		detail: "Paid 10-Mar-2022",
+	}} {
+		c.Logf("status %q", test.invoice.Status)
+		overlay := pdf.StatusOverlay(&test.invoice)
+		if test.label == "" {
+			c.Check(overlay, gc.IsNil)
+			continue
+		}
+		c.Assert(overlay, gc.NotNil)
+		c.Check(overlay.Label, gc.Equals, test.label)
+		c.Check(overlay.Detail, gc.Equals, test.detail)
+	}
+}
+
+func (s *templateSuite) TestOverlayGolden(c *gc.C) {
+	b := fixtureBuilder()
+	b.Invoice.Status = db.InvoiceStatusPaid
+	b.Invoice.PaidDate = time.Date(2022, 3, 10, 0, 0, 0, 0, time.UTC)
+	b.Overlay = pdf.StatusOverlay(b.Invoice)
+	s.checkGolden(c, b, "classic-paid")
+}
+
+func (s *templateSuite) TestOverlayLeavesOriginalAlone(c *gc.C) {
+	b := fixtureBuilder()
+	b.Overlay = pdf.StatusOverlay(b.Invoice)
+	c.Assert(b.Overlay, gc.IsNil)
+	s.checkGolden(c, b, pdf.DefaultTemplate)
+}
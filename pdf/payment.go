@@ -0,0 +1,214 @@
+package pdf
+
+import (
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+
+	"github.com/johnfercher/maroto/pkg/consts"
+	"github.com/johnfercher/maroto/pkg/pdf"
+	"github.com/johnfercher/maroto/pkg/props"
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/util"
+)
+
+// ValidatePaymentSettings checks that the settings can produce the QR code
+// they ask for.
+func ValidatePaymentSettings(s *db.PaymentSettings) error {
+	if n := len([]rune(s.ReferencePrefix)); n > db.MaxReferencePrefix {
+		return errors.NotValidf("reference prefix longer than %d characters", db.MaxReferencePrefix)
+	}
+
+	switch s.QRCode {
+	case db.QRCodeNone:
+	case db.QRCodeEPC:
+		if err := validateIBAN(s.IBAN); err != nil {
+			return errors.Trace(err)
+		}
+		if n := len(s.BIC); n != 0 && n != 8 && n != 11 {
+			return errors.NotValidf("BIC %q", s.BIC)
+		}
+	case db.QRCodeLink:
+		u, err := url.Parse(s.PaymentLink)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return errors.NotValidf("payment link %q", s.PaymentLink)
+		}
+	default:
+		return errors.NotValidf("qr code %q", s.QRCode)
+	}
+
+	return nil
+}
+
+// validateIBAN checks the length and ISO 7064 check digits of an IBAN.
+func validateIBAN(iban string) error {
+	iban = normaliseIBAN(iban)
+	if len(iban) < 15 || len(iban) > 34 {
+		return errors.NotValidf("IBAN %q", iban)
+	}
+
+	var digits strings.Builder
+	for _, r := range iban[4:] + iban[:4] {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r >= 'A' && r <= 'Z':
+			fmt.Fprintf(&digits, "%d", r-'A'+10)
+		default:
+			return errors.NotValidf("IBAN %q", iban)
+		}
+	}
+
+	n, _ := new(big.Int).SetString(digits.String(), 10)
+	if new(big.Int).Mod(n, big.NewInt(97)).Int64() != 1 {
+		return errors.NotValidf("IBAN %q", iban)
+	}
+	return nil
+}
+
+func normaliseIBAN(iban string) string {
+	return strings.ToUpper(strings.ReplaceAll(iban, " ", ""))
+}
+
+// EPCPayload returns the contents of an EPC credit transfer QR code
+// (EPC069-12, version 002) paying amount euros to the named beneficiary.
+func EPCPayload(name, iban, bic string, amount float32, reference string) (string, error) {
+	if err := validateIBAN(iban); err != nil {
+		return "", errors.Trace(err)
+	}
+	if name == "" {
+		return "", errors.NotValidf("empty beneficiary name")
+	}
+	if amount < 0.01 || amount > 999999999.99 {
+		return "", errors.NotValidf("amount %.2f", amount)
+	}
+
+	lines := []string{
+		"BCD",
+		"002",
+		"1", // UTF-8
+		"SCT",
+		bic,
+		truncate(name, 70),
+		normaliseIBAN(iban),
+		fmt.Sprintf("EUR%.2f", amount),
+		"", // purpose
+		"", // structured reference
+		truncate(reference, 140),
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// PaymentLink fills the reference and amount into the link template.
+func PaymentLink(link string, amount float32, reference string) string {
+	return strings.NewReplacer(
+		"{reference}", url.QueryEscape(reference),
+		"{amount}", fmt.Sprintf("%.2f", amount),
+	).Replace(link)
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+// paymentQRCode returns what to encode in the invoice's payment QR code, or
+// "" if there shouldn't be one. EPC codes are only for invoices in euros.
+func paymentQRCode(b Builder) string {
+	if b.Profile == nil || b.Profile.Payment == nil {
+		return ""
+	}
+	settings := b.Profile.Payment
+	reference := b.Invoice.PaymentReference(settings)
+	amount := b.Invoice.GetTotal()
+
+	switch settings.QRCode {
+	case db.QRCodeEPC:
+		// EPC codes can only ask for euros; anything else gets the payment
+		// link, if there is one.
+		if currency := b.Invoice.Currency; currency != "EUR" {
+			if settings.PaymentLink == "" {
+				return ""
+			}
+			return PaymentLink(settings.PaymentLink, amount, reference)
+		}
+		payload, err := EPCPayload(issuerName(b), settings.IBAN, settings.BIC, amount, reference)
+		if err != nil {
+			util.Logger.Warnf("no payment QR code for invoice %s: %v", b.Invoice.ID, err)
+			return ""
+		}
+		return payload
+	case db.QRCodeLink:
+		return PaymentLink(settings.PaymentLink, amount, reference)
+	}
+	return ""
+}
+
+// getPaymentSection renders how to pay: bank details, the reference to
+// quote and, if the user wants one, a QR code.
+func getPaymentSection(m pdf.Maroto, b Builder, theme Theme) {
+	p := b.Profile
+	if p == nil {
+		return
+	}
+	settings := p.Payment
+	qr := paymentQRCode(b)
+	if p.BankAccount == "" && p.PaymentInstructions == "" && qr == "" {
+		return
+	}
+
+	lines := []string{}
+	if p.BankAccount != "" {
+		lines = append(lines, fmt.Sprintf("Bank account: %s", p.BankAccount))
+	}
+	if settings != nil && settings.IBAN != "" {
+		lines = append(lines, fmt.Sprintf("IBAN: %s", normaliseIBAN(settings.IBAN)))
+	}
+	if settings != nil && settings.BIC != "" {
+		lines = append(lines, fmt.Sprintf("BIC: %s", settings.BIC))
+	}
+	lines = append(lines,
+		fmt.Sprintf("Reference: %s", b.Invoice.PaymentReference(settings)),
+		fmt.Sprintf("Amount due: %s", money(b.Invoice, b.Invoice.GetTotal())),
+	)
+	if p.PaymentInstructions != "" {
+		lines = append(lines, p.PaymentInstructions)
+	}
+
+	m.Row(35, func() {
+		textWidth := uint(12)
+		if qr != "" {
+			textWidth = 9
+		}
+		m.Col(textWidth, func() {
+			m.Text("How to pay", props.Text{
+				Top:   8,
+				Size:  10,
+				Style: consts.Bold,
+				Align: consts.Left,
+				Color: theme.Accent,
+			})
+			top := 13.0
+			for _, line := range lines {
+				m.Text(line, props.Text{
+					Top:   top,
+					Size:  8,
+					Align: consts.Left,
+				})
+				top += 4
+			}
+		})
+		if qr != "" {
+			m.Col(3, func() {
+				m.QrCode(qr, props.Rect{
+					Center:  true,
+					Percent: 90,
+				})
+			})
+		}
+	})
+}
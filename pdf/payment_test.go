@@ -0,0 +1,96 @@
+package pdf_test
+
+import (
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/pdf"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type paymentSuite struct{}
+
+var _ = gc.Suite(&paymentSuite{})
+
+func (s *paymentSuite) TestEPCPayload(c *gc.C) {
+	payload, err := pdf.EPCPayload("Doe Digital", "de89 3704 0044 0532 0130 00", "COBADEFFXXX", 1035, "INV-000042")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(payload, gc.Equals, "BCD\n002\n1\nSCT\nCOBADEFFXXX\nDoe Digital\nDE89370400440532013000\nEUR1035.00\n\n\nINV-000042")
+}
+
+func (s *paymentSuite) TestEPCPayloadInvalid(c *gc.C) {
+	_, err := pdf.EPCPayload("Doe Digital", "DE89370400440532013001", "", 10, "ref")
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	_, err = pdf.EPCPayload("Doe Digital", "DE89370400440532013000", "", 0, "ref")
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+	_, err = pdf.EPCPayload("", "DE89370400440532013000", "", 10, "ref")
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (s *paymentSuite) TestPaymentLink(c *gc.C) {
+	link := pdf.PaymentLink("https://pay.example/doe?ref={reference}&amount={amount}", 1035, "INV 42")
+	c.Check(link, gc.Equals, "https://pay.example/doe?ref=INV+42&amount=1035.00")
+}
+
+func (s *paymentSuite) TestValidatePaymentSettings(c *gc.C) {
+	for i, test := range []struct {
+		settings db.PaymentSettings
+		valid    bool
+	}{{
+		settings: db.PaymentSettings{},
+		valid:    true,
+	}, {
+		settings: db.PaymentSettings{QRCode: db.QRCodeEPC, IBAN: "GB82 WEST 1234 5698 7654 32"},
+		valid:    true,
+	}, {
+		settings: db.PaymentSettings{QRCode: db.QRCodeEPC, IBAN: "GB82 WEST 1234 5698 7654 33"},
+	}, {
+		settings: db.PaymentSettings{QRCode: db.QRCodeEPC, IBAN: "GB82WEST12345698765432", BIC: "WEST"},
+	}, {
+		settings: db.PaymentSettings{QRCode: db.QRCodeLink, PaymentLink: "https://pay.example/{reference}"},
+		valid:    true,
+	}, {
+		settings: db.PaymentSettings{QRCode: db.QRCodeLink, PaymentLink: "javascript:alert(1)"},
+	}, {
+		settings: db.PaymentSettings{QRCode: "bitcoin"},
+	}, {
+		settings: db.PaymentSettings{ReferencePrefix: "INVOICE"},
+	}} {
+		c.Logf("test %d", i)
+		err := pdf.ValidatePaymentSettings(&test.settings)
+		if test.valid {
+			c.Check(err, jc.ErrorIsNil)
+		} else {
+			c.Check(err, jc.Satisfies, errors.IsNotValid)
+		}
+	}
+}
+
+func (s *paymentSuite) TestPaymentQRCodeCurrency(c *gc.C) {
+	b := fixtureBuilder()
+	b.Profile.Payment = &db.PaymentSettings{
+		QRCode: db.QRCodeEPC,
+		IBAN:   "DE89370400440532013000",
+	}
+	b.Invoice.Currency = "EUR"
+	c.Check(pdf.PaymentQRCode(b), jc.HasPrefix, "BCD\n")
+
+	// An EPC code would ask for the NZD total in euros.
+	b.Invoice.Currency = ""
+	c.Check(pdf.PaymentQRCode(b), gc.Equals, "")
+	b.Invoice.Currency = "AUD"
+	b.Profile.Payment.PaymentLink = "https://pay.example/{reference}?amount={amount}"
+	c.Check(pdf.PaymentQRCode(b), gc.Equals, "https://pay.example/INV-000042?amount=1035.00")
+}
+
+func (s *templateSuite) TestPaymentQRCodeGolden(c *gc.C) {
+	b := fixtureBuilder()
+	b.Invoice.Currency = "EUR"
+	b.Profile.Payment = &db.PaymentSettings{
+		QRCode: db.QRCodeEPC,
+		IBAN:   "DE89370400440532013000",
+		BIC:    "COBADEFFXXX",
+	}
+	s.checkGolden(c, b, "classic-epc")
+}
@@ -1,9 +1,11 @@
 package pdf
 
 import (
+	"bytes"
 	"context"
 	"fmt"
-	"os"
+	"io"
+	"strings"
 
 	"github.com/johnfercher/maroto/pkg/color"
 	"github.com/johnfercher/maroto/pkg/consts"
@@ -12,78 +14,124 @@ import (
 	"github.com/juju/errors"
 	uuid "github.com/satori/go.uuid"
 	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/einvoice"
+	"github.com/wham-invoice/wham-platform/placeholder"
 	"github.com/wham-invoice/wham-platform/util"
 )
 
 type Builder struct {
-	App        *db.App
-	Invoice    *db.Invoice
-	User       *db.User
-	Contact    *db.Contact
-	OutputPath string
+	App     *db.App
+	Invoice *db.Invoice
+	User    *db.User
+	// Profile is the issuer's business profile. It is nil if the user
+	// hasn't set one up.
+	Profile *db.BusinessProfile
+	// Logo is the PNG or JPEG referenced by Profile.LogoID, if any.
+	Logo    []byte
+	Contact *db.Contact
+	// Overlay, if set, is stamped across every page.
+	Overlay *Overlay
+	// FacturX, if set, makes the PDF a PDF/A-3 Factur-X hybrid carrying the
+	// invoice as CII XML at this profile. It needs Profile.
+	FacturX einvoice.Profile
 }
 
-// createPDF creates a PDF from an invoice ID and stores the file in firebase.
-// We delete the file from local disk. Finally we return the ID of the file in firebase.
+// theme returns the issuer's chosen theme. Themes are validated when they're
+// saved, so we quietly fall back to the default if a stored one is bad.
+func (b Builder) theme() Theme {
+	if b.Profile == nil {
+		return DefaultTheme()
+	}
+	theme, err := NewTheme(b.Profile.Theme)
+	if err != nil {
+		util.Logger.Warnf("ignoring invalid theme for %s: %v", b.Profile.UserID, err)
+		return DefaultTheme()
+	}
+	return theme
+}
+
+// expandPlaceholders returns b with the contact's details filled into the
+// invoice description and the payment instructions. The stored invoice and
+// profile keep their placeholders.
+func (b Builder) expandPlaceholders() Builder {
+	values := placeholder.Values(b.Contact, b.Invoice)
+	if b.Invoice != nil {
+		b.Invoice = placeholder.Invoice(b.Invoice, b.Contact)
+	}
+	if b.Profile != nil {
+		profile := *b.Profile
+		profile.PaymentInstructions = placeholder.Expand(profile.PaymentInstructions, values)
+		b.Profile = &profile
+	}
+	return b
+}
+
+// CreatePDF renders the invoice described by b and stores it, returning the
+// ID of the stored file. Nothing touches the local disk, so it is safe to call
+// concurrently and on a read-only filesystem.
 func CreatePDF(ctx context.Context, b Builder) (string, error) {
 
 	pdfID := uuid.NewV4().String()
 
-	// TODO store in temp folder?
-	filePath := fmt.Sprintf("test_dir/%s.pdf", pdfID)
-	b.OutputPath = filePath
-
-	if err := build(b); err != nil {
-		return "", errors.Trace(err)
-	}
-	if err := b.App.StorePDF(ctx, pdfID, filePath); err != nil {
+	var buf bytes.Buffer
+	if err := Render(&buf, b); err != nil {
 		return "", errors.Trace(err)
 	}
-	if err := os.Remove(filePath); err != nil {
+	if err := b.App.StorePDF(ctx, pdfID, &buf); err != nil {
 		return "", errors.Trace(err)
 	}
 
 	return pdfID, nil
 }
 
-func build(b Builder) error {
+// Render writes the PDF for the invoice described by b to w.
+func Render(w io.Writer, b Builder) error {
+	b = b.expandPlaceholders()
 
-	m := pdf.NewMaroto(consts.Portrait, consts.A4)
-	m.SetPageMargins(10, 15, 10)
-
-	blueColor := getBlueColor()
-	m.RegisterHeader(func() {
-		m.Row(20, func() {
-			m.Col(3, func() {
-				m.Text(b.User.FullName(), props.Text{
-					Size:        12,
-					Align:       consts.Left,
-					Style:       consts.Bold,
-					Extrapolate: false,
-				})
-				// TODO ask for users phone number.
-				m.Text(fmt.Sprintf("Tel: %s", "ask for users phone"), props.Text{
-					Top:   12,
-					Style: consts.BoldItalic,
-					Size:  8,
-					Align: consts.Left,
-					Color: blueColor,
-				})
-			})
+	var facturX *attachment
+	if b.FacturX != "" {
+		a, err := facturXAttachment(b, b.FacturX)
+		if err != nil {
+			return errors.Annotate(err, "cannot describe invoice for Factur-X")
+		}
+		facturX = &a
+	}
 
-			m.ColSpace(6)
+	theme := b.theme()
 
-		})
-	})
+	m := pdf.NewMaroto(consts.Portrait, consts.A4)
+	if facturX != nil {
+		if err := useEmbeddedFont(m); err != nil {
+			return errors.Annotate(err, "cannot embed font for PDF/A")
+		}
+		theme.Font = embeddedFont
+	}
+	m.SetDefaultFontFamily(theme.Font)
 
-	m.Row(30, func() {
-		getBillTo(m, b.Contact)
-		m.ColSpace(6)
-		getInvoiceDetails(m, b.Invoice)
-	})
+	b.template().Render(m, b, theme)
+	if b.Overlay != nil {
+		drawOverlay(m, b.Overlay, theme.Font)
+	}
 
-	getTable(m, b.Invoice)
+	buf, err := m.Output()
+	if err != nil {
+		return errors.Annotate(err, "could not render PDF")
+	}
+	out := buf.Bytes()
+	if facturX != nil {
+		if out, err = toPDFA3(out, *facturX); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if _, err := w.Write(out); err != nil {
+		return errors.Annotate(err, "could not write PDF")
+	}
 
+	return nil
+}
+
+// getTotals renders the subtotal, GST and total rows.
+func getTotals(m pdf.Maroto, i *db.Invoice, theme Theme) {
 	m.Row(5, func() {
 		m.Col(9, func() {
 			m.Text("Subtotal (exc. GST):", props.Text{
@@ -94,7 +142,7 @@ func build(b Builder) error {
 		})
 		m.Col(3, func() {
 			m.Text(
-				fmt.Sprintf("$%.2f", b.Invoice.GetSubtotal()), props.Text{
+				money(i, i.GetSubtotal()), props.Text{
 					Top:   5,
 					Size:  10,
 					Align: consts.Right,
@@ -103,7 +151,7 @@ func build(b Builder) error {
 	})
 	m.Row(5, func() {
 		m.Col(9, func() {
-			m.Text("GST:", props.Text{
+			m.Text(gstLabel(i)+":", props.Text{
 				Top:   5,
 				Size:  10,
 				Align: consts.Right,
@@ -111,7 +159,7 @@ func build(b Builder) error {
 		})
 		m.Col(3, func() {
 			m.Text(
-				fmt.Sprintf("$%.2f", b.Invoice.GetGST()),
+				money(i, i.GetGST()),
 				props.Text{
 					Top:   5,
 					Size:  10,
@@ -130,20 +178,106 @@ func build(b Builder) error {
 		})
 		m.Col(3, func() {
 			m.Text(
-				fmt.Sprintf("$%.2f", b.Invoice.GetTotal()),
+				money(i, i.GetTotal()),
 				props.Text{
 					Top:   5,
+					Style: consts.Bold,
 					Size:  12,
 					Align: consts.Right,
+					Color: theme.Accent,
 				})
 		})
 	})
 
-	if err := m.OutputFileAndClose(b.OutputPath); err != nil {
-		return errors.Annotate(err, "could not save file")
+}
+
+// issuerName returns the name the invoice is issued under.
+func issuerName(b Builder) string {
+	if b.Profile != nil && b.Profile.DisplayName() != "" {
+		return b.Profile.DisplayName()
 	}
+	return b.User.FullName()
+}
 
-	return nil
+// getIssuer renders who the invoice is from, with their logo if they have
+// one. Without a business profile we only know the user's name.
+func getIssuer(m pdf.Maroto, b Builder, theme Theme) {
+	name := issuerName(b)
+	var lines []string
+	if p := b.Profile; p != nil {
+		if p.Address != nil {
+			lines = append(lines, p.Address.FirstLine, p.Address.SecondLine,
+				strings.TrimSpace(fmt.Sprintf("%s %s", p.Address.Suburb, p.Address.Postcode)))
+		}
+		if p.Phone != "" {
+			lines = append(lines, fmt.Sprintf("Tel: %s", p.Phone))
+		}
+		if p.Email != "" {
+			lines = append(lines, p.Email)
+		}
+	}
+
+	textWidth := uint(6)
+	if len(b.Logo) > 0 {
+		logo, ext, err := logoImage(b.Logo)
+		if err != nil {
+			util.Logger.Warnf("ignoring invalid logo: %v", err)
+		} else {
+			m.Col(2, func() {
+				if err := m.Base64Image(logo, ext, props.Rect{Percent: 100}); err != nil {
+					util.Logger.Warnf("cannot render logo: %v", err)
+				}
+			})
+			textWidth = 4
+		}
+	}
+
+	m.Col(textWidth, func() {
+		m.Text(name, props.Text{
+			Size:        12,
+			Align:       consts.Left,
+			Style:       consts.Bold,
+			Extrapolate: false,
+		})
+
+		top := 6.0
+		for _, line := range lines {
+			if line == "" {
+				continue
+			}
+			m.Text(line, props.Text{
+				Top:   top,
+				Size:  8,
+				Align: consts.Left,
+				Color: theme.Accent,
+			})
+			top += 3
+		}
+	})
+	m.ColSpace(6)
+}
+
+// getPaymentDetails renders the issuer's legal details in the page footer.
+// How to pay is in the body; see getPaymentSection.
+func getPaymentDetails(m pdf.Maroto, p *db.BusinessProfile, theme Theme) {
+	if p == nil {
+		return
+	}
+
+	legal := p.LegalName
+	if p.TaxNumber != "" {
+		legal = strings.TrimSpace(fmt.Sprintf("%s  GST No. %s", legal, p.TaxNumber))
+	}
+
+	m.Row(15, func() {
+		m.Col(12, func() {
+			m.Text(legal, props.Text{
+				Size:  8,
+				Align: consts.Center,
+				Color: theme.Header,
+			})
+		})
+	})
 }
 
 func getBillTo(m pdf.Maroto, client *db.Contact) {
@@ -170,38 +304,40 @@ func getBillTo(m pdf.Maroto, client *db.Contact) {
 			Align:       consts.Left,
 			Extrapolate: false,
 		})
-		m.Text(
-			fmt.Sprintf("%s", client.Address.FirstLine),
-			props.Text{
-				Top:         12,
-				Size:        8,
-				Align:       consts.Left,
-				Extrapolate: false,
-			})
-		m.Text(
-			fmt.Sprintf("%s", client.Address.SecondLine),
-			props.Text{
-				Top:         15,
-				Size:        8,
-				Align:       consts.Left,
-				Extrapolate: false,
-			})
-		m.Text(
-			fmt.Sprintf("%s", client.Address.Postcode),
-			props.Text{
-				Top:         18,
-				Size:        8,
-				Align:       consts.Left,
-				Extrapolate: false,
-			})
-		m.Text(
-			fmt.Sprintf("%s", client.Address.Country),
-			props.Text{
-				Top:         21,
-				Size:        8,
-				Align:       consts.Left,
-				Extrapolate: false,
-			})
+		if a := client.Address; a != nil {
+			m.Text(
+				fmt.Sprintf("%s", a.FirstLine),
+				props.Text{
+					Top:         12,
+					Size:        8,
+					Align:       consts.Left,
+					Extrapolate: false,
+				})
+			m.Text(
+				fmt.Sprintf("%s", a.SecondLine),
+				props.Text{
+					Top:         15,
+					Size:        8,
+					Align:       consts.Left,
+					Extrapolate: false,
+				})
+			m.Text(
+				fmt.Sprintf("%s", a.Postcode),
+				props.Text{
+					Top:         18,
+					Size:        8,
+					Align:       consts.Left,
+					Extrapolate: false,
+				})
+			m.Text(
+				fmt.Sprintf("%s", a.Country),
+				props.Text{
+					Top:         21,
+					Size:        8,
+					Align:       consts.Left,
+					Extrapolate: false,
+				})
+		}
 	})
 }
 
@@ -254,17 +390,17 @@ func getInvoiceDetails(m pdf.Maroto, i *db.Invoice) {
 	})
 }
 
-func getTable(m pdf.Maroto, i *db.Invoice) {
+func getTable(m pdf.Maroto, i *db.Invoice, theme Theme) {
 
-	grayColor := getGrayColor()
+	stripeColor := theme.Stripe
 
-	m.SetBackgroundColor(getDarkGrayColor())
+	m.SetBackgroundColor(theme.Header)
 	m.Row(5, func() {
 		m.ColSpace(12)
 	})
 	m.SetBackgroundColor(color.NewWhite())
 
-	m.TableList(getHeader(), getContents(i), props.TableList{
+	m.TableList(getHeader(i), getContents(i), props.TableList{
 		HeaderProp: props.TableListContent{
 			Size:      9,
 			GridSizes: []uint{7, 2, 3},
@@ -274,43 +410,49 @@ func getTable(m pdf.Maroto, i *db.Invoice) {
 			GridSizes: []uint{7, 2, 3},
 		},
 		Align:                consts.Center,
-		AlternatedBackground: &grayColor,
+		AlternatedBackground: &stripeColor,
 		HeaderContentSpace:   1,
 		Line:                 false,
 	})
 
 }
 
-func getHeader() []string {
-	return []string{"Description", "Quantity", "Amount($) ex GST"}
+func getHeader(i *db.Invoice) []string {
+	unit := "$"
+	if !defaultCurrency(i) {
+		unit = i.Currency
+	}
+	return []string{"Description", "Quantity", fmt.Sprintf("Amount(%s) ex GST", unit)}
 }
 
-func getContents(i *db.Invoice) [][]string {
-	return [][]string{
-		{i.Description, fmt.Sprintf("%.2f", i.Hours), fmt.Sprintf("%.2f", i.Rate)},
-	}
+// defaultCurrency reports whether the invoice is in NZD, which is written
+// with a plain dollar sign.
+func defaultCurrency(i *db.Invoice) bool {
+	return i.Currency == "" || i.Currency == db.DefaultCurrency
 }
 
-func getDarkGrayColor() color.Color {
-	return color.Color{
-		Red:   55,
-		Green: 55,
-		Blue:  55,
+// money formats an amount in the invoice's currency.
+func money(i *db.Invoice, amount float32) string {
+	if defaultCurrency(i) {
+		return fmt.Sprintf("$%.2f", amount)
 	}
+	return fmt.Sprintf("%s %.2f", i.Currency, amount)
 }
 
-func getGrayColor() color.Color {
-	return color.Color{
-		Red:   200,
-		Green: 200,
-		Blue:  200,
+// gstLabel names the GST line, saying why zero rated and exempt invoices
+// have none.
+func gstLabel(i *db.Invoice) string {
+	switch i.TaxTreatment {
+	case db.TaxZeroRated:
+		return "GST (zero rated)"
+	case db.TaxExempt:
+		return "GST (exempt)"
 	}
+	return "GST"
 }
 
-func getBlueColor() color.Color {
-	return color.Color{
-		Red:   10,
-		Green: 10,
-		Blue:  150,
+func getContents(i *db.Invoice) [][]string {
+	return [][]string{
+		{i.Description, fmt.Sprintf("%.2f", i.Hours), fmt.Sprintf("%.2f", i.Rate)},
 	}
 }
@@ -0,0 +1,43 @@
+package pdf_test
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/wham-invoice/wham-platform/pdf"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type renderSuite struct{}
+
+var _ = gc.Suite(&renderSuite{})
+
+func (s *renderSuite) TestRenderWritesPDF(c *gc.C) {
+	var buf bytes.Buffer
+	c.Assert(pdf.Render(&buf, fixtureBuilder()), jc.ErrorIsNil)
+	c.Check(bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")), jc.IsTrue)
+}
+
+func (s *renderSuite) TestRenderConcurrently(c *gc.C) {
+	const n = 8
+
+	var wg sync.WaitGroup
+	outputs := make([]*bytes.Buffer, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			outputs[i] = new(bytes.Buffer)
+			errs[i] = pdf.Render(outputs[i], fixtureBuilder())
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		c.Assert(errs[i], jc.ErrorIsNil)
+		c.Check(bytes.HasPrefix(outputs[i].Bytes(), []byte("%PDF-")), jc.IsTrue)
+	}
+}
@@ -0,0 +1,266 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/md5"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// attachment is a file to embed in a PDF/A-3 document, with the XMP
+// metadata that describes why it's there.
+type attachment struct {
+	Name        string
+	Description string
+	MimeType    string
+	// Relationship is the PDF/A-3 AFRelationship: Data, Source,
+	// Alternative, Supplement or Unspecified.
+	Relationship string
+	Data         []byte
+	// Metadata returns the XMP packet for the document, given the producer
+	// and creation date gofpdf recorded, which it has to repeat.
+	Metadata func(producer string, created time.Time) []byte
+}
+
+// gofpdfDocument is a PDF as gofpdf writes it: one classic xref table, no
+// object streams and every object at generation 0.
+type gofpdfDocument struct {
+	// objects[n] is object n from "n 0 obj" up to the next object.
+	objects    [][]byte
+	root, info int
+}
+
+var (
+	startxrefRE = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF\s*$`)
+	rootRE      = regexp.MustCompile(`/Root (\d+) 0 R`)
+	infoRE      = regexp.MustCompile(`/Info (\d+) 0 R`)
+	producerRE  = regexp.MustCompile(`/Producer \(([^)]*)\)`)
+	createdRE   = regexp.MustCompile(`/CreationDate \(D:(\d{14})\)`)
+)
+
+func parseGofpdf(data []byte) (*gofpdfDocument, error) {
+	m := startxrefRE.FindSubmatch(data)
+	if m == nil {
+		return nil, errors.NotValidf("PDF without startxref")
+	}
+	xrefAt, _ := strconv.Atoi(string(m[1]))
+	if xrefAt >= len(data) || !bytes.HasPrefix(data[xrefAt:], []byte("xref\n")) {
+		return nil, errors.NotSupportedf("PDF without a classic xref table")
+	}
+
+	var first, count int
+	rest := data[xrefAt+len("xref\n"):]
+	if _, err := fmt.Sscanf(string(rest[:bytes.IndexByte(rest, '\n')]), "%d %d", &first, &count); err != nil || first != 0 {
+		return nil, errors.NotSupportedf("xref table %q", rest[:bytes.IndexByte(rest, '\n')])
+	}
+	rest = rest[bytes.IndexByte(rest, '\n')+1:]
+
+	const entrySize = 20
+	if len(rest) < count*entrySize {
+		return nil, errors.NotValidf("truncated xref table")
+	}
+	offsets := make([]int, count)
+	for n := 1; n < count; n++ {
+		entry := rest[n*entrySize : (n+1)*entrySize]
+		if entry[17] != 'n' {
+			return nil, errors.NotSupportedf("free object %d", n)
+		}
+		offsets[n], _ = strconv.Atoi(string(entry[:10]))
+	}
+	trailer := rest[count*entrySize:]
+	if bytes.Contains(trailer, []byte("/Encrypt")) {
+		return nil, errors.NotSupportedf("encrypted PDF")
+	}
+
+	doc := &gofpdfDocument{objects: make([][]byte, count)}
+	order := make([]int, 0, count-1)
+	for n := 1; n < count; n++ {
+		order = append(order, n)
+	}
+	sort.Slice(order, func(i, j int) bool { return offsets[order[i]] < offsets[order[j]] })
+	for i, n := range order {
+		end := xrefAt
+		if i+1 < len(order) {
+			end = offsets[order[i+1]]
+		}
+		object := data[offsets[n]:end]
+		if !bytes.HasPrefix(object, []byte(fmt.Sprintf("%d 0 obj", n))) {
+			return nil, errors.NotValidf("xref entry for object %d", n)
+		}
+		doc.objects[n] = object
+	}
+
+	for _, ref := range []struct {
+		re *regexp.Regexp
+		n  *int
+	}{{rootRE, &doc.root}, {infoRE, &doc.info}} {
+		m := ref.re.FindSubmatch(trailer)
+		if m == nil {
+			return nil, errors.NotValidf("trailer without %s", ref.re)
+		}
+		*ref.n, _ = strconv.Atoi(string(m[1]))
+		if *ref.n <= 0 || *ref.n >= count {
+			return nil, errors.NotValidf("trailer reference to object %d", *ref.n)
+		}
+	}
+	return doc, nil
+}
+
+// toPDFA3 rewrites a PDF from gofpdf as PDF/A-3b with a embedded as an
+// associated file: it adds the XMP identification, an sRGB output intent
+// and the file itself, and writes a fresh xref with a document ID. The PDF
+// must already be set in embedded fonts; see useEmbeddedFont.
+func toPDFA3(data []byte, a attachment) ([]byte, error) {
+	doc, err := parseGofpdf(data)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot read rendered PDF")
+	}
+
+	catalog := doc.objects[doc.root]
+	open, end := bytes.Index(catalog, []byte("<<")), bytes.LastIndex(catalog, []byte(">>"))
+	if open < 0 || end < open {
+		return nil, errors.NotValidf("catalog object %d", doc.root)
+	}
+	if bytes.Contains(catalog, []byte("/Names")) || bytes.Contains(catalog, []byte("/Metadata")) {
+		return nil, errors.NotSupportedf("catalog with names or metadata")
+	}
+
+	info := doc.objects[doc.info]
+	producer := "FPDF"
+	if m := producerRE.FindSubmatch(info); m != nil {
+		producer = string(m[1])
+	}
+	var created time.Time
+	if m := createdRE.FindSubmatch(info); m != nil {
+		created, _ = time.Parse("20060102150405", string(m[1]))
+	}
+
+	w := pdfWriter{offsets: make([]int, len(doc.objects))}
+	w.buf.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	for n, object := range doc.objects {
+		if n == 0 || n == doc.root {
+			continue
+		}
+		w.offsets[n] = w.buf.Len()
+		w.buf.Write(object)
+	}
+
+	compressed, err := deflate(a.Data)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	file := w.stream(compressed, fmt.Sprintf(
+		"/Type /EmbeddedFile /Subtype /%s /Filter /FlateDecode /Params << /ModDate %s /Size %d >>",
+		pdfName(a.MimeType), pdfString("D:"+created.Format("20060102150405")), len(a.Data),
+	))
+	spec := w.object(fmt.Sprintf(
+		"<< /Type /Filespec /F %[1]s /UF %[1]s /Desc %[2]s /AFRelationship /%[3]s /EF << /F %[4]d 0 R /UF %[4]d 0 R >> >>",
+		pdfString(a.Name), pdfString(a.Description), a.Relationship, file,
+	))
+	metadata := w.stream(a.Metadata(producer, created), "/Type /Metadata /Subtype /XML")
+	iccData, err := deflate(sRGBProfile())
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	icc := w.stream(iccData, "/N 3 /Filter /FlateDecode")
+	intent := w.object(fmt.Sprintf(
+		"<< /Type /OutputIntent /S /GTS_PDFA1 /OutputConditionIdentifier %[1]s /Info %[1]s /DestOutputProfile %[2]d 0 R >>",
+		pdfString("sRGB IEC61966-2.1"), icc,
+	))
+
+	w.offsets[doc.root] = w.buf.Len()
+	fmt.Fprintf(&w.buf, "%d 0 obj\n", doc.root)
+	w.buf.Write(catalog[open:end])
+	fmt.Fprintf(&w.buf, "/Metadata %d 0 R\n", metadata)
+	fmt.Fprintf(&w.buf, "/OutputIntents [%d 0 R]\n", intent)
+	fmt.Fprintf(&w.buf, "/AF [%d 0 R]\n", spec)
+	fmt.Fprintf(&w.buf, "/Names << /EmbeddedFiles << /Names [%s %d 0 R] >> >>\n", pdfString(a.Name), spec)
+	w.buf.WriteString(">>\nendobj\n")
+
+	return w.finish(doc.root, doc.info), nil
+}
+
+// pdfWriter writes objects and remembers where they are for the xref.
+type pdfWriter struct {
+	buf     bytes.Buffer
+	offsets []int
+}
+
+func (w *pdfWriter) object(body string) int {
+	n := len(w.offsets)
+	w.offsets = append(w.offsets, w.buf.Len())
+	fmt.Fprintf(&w.buf, "%d 0 obj\n%s\nendobj\n", n, body)
+	return n
+}
+
+func (w *pdfWriter) stream(data []byte, dict string) int {
+	n := len(w.offsets)
+	w.offsets = append(w.offsets, w.buf.Len())
+	fmt.Fprintf(&w.buf, "%d 0 obj\n<< %s /Length %d >>\nstream\n", n, dict, len(data))
+	w.buf.Write(data)
+	w.buf.WriteString("\nendstream\nendobj\n")
+	return n
+}
+
+func (w *pdfWriter) finish(root, info int) []byte {
+	id := md5.Sum(w.buf.Bytes())
+
+	xrefAt := w.buf.Len()
+	fmt.Fprintf(&w.buf, "xref\n0 %d\n0000000000 65535 f \n", len(w.offsets))
+	for _, offset := range w.offsets[1:] {
+		fmt.Fprintf(&w.buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&w.buf, "trailer\n<<\n/Size %d\n/Root %d 0 R\n/Info %d 0 R\n/ID [<%x> <%x>]\n>>\n",
+		len(w.offsets), root, info, id, id)
+	fmt.Fprintf(&w.buf, "startxref\n%d\n%%%%EOF\n", xrefAt)
+	return w.buf.Bytes()
+}
+
+func deflate(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// pdfString writes s as a literal string, escaping what needs it.
+func pdfString(s string) string {
+	var b bytes.Buffer
+	b.WriteByte('(')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '(', ')', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// pdfName escapes s for use as a name, so text/xml becomes text#2Fxml.
+func pdfName(s string) string {
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < '!' || c > '~' || bytes.IndexByte([]byte("#()<>[]{}/%"), c) >= 0 {
+			fmt.Fprintf(&b, "#%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,149 @@
+package pdf
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/johnfercher/maroto/pkg/color"
+	"github.com/johnfercher/maroto/pkg/consts"
+	"github.com/johnfercher/maroto/pkg/pdf"
+	"github.com/johnfercher/maroto/pkg/props"
+	"github.com/juju/errors"
+	uuid "github.com/satori/go.uuid"
+	"github.com/wham-invoice/wham-platform/db"
+)
+
+// gridColumns is how many columns maroto divides a row into.
+const gridColumns = 12
+
+// Table is a report laid out as a PDF: a title, a few lines under it, then a
+// table that runs over as many pages as it needs.
+type Table struct {
+	Title string
+	// Lines are shown under the title, e.g. the date the report is for.
+	Lines   []string
+	Columns []TableColumn
+	Rows    [][]string
+	// Footer rows, such as totals, are shown in bold after the rest.
+	Footer    [][]string
+	Landscape bool
+}
+
+// TableColumn is a column of a Table. The widths of a table's columns must
+// add up to 12.
+type TableColumn struct {
+	Header string
+	Width  uint
+	// Right aligns the column, as suits amounts.
+	Right bool
+}
+
+// RenderTable writes the table as a PDF to w.
+func RenderTable(w io.Writer, t Table, theme Theme) error {
+	var width uint
+	for _, col := range t.Columns {
+		width += col.Width
+	}
+	if width != gridColumns {
+		return errors.NotValidf("table columns %d wide", width)
+	}
+	for _, row := range append(append([][]string{}, t.Rows...), t.Footer...) {
+		if len(row) != len(t.Columns) {
+			return errors.NotValidf("table row with %d cells for %d columns", len(row), len(t.Columns))
+		}
+	}
+
+	orientation := consts.Portrait
+	if t.Landscape {
+		orientation = consts.Landscape
+	}
+	m := pdf.NewMaroto(orientation, consts.A4)
+	m.SetDefaultFontFamily(theme.Font)
+	m.SetPageMargins(10, 10, 10)
+
+	m.Row(10, func() {
+		m.Col(gridColumns, func() {
+			m.Text(t.Title, props.Text{
+				Size:  14,
+				Style: consts.Bold,
+				Color: theme.Accent,
+			})
+		})
+	})
+	for _, line := range t.Lines {
+		m.Row(5, func() {
+			m.Col(gridColumns, func() {
+				m.Text(line, props.Text{Size: 9})
+			})
+		})
+	}
+	m.Row(4, func() {
+		m.ColSpace(gridColumns)
+	})
+
+	header := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		header[i] = col.Header
+	}
+	m.SetBackgroundColor(theme.Header)
+	tableRow(m, t.Columns, header, props.Text{Size: 8, Style: consts.Bold, Color: color.NewWhite()})
+	m.SetBackgroundColor(color.NewWhite())
+
+	for i, row := range t.Rows {
+		if i%2 == 1 {
+			m.SetBackgroundColor(theme.Stripe)
+		}
+		tableRow(m, t.Columns, row, props.Text{Size: 8})
+		m.SetBackgroundColor(color.NewWhite())
+	}
+	if len(t.Footer) > 0 {
+		m.Line(1)
+	}
+	for _, row := range t.Footer {
+		tableRow(m, t.Columns, row, props.Text{Size: 8, Style: consts.Bold})
+	}
+
+	buf, err := m.Output()
+	if err != nil {
+		return errors.Annotate(err, "could not render PDF")
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return errors.Annotate(err, "could not write PDF")
+	}
+	return nil
+}
+
+// CreateTablePDF renders the table and stores it as CreatePDF stores
+// invoices, returning the ID of the stored file.
+func CreateTablePDF(ctx context.Context, app *db.App, t Table, theme Theme) (string, error) {
+	pdfID := uuid.NewV4().String()
+
+	var buf bytes.Buffer
+	if err := RenderTable(&buf, t, theme); err != nil {
+		return "", errors.Trace(err)
+	}
+	if err := app.StorePDF(ctx, pdfID, &buf); err != nil {
+		return "", errors.Trace(err)
+	}
+
+	return pdfID, nil
+}
+
+// tableRow draws one row of cells in text's style.
+func tableRow(m pdf.Maroto, columns []TableColumn, cells []string, text props.Text) {
+	m.Row(6, func() {
+		for i, col := range columns {
+			cell := text
+			cell.Top = 1.5
+			cell.Align = consts.Left
+			if col.Right {
+				cell.Align = consts.Right
+			}
+			value := cells[i]
+			m.Col(col.Width, func() {
+				m.Text(value, cell)
+			})
+		}
+	})
+}
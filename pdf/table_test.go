@@ -0,0 +1,60 @@
+package pdf_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/pdf"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+func fixtureTable() pdf.Table {
+	return pdf.Table{
+		Title: "Aged receivables",
+		Lines: []string{"As at 30 June 2022"},
+		Columns: []pdf.TableColumn{
+			{Header: "Contact", Width: 6},
+			{Header: "Invoices", Width: 2, Right: true},
+			{Header: "Total", Width: 4, Right: true},
+		},
+		Rows: [][]string{
+			{"Ann Adams", "1", "115.00"},
+			{"Bob Brown", "2", "230.00"},
+			{"Jane Smith", "1", "57.50"},
+		},
+		Footer:    [][]string{{"Total", "4", "402.50"}},
+		Landscape: true,
+	}
+}
+
+// TestTable is on templateSuite so the PDF is rendered with the same pinned
+// dates as the templates.
+func (s *templateSuite) TestTable(c *gc.C) {
+	var buf bytes.Buffer
+	c.Assert(pdf.RenderTable(&buf, fixtureTable(), pdf.DefaultTheme()), jc.ErrorIsNil)
+	got := buf.Bytes()
+
+	golden := filepath.Join("testdata", "table.golden.pdf")
+	if *update {
+		c.Assert(ioutil.WriteFile(golden, got, 0644), jc.ErrorIsNil)
+	}
+	want, err := ioutil.ReadFile(golden)
+	c.Assert(err, jc.ErrorIsNil)
+	if !bytes.Equal(got, want) {
+		c.Errorf("%s does not match; rerun with -update and check the new PDF", golden)
+	}
+}
+
+func (s *templateSuite) TestTableInvalid(c *gc.C) {
+	t := fixtureTable()
+	t.Columns[0].Width = 5
+	c.Check(errors.IsNotValid(pdf.RenderTable(ioutil.Discard, t, pdf.DefaultTheme())), jc.IsTrue)
+
+	t = fixtureTable()
+	t.Rows = append(t.Rows, []string{"Short"})
+	c.Check(errors.IsNotValid(pdf.RenderTable(ioutil.Discard, t, pdf.DefaultTheme())), jc.IsTrue)
+}
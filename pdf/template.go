@@ -0,0 +1,90 @@
+package pdf
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/johnfercher/maroto/pkg/pdf"
+	"github.com/wham-invoice/wham-platform/util"
+)
+
+// DefaultTemplate is used when neither the invoice nor the issuer's profile
+// picks a template.
+const DefaultTemplate = "classic"
+
+// Template lays out an invoice. New layouts only need to implement this and
+// call Register from an init func; nothing else refers to them by type.
+type Template interface {
+	// Name identifies the template in profiles, invoices and requests.
+	Name() string
+	// Render draws the invoice described by b onto m using theme. The
+	// document has been created but nothing has been drawn on it yet.
+	Render(m pdf.Maroto, b Builder, theme Theme)
+}
+
+var (
+	templatesMu sync.RWMutex
+	templates   = map[string]Template{}
+)
+
+// Register makes t available by name. It panics if the name is already
+// taken, because that can only be a programming error.
+func Register(t Template) {
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+
+	if _, ok := templates[t.Name()]; ok {
+		panic(fmt.Sprintf("pdf template %q registered twice", t.Name()))
+	}
+	templates[t.Name()] = t
+}
+
+// LookupTemplate returns the template registered as name.
+func LookupTemplate(name string) (Template, bool) {
+	templatesMu.RLock()
+	defer templatesMu.RUnlock()
+
+	t, ok := templates[name]
+	return t, ok
+}
+
+// TemplateNames returns the names of all registered templates, sorted.
+func TemplateNames() []string {
+	templatesMu.RLock()
+	defer templatesMu.RUnlock()
+
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// template returns the template chosen for the invoice, then the issuer's
+// default, then DefaultTemplate. Unknown names are skipped so that removing a
+// template never stops old invoices from rendering.
+func (b Builder) template() Template {
+	var names []string
+	if b.Invoice != nil {
+		names = append(names, b.Invoice.Template)
+	}
+	if b.Profile != nil {
+		names = append(names, b.Profile.DefaultTemplate)
+	}
+
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if t, ok := LookupTemplate(name); ok {
+			return t
+		}
+		util.Logger.Warnf("ignoring unknown pdf template %q", name)
+	}
+
+	t, _ := LookupTemplate(DefaultTemplate)
+	return t
+}
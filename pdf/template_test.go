@@ -0,0 +1,166 @@
+package pdf_test
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/pdf"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+type templateSuite struct{}
+
+var _ = gc.Suite(&templateSuite{})
+
+func (s *templateSuite) SetUpSuite(c *gc.C) {
+	// Pin everything gofpdf would otherwise vary between runs.
+	gofpdf.SetDefaultCreationDate(time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC))
+	gofpdf.SetDefaultCatalogSort(true)
+}
+
+func (s *templateSuite) TearDownSuite(c *gc.C) {
+	gofpdf.SetDefaultCreationDate(time.Time{})
+	gofpdf.SetDefaultCatalogSort(false)
+}
+
+func (s *templateSuite) TestBuiltInTemplates(c *gc.C) {
+	c.Check(pdf.TemplateNames(), jc.DeepEquals, []string{"classic", "compact", "modern"})
+}
+
+func (s *templateSuite) TestGolden(c *gc.C) {
+	for _, name := range pdf.TemplateNames() {
+		c.Logf("template %s", name)
+
+		b := fixtureBuilder()
+		b.Invoice.Template = name
+		s.checkGolden(c, b, name)
+	}
+}
+
+func (s *templateSuite) TestProfileDefaultTemplate(c *gc.C) {
+	b := fixtureBuilder()
+	b.Profile.DefaultTemplate = "compact"
+
+	s.checkGolden(c, b, "compact")
+}
+
+func (s *templateSuite) TestUnknownTemplateFallsBack(c *gc.C) {
+	b := fixtureBuilder()
+	b.Invoice.Template = "retired"
+
+	s.checkGolden(c, b, pdf.DefaultTemplate)
+}
+
+func (s *templateSuite) TestContactWithoutAddress(c *gc.C) {
+	for _, name := range pdf.TemplateNames() {
+		b := fixtureBuilder()
+		b.Invoice.Template = name
+		b.Contact.Address = nil
+		var buf bytes.Buffer
+		c.Check(pdf.Render(&buf, b), jc.ErrorIsNil, gc.Commentf("template %s", name))
+	}
+}
+
+// checkGolden renders b and compares it to testdata/<name>.golden.pdf.
+func (s *templateSuite) checkGolden(c *gc.C, b pdf.Builder, name string) {
+	var buf bytes.Buffer
+	c.Assert(pdf.Render(&buf, b), jc.ErrorIsNil)
+	got := buf.Bytes()
+
+	golden := filepath.Join("testdata", name+".golden.pdf")
+	if *update {
+		c.Assert(ioutil.WriteFile(golden, got, 0644), jc.ErrorIsNil)
+	}
+
+	want, err := ioutil.ReadFile(golden)
+	c.Assert(err, jc.ErrorIsNil)
+	if !bytes.Equal(got, want) {
+		c.Errorf("%s does not match; rerun with -update and check the new PDF", golden)
+	}
+}
+
+// fixtureBuilder returns an invoice with every field the templates draw.
+func fixtureBuilder() pdf.Builder {
+	issued := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	return pdf.Builder{
+		Invoice: &db.Invoice{
+			Number:      42,
+			Rate:        120,
+			Hours:       7.5,
+			Description: "Website maintenance",
+			IssueDate:   issued,
+			DueDate:     issued.AddDate(0, 0, 14),
+		},
+		User: &db.User{
+			FirstName: "Jane",
+			LastName:  "Doe",
+		},
+		Profile: &db.BusinessProfile{
+			TradingName:         "Doe Digital",
+			LegalName:           "Doe Digital Limited",
+			TaxNumber:           "123-456-789",
+			Phone:               "021 555 0100",
+			Email:               "jane@doe.example",
+			BankAccount:         "12-3456-7890123-00",
+			PaymentInstructions: "Please use the invoice number as the reference.",
+			Address: &db.Address{
+				FirstLine: "1 Queen Street",
+				Suburb:    "Auckland CBD",
+				Postcode:  "1010",
+				Country:   "New Zealand",
+			},
+		},
+		Contact: &db.Contact{
+			FirstName: "John",
+			LastName:  "Smith",
+			Company:   "Smith & Co",
+			Email:     "john@smith.example",
+			Address: &db.Address{
+				FirstLine:  "99 Cuba Street",
+				SecondLine: "Level 2",
+				Suburb:     "Te Aro",
+				Postcode:   "6011",
+				Country:    "New Zealand",
+			},
+		},
+	}
+}
+
+func (s *templateSuite) TestPlaceholders(c *gc.C) {
+	b := fixtureBuilder()
+	b.Contact.CustomFields = map[string]string{"po_number": "PO-7"}
+	b.Invoice.Description = "Maintenance for {contact.company}, {field.po_number}"
+	b.Profile.PaymentInstructions = "Thanks {contact.first_name}."
+	var got bytes.Buffer
+	c.Assert(pdf.Render(&got, b), jc.ErrorIsNil)
+
+	// The stored invoice and profile keep their placeholders.
+	c.Check(b.Invoice.Description, gc.Equals, "Maintenance for {contact.company}, {field.po_number}")
+	c.Check(b.Profile.PaymentInstructions, gc.Equals, "Thanks {contact.first_name}.")
+
+	want := fixtureBuilder()
+	want.Contact.CustomFields = b.Contact.CustomFields
+	want.Invoice.Description = "Maintenance for Smith & Co, PO-7"
+	want.Profile.PaymentInstructions = "Thanks John."
+	var expected bytes.Buffer
+	c.Assert(pdf.Render(&expected, want), jc.ErrorIsNil)
+	c.Check(bytes.Equal(got.Bytes(), expected.Bytes()), jc.IsTrue)
+}
+
+func (s *templateSuite) TestCurrencyAndTaxTreatment(c *gc.C) {
+	b := fixtureBuilder()
+	b.Invoice.Currency = "AUD"
+	b.Invoice.TaxTreatment = db.TaxZeroRated
+
+	s.checkGolden(c, b, "classic-aud-zero-rated")
+}
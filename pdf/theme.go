@@ -0,0 +1,197 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	// Register the decoders for the logo formats we accept.
+	_ "image/jpeg"
+	_ "image/png"
+	"strconv"
+	"strings"
+
+	"github.com/johnfercher/maroto/pkg/color"
+	"github.com/johnfercher/maroto/pkg/consts"
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+)
+
+const (
+	// MaxLogoBytes is the largest logo file we accept.
+	MaxLogoBytes = 1 << 20
+	// maxLogoPixels bounds each side of a logo so huge images don't bloat
+	// every PDF we render.
+	maxLogoPixels = 2000
+)
+
+// fonts are the families we can render without embedding font files.
+var fonts = map[string]bool{
+	consts.Arial:     true,
+	consts.Helvetica: true,
+	consts.Courier:   true,
+	"times":          true,
+}
+
+// Theme holds the colours and font applied to a PDF.
+type Theme struct {
+	// Accent is used for the issuer details and the invoice total.
+	Accent color.Color
+	// Stripe is the alternating background of table rows.
+	Stripe color.Color
+	// Header is the bar above the table and the footer text.
+	Header color.Color
+	Font   string
+}
+
+// DefaultTheme returns the theme used when the user hasn't chosen one.
+func DefaultTheme() Theme {
+	return Theme{
+		Accent: getBlueColor(),
+		Stripe: getGrayColor(),
+		Header: getDarkGrayColor(),
+		Font:   consts.Arial,
+	}
+}
+
+// NewTheme returns the theme described by t, using the defaults for anything
+// left blank. It returns an error if a colour or font is not valid.
+func NewTheme(t *db.Theme) (Theme, error) {
+	theme := DefaultTheme()
+	if t == nil {
+		return theme, nil
+	}
+
+	for _, c := range []struct {
+		hex string
+		dst *color.Color
+	}{
+		{t.AccentColor, &theme.Accent},
+		{t.StripeColor, &theme.Stripe},
+		{t.HeaderColor, &theme.Header},
+	} {
+		if c.hex == "" {
+			continue
+		}
+		parsed, err := parseColor(c.hex)
+		if err != nil {
+			return theme, errors.Trace(err)
+		}
+		*c.dst = parsed
+	}
+
+	if t.Font != "" {
+		font := strings.ToLower(t.Font)
+		if !fonts[font] {
+			return theme, errors.NotValidf("font %q", t.Font)
+		}
+		theme.Font = font
+	}
+
+	return theme, nil
+}
+
+// parseColor parses a "#rrggbb" hex colour.
+func parseColor(hex string) (color.Color, error) {
+	s := strings.TrimPrefix(hex, "#")
+	if len(s) != 6 {
+		return color.Color{}, errors.NotValidf("colour %q", hex)
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.Color{}, errors.NotValidf("colour %q", hex)
+	}
+
+	return color.Color{
+		Red:   int(v >> 16 & 0xff),
+		Green: int(v >> 8 & 0xff),
+		Blue:  int(v & 0xff),
+	}, nil
+}
+
+// ValidateLogo checks that data is a PNG or JPEG of a sensible size and
+// returns its MIME type.
+func ValidateLogo(data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", errors.NotValidf("empty logo")
+	}
+	if len(data) > MaxLogoBytes {
+		return "", errors.NotValidf("logo larger than %d bytes", MaxLogoBytes)
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", errors.NotValidf("logo image")
+	}
+	var mimeType string
+	switch format {
+	case "png":
+		mimeType = "image/png"
+	case "jpeg":
+		mimeType = "image/jpeg"
+	default:
+		return "", errors.NotValidf("logo format %q", format)
+	}
+
+	if cfg.Width > maxLogoPixels || cfg.Height > maxLogoPixels {
+		return "", errors.NotValidf(
+			"logo of %dx%d pixels (max %d)", cfg.Width, cfg.Height, maxLogoPixels)
+	}
+
+	return mimeType, nil
+}
+
+// logoImage returns the logo encoded the way maroto wants it.
+func logoImage(data []byte) (string, consts.Extension, error) {
+	mimeType, err := ValidateLogo(data)
+	if err != nil {
+		return "", "", errors.Trace(err)
+	}
+
+	ext := consts.Png
+	if mimeType == "image/jpeg" {
+		ext = consts.Jpg
+	}
+
+	return base64.StdEncoding.EncodeToString(data), ext, nil
+}
+
+func getDarkGrayColor() color.Color {
+	return color.Color{
+		Red:   55,
+		Green: 55,
+		Blue:  55,
+	}
+}
+
+func getGrayColor() color.Color {
+	return color.Color{
+		Red:   200,
+		Green: 200,
+		Blue:  200,
+	}
+}
+
+func getBlueColor() color.Color {
+	return color.Color{
+		Red:   10,
+		Green: 10,
+		Blue:  150,
+	}
+}
+
+func getRedColor() color.Color {
+	return color.Color{
+		Red:   200,
+		Green: 30,
+		Blue:  30,
+	}
+}
+
+func getGreenColor() color.Color {
+	return color.Color{
+		Red:   20,
+		Green: 140,
+		Blue:  60,
+	}
+}
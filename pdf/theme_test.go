@@ -0,0 +1,66 @@
+package pdf_test
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+
+	"github.com/johnfercher/maroto/pkg/color"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/pdf"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type themeSuite struct{}
+
+var _ = gc.Suite(&themeSuite{})
+
+func (s *themeSuite) TestNilThemeIsDefault(c *gc.C) {
+	theme, err := pdf.NewTheme(nil)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(theme, jc.DeepEquals, pdf.DefaultTheme())
+}
+
+func (s *themeSuite) TestNewTheme(c *gc.C) {
+	theme, err := pdf.NewTheme(&db.Theme{
+		AccentColor: "#ff8000",
+		Font:        "Courier",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(theme.Accent, gc.Equals, color.Color{Red: 255, Green: 128, Blue: 0})
+	c.Check(theme.Stripe, gc.Equals, pdf.DefaultTheme().Stripe)
+	c.Check(theme.Font, gc.Equals, "courier")
+}
+
+func (s *themeSuite) TestNewThemeInvalid(c *gc.C) {
+	_, err := pdf.NewTheme(&db.Theme{AccentColor: "orange"})
+	c.Check(err, gc.ErrorMatches, `colour "orange" not valid`)
+
+	_, err = pdf.NewTheme(&db.Theme{Font: "comic sans"})
+	c.Check(err, gc.ErrorMatches, `font "comic sans" not valid`)
+}
+
+func (s *themeSuite) TestValidateLogo(c *gc.C) {
+	mimeType, err := pdf.ValidateLogo(pngBytes(c, 100, 50))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(mimeType, gc.Equals, "image/png")
+}
+
+func (s *themeSuite) TestValidateLogoTooLarge(c *gc.C) {
+	_, err := pdf.ValidateLogo(pngBytes(c, 3000, 10))
+	c.Check(err, gc.ErrorMatches, `logo of 3000x10 pixels \(max 2000\) not valid`)
+}
+
+func (s *themeSuite) TestValidateLogoNotImage(c *gc.C) {
+	_, err := pdf.ValidateLogo([]byte("not an image"))
+	c.Check(err, gc.ErrorMatches, `logo image not valid`)
+}
+
+func pngBytes(c *gc.C, width, height int) []byte {
+	var buf bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	c.Assert(png.Encode(&buf, img), jc.ErrorIsNil)
+	return buf.Bytes()
+}
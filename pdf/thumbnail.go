@@ -0,0 +1,39 @@
+package pdf
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strconv"
+
+	"github.com/juju/errors"
+)
+
+// ThumbnailWidth is the width in pixels of invoice thumbnails.
+const ThumbnailWidth = 600
+
+// Thumbnail renders the first page of the PDF in data as a PNG, width pixels
+// wide. It needs pdftoppm from poppler-utils; if that isn't installed it
+// returns an error satisfying errors.IsNotSupported.
+func Thumbnail(ctx context.Context, data []byte, width int) ([]byte, error) {
+	pdftoppm, err := exec.LookPath("pdftoppm")
+	if err != nil {
+		return nil, errors.NewNotSupported(err, "thumbnails without pdftoppm")
+	}
+
+	// With no output root, pdftoppm writes the single page to stdout.
+	cmd := exec.CommandContext(ctx, pdftoppm,
+		"-png", "-singlefile", "-f", "1", "-l", "1",
+		"-scale-to-x", strconv.Itoa(width), "-scale-to-y", "-1",
+		"-",
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Annotatef(err, "pdftoppm failed: %s", bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return stdout.Bytes(), nil
+}
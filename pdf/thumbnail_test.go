@@ -0,0 +1,32 @@
+package pdf_test
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"os/exec"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/wham-invoice/wham-platform/pdf"
+)
+
+type thumbnailSuite struct{}
+
+var _ = gc.Suite(&thumbnailSuite{})
+
+func (s *thumbnailSuite) TestThumbnail(c *gc.C) {
+	if _, err := exec.LookPath("pdftoppm"); err != nil {
+		c.Skip("pdftoppm not installed")
+	}
+
+	var buf bytes.Buffer
+	c.Assert(pdf.Render(&buf, fixtureBuilder()), jc.ErrorIsNil)
+
+	data, err := pdf.Thumbnail(context.Background(), buf.Bytes(), 200)
+	c.Assert(err, jc.ErrorIsNil)
+	img, err := png.Decode(bytes.NewReader(data))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(img.Bounds().Dx(), gc.Equals, 200)
+}
@@ -0,0 +1,58 @@
+// Package placeholder fills details of the contact being billed into text the
+// user writes once, such as invoice descriptions and email messages.
+//
+// Placeholders are written in braces: {contact.first_name} and the other
+// contact fields, {invoice.number} and {invoice.due_date}, and {field.key}
+// for the contact's custom fields. Unknown placeholders are left as they are,
+// so a typo shows up in the output rather than silently disappearing.
+package placeholder
+
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/wham-invoice/wham-platform/db"
+)
+
+var pattern = regexp.MustCompile(`\{[a-z]+\.[a-z0-9_]+\}`)
+
+// Values returns what each placeholder stands for. Either argument may be
+// nil.
+func Values(contact *db.Contact, invoice *db.Invoice) map[string]string {
+	values := map[string]string{}
+	if contact != nil {
+		values["contact.first_name"] = contact.FirstName
+		values["contact.last_name"] = contact.LastName
+		values["contact.name"] = contact.GetFullName()
+		values["contact.company"] = contact.Company
+		values["contact.email"] = contact.Email
+		values["contact.phone"] = contact.Phone
+		values["contact.buyer_reference"] = contact.BuyerReference
+		for key, value := range contact.CustomFields {
+			values["field."+key] = value
+		}
+	}
+	if invoice != nil {
+		values["invoice.number"] = strconv.Itoa(invoice.Number)
+		values["invoice.due_date"] = invoice.DueDate.Format("2 January 2006")
+	}
+	return values
+}
+
+// Expand replaces the placeholders in s with their values.
+func Expand(s string, values map[string]string) string {
+	return pattern.ReplaceAllStringFunc(s, func(p string) string {
+		if value, ok := values[p[1:len(p)-1]]; ok {
+			return value
+		}
+		return p
+	})
+}
+
+// Invoice returns a copy of invoice with the placeholders in its description
+// filled in for contact.
+func Invoice(invoice *db.Invoice, contact *db.Contact) *db.Invoice {
+	expanded := *invoice
+	expanded.Description = Expand(invoice.Description, Values(contact, invoice))
+	return &expanded
+}
@@ -0,0 +1,52 @@
+package placeholder_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/placeholder"
+
+	gc "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+type placeholderSuite struct{}
+
+var _ = gc.Suite(&placeholderSuite{})
+
+func (s *placeholderSuite) TestExpand(c *gc.C) {
+	contact := &db.Contact{
+		FirstName:    "Jane",
+		LastName:     "Smith",
+		Company:      "Smith & Co",
+		CustomFields: map[string]string{"po_number": "PO-7"},
+	}
+	invoice := &db.Invoice{
+		Number:  42,
+		DueDate: time.Date(2022, 3, 15, 0, 0, 0, 0, time.UTC),
+	}
+	values := placeholder.Values(contact, invoice)
+
+	for _, t := range []struct{ in, out string }{
+		{"Hi {contact.first_name}", "Hi Jane"},
+		{"{contact.name} at {contact.company}", "Jane Smith at Smith & Co"},
+		{"PO {field.po_number}", "PO PO-7"},
+		{"Invoice {invoice.number} due {invoice.due_date}", "Invoice 42 due 15 March 2022"},
+		// Unknown placeholders and stray braces are left alone.
+		{"{field.missing} {contact} {Contact.first_name}", "{field.missing} {contact} {Contact.first_name}"},
+	} {
+		c.Check(placeholder.Expand(t.in, values), gc.Equals, t.out, gc.Commentf("%q", t.in))
+	}
+}
+
+func (s *placeholderSuite) TestInvoice(c *gc.C) {
+	invoice := &db.Invoice{Description: "Retainer for {contact.company}"}
+
+	expanded := placeholder.Invoice(invoice, &db.Contact{Company: "Acme"})
+	c.Check(expanded.Description, gc.Equals, "Retainer for Acme")
+	c.Check(invoice.Description, gc.Equals, "Retainer for {contact.company}")
+}
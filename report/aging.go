@@ -0,0 +1,356 @@
+// Package report works out summaries of a user's or organisation's
+// invoices, such as who owes them what.
+package report
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/export"
+	"github.com/wham-invoice/wham-platform/pdf"
+)
+
+// AgingBuckets label how overdue the balances in each column of an aging
+// report are, in order.
+var AgingBuckets = []string{"Current", "1-30 days", "31-60 days", "61-90 days", "90+ days"}
+
+// agingBucket returns which of AgingBuckets an invoice days overdue falls
+// in.
+func agingBucket(days int) int {
+	switch {
+	case days <= 0:
+		return 0
+	case days <= 30:
+		return 1
+	case days <= 60:
+		return 2
+	case days <= 90:
+		return 3
+	}
+	return 4
+}
+
+// Balances are amounts outstanding by how overdue they are.
+type Balances struct {
+	Current    float64 `json:"current"`
+	Days1To30  float64 `json:"days_1_30"`
+	Days31To60 float64 `json:"days_31_60"`
+	Days61To90 float64 `json:"days_61_90"`
+	Over90     float64 `json:"days_90_plus"`
+	Total      float64 `json:"total"`
+}
+
+// buckets are balances in cents, so adding them up is exact.
+type buckets [5]int64
+
+func (b buckets) balances() Balances {
+	var total int64
+	for _, c := range b {
+		total += c
+	}
+	return Balances{
+		Current:    dollars(b[0]),
+		Days1To30:  dollars(b[1]),
+		Days31To60: dollars(b[2]),
+		Days61To90: dollars(b[3]),
+		Over90:     dollars(b[4]),
+		Total:      dollars(total),
+	}
+}
+
+// AgingRow is what one contact owes in one currency.
+type AgingRow struct {
+	ContactID string `json:"contact_id"`
+	Name      string `json:"name"`
+	Company   string `json:"company,omitempty"`
+	Currency  string `json:"currency"`
+	Invoices  int    `json:"invoices"`
+	Balances
+}
+
+// AgingTotal is everything owed in one currency.
+type AgingTotal struct {
+	Currency string `json:"currency"`
+	Invoices int    `json:"invoices"`
+	Balances
+}
+
+// AgingReport is who owed what, and for how long, at the end of AsOf.
+type AgingReport struct {
+	AsOf time.Time `json:"as_of"`
+	// Rows are sorted by name, then currency.
+	Rows []AgingRow `json:"rows"`
+	// Totals are sorted by currency. Amounts in different currencies are
+	// never added together.
+	Totals []AgingTotal `json:"totals"`
+}
+
+// Aging builds an AgingReport from invoices and credit notes added one at a
+// time.
+type Aging struct {
+	asOf time.Time
+	// invoices are the ones outstanding at asOf.
+	invoices []agingInvoice
+	// credited is what the credit notes issued by asOf took off each
+	// invoice, in cents, by invoice ID.
+	credited map[string]int64
+	// contacts are who each contact ID is, as far as we know.
+	contacts map[string]*db.Contact
+}
+
+// agingInvoice is an outstanding invoice, before its credit notes are taken
+// off.
+type agingInvoice struct {
+	id     string
+	key    agingKey
+	bucket int
+	total  int64
+}
+
+type agingKey struct {
+	contactID, currency string
+}
+
+type agingRow struct {
+	invoices int
+	buckets  buckets
+}
+
+// NewAging returns an empty report as of the end of the day asOf falls on.
+func NewAging(asOf time.Time) *Aging {
+	return &Aging{
+		asOf:     date(asOf),
+		credited: map[string]int64{},
+		contacts: map[string]*db.Contact{},
+	}
+}
+
+// Outstanding reports whether the invoice was owed at the end of asOf: it
+// had been issued, and wasn't a draft, void, or paid by then. Invoices
+// marked paid without a date are taken to have been paid all along.
+func Outstanding(i *db.Invoice, asOf time.Time) bool {
+	asOf = date(asOf)
+	if date(i.IssueDate).After(asOf) {
+		return false
+	}
+	switch i.CurrentStatus() {
+	case db.InvoiceStatusDraft, db.InvoiceStatusVoid:
+		return false
+	case db.InvoiceStatusPaid:
+		return !i.PaidDate.IsZero() && date(i.PaidDate).After(asOf)
+	}
+	return true
+}
+
+// DaysOverdue returns how many days past its due date the invoice was at
+// asOf, counting calendar days. It is zero or less for invoices not yet due.
+func DaysOverdue(i *db.Invoice, asOf time.Time) int {
+	return int(date(asOf).Sub(date(i.DueDate)).Hours() / 24)
+}
+
+// Add counts the invoice if it was outstanding, under contact, who may be
+// nil if they've gone. What it counts for is less any credit notes added
+// for it, in either order.
+func (a *Aging) Add(i *db.Invoice, contact *db.Contact) {
+	if !Outstanding(i, a.asOf) {
+		return
+	}
+	if contact == nil {
+		contact = i.BillTo
+	}
+	if contact != nil {
+		a.contacts[i.ContactID] = contact
+	}
+	a.invoices = append(a.invoices, agingInvoice{
+		id:     i.ID,
+		key:    agingKey{contactID: i.ContactID, currency: currency(i)},
+		bucket: agingBucket(DaysOverdue(i, a.asOf)),
+		total:  db.Cents(i.GetTotal()),
+	})
+}
+
+// AddCreditNote takes the credit note off what its invoice was owed, if it
+// had been issued by asOf.
+func (a *Aging) AddCreditNote(n *db.CreditNote) {
+	if date(n.IssueDate).After(a.asOf) {
+		return
+	}
+	a.credited[n.InvoiceID] += db.Cents(n.GetTotal())
+}
+
+// rows returns what each contact owed in each currency. Invoices credited
+// in full weren't owed at all, so aren't counted.
+func (a *Aging) rows() map[agingKey]*agingRow {
+	rows := map[agingKey]*agingRow{}
+	for _, i := range a.invoices {
+		balance := i.total - a.credited[i.id]
+		if balance <= 0 {
+			continue
+		}
+		row := rows[i.key]
+		if row == nil {
+			row = &agingRow{}
+			rows[i.key] = row
+		}
+		row.invoices++
+		row.buckets[i.bucket] += balance
+	}
+	return rows
+}
+
+// Report returns the report of the invoices and credit notes added so far.
+func (a *Aging) Report() AgingReport {
+	report := AgingReport{AsOf: a.asOf, Rows: []AgingRow{}, Totals: []AgingTotal{}}
+	totals := map[string]*AgingTotal{}
+	sums := map[string]*buckets{}
+	for key, row := range a.rows() {
+		r := AgingRow{
+			ContactID: key.contactID,
+			Currency:  key.currency,
+			Invoices:  row.invoices,
+			Balances:  row.buckets.balances(),
+		}
+		if contact := a.contacts[key.contactID]; contact != nil {
+			r.Name = strings.TrimSpace(contact.GetFullName())
+			r.Company = contact.Company
+		}
+		report.Rows = append(report.Rows, r)
+
+		if totals[key.currency] == nil {
+			totals[key.currency] = &AgingTotal{Currency: key.currency}
+			sums[key.currency] = &buckets{}
+		}
+		totals[key.currency].Invoices += row.invoices
+		for i, c := range row.buckets {
+			sums[key.currency][i] += c
+		}
+	}
+	for currency, total := range totals {
+		total.Balances = sums[currency].balances()
+		report.Totals = append(report.Totals, *total)
+	}
+
+	sort.Slice(report.Rows, func(i, j int) bool {
+		a, b := report.Rows[i], report.Rows[j]
+		if a.Name != b.Name {
+			return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+		}
+		if a.Currency != b.Currency {
+			return a.Currency < b.Currency
+		}
+		return a.ContactID < b.ContactID
+	})
+	sort.Slice(report.Totals, func(i, j int) bool {
+		return report.Totals[i].Currency < report.Totals[j].Currency
+	})
+	return report
+}
+
+// AgingHeader is the header row of the report as a table.
+func AgingHeader() []string {
+	return append(append([]string{"Contact", "Company", "Currency", "Invoices"}, AgingBuckets...), "Total")
+}
+
+// WriteTable writes the report as a spreadsheet: a row for each contact and
+// currency, then a total for each currency.
+func (r AgingReport) WriteTable(w export.RowWriter) error {
+	header := make([]export.Cell, 0, len(AgingHeader()))
+	for _, h := range AgingHeader() {
+		header = append(header, export.Text(h))
+	}
+	if err := w.WriteRow(header); err != nil {
+		return errors.Trace(err)
+	}
+	for _, row := range r.Rows {
+		cells := []export.Cell{
+			export.Text(row.Name),
+			export.Text(row.Company),
+			export.Text(row.Currency),
+			export.Integer(row.Invoices),
+		}
+		if err := w.WriteRow(append(cells, row.Balances.cells()...)); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	for _, total := range r.Totals {
+		cells := []export.Cell{
+			export.Text("Total"),
+			export.Text(""),
+			export.Text(total.Currency),
+			export.Integer(total.Invoices),
+		}
+		if err := w.WriteRow(append(cells, total.Balances.cells()...)); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// PDFTable lays the report out for pdf.RenderTable, with the same rows as
+// WriteTable.
+func (r AgingReport) PDFTable() pdf.Table {
+	t := pdf.Table{
+		Title:     "Aged receivables",
+		Lines:     []string{"As at " + r.AsOf.Format("2 January 2006")},
+		Landscape: true,
+	}
+	for i, header := range AgingHeader() {
+		col := pdf.TableColumn{Header: header, Width: 1, Right: i >= 3}
+		if i < 2 {
+			col.Width = 2
+		}
+		t.Columns = append(t.Columns, col)
+	}
+	for _, row := range r.Rows {
+		cells := []string{row.Name, row.Company, row.Currency, strconv.Itoa(row.Invoices)}
+		t.Rows = append(t.Rows, append(cells, row.Balances.Strings()...))
+	}
+	for _, total := range r.Totals {
+		cells := []string{"Total", "", total.Currency, strconv.Itoa(total.Invoices)}
+		t.Footer = append(t.Footer, append(cells, total.Balances.Strings()...))
+	}
+	return t
+}
+
+func (b Balances) cells() []export.Cell {
+	return []export.Cell{
+		money(b.Current), money(b.Days1To30), money(b.Days31To60),
+		money(b.Days61To90), money(b.Over90), money(b.Total),
+	}
+}
+
+// Strings returns the balances formatted for display, in the order of
+// AgingBuckets followed by the total.
+func (b Balances) Strings() []string {
+	var s []string
+	for _, cell := range b.cells() {
+		s = append(s, cell.String())
+	}
+	return s
+}
+
+func money(f float64) export.Cell {
+	return export.Cell{Kind: export.KindMoney, Number: f}
+}
+
+func currency(i *db.Invoice) string {
+	if i.Currency == "" {
+		return db.DefaultCurrency
+	}
+	return i.Currency
+}
+
+func dollars(c int64) float64 {
+	return float64(c) / 100
+}
+
+// date returns the start of t's day, in UTC, so days between dates come out
+// whole.
+func date(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
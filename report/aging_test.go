@@ -0,0 +1,166 @@
+package report_test
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/export"
+	"github.com/wham-invoice/wham-platform/report"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type agingSuite struct{}
+
+var _ = gc.Suite(&agingSuite{})
+
+var asOf = time.Date(2022, 6, 30, 17, 0, 0, 0, time.UTC)
+
+// invoice returns an invoice for $100 plus GST, due daysOverdue days before
+// asOf.
+func invoice(contactID string, daysOverdue int) *db.Invoice {
+	due := asOf.AddDate(0, 0, -daysOverdue)
+	return &db.Invoice{
+		ContactID: contactID,
+		Hours:     1,
+		Rate:      100,
+		IssueDate: due.AddDate(0, 0, -14),
+		DueDate:   due,
+		Status:    db.InvoiceStatusIssued,
+	}
+}
+
+func (s *agingSuite) TestBuckets(c *gc.C) {
+	jane := &db.Contact{ID: "jane", FirstName: "Jane", LastName: "Smith", Company: "Smithworks"}
+	aging := report.NewAging(asOf)
+	for _, days := range []int{-5, 0, 1, 30, 31, 60, 61, 90, 91, 400} {
+		aging.Add(invoice("jane", days), jane)
+	}
+
+	r := aging.Report()
+	c.Check(r.AsOf, gc.Equals, time.Date(2022, 6, 30, 0, 0, 0, 0, time.UTC))
+	c.Assert(r.Rows, gc.HasLen, 1)
+	c.Check(r.Rows[0], jc.DeepEquals, report.AgingRow{
+		ContactID: "jane",
+		Name:      "Jane Smith",
+		Company:   "Smithworks",
+		Currency:  "NZD",
+		Invoices:  10,
+		Balances: report.Balances{
+			Current:    230,
+			Days1To30:  230,
+			Days31To60: 230,
+			Days61To90: 230,
+			Over90:     230,
+			Total:      1150,
+		},
+	})
+	c.Check(r.Totals, jc.DeepEquals, []report.AgingTotal{{
+		Currency: "NZD",
+		Invoices: 10,
+		Balances: r.Rows[0].Balances,
+	}})
+}
+
+func (s *agingSuite) TestCreditNotes(c *gc.C) {
+	aging := report.NewAging(asOf)
+	credited := func(id string, amount float32, issued time.Time) {
+		aging.AddCreditNote(&db.CreditNote{InvoiceID: id, Amount: amount, IssueDate: issued})
+	}
+	// Credit notes count whichever order they're added in.
+	credited("part", 20, asOf.AddDate(0, 0, -1))
+	for _, id := range []string{"part", "full", "later"} {
+		i := invoice("jane", 45)
+		i.ID = id
+		aging.Add(i, nil)
+	}
+	credited("full", 100, asOf)
+	credited("later", 100, asOf.AddDate(0, 0, 1))
+
+	r := aging.Report()
+	c.Assert(r.Rows, gc.HasLen, 1)
+	c.Check(r.Rows[0].Invoices, gc.Equals, 2)
+	c.Check(r.Rows[0].Days31To60, gc.Equals, float64(92+115))
+}
+
+func (s *agingSuite) TestOutstanding(c *gc.C) {
+	paidLater := invoice("a", 10)
+	paidLater.Status = db.InvoiceStatusPaid
+	paidLater.PaidDate = asOf.AddDate(0, 0, 1)
+	c.Check(report.Outstanding(paidLater, asOf), jc.IsTrue)
+
+	paidSameDay := invoice("a", 10)
+	paidSameDay.Status = db.InvoiceStatusPaid
+	paidSameDay.PaidDate = asOf.Add(-time.Hour)
+	c.Check(report.Outstanding(paidSameDay, asOf), jc.IsFalse)
+
+	// Legacy invoices paid before dates were kept.
+	legacy := invoice("a", 10)
+	legacy.Status, legacy.Paid = "", true
+	c.Check(report.Outstanding(legacy, asOf), jc.IsFalse)
+
+	issuedLater := invoice("a", -30)
+	issuedLater.IssueDate = asOf.AddDate(0, 0, 1)
+	c.Check(report.Outstanding(issuedLater, asOf), jc.IsFalse)
+
+	for _, status := range []db.InvoiceStatus{db.InvoiceStatusDraft, db.InvoiceStatusVoid} {
+		i := invoice("a", 10)
+		i.Status = status
+		c.Check(report.Outstanding(i, asOf), jc.IsFalse, gc.Commentf("%s", status))
+	}
+	overdue := invoice("a", 10)
+	overdue.Status = db.InvoiceStatusOverdue
+	c.Check(report.Outstanding(overdue, asOf), jc.IsTrue)
+}
+
+func (s *agingSuite) TestCurrencies(c *gc.C) {
+	aging := report.NewAging(asOf)
+	aud := invoice("bob", 45)
+	aud.Currency = "AUD"
+	aud.TaxTreatment = db.TaxZeroRated
+	aging.Add(aud, &db.Contact{FirstName: "Bob", LastName: "Brown"})
+	aging.Add(invoice("bob", 45), nil)
+	// The contact has gone, but the invoice remembers who it was for.
+	gone := invoice("ann", 0)
+	gone.BillTo = &db.Contact{FirstName: "Ann", LastName: "Adams"}
+	aging.Add(gone, nil)
+
+	r := aging.Report()
+	c.Assert(r.Rows, gc.HasLen, 3)
+	c.Check(r.Rows[0].Name, gc.Equals, "Ann Adams")
+	c.Check(r.Rows[1].Currency, gc.Equals, "AUD")
+	c.Check(r.Rows[1].Days31To60, gc.Equals, float64(100))
+	c.Check(r.Rows[2].Currency, gc.Equals, "NZD")
+	c.Check(r.Rows[2].Days31To60, gc.Equals, float64(115))
+	c.Assert(r.Totals, gc.HasLen, 2)
+	c.Check(r.Totals[0].Total, gc.Equals, float64(100))
+	c.Check(r.Totals[1].Total, gc.Equals, float64(230))
+	c.Check(r.Totals[1].Invoices, gc.Equals, 2)
+}
+
+func (s *agingSuite) TestWriteTable(c *gc.C) {
+	aging := report.NewAging(asOf)
+	aging.Add(invoice("jane", 20), &db.Contact{FirstName: "Jane", LastName: "Smith"})
+
+	var buf bytes.Buffer
+	w := export.NewCSV(&buf)
+	c.Assert(aging.Report().WriteTable(w), jc.ErrorIsNil)
+	c.Assert(w.Close(), jc.ErrorIsNil)
+	c.Check(buf.String(), gc.Equals, ""+
+		"Contact,Company,Currency,Invoices,Current,1-30 days,31-60 days,61-90 days,90+ days,Total\n"+
+		"Jane Smith,,NZD,1,0.00,115.00,0.00,0.00,0.00,115.00\n"+
+		"Total,,NZD,1,0.00,115.00,0.00,0.00,0.00,115.00\n")
+}
+
+func (s *agingSuite) TestPDFTable(c *gc.C) {
+	aging := report.NewAging(asOf)
+	aging.Add(invoice("jane", 20), &db.Contact{FirstName: "Jane", LastName: "Smith"})
+
+	t := aging.Report().PDFTable()
+	c.Check(t.Lines, jc.DeepEquals, []string{"As at 30 June 2022"})
+	c.Assert(t.Rows, gc.HasLen, 1)
+	c.Check(t.Rows[0], jc.DeepEquals, []string{"Jane Smith", "", "NZD", "1", "0.00", "115.00", "0.00", "0.00", "0.00", "115.00"})
+	c.Check(t.Footer, gc.HasLen, 1)
+}
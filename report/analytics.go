@@ -0,0 +1,331 @@
+package report
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wham-invoice/wham-platform/db"
+)
+
+// DSOMonths is how many months, up to and including the current one, days
+// sales outstanding are worked out over.
+const DSOMonths = 3
+
+// RevenueMonth is what was invoiced and received in a month, in one
+// currency.
+type RevenueMonth struct {
+	// Month is as 2006-01.
+	Month    string  `json:"month"`
+	Currency string  `json:"currency"`
+	Invoices int64   `json:"invoices"`
+	Invoiced float64 `json:"invoiced"`
+	Credited float64 `json:"credited"`
+	// Revenue is what was invoiced less what was credited.
+	Revenue  float64 `json:"revenue"`
+	Received float64 `json:"received"`
+}
+
+// ContactRevenue is everything invoiced to a contact in one currency.
+type ContactRevenue struct {
+	ContactID   string  `json:"contact_id"`
+	Name        string  `json:"name"`
+	Company     string  `json:"company,omitempty"`
+	Currency    string  `json:"currency"`
+	Invoices    int64   `json:"invoices"`
+	Invoiced    float64 `json:"invoiced"`
+	Received    float64 `json:"received"`
+	Outstanding float64 `json:"outstanding"`
+	// AverageDaysToPay and AverageDaysLate are over the invoices paid with a
+	// known date, counting from the issue and due dates. They are nil if
+	// there are none.
+	AverageDaysToPay *float64 `json:"average_days_to_pay"`
+	AverageDaysLate  *float64 `json:"average_days_late"`
+}
+
+// StatusRevenue counts the invoices with a status in one currency.
+type StatusRevenue struct {
+	Status   db.InvoiceStatus `json:"status"`
+	Currency string           `json:"currency"`
+	Invoices int64            `json:"invoices"`
+	Amount   float64          `json:"amount"`
+}
+
+// DSO is days sales outstanding in one currency: how many days of sales are
+// owed, going by sales over the last DSOMonths months.
+type DSO struct {
+	Currency    string  `json:"currency"`
+	Receivables float64 `json:"receivables"`
+	Sales       float64 `json:"sales"`
+	Days        int     `json:"days"`
+	// DSO is nil if there were no sales.
+	DSO *float64 `json:"dso"`
+}
+
+// ForecastMonth is what outstanding invoices are expected to bring in
+// during a month, in one currency. Each invoice is expected to be paid as
+// many days after it is due as its contact has taken on average.
+type ForecastMonth struct {
+	Month    string  `json:"month"`
+	Currency string  `json:"currency"`
+	Expected float64 `json:"expected"`
+	// Overdue is the part of Expected that should already have come in, and
+	// is counted in the current month.
+	Overdue float64 `json:"overdue"`
+}
+
+// AnalyticsReport is how an owner's invoicing and cash flow are going.
+type AnalyticsReport struct {
+	AsOf time.Time `json:"as_of"`
+	// Months are the months asked for, oldest first.
+	Months []RevenueMonth `json:"months"`
+	// Contacts are sorted by what was invoiced, most first.
+	Contacts []ContactRevenue `json:"contacts"`
+	Statuses []StatusRevenue  `json:"statuses"`
+	DSO      []DSO            `json:"dso"`
+	Forecast []ForecastMonth  `json:"forecast"`
+}
+
+// NewAnalyticsReport works out the report from the owner's analytics as
+// they stand at now, over the months up to and including now's. contacts
+// name the contacts in the analytics; those missing are left unnamed.
+func NewAnalyticsReport(a *db.Analytics, contacts map[string]*db.Contact, now time.Time, months int) AnalyticsReport {
+	now = date(now)
+	return AnalyticsReport{
+		AsOf:     now,
+		Months:   revenueMonths(a, now, months),
+		Contacts: contactRevenue(a, contacts),
+		Statuses: statusRevenue(a),
+		DSO:      daysSalesOutstanding(a, now),
+		Forecast: forecast(a, now),
+	}
+}
+
+// lastMonths returns the n months up to and including t's, oldest first, as
+// 2006-01.
+func lastMonths(t time.Time, n int) []string {
+	first := time.Date(t.Year(), t.Month()-time.Month(n-1), 1, 0, 0, 0, 0, time.UTC)
+	months := make([]string, n)
+	for i := range months {
+		months[i] = first.AddDate(0, i, 0).Format("2006-01")
+	}
+	return months
+}
+
+func revenueMonths(a *db.Analytics, now time.Time, n int) []RevenueMonth {
+	months := lastMonths(now, n)
+	currencies := map[string]bool{}
+	for _, month := range months {
+		for cur, m := range a.Months[month] {
+			if m != (db.MonthTotals{}) {
+				currencies[cur] = true
+			}
+		}
+	}
+
+	// Every currency has every month, so they chart without gaps.
+	revenue := []RevenueMonth{}
+	for _, month := range months {
+		for _, cur := range sortedKeys(currencies) {
+			m := a.Months[month][cur]
+			revenue = append(revenue, RevenueMonth{
+				Month:    month,
+				Currency: cur,
+				Invoices: m.Invoices,
+				Invoiced: dollars(m.Invoiced),
+				Credited: dollars(m.Credited),
+				Revenue:  dollars(m.Invoiced - m.Credited),
+				Received: dollars(m.Received),
+			})
+		}
+	}
+	return revenue
+}
+
+func contactRevenue(a *db.Analytics, contacts map[string]*db.Contact) []ContactRevenue {
+	revenue := []ContactRevenue{}
+	for contactID, byCurrency := range a.Contacts {
+		for cur, c := range byCurrency {
+			if c.Invoices == 0 {
+				continue
+			}
+			r := ContactRevenue{
+				ContactID:   contactID,
+				Currency:    cur,
+				Invoices:    c.Invoices,
+				Invoiced:    dollars(c.Invoiced),
+				Received:    dollars(c.Received),
+				Outstanding: dollars(c.Outstanding),
+			}
+			if c.Paid > 0 {
+				r.AverageDaysToPay = ratio(c.DaysToPay, c.Paid)
+				r.AverageDaysLate = ratio(c.DaysLate, c.Paid)
+			}
+			if contact := contacts[contactID]; contact != nil {
+				r.Name = strings.TrimSpace(contact.GetFullName())
+				r.Company = contact.Company
+			}
+			revenue = append(revenue, r)
+		}
+	}
+	sort.Slice(revenue, func(i, j int) bool {
+		a, b := revenue[i], revenue[j]
+		if a.Invoiced != b.Invoiced {
+			return a.Invoiced > b.Invoiced
+		}
+		if a.Name != b.Name {
+			return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+		}
+		if a.ContactID != b.ContactID {
+			return a.ContactID < b.ContactID
+		}
+		return a.Currency < b.Currency
+	})
+	return revenue
+}
+
+// statusOrder is the order invoices move through statuses in.
+var statusOrder = []db.InvoiceStatus{
+	db.InvoiceStatusDraft,
+	db.InvoiceStatusIssued,
+	db.InvoiceStatusOverdue,
+	db.InvoiceStatusPaid,
+	db.InvoiceStatusVoid,
+}
+
+func statusRevenue(a *db.Analytics) []StatusRevenue {
+	revenue := []StatusRevenue{}
+	for _, status := range statusOrder {
+		byCurrency := a.Statuses[string(status)]
+		currencies := map[string]bool{}
+		for cur, s := range byCurrency {
+			currencies[cur] = s.Invoices != 0
+		}
+		for _, cur := range sortedKeys(currencies) {
+			if !currencies[cur] {
+				continue
+			}
+			s := byCurrency[cur]
+			revenue = append(revenue, StatusRevenue{
+				Status:   status,
+				Currency: cur,
+				Invoices: s.Invoices,
+				Amount:   dollars(s.Amount),
+			})
+		}
+	}
+	return revenue
+}
+
+func daysSalesOutstanding(a *db.Analytics, now time.Time) []DSO {
+	receivables := map[string]int64{}
+	for _, byCurrency := range a.Contacts {
+		for cur, c := range byCurrency {
+			receivables[cur] += c.Outstanding
+		}
+	}
+	sales := map[string]int64{}
+	for _, month := range lastMonths(now, DSOMonths) {
+		for cur, m := range a.Months[month] {
+			sales[cur] += m.Invoiced - m.Credited
+		}
+	}
+	start := time.Date(now.Year(), now.Month()-(DSOMonths-1), 1, 0, 0, 0, 0, time.UTC)
+	days := int(now.Sub(start).Hours()/24) + 1
+
+	currencies := map[string]bool{}
+	for cur, c := range receivables {
+		currencies[cur] = currencies[cur] || c != 0
+	}
+	for cur, c := range sales {
+		currencies[cur] = currencies[cur] || c != 0
+	}
+	dso := []DSO{}
+	for _, cur := range sortedKeys(currencies) {
+		if !currencies[cur] {
+			continue
+		}
+		d := DSO{
+			Currency:    cur,
+			Receivables: dollars(receivables[cur]),
+			Sales:       dollars(sales[cur]),
+			Days:        days,
+		}
+		if sales[cur] > 0 {
+			d.DSO = ratio(receivables[cur]*int64(days), sales[cur])
+		}
+		dso = append(dso, d)
+	}
+	return dso
+}
+
+func forecast(a *db.Analytics, now time.Time) []ForecastMonth {
+	type key struct{ month, currency string }
+	// In cents, expected then overdue.
+	sums := map[key]*[2]int64{}
+	thisMonth := now.Format("2006-01")
+	for contactID, byDate := range a.Due {
+		for day, byCurrency := range byDate {
+			due, err := time.Parse("2006-01-02", day)
+			if err != nil {
+				continue
+			}
+			for cur, amount := range byCurrency {
+				if amount == 0 {
+					continue
+				}
+				when := due
+				if c := a.Contacts[contactID][cur]; c.Paid > 0 {
+					when = due.AddDate(0, 0, int(math.Round(float64(c.DaysLate)/float64(c.Paid))))
+				}
+				k := key{month: when.Format("2006-01"), currency: cur}
+				overdue := when.Before(now)
+				if overdue {
+					k.month = thisMonth
+				}
+				sum := sums[k]
+				if sum == nil {
+					sum = &[2]int64{}
+					sums[k] = sum
+				}
+				sum[0] += amount
+				if overdue {
+					sum[1] += amount
+				}
+			}
+		}
+	}
+
+	months := []ForecastMonth{}
+	for k, sum := range sums {
+		months = append(months, ForecastMonth{
+			Month:    k.month,
+			Currency: k.currency,
+			Expected: dollars(sum[0]),
+			Overdue:  dollars(sum[1]),
+		})
+	}
+	sort.Slice(months, func(i, j int) bool {
+		if months[i].Month != months[j].Month {
+			return months[i].Month < months[j].Month
+		}
+		return months[i].Currency < months[j].Currency
+	})
+	return months
+}
+
+// ratio returns a / b to one decimal place.
+func ratio(a, b int64) *float64 {
+	r := math.Round(float64(a)/float64(b)*10) / 10
+	return &r
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
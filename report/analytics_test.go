@@ -0,0 +1,123 @@
+package report_test
+
+import (
+	"time"
+
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/report"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type analyticsSuite struct{}
+
+var _ = gc.Suite(&analyticsSuite{})
+
+var now = time.Date(2022, 6, 15, 12, 0, 0, 0, time.UTC)
+
+// billed returns an invoice to contactID for $100 plus GST, issued on the
+// first of month and due 20 days later.
+func billed(contactID string, month time.Month) *db.Invoice {
+	issued := time.Date(2022, month, 1, 0, 0, 0, 0, time.UTC)
+	return &db.Invoice{
+		ContactID: contactID,
+		Hours:     1,
+		Rate:      100,
+		IssueDate: issued,
+		DueDate:   issued.AddDate(0, 0, 20),
+		Status:    db.InvoiceStatusIssued,
+	}
+}
+
+func paid(i *db.Invoice, daysLate int) *db.Invoice {
+	i.Status = db.InvoiceStatusPaid
+	i.Paid = true
+	i.PaidDate = i.DueDate.AddDate(0, 0, daysLate)
+	return i
+}
+
+func (s *analyticsSuite) TestRevenue(c *gc.C) {
+	a := db.NewAnalytics()
+	a.AddInvoice(paid(billed("jane", 4), 10), 1)
+	a.AddInvoice(paid(billed("jane", 5), 0), 1)
+	a.AddInvoice(billed("bob", 6), 1)
+	draft := billed("bob", 6)
+	draft.Status = db.InvoiceStatusDraft
+	a.AddInvoice(draft, 1)
+	a.AddCreditNote(&db.CreditNote{IssueDate: time.Date(2022, 5, 3, 0, 0, 0, 0, time.UTC), Amount: 20}, 1)
+	// Added and taken back out again.
+	a.AddInvoice(billed("bob", 3), 1)
+	a.AddInvoice(billed("bob", 3), -1)
+
+	r := report.NewAnalyticsReport(a, map[string]*db.Contact{
+		"jane": {FirstName: "Jane", LastName: "Smith", Company: "Smithworks"},
+	}, now, 3)
+	c.Check(r.AsOf, gc.Equals, time.Date(2022, 6, 15, 0, 0, 0, 0, time.UTC))
+	c.Check(r.Months, jc.DeepEquals, []report.RevenueMonth{
+		{Month: "2022-04", Currency: "NZD", Invoices: 1, Invoiced: 115, Revenue: 115},
+		{Month: "2022-05", Currency: "NZD", Invoices: 1, Invoiced: 115, Credited: 23, Revenue: 92, Received: 230},
+		{Month: "2022-06", Currency: "NZD", Invoices: 1, Invoiced: 115, Revenue: 115},
+	})
+
+	c.Assert(r.Contacts, gc.HasLen, 2)
+	c.Check(r.Contacts[0].Name, gc.Equals, "Jane Smith")
+	c.Check(r.Contacts[0].Invoiced, gc.Equals, float64(230))
+	c.Check(r.Contacts[0].Received, gc.Equals, float64(230))
+	c.Check(*r.Contacts[0].AverageDaysToPay, gc.Equals, 25.0)
+	c.Check(*r.Contacts[0].AverageDaysLate, gc.Equals, 5.0)
+	c.Check(r.Contacts[1], jc.DeepEquals, report.ContactRevenue{
+		ContactID:   "bob",
+		Currency:    "NZD",
+		Invoices:    1,
+		Invoiced:    115,
+		Outstanding: 115,
+	})
+
+	c.Check(r.Statuses, jc.DeepEquals, []report.StatusRevenue{
+		{Status: db.InvoiceStatusDraft, Currency: "NZD", Invoices: 1, Amount: 115},
+		{Status: db.InvoiceStatusIssued, Currency: "NZD", Invoices: 1, Amount: 115},
+		{Status: db.InvoiceStatusPaid, Currency: "NZD", Invoices: 2, Amount: 230},
+	})
+}
+
+func (s *analyticsSuite) TestDSO(c *gc.C) {
+	a := db.NewAnalytics()
+	a.AddInvoice(billed("bob", 4), 1)
+	a.AddInvoice(billed("bob", 6), 1)
+	a.AddInvoice(paid(billed("jane", 5), 0), 1)
+
+	r := report.NewAnalyticsReport(a, nil, now, 1)
+	c.Assert(r.DSO, gc.HasLen, 1)
+	dso := r.DSO[0]
+	c.Check(dso.Receivables, gc.Equals, float64(230))
+	c.Check(dso.Sales, gc.Equals, float64(345))
+	// 1 April to 15 June.
+	c.Check(dso.Days, gc.Equals, 76)
+	c.Check(*dso.DSO, gc.Equals, 50.7)
+
+	// Nothing sold lately.
+	r = report.NewAnalyticsReport(a, nil, now.AddDate(1, 0, 0), 1)
+	c.Assert(r.DSO, gc.HasLen, 1)
+	c.Check(r.DSO[0].DSO, gc.IsNil)
+}
+
+func (s *analyticsSuite) TestForecast(c *gc.C) {
+	a := db.NewAnalytics()
+	// Jane pays 30 days late, so her invoice due 21 June is expected on 21
+	// July.
+	a.AddInvoice(paid(billed("jane", 1), 30), 1)
+	a.AddInvoice(billed("jane", 6), 1)
+	// Bob has never paid, so his is expected when due, which has passed.
+	a.AddInvoice(billed("bob", 5), 1)
+	aud := billed("bob", 6)
+	aud.Currency, aud.TaxTreatment = "AUD", db.TaxZeroRated
+	a.AddInvoice(aud, 1)
+
+	r := report.NewAnalyticsReport(a, nil, now, 1)
+	c.Check(r.Forecast, jc.DeepEquals, []report.ForecastMonth{
+		{Month: "2022-06", Currency: "AUD", Expected: 100},
+		{Month: "2022-06", Currency: "NZD", Expected: 115, Overdue: 115},
+		{Month: "2022-07", Currency: "NZD", Expected: 115},
+	})
+}
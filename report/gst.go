@@ -0,0 +1,434 @@
+package report
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/export"
+	"github.com/wham-invoice/wham-platform/pdf"
+)
+
+// GSTBasis is when sales count towards a GST return.
+type GSTBasis string
+
+const (
+	// GSTInvoiceBasis counts invoices in the period they were issued.
+	GSTInvoiceBasis GSTBasis = "invoice"
+	// GSTPaymentsBasis counts invoices in the period they were paid.
+	GSTPaymentsBasis GSTBasis = "payments"
+)
+
+// Valid reports whether b is a known basis.
+func (b GSTBasis) Valid() bool {
+	return b == GSTInvoiceBasis || b == GSTPaymentsBasis
+}
+
+// GSTFrequency is how often GST returns are filed.
+type GSTFrequency string
+
+const (
+	GSTMonthly    GSTFrequency = "monthly"
+	GSTTwoMonthly GSTFrequency = "two_monthly"
+	GSTSixMonthly GSTFrequency = "six_monthly"
+)
+
+// Months returns how many months a period covers, or zero if f isn't a known
+// frequency.
+func (f GSTFrequency) Months() int {
+	switch f {
+	case GSTMonthly:
+		return 1
+	case GSTTwoMonthly:
+		return 2
+	case GSTSixMonthly:
+		return 6
+	}
+	return 0
+}
+
+// GSTPeriod is the days a GST return covers, Start to End inclusive.
+type GSTPeriod struct {
+	Frequency GSTFrequency `json:"frequency"`
+	Start     time.Time    `json:"start"`
+	End       time.Time    `json:"end"`
+}
+
+// NewGSTPeriod returns the period of frequency f that ends with the month
+// end falls in. Returns are named after the month their period ends, and
+// which months those are varies between businesses, so it is up to the
+// caller to pick one that matches their filing cycle.
+func NewGSTPeriod(f GSTFrequency, end time.Time) (GSTPeriod, error) {
+	months := f.Months()
+	if months == 0 {
+		return GSTPeriod{}, errors.NotValidf("GST frequency %q", string(f))
+	}
+	next := time.Date(end.Year(), end.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	return GSTPeriod{
+		Frequency: f,
+		Start:     next.AddDate(0, -months, 0),
+		End:       next.AddDate(0, 0, -1),
+	}, nil
+}
+
+// Before returns the start of the day after the period.
+func (p GSTPeriod) Before() time.Time {
+	return p.End.AddDate(0, 0, 1)
+}
+
+// Contains reports whether t falls on a day in the period.
+func (p GSTPeriod) Contains(t time.Time) bool {
+	day := date(t)
+	return !day.Before(p.Start) && !day.After(p.End)
+}
+
+// Kinds of GSTLine.
+const (
+	GSTLineInvoice    = "invoice"
+	GSTLineCreditNote = "credit_note"
+)
+
+// GSTLine is an invoice or credit note counted in a GST return. Amounts on
+// credit notes are negative.
+type GSTLine struct {
+	Kind string `json:"kind"`
+	ID   string `json:"id"`
+	// Number is the invoice's number, or for a credit note, the number of
+	// the invoice it credits.
+	Number int `json:"number"`
+	// Date is when the line counts from: the issue date, or on the payments
+	// basis the date an invoice was paid.
+	Date         time.Time       `json:"date"`
+	Contact      string          `json:"contact"`
+	Currency     string          `json:"currency"`
+	TaxTreatment db.TaxTreatment `json:"tax_treatment"`
+	Net          float64         `json:"net"`
+	GST          float64         `json:"gst"`
+	Total        float64         `json:"total"`
+}
+
+// GSTTotal adds up a return's lines in one currency. Returns are filed in
+// NZD, so totals in other currencies need converting first.
+type GSTTotal struct {
+	Currency string `json:"currency"`
+	// Sales are total sales including GST, zero rated sales among them but
+	// not exempt ones, before credit notes.
+	Sales     float64 `json:"sales"`
+	ZeroRated float64 `json:"zero_rated"`
+	// GST is the GST charged on Sales.
+	GST float64 `json:"gst"`
+	// Credits are what credit notes gave back including GST, and CreditGST
+	// the GST among it, which is adjusted off what is owed.
+	Credits   float64 `json:"credits"`
+	CreditGST float64 `json:"credit_gst"`
+	// NetGST is the GST to pay: GST less CreditGST.
+	NetGST float64 `json:"net_gst"`
+	// Exempt sales are outside GST, and only shown for completeness.
+	Exempt float64 `json:"exempt"`
+}
+
+// GSTReport is the sales a GST return is made up from.
+type GSTReport struct {
+	Basis  GSTBasis  `json:"basis"`
+	Period GSTPeriod `json:"period"`
+	// Lines are sorted by date, invoices before credit notes.
+	Lines []GSTLine `json:"lines"`
+	// Totals are sorted by currency.
+	Totals []GSTTotal `json:"totals"`
+}
+
+// GST builds a GSTReport from invoices and credit notes added one at a
+// time.
+type GST struct {
+	period GSTPeriod
+	basis  GSTBasis
+	lines  []gstLine
+}
+
+// gstLine is a GSTLine in cents.
+type gstLine struct {
+	GSTLine
+	net, gst int64
+}
+
+// NewGST returns an empty report for the period on basis.
+func NewGST(period GSTPeriod, basis GSTBasis) (*GST, error) {
+	if !basis.Valid() {
+		return nil, errors.NotValidf("GST basis %q", string(basis))
+	}
+	return &GST{period: period, basis: basis}, nil
+}
+
+// AddInvoice counts the invoice, under contact, who may be nil if they've
+// gone, if it falls in the period. Drafts and void invoices never count. On
+// the payments basis only invoices paid in the period do, so those paid
+// before payment dates were kept don't.
+func (g *GST) AddInvoice(i *db.Invoice, contact *db.Contact) {
+	when := i.IssueDate
+	switch i.CurrentStatus() {
+	case db.InvoiceStatusDraft, db.InvoiceStatusVoid:
+		return
+	case db.InvoiceStatusPaid:
+		if g.basis == GSTPaymentsBasis {
+			when = i.PaidDate
+		}
+	default:
+		if g.basis == GSTPaymentsBasis {
+			return
+		}
+	}
+	if when.IsZero() || !g.period.Contains(when) {
+		return
+	}
+
+	net := db.Cents(i.GetSubtotal())
+	g.add(GSTLine{
+		Kind:         GSTLineInvoice,
+		ID:           i.ID,
+		Number:       i.Number,
+		Date:         date(when),
+		Contact:      contactName(contact, i.BillTo),
+		Currency:     currency(i),
+		TaxTreatment: treatment(i.TaxTreatment),
+	}, net, db.Cents(i.GetTotal())-net)
+}
+
+// AddCreditNote counts the credit note if it was issued in the period, on
+// either basis.
+func (g *GST) AddCreditNote(n *db.CreditNote, contact *db.Contact) {
+	if !g.period.Contains(n.IssueDate) {
+		return
+	}
+	cur := n.Currency
+	if cur == "" {
+		cur = db.DefaultCurrency
+	}
+
+	net := db.Cents(n.Amount)
+	g.add(GSTLine{
+		Kind:         GSTLineCreditNote,
+		ID:           n.ID,
+		Number:       n.InvoiceNumber,
+		Date:         date(n.IssueDate),
+		Contact:      contactName(contact, n.BillTo),
+		Currency:     cur,
+		TaxTreatment: treatment(n.TaxTreatment),
+	}, -net, -(db.Cents(n.GetTotal()) - net))
+}
+
+func (g *GST) add(line GSTLine, net, gst int64) {
+	line.Net, line.GST, line.Total = dollars(net), dollars(gst), dollars(net+gst)
+	g.lines = append(g.lines, gstLine{GSTLine: line, net: net, gst: gst})
+}
+
+// gstSums are a GSTTotal in cents.
+type gstSums struct {
+	sales, zeroRated, gst, credits, creditGST, exempt int64
+}
+
+// Report returns the report of what has been added so far.
+func (g *GST) Report() GSTReport {
+	report := GSTReport{Basis: g.basis, Period: g.period, Lines: []GSTLine{}, Totals: []GSTTotal{}}
+	sums := map[string]*gstSums{}
+	for _, line := range g.lines {
+		report.Lines = append(report.Lines, line.GSTLine)
+
+		s := sums[line.Currency]
+		if s == nil {
+			s = &gstSums{}
+			sums[line.Currency] = s
+		}
+		total := line.net + line.gst
+		switch {
+		case line.Kind == GSTLineCreditNote:
+			s.credits -= total
+			s.creditGST -= line.gst
+		case line.TaxTreatment == db.TaxExempt:
+			s.exempt += total
+		default:
+			s.sales += total
+			s.gst += line.gst
+			if line.TaxTreatment == db.TaxZeroRated {
+				s.zeroRated += total
+			}
+		}
+	}
+	for cur, s := range sums {
+		report.Totals = append(report.Totals, GSTTotal{
+			Currency:  cur,
+			Sales:     dollars(s.sales),
+			ZeroRated: dollars(s.zeroRated),
+			GST:       dollars(s.gst),
+			Credits:   dollars(s.credits),
+			CreditGST: dollars(s.creditGST),
+			NetGST:    dollars(s.gst - s.creditGST),
+			Exempt:    dollars(s.exempt),
+		})
+	}
+
+	sort.SliceStable(report.Lines, func(i, j int) bool {
+		a, b := report.Lines[i], report.Lines[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if a.Kind != b.Kind {
+			return a.Kind == GSTLineInvoice
+		}
+		if a.Number != b.Number {
+			return a.Number < b.Number
+		}
+		return a.ID < b.ID
+	})
+	sort.Slice(report.Totals, func(i, j int) bool {
+		return report.Totals[i].Currency < report.Totals[j].Currency
+	})
+	return report
+}
+
+// GSTHeader is the header row of the report as a table.
+func GSTHeader() []string {
+	return []string{"Date", "Type", "Invoice", "Contact", "Currency", "Tax", "Net", "GST", "Total"}
+}
+
+// WriteTable writes the report as a spreadsheet: a row for each invoice and
+// credit note, then the totals for each currency.
+func (r GSTReport) WriteTable(w export.RowWriter) error {
+	header := make([]export.Cell, 0, len(GSTHeader()))
+	for _, h := range GSTHeader() {
+		header = append(header, export.Text(h))
+	}
+	if err := w.WriteRow(header); err != nil {
+		return errors.Trace(err)
+	}
+	for _, line := range r.Lines {
+		if err := w.WriteRow(line.cells()); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	for _, total := range r.Totals {
+		for _, row := range total.rows() {
+			if err := w.WriteRow(row); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+	return nil
+}
+
+// PDFTable lays the report out for pdf.RenderTable, with the same rows as
+// WriteTable.
+func (r GSTReport) PDFTable() pdf.Table {
+	basis := "Invoice basis"
+	if r.Basis == GSTPaymentsBasis {
+		basis = "Payments basis"
+	}
+	t := pdf.Table{
+		Title: "GST return",
+		Lines: []string{
+			r.Period.Start.Format("2 January 2006") + " to " + r.Period.End.Format("2 January 2006"),
+			basis,
+		},
+		Landscape: true,
+	}
+	for i, header := range GSTHeader() {
+		col := pdf.TableColumn{Header: header, Width: 1, Right: i == 2 || i >= 6}
+		switch header {
+		case "Contact":
+			col.Width = 3
+		case "Tax":
+			col.Width = 2
+		}
+		t.Columns = append(t.Columns, col)
+	}
+	for _, line := range r.Lines {
+		t.Rows = append(t.Rows, cellStrings(line.cells()))
+	}
+	for _, total := range r.Totals {
+		for _, row := range total.rows() {
+			t.Footer = append(t.Footer, cellStrings(row))
+		}
+	}
+	return t
+}
+
+func (l GSTLine) cells() []export.Cell {
+	kind := "Invoice"
+	if l.Kind == GSTLineCreditNote {
+		kind = "Credit note"
+	}
+	return []export.Cell{
+		export.Date(l.Date),
+		export.Text(kind),
+		export.Integer(l.Number),
+		export.Text(l.Contact),
+		export.Text(l.Currency),
+		export.Text(treatmentName(l.TaxTreatment)),
+		money(l.Net),
+		money(l.GST),
+		money(l.Total),
+	}
+}
+
+// rows lays the total out under the columns of the lines, labelled in the
+// Type column.
+func (t GSTTotal) rows() [][]export.Cell {
+	blank := export.Text("")
+	row := func(label string, net, gst, total export.Cell) []export.Cell {
+		return []export.Cell{blank, export.Text(label), blank, blank, export.Text(t.Currency), blank, net, gst, total}
+	}
+	return [][]export.Cell{
+		row("Sales", money(t.Sales-t.GST), money(t.GST), money(t.Sales)),
+		row("Zero rated", blank, blank, money(t.ZeroRated)),
+		row("Credit notes", money(t.CreditGST-t.Credits), money(-t.CreditGST), money(-t.Credits)),
+		row("GST to pay", blank, money(t.NetGST), blank),
+		row("Exempt", blank, blank, money(t.Exempt)),
+	}
+}
+
+func cellStrings(cells []export.Cell) []string {
+	s := make([]string, len(cells))
+	for i, cell := range cells {
+		s[i] = cell.String()
+	}
+	return s
+}
+
+// contactName returns who a line was for: who it was billed to, or for
+// invoices from before that was kept, the contact as they are now.
+func contactName(contact, billTo *db.Contact) string {
+	if billTo != nil {
+		contact = billTo
+	}
+	if contact == nil {
+		return ""
+	}
+	name := strings.TrimSpace(contact.GetFullName())
+	if contact.Company != "" {
+		if name == "" {
+			return contact.Company
+		}
+		name += " (" + contact.Company + ")"
+	}
+	return name
+}
+
+// treatment returns t, with the blank treatment of older invoices spelled
+// out.
+func treatment(t db.TaxTreatment) db.TaxTreatment {
+	if t == "" {
+		return db.TaxStandard
+	}
+	return t
+}
+
+func treatmentName(t db.TaxTreatment) string {
+	switch t {
+	case db.TaxZeroRated:
+		return "Zero rated"
+	case db.TaxExempt:
+		return "Exempt"
+	}
+	return "Standard"
+}
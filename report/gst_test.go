@@ -0,0 +1,212 @@
+package report_test
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/export"
+	"github.com/wham-invoice/wham-platform/report"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type gstSuite struct{}
+
+var _ = gc.Suite(&gstSuite{})
+
+// sale returns an invoice for $100 plus GST, issued when given.
+func sale(number int, issued time.Time) *db.Invoice {
+	return &db.Invoice{
+		ID:        "invoice-" + strconv.Itoa(number),
+		Number:    number,
+		Hours:     1,
+		Rate:      100,
+		IssueDate: issued,
+		DueDate:   issued.AddDate(0, 0, 20),
+		Status:    db.InvoiceStatusIssued,
+		BillTo:    &db.Contact{FirstName: "Jane", LastName: "Smith"},
+	}
+}
+
+func day(month time.Month, d int) time.Time {
+	return time.Date(2022, month, d, 9, 0, 0, 0, time.UTC)
+}
+
+func (s *gstSuite) TestNewGSTPeriod(c *gc.C) {
+	for _, t := range []struct {
+		frequency   report.GSTFrequency
+		end         time.Time
+		start, last string
+	}{
+		{report.GSTMonthly, day(2, 14), "2022-02-01", "2022-02-28"},
+		{report.GSTTwoMonthly, day(3, 1), "2022-02-01", "2022-03-31"},
+		{report.GSTTwoMonthly, day(1, 31), "2021-12-01", "2022-01-31"},
+		{report.GSTSixMonthly, day(3, 31), "2021-10-01", "2022-03-31"},
+	} {
+		p, err := report.NewGSTPeriod(t.frequency, t.end)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(p.Start.Format(export.DateFormat), gc.Equals, t.start)
+		c.Check(p.End.Format(export.DateFormat), gc.Equals, t.last)
+	}
+
+	_, err := report.NewGSTPeriod("fortnightly", day(3, 31))
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (s *gstSuite) TestInvoiceBasis(c *gc.C) {
+	period, err := report.NewGSTPeriod(report.GSTTwoMonthly, day(3, 1))
+	c.Assert(err, jc.ErrorIsNil)
+	gst, err := report.NewGST(period, report.GSTInvoiceBasis)
+	c.Assert(err, jc.ErrorIsNil)
+
+	gst.AddInvoice(sale(1, day(1, 31)), nil)
+	gst.AddInvoice(sale(2, day(2, 1)), nil)
+	// Paid after the period, but issued in it.
+	paid := sale(3, day(3, 31))
+	paid.Status, paid.PaidDate = db.InvoiceStatusPaid, day(4, 2)
+	gst.AddInvoice(paid, nil)
+	zero := sale(4, day(3, 5))
+	zero.TaxTreatment = db.TaxZeroRated
+	gst.AddInvoice(zero, nil)
+	exempt := sale(5, day(3, 6))
+	exempt.TaxTreatment = db.TaxExempt
+	gst.AddInvoice(exempt, nil)
+	for _, status := range []db.InvoiceStatus{db.InvoiceStatusDraft, db.InvoiceStatusVoid} {
+		i := sale(6, day(2, 10))
+		i.Status = status
+		gst.AddInvoice(i, nil)
+	}
+	gst.AddInvoice(sale(7, day(4, 1)), nil)
+	gst.AddCreditNote(&db.CreditNote{
+		ID:            "credit",
+		InvoiceNumber: 2,
+		IssueDate:     day(2, 1),
+		Amount:        40,
+	}, &db.Contact{FirstName: "Jane", LastName: "Smith"})
+	gst.AddCreditNote(&db.CreditNote{IssueDate: day(4, 1), Amount: 40}, nil)
+
+	r := gst.Report()
+	c.Check(r.Basis, gc.Equals, report.GSTInvoiceBasis)
+	c.Assert(r.Lines, gc.HasLen, 5)
+	var numbers []int
+	for _, line := range r.Lines {
+		numbers = append(numbers, line.Number)
+	}
+	c.Check(numbers, jc.DeepEquals, []int{2, 2, 4, 5, 3})
+	c.Check(r.Lines[1], jc.DeepEquals, report.GSTLine{
+		Kind:         report.GSTLineCreditNote,
+		ID:           "credit",
+		Number:       2,
+		Date:         time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC),
+		Contact:      "Jane Smith",
+		Currency:     "NZD",
+		TaxTreatment: db.TaxStandard,
+		Net:          -40,
+		GST:          -6,
+		Total:        -46,
+	})
+	c.Check(r.Totals, jc.DeepEquals, []report.GSTTotal{{
+		Currency:  "NZD",
+		Sales:     330,
+		ZeroRated: 100,
+		GST:       30,
+		Credits:   46,
+		CreditGST: 6,
+		NetGST:    24,
+		Exempt:    100,
+	}})
+}
+
+func (s *gstSuite) TestPaymentsBasis(c *gc.C) {
+	period, err := report.NewGSTPeriod(report.GSTMonthly, day(4, 1))
+	c.Assert(err, jc.ErrorIsNil)
+	gst, err := report.NewGST(period, report.GSTPaymentsBasis)
+	c.Assert(err, jc.ErrorIsNil)
+
+	paid := sale(1, day(3, 20))
+	paid.Status, paid.PaidDate = db.InvoiceStatusPaid, day(4, 2)
+	gst.AddInvoice(paid, nil)
+	// Issued in the period, but not yet paid.
+	gst.AddInvoice(sale(2, day(4, 3)), nil)
+	paidEarlier := sale(3, day(3, 1))
+	paidEarlier.Status, paidEarlier.PaidDate = db.InvoiceStatusPaid, day(3, 30)
+	gst.AddInvoice(paidEarlier, nil)
+	// Paid before payment dates were kept.
+	legacy := sale(4, day(4, 5))
+	legacy.Status, legacy.Paid = "", true
+	gst.AddInvoice(legacy, nil)
+
+	r := gst.Report()
+	c.Assert(r.Lines, gc.HasLen, 1)
+	c.Check(r.Lines[0].Number, gc.Equals, 1)
+	c.Check(r.Lines[0].Date, gc.Equals, time.Date(2022, 4, 2, 0, 0, 0, 0, time.UTC))
+	c.Check(r.Totals[0].NetGST, gc.Equals, float64(15))
+}
+
+func (s *gstSuite) TestCurrencies(c *gc.C) {
+	period, err := report.NewGSTPeriod(report.GSTMonthly, day(4, 1))
+	c.Assert(err, jc.ErrorIsNil)
+	gst, err := report.NewGST(period, report.GSTInvoiceBasis)
+	c.Assert(err, jc.ErrorIsNil)
+
+	aud := sale(1, day(4, 2))
+	aud.Currency, aud.TaxTreatment = "AUD", db.TaxZeroRated
+	gst.AddInvoice(aud, nil)
+	gst.AddInvoice(sale(2, day(4, 2)), nil)
+
+	r := gst.Report()
+	c.Assert(r.Totals, gc.HasLen, 2)
+	c.Check(r.Totals[0].Currency, gc.Equals, "AUD")
+	c.Check(r.Totals[0].Sales, gc.Equals, float64(100))
+	c.Check(r.Totals[0].GST, gc.Equals, float64(0))
+	c.Check(r.Totals[1].Currency, gc.Equals, "NZD")
+	c.Check(r.Totals[1].GST, gc.Equals, float64(15))
+}
+
+func (s *gstSuite) TestBadBasis(c *gc.C) {
+	_, err := report.NewGST(report.GSTPeriod{}, "cash")
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (s *gstSuite) TestWriteTable(c *gc.C) {
+	period, err := report.NewGSTPeriod(report.GSTMonthly, day(4, 1))
+	c.Assert(err, jc.ErrorIsNil)
+	gst, err := report.NewGST(period, report.GSTInvoiceBasis)
+	c.Assert(err, jc.ErrorIsNil)
+	gst.AddInvoice(sale(7, day(4, 2)), nil)
+	gst.AddCreditNote(&db.CreditNote{InvoiceNumber: 7, IssueDate: day(4, 9), Amount: 10}, nil)
+
+	var buf bytes.Buffer
+	w := export.NewCSV(&buf)
+	c.Assert(gst.Report().WriteTable(w), jc.ErrorIsNil)
+	c.Assert(w.Close(), jc.ErrorIsNil)
+	c.Check(buf.String(), gc.Equals, ""+
+		"Date,Type,Invoice,Contact,Currency,Tax,Net,GST,Total\n"+
+		"2022-04-02,Invoice,7,Jane Smith,NZD,Standard,100.00,15.00,115.00\n"+
+		"2022-04-09,Credit note,7,,NZD,Standard,-10.00,-1.50,-11.50\n"+
+		",Sales,,,NZD,,100.00,15.00,115.00\n"+
+		",Zero rated,,,NZD,,,,0.00\n"+
+		",Credit notes,,,NZD,,-10.00,-1.50,-11.50\n"+
+		",GST to pay,,,NZD,,,13.50,\n"+
+		",Exempt,,,NZD,,,,0.00\n")
+}
+
+func (s *gstSuite) TestPDFTable(c *gc.C) {
+	period, err := report.NewGSTPeriod(report.GSTSixMonthly, day(3, 31))
+	c.Assert(err, jc.ErrorIsNil)
+	gst, err := report.NewGST(period, report.GSTPaymentsBasis)
+	c.Assert(err, jc.ErrorIsNil)
+
+	t := gst.Report().PDFTable()
+	c.Check(t.Lines, jc.DeepEquals, []string{"1 October 2021 to 31 March 2022", "Payments basis"})
+	c.Check(t.Rows, gc.HasLen, 0)
+	var width uint
+	for _, col := range t.Columns {
+		width += col.Width
+	}
+	c.Check(width, gc.Equals, uint(12))
+}
@@ -0,0 +1,373 @@
+package report
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/export"
+	"github.com/wham-invoice/wham-platform/pdf"
+)
+
+// Kinds of StatementLine.
+const (
+	StatementInvoice    = "invoice"
+	StatementPayment    = "payment"
+	StatementCreditNote = "credit_note"
+)
+
+// statementOrder is the order lines on the same day are shown in.
+var statementOrder = map[string]int{
+	StatementInvoice:    0,
+	StatementCreditNote: 1,
+	StatementPayment:    2,
+}
+
+// StatementLine is an invoice charged to a contact, or a payment or credit
+// note against one.
+type StatementLine struct {
+	Kind string `json:"kind"`
+	// ID is the invoice's, or for a credit note, the credit note's.
+	ID     string    `json:"id"`
+	Number int       `json:"number"`
+	Date   time.Time `json:"date"`
+	// Reference is the invoice's description or the credit note's reason.
+	Reference string `json:"reference,omitempty"`
+	Currency  string `json:"currency"`
+	// Charge is what an invoice added to the balance including GST, and
+	// Credit what a payment or credit note took off it.
+	Charge float64 `json:"charge"`
+	Credit float64 `json:"credit"`
+	// Balance is what the contact owed in the line's currency after it.
+	Balance float64 `json:"balance"`
+}
+
+// StatementBalance is how a contact's balance in one currency moved over a
+// statement.
+type StatementBalance struct {
+	Currency string  `json:"currency"`
+	Opening  float64 `json:"opening"`
+	Charges  float64 `json:"charges"`
+	Credits  float64 `json:"credits"`
+	Closing  float64 `json:"closing"`
+}
+
+// StatementReport is a contact's account from From to To inclusive.
+type StatementReport struct {
+	ContactID string    `json:"contact_id"`
+	Contact   string    `json:"contact"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	// Lines are sorted by date; on the same day invoices come first, then
+	// credit notes, then payments.
+	Lines []StatementLine `json:"lines"`
+	// Balances are sorted by currency, and include every currency with a
+	// line or an opening balance.
+	Balances []StatementBalance `json:"balances"`
+}
+
+// Statement builds a StatementReport from a contact's invoices and credit
+// notes added one at a time.
+type Statement struct {
+	contact  *db.Contact
+	from, to time.Time
+	invoices []*db.Invoice
+	notes    []*db.CreditNote
+}
+
+// NewStatement returns an empty statement for contact from the start of
+// from's day to the end of to's.
+func NewStatement(contact *db.Contact, from, to time.Time) (*Statement, error) {
+	from, to = date(from), date(to)
+	if to.Before(from) {
+		return nil, errors.NotValidf("statement ending before it starts")
+	}
+	return &Statement{contact: contact, from: from, to: to}, nil
+}
+
+// AddInvoice adds the invoice, and its payment if it was paid. Drafts and
+// void invoices were never owed, and neither were invoices marked paid
+// without a date, which are taken to have been paid all along, as aging
+// reports take them.
+func (s *Statement) AddInvoice(i *db.Invoice) {
+	switch i.CurrentStatus() {
+	case db.InvoiceStatusDraft, db.InvoiceStatusVoid:
+		return
+	case db.InvoiceStatusPaid:
+		if i.PaidDate.IsZero() {
+			return
+		}
+	}
+	s.invoices = append(s.invoices, i)
+}
+
+// AddCreditNote adds the credit note. It only counts if the invoice it
+// credits is added too, in either order.
+func (s *Statement) AddCreditNote(n *db.CreditNote) {
+	s.notes = append(s.notes, n)
+}
+
+// statementEntry is a StatementLine in cents, positive for charges.
+type statementEntry struct {
+	StatementLine
+	amount int64
+}
+
+// entries returns everything that moved the balance up to the end of the
+// statement. Credit notes only count against invoices that do. A payment
+// settles what was left of its invoice after the credit notes issued
+// against it by the day it was paid.
+func (s *Statement) entries() []statementEntry {
+	credited := map[string][]*db.CreditNote{}
+	for _, i := range s.invoices {
+		credited[i.ID] = nil
+	}
+	entries := []statementEntry{}
+	for _, n := range s.notes {
+		if _, ok := credited[n.InvoiceID]; !ok {
+			continue
+		}
+		credited[n.InvoiceID] = append(credited[n.InvoiceID], n)
+		if date(n.IssueDate).After(s.to) {
+			continue
+		}
+		cur := n.Currency
+		if cur == "" {
+			cur = db.DefaultCurrency
+		}
+		entries = append(entries, statementEntry{
+			StatementLine: StatementLine{
+				Kind:      StatementCreditNote,
+				ID:        n.ID,
+				Number:    n.InvoiceNumber,
+				Date:      date(n.IssueDate),
+				Reference: n.Reason,
+				Currency:  cur,
+			},
+			amount: -db.Cents(n.GetTotal()),
+		})
+	}
+
+	for _, i := range s.invoices {
+		if date(i.IssueDate).After(s.to) {
+			continue
+		}
+		total := db.Cents(i.GetTotal())
+		line := StatementLine{
+			ID:        i.ID,
+			Number:    i.Number,
+			Reference: i.Description,
+			Currency:  currency(i),
+		}
+		charge := line
+		charge.Kind, charge.Date = StatementInvoice, date(i.IssueDate)
+		entries = append(entries, statementEntry{StatementLine: charge, amount: total})
+
+		if i.CurrentStatus() != db.InvoiceStatusPaid || date(i.PaidDate).After(s.to) {
+			continue
+		}
+		paid := total
+		for _, n := range credited[i.ID] {
+			if !date(n.IssueDate).After(date(i.PaidDate)) {
+				paid -= db.Cents(n.GetTotal())
+			}
+		}
+		if paid <= 0 {
+			continue
+		}
+		payment := line
+		payment.Kind, payment.Date, payment.Reference = StatementPayment, date(i.PaidDate), ""
+		entries = append(entries, statementEntry{StatementLine: payment, amount: -paid})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if a.Kind != b.Kind {
+			return statementOrder[a.Kind] < statementOrder[b.Kind]
+		}
+		if a.Number != b.Number {
+			return a.Number < b.Number
+		}
+		return a.ID < b.ID
+	})
+	return entries
+}
+
+// statementSums are a StatementBalance in cents.
+type statementSums struct {
+	opening, charges, credits int64
+}
+
+// Report returns the statement of what has been added so far. Everything
+// before it starts is carried into the opening balances.
+func (s *Statement) Report() StatementReport {
+	report := StatementReport{
+		From:     s.from,
+		To:       s.to,
+		Lines:    []StatementLine{},
+		Balances: []StatementBalance{},
+	}
+	if s.contact != nil {
+		report.ContactID = s.contact.ID
+		report.Contact = contactName(s.contact, nil)
+	}
+
+	entries := s.entries()
+	sums := map[string]*statementSums{}
+	for _, e := range entries {
+		if sums[e.Currency] == nil {
+			sums[e.Currency] = &statementSums{}
+		}
+		if e.Date.Before(s.from) {
+			sums[e.Currency].opening += e.amount
+		}
+	}
+	balances := map[string]int64{}
+	for cur, sum := range sums {
+		balances[cur] = sum.opening
+	}
+	for _, e := range entries {
+		if e.Date.Before(s.from) {
+			continue
+		}
+		sum := sums[e.Currency]
+		if e.amount > 0 {
+			sum.charges += e.amount
+			e.Charge = dollars(e.amount)
+		} else {
+			sum.credits -= e.amount
+			e.Credit = dollars(-e.amount)
+		}
+		balances[e.Currency] += e.amount
+		e.Balance = dollars(balances[e.Currency])
+		report.Lines = append(report.Lines, e.StatementLine)
+	}
+
+	for cur, sum := range sums {
+		if sum.opening == 0 && sum.charges == 0 && sum.credits == 0 {
+			continue
+		}
+		report.Balances = append(report.Balances, StatementBalance{
+			Currency: cur,
+			Opening:  dollars(sum.opening),
+			Charges:  dollars(sum.charges),
+			Credits:  dollars(sum.credits),
+			Closing:  dollars(balances[cur]),
+		})
+	}
+	sort.Slice(report.Balances, func(i, j int) bool {
+		return report.Balances[i].Currency < report.Balances[j].Currency
+	})
+	return report
+}
+
+// StatementHeader is the header row of the statement as a table.
+func StatementHeader() []string {
+	return []string{"Date", "Type", "Invoice", "Reference", "Currency", "Charges", "Credits", "Balance"}
+}
+
+// WriteTable writes the statement as a spreadsheet: the opening balance in
+// each currency, a row for each line, then the closing balances.
+func (r StatementReport) WriteTable(w export.RowWriter) error {
+	header := make([]export.Cell, 0, len(StatementHeader()))
+	for _, h := range StatementHeader() {
+		header = append(header, export.Text(h))
+	}
+	rows := [][]export.Cell{header}
+	rows = append(rows, r.openingRows()...)
+	for _, line := range r.Lines {
+		rows = append(rows, line.cells())
+	}
+	rows = append(rows, r.closingRows()...)
+	for _, row := range rows {
+		if err := w.WriteRow(row); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// PDFTable lays the statement out for pdf.RenderTable, with the same rows
+// as WriteTable.
+func (r StatementReport) PDFTable() pdf.Table {
+	t := pdf.Table{
+		Title: "Statement",
+		Lines: []string{
+			r.Contact,
+			r.From.Format("2 January 2006") + " to " + r.To.Format("2 January 2006"),
+		},
+		Landscape: true,
+	}
+	for i, header := range StatementHeader() {
+		col := pdf.TableColumn{Header: header, Width: 1, Right: i == 2 || i >= 5}
+		if header == "Reference" {
+			col.Width = 5
+		}
+		t.Columns = append(t.Columns, col)
+	}
+	for _, row := range r.openingRows() {
+		t.Rows = append(t.Rows, cellStrings(row))
+	}
+	for _, line := range r.Lines {
+		t.Rows = append(t.Rows, cellStrings(line.cells()))
+	}
+	for _, row := range r.closingRows() {
+		t.Footer = append(t.Footer, cellStrings(row))
+	}
+	return t
+}
+
+func (l StatementLine) cells() []export.Cell {
+	kind := "Invoice"
+	switch l.Kind {
+	case StatementPayment:
+		kind = "Payment"
+	case StatementCreditNote:
+		kind = "Credit note"
+	}
+	blank := export.Text("")
+	charge, credit := blank, blank
+	if l.Kind == StatementInvoice {
+		charge = money(l.Charge)
+	} else {
+		credit = money(l.Credit)
+	}
+	return []export.Cell{
+		export.Date(l.Date),
+		export.Text(kind),
+		export.Integer(l.Number),
+		export.Text(strings.TrimSpace(l.Reference)),
+		export.Text(l.Currency),
+		charge,
+		credit,
+		money(l.Balance),
+	}
+}
+
+func (r StatementReport) openingRows() [][]export.Cell {
+	rows := [][]export.Cell{}
+	for _, b := range r.Balances {
+		rows = append(rows, balanceRow(r.From, "Opening balance", b.Currency, export.Text(""), export.Text(""), b.Opening))
+	}
+	return rows
+}
+
+func (r StatementReport) closingRows() [][]export.Cell {
+	rows := [][]export.Cell{}
+	for _, b := range r.Balances {
+		rows = append(rows, balanceRow(r.To, "Closing balance", b.Currency, money(b.Charges), money(b.Credits), b.Closing))
+	}
+	return rows
+}
+
+// balanceRow lays a balance out under the columns of the lines, labelled
+// in the Type column.
+func balanceRow(day time.Time, label, currency string, charges, credits export.Cell, balance float64) []export.Cell {
+	blank := export.Text("")
+	return []export.Cell{export.Date(day), export.Text(label), blank, blank, export.Text(currency), charges, credits, money(balance)}
+}
@@ -0,0 +1,142 @@
+package report_test
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/export"
+	"github.com/wham-invoice/wham-platform/report"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type statementSuite struct{}
+
+var _ = gc.Suite(&statementSuite{})
+
+var jane = &db.Contact{ID: "jane", FirstName: "Jane", LastName: "Smith", Company: "Smithworks"}
+
+// april returns Jane's statement for April 2022, with an invoice paid in
+// April after a credit in March, an invoice issued and credited in April,
+// and others that shouldn't appear.
+func april(c *gc.C) report.StatementReport {
+	s, err := report.NewStatement(jane, day(4, 1), day(4, 30))
+	c.Assert(err, jc.ErrorIsNil)
+
+	march := sale(1, day(3, 2))
+	march.Status, march.PaidDate = db.InvoiceStatusPaid, day(4, 5)
+	s.AddInvoice(march)
+	s.AddCreditNote(&db.CreditNote{ID: "credit-1", InvoiceID: march.ID, InvoiceNumber: 1, IssueDate: day(3, 20), Amount: 10})
+
+	// Credited before it is added.
+	s.AddCreditNote(&db.CreditNote{ID: "credit-2", InvoiceID: "invoice-2", InvoiceNumber: 2, IssueDate: day(4, 12), Amount: 20, Reason: "discount"})
+	issued := sale(2, day(4, 10))
+	issued.Description = "April work"
+	s.AddInvoice(issued)
+
+	s.AddInvoice(sale(3, day(5, 1)))
+	draft := sale(4, day(4, 2))
+	draft.Status = db.InvoiceStatusDraft
+	s.AddInvoice(draft)
+	undated := sale(5, day(4, 3))
+	undated.Status = db.InvoiceStatusPaid
+	s.AddInvoice(undated)
+	s.AddCreditNote(&db.CreditNote{ID: "credit-3", InvoiceID: "invoice-4", IssueDate: day(4, 4), Amount: 10})
+	return s.Report()
+}
+
+func (s *statementSuite) TestReport(c *gc.C) {
+	r := april(c)
+	c.Check(r.ContactID, gc.Equals, "jane")
+	c.Check(r.Contact, gc.Equals, "Jane Smith (Smithworks)")
+	c.Check(r.Lines, jc.DeepEquals, []report.StatementLine{{
+		Kind:     report.StatementPayment,
+		ID:       "invoice-1",
+		Number:   1,
+		Date:     time.Date(2022, 4, 5, 0, 0, 0, 0, time.UTC),
+		Currency: "NZD",
+		Credit:   103.5,
+		Balance:  0,
+	}, {
+		Kind:      report.StatementInvoice,
+		ID:        "invoice-2",
+		Number:    2,
+		Date:      time.Date(2022, 4, 10, 0, 0, 0, 0, time.UTC),
+		Reference: "April work",
+		Currency:  "NZD",
+		Charge:    115,
+		Balance:   115,
+	}, {
+		Kind:      report.StatementCreditNote,
+		ID:        "credit-2",
+		Number:    2,
+		Date:      time.Date(2022, 4, 12, 0, 0, 0, 0, time.UTC),
+		Reference: "discount",
+		Currency:  "NZD",
+		Credit:    23,
+		Balance:   92,
+	}})
+	c.Check(r.Balances, jc.DeepEquals, []report.StatementBalance{{
+		Currency: "NZD",
+		Opening:  103.5,
+		Charges:  115,
+		Credits:  126.5,
+		Closing:  92,
+	}})
+}
+
+func (s *statementSuite) TestCurrencies(c *gc.C) {
+	st, err := report.NewStatement(jane, day(6, 1), day(6, 30))
+	c.Assert(err, jc.ErrorIsNil)
+	// Paid off before the statement, so it has nothing to show.
+	paid := sale(1, day(4, 1))
+	paid.Status, paid.PaidDate = db.InvoiceStatusPaid, day(5, 1)
+	st.AddInvoice(paid)
+	aud := sale(2, day(4, 1))
+	aud.Currency, aud.TaxTreatment = "AUD", db.TaxZeroRated
+	st.AddInvoice(aud)
+
+	r := st.Report()
+	c.Check(r.Lines, gc.HasLen, 0)
+	c.Check(r.Balances, jc.DeepEquals, []report.StatementBalance{
+		{Currency: "AUD", Opening: 100, Closing: 100},
+	})
+}
+
+func (s *statementSuite) TestBadRange(c *gc.C) {
+	_, err := report.NewStatement(jane, day(4, 30), day(4, 1))
+	c.Check(err, jc.Satisfies, errors.IsNotValid)
+
+	// A statement can be for a single day.
+	_, err = report.NewStatement(jane, day(4, 30), day(4, 30).Add(-1))
+	c.Check(err, jc.ErrorIsNil)
+}
+
+func (s *statementSuite) TestWriteTable(c *gc.C) {
+	var buf bytes.Buffer
+	w := export.NewCSV(&buf)
+	c.Assert(april(c).WriteTable(w), jc.ErrorIsNil)
+	c.Assert(w.Close(), jc.ErrorIsNil)
+	c.Check(buf.String(), gc.Equals, ""+
+		"Date,Type,Invoice,Reference,Currency,Charges,Credits,Balance\n"+
+		"2022-04-01,Opening balance,,,NZD,,,103.50\n"+
+		"2022-04-05,Payment,1,,NZD,,103.50,0.00\n"+
+		"2022-04-10,Invoice,2,April work,NZD,115.00,,115.00\n"+
+		"2022-04-12,Credit note,2,discount,NZD,,23.00,92.00\n"+
+		"2022-04-30,Closing balance,,,NZD,115.00,126.50,92.00\n")
+}
+
+func (s *statementSuite) TestPDFTable(c *gc.C) {
+	t := april(c).PDFTable()
+	c.Check(t.Lines, jc.DeepEquals, []string{"Jane Smith (Smithworks)", "1 April 2022 to 30 April 2022"})
+	c.Check(t.Rows, gc.HasLen, 4)
+	c.Check(t.Footer, gc.HasLen, 1)
+	var width uint
+	for _, col := range t.Columns {
+		width += col.Width
+	}
+	c.Check(width, gc.Equals, uint(12))
+}
@@ -0,0 +1,202 @@
+package search
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Memory is an Index held in memory as an inverted index from each word to
+// the documents containing it. It is lost on restart and isn't shared
+// between processes, so it suits a single instance that rebuilds it from
+// the database.
+type Memory struct {
+	mu   sync.RWMutex
+	docs map[docKey]*memoryDoc
+	// postings maps each owner's words to the documents containing them.
+	postings map[string]map[string]map[docKey]bool
+}
+
+type docKey struct {
+	kind, id string
+}
+
+type memoryDoc struct {
+	owner string
+	terms map[string]termInfo
+}
+
+// termInfo is where a word appears in a document.
+type termInfo struct {
+	// weight is that of the heaviest field it appears in.
+	weight float64
+	fields []string
+}
+
+// NewMemory returns an empty in-memory index.
+func NewMemory() *Memory {
+	return &Memory{
+		docs:     map[docKey]*memoryDoc{},
+		postings: map[string]map[string]map[docKey]bool{},
+	}
+}
+
+// Put is part of the Index interface.
+func (m *Memory) Put(_ context.Context, doc Document) error {
+	d := &memoryDoc{owner: doc.OwnerID, terms: map[string]termInfo{}}
+	for _, f := range doc.Fields {
+		for _, term := range Terms(f.Text) {
+			info := d.terms[term]
+			if f.Weight > info.weight {
+				info.weight = f.Weight
+			}
+			if !contains(info.fields, f.Name) {
+				info.fields = append(info.fields, f.Name)
+			}
+			d.terms[term] = info
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := docKey{doc.Kind, doc.ID}
+	m.remove(key)
+	m.docs[key] = d
+	owned := m.postings[d.owner]
+	if owned == nil {
+		owned = map[string]map[docKey]bool{}
+		m.postings[d.owner] = owned
+	}
+	for term := range d.terms {
+		if owned[term] == nil {
+			owned[term] = map[docKey]bool{}
+		}
+		owned[term][key] = true
+	}
+	return nil
+}
+
+// Delete is part of the Index interface.
+func (m *Memory) Delete(_ context.Context, kind, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.remove(docKey{kind, id})
+	return nil
+}
+
+// remove takes the document out of the index. m.mu must be held.
+func (m *Memory) remove(key docKey) {
+	d, ok := m.docs[key]
+	if !ok {
+		return
+	}
+	delete(m.docs, key)
+	owned := m.postings[d.owner]
+	for term := range d.terms {
+		delete(owned[term], key)
+		if len(owned[term]) == 0 {
+			delete(owned, term)
+		}
+	}
+	if len(owned) == 0 {
+		delete(m.postings, d.owner)
+	}
+}
+
+// Search is part of the Index interface. Each word of the query matches
+// words it starts, so "smi" finds "Smith", but whole words score double.
+func (m *Memory) Search(_ context.Context, q Query) ([]Hit, error) {
+	terms := Terms(q.Text)
+	if len(terms) == 0 {
+		return []Hit{}, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	owned := m.postings[q.OwnerID]
+	var hits map[docKey]*Hit
+	for _, term := range terms {
+		// The best score each document gets for this word.
+		matched := map[docKey]*Hit{}
+		for word, keys := range owned {
+			if !strings.HasPrefix(word, term) {
+				continue
+			}
+			for key := range keys {
+				if !q.wants(key.kind) {
+					continue
+				}
+				info := m.docs[key].terms[word]
+				score := info.weight
+				if word == term {
+					score *= 2
+				}
+				hit := matched[key]
+				if hit == nil {
+					hit = &Hit{Kind: key.kind, ID: key.id}
+					matched[key] = hit
+				}
+				if score > hit.Score {
+					hit.Score = score
+				}
+				for _, f := range info.fields {
+					if !contains(hit.Fields, f) {
+						hit.Fields = append(hit.Fields, f)
+					}
+				}
+			}
+		}
+
+		// Documents must match every word.
+		if hits == nil {
+			hits = matched
+			continue
+		}
+		for key, hit := range hits {
+			other, ok := matched[key]
+			if !ok {
+				delete(hits, key)
+				continue
+			}
+			hit.Score += other.Score
+			for _, f := range other.Fields {
+				if !contains(hit.Fields, f) {
+					hit.Fields = append(hit.Fields, f)
+				}
+			}
+		}
+	}
+
+	results := make([]Hit, 0, len(hits))
+	for _, hit := range hits {
+		sort.Strings(hit.Fields)
+		results = append(results, *hit)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.ID < b.ID
+	})
+	if limit := q.limit(); len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
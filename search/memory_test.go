@@ -0,0 +1,139 @@
+package search_test
+
+import (
+	"context"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/wham-invoice/wham-platform/search"
+)
+
+type memorySuite struct {
+	index *search.Memory
+}
+
+var _ = gc.Suite(&memorySuite{})
+
+func (s *memorySuite) SetUpTest(c *gc.C) {
+	s.index = search.NewMemory()
+	for _, doc := range []search.Document{{
+		Kind:    search.KindContact,
+		ID:      "smith",
+		OwnerID: "user",
+		Fields: []search.Field{
+			{Name: "name", Text: "Jane Smith", Weight: 2},
+			{Name: "email", Text: "jane@smithworks.example", Weight: 2},
+		},
+	}, {
+		Kind:    search.KindInvoice,
+		ID:      "42",
+		OwnerID: "user",
+		Fields: []search.Field{
+			{Name: "number", Text: "42 INV-000042", Weight: 3},
+			{Name: "name", Text: "Jane Smith", Weight: 2},
+			{Name: "description", Text: "Website redesign for Smithworks", Weight: 1},
+		},
+	}, {
+		Kind:    search.KindContact,
+		ID:      "other",
+		OwnerID: "someone-else",
+		Fields: []search.Field{
+			{Name: "name", Text: "Jane Smith", Weight: 2},
+		},
+	}} {
+		c.Assert(s.index.Put(context.Background(), doc), jc.ErrorIsNil)
+	}
+}
+
+func (s *memorySuite) search(c *gc.C, q search.Query) []search.Hit {
+	if q.OwnerID == "" {
+		q.OwnerID = "user"
+	}
+	hits, err := s.index.Search(context.Background(), q)
+	c.Assert(err, jc.ErrorIsNil)
+	return hits
+}
+
+func (s *memorySuite) TestSearch(c *gc.C) {
+	hits := s.search(c, search.Query{Text: "smith"})
+	c.Check(hits, jc.DeepEquals, []search.Hit{
+		{Kind: search.KindContact, ID: "smith", Score: 4, Fields: []string{"email", "name"}},
+		{Kind: search.KindInvoice, ID: "42", Score: 4, Fields: []string{"description", "name"}},
+	})
+}
+
+func (s *memorySuite) TestEveryWord(c *gc.C) {
+	hits := s.search(c, search.Query{Text: "jane redesign"})
+	c.Assert(hits, gc.HasLen, 1)
+	c.Check(hits[0].ID, gc.Equals, "42")
+	c.Check(hits[0].Score, gc.Equals, float64(4+2))
+}
+
+func (s *memorySuite) TestInvoiceNumber(c *gc.C) {
+	for _, text := range []string{"42", "000042", "INV-000042", "inv 42"} {
+		hits := s.search(c, search.Query{Text: text})
+		c.Assert(hits, gc.HasLen, 1, gc.Commentf("%q", text))
+		c.Check(hits[0].ID, gc.Equals, "42")
+	}
+}
+
+func (s *memorySuite) TestPrefix(c *gc.C) {
+	hits := s.search(c, search.Query{Text: "redes"})
+	c.Assert(hits, gc.HasLen, 1)
+	c.Check(hits[0].Score, gc.Equals, float64(1))
+}
+
+func (s *memorySuite) TestKinds(c *gc.C) {
+	hits := s.search(c, search.Query{Text: "jane", Kinds: []string{search.KindInvoice}})
+	c.Assert(hits, gc.HasLen, 1)
+	c.Check(hits[0].Kind, gc.Equals, search.KindInvoice)
+}
+
+func (s *memorySuite) TestOwner(c *gc.C) {
+	hits := s.search(c, search.Query{OwnerID: "someone-else", Text: "jane"})
+	c.Assert(hits, gc.HasLen, 1)
+	c.Check(hits[0].ID, gc.Equals, "other")
+
+	c.Check(s.search(c, search.Query{OwnerID: "nobody", Text: "jane"}), gc.HasLen, 0)
+}
+
+func (s *memorySuite) TestLimit(c *gc.C) {
+	hits := s.search(c, search.Query{Text: "jane", Limit: 1})
+	c.Check(hits, gc.HasLen, 1)
+}
+
+func (s *memorySuite) TestNoWords(c *gc.C) {
+	c.Check(s.search(c, search.Query{Text: " - "}), jc.DeepEquals, []search.Hit{})
+}
+
+func (s *memorySuite) TestPutReplaces(c *gc.C) {
+	ctx := context.Background()
+	err := s.index.Put(ctx, search.Document{
+		Kind:    search.KindContact,
+		ID:      "smith",
+		OwnerID: "user",
+		Fields:  []search.Field{{Name: "name", Text: "Jane Jones", Weight: 2}},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	hits := s.search(c, search.Query{Text: "smith", Kinds: []string{search.KindContact}})
+	c.Check(hits, gc.HasLen, 0)
+	hits = s.search(c, search.Query{Text: "jones"})
+	c.Check(hits, gc.HasLen, 1)
+}
+
+func (s *memorySuite) TestDelete(c *gc.C) {
+	ctx := context.Background()
+	c.Assert(s.index.Delete(ctx, search.KindInvoice, "42"), jc.ErrorIsNil)
+	c.Assert(s.index.Delete(ctx, search.KindInvoice, "missing"), jc.ErrorIsNil)
+
+	hits := s.search(c, search.Query{Text: "smith"})
+	c.Assert(hits, gc.HasLen, 1)
+	c.Check(hits[0].ID, gc.Equals, "smith")
+}
+
+func (s *memorySuite) TestTerms(c *gc.C) {
+	c.Check(search.Terms("Jane O'Brien, INV-000042 café 0"), jc.DeepEquals,
+		[]string{"jane", "o", "brien", "inv", "42", "café", "0"})
+}
@@ -0,0 +1,116 @@
+// Package search finds documents, such as invoices and contacts, by the words
+// in them. Everything that searches goes through an Index, so the backend can
+// be swapped without touching callers.
+package search
+
+import (
+	"context"
+	"strings"
+	"unicode"
+)
+
+// Kinds of document.
+const (
+	KindContact = "contact"
+	KindInvoice = "invoice"
+)
+
+// DefaultLimit and MaxLimit bound how many hits a search returns.
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// Index holds documents and finds the ones matching a query.
+type Index interface {
+	// Put adds the document, replacing any with the same kind and ID.
+	Put(ctx context.Context, doc Document) error
+	// Delete removes the document, if it is there.
+	Delete(ctx context.Context, kind, id string) error
+	// Search returns the owner's documents containing every word of the
+	// query, best first.
+	Search(ctx context.Context, q Query) ([]Hit, error)
+}
+
+// Document is something to be found.
+type Document struct {
+	Kind string
+	ID   string
+	// OwnerID is the user or organisation the document belongs to. Searches
+	// only ever see one owner's documents.
+	OwnerID string
+	Fields  []Field
+}
+
+// Field is some text in a document. Words in fields with a higher Weight
+// count for more.
+type Field struct {
+	Name   string
+	Text   string
+	Weight float64
+}
+
+// Query is what to search for.
+type Query struct {
+	OwnerID string
+	Text    string
+	// Kinds, if set, keeps only documents of those kinds.
+	Kinds []string
+	// Limit defaults to DefaultLimit and is capped at MaxLimit.
+	Limit int
+}
+
+func (q Query) limit() int {
+	switch {
+	case q.Limit <= 0:
+		return DefaultLimit
+	case q.Limit > MaxLimit:
+		return MaxLimit
+	}
+	return q.Limit
+}
+
+func (q Query) wants(kind string) bool {
+	if len(q.Kinds) == 0 {
+		return true
+	}
+	for _, k := range q.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Hit is a document that matched a query.
+type Hit struct {
+	Kind  string  `json:"kind"`
+	ID    string  `json:"id"`
+	Score float64 `json:"score"`
+	// Fields names the fields that matched.
+	Fields []string `json:"fields"`
+}
+
+// Terms splits text into the words an index holds: lower case runs of
+// letters and digits. Leading zeros are dropped from numbers, so "000042"
+// finds invoice 42.
+func Terms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, w := range words {
+		if trimmed := strings.TrimLeft(w, "0"); trimmed != "" && isNumber(w) {
+			words[i] = trimmed
+		}
+	}
+	return words
+}
+
+func isNumber(s string) bool {
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/report"
+	"github.com/wham-invoice/wham-platform/server/route"
+)
+
+// Analytics report up to MaxAnalyticsMonths months of revenue, and
+// DefaultAnalyticsMonths unless asked for another number.
+const (
+	DefaultAnalyticsMonths = 12
+	MaxAnalyticsMonths     = 60
+)
+
+// AnalyticsRequest is the query for analytics.
+type AnalyticsRequest struct {
+	// Months is how many months of revenue to report, up to and including
+	// this one.
+	Months int `form:"months"`
+	// OrganisationID reports on the organisation's invoices rather than the
+	// user's.
+	OrganisationID string `form:"organisation_id"`
+}
+
+// Analytics reports revenue by month, contact and status, how long each
+// contact takes to pay, days sales outstanding, and when outstanding
+// invoices are expected to be paid. It reads totals kept up to date as
+// invoices change rather than the invoices themselves.
+var Analytics = route.Endpoint{
+	Method: "GET",
+	Path:   "/report/analytics",
+	Do: func(c *gin.Context) (interface{}, error) {
+		ctx := c.Request.Context()
+		app := MustApp(c)
+
+		var req AnalyticsRequest
+		if err := c.ShouldBindQuery(&req); err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		switch {
+		case req.Months == 0:
+			req.Months = DefaultAnalyticsMonths
+		case req.Months < 0 || req.Months > MaxAnalyticsMonths:
+			return nil, errors.Wrap(errors.NotValidf("%d months", req.Months), route.BadRequest)
+		}
+		filter, err := exportOwner(c, ExportRequest{OrganisationID: req.OrganisationID})
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		analytics, err := app.Analytics(ctx, db.AnalyticsOwner{
+			UserID:         filter.UserID,
+			OrganisationID: filter.OrganisationID,
+		})
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot get analytics")
+		}
+		ids := make([]string, 0, len(analytics.Contacts))
+		for id := range analytics.Contacts {
+			ids = append(ids, id)
+		}
+		contacts, err := app.Contacts(ctx, ids)
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot get contacts")
+		}
+
+		return report.NewAnalyticsReport(analytics, contacts, time.Now(), req.Months), nil
+	},
+}
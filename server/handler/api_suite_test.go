@@ -52,9 +52,10 @@ func (s *APISuiteCore) SetUpSuite(c *gc.C) {
 
 	root, err := handler.Root(handler.Config{
 		AllowOrigin: "http://test.origin",
+		FrontendURL: "http://test.origin",
 		AppDB:       s.App,
 		RedisStore:  &store,
-		Session:     s,
+		Session:     handler.APIKeySession{Fallback: s},
 	})
 	c.Assert(err, jc.ErrorIsNil)
 
@@ -146,6 +147,13 @@ func (s *APISuiteCore) Put200(c *gc.C, path, payload string) string {
 	return readAll(c, res.Body)
 }
 
+func (s *APISuiteCore) Put400(c *gc.C, path, payload string) {
+	req := httptest.NewRequest("PUT", path, strings.NewReader(payload))
+	res := s.Serve(req)
+	c.Check(res.StatusCode, gc.Equals, 400)
+	res.Body.Close()
+}
+
 func (s *APISuiteCore) Put204(c *gc.C, path, payload string) {
 	req := httptest.NewRequest("PUT", path, strings.NewReader(payload))
 	res := s.Serve(req)
@@ -160,6 +168,13 @@ func (s *APISuiteCore) Delete204(c *gc.C, path string) {
 	res.Body.Close()
 }
 
+func (s *APISuiteCore) Delete400(c *gc.C, path string) {
+	req := httptest.NewRequest("DELETE", path, nil)
+	res := s.Serve(req)
+	c.Check(res.StatusCode, gc.Equals, 400)
+	res.Body.Close()
+}
+
 func (s *APISuiteCore) Delete403(c *gc.C, path string) {
 	req := httptest.NewRequest("DELETE", path, nil)
 	res := s.Serve(req)
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/server/route"
+)
+
+type NewAPIKeyRequest struct {
+	Label string `json:"label" binding:"required"`
+	Scope string `json:"scope" binding:"required,oneof=read write"`
+}
+
+type UpdateAPIKeyRequest struct {
+	Label string `json:"label" binding:"required"`
+}
+
+// NewAPIKeyResponse is the only time the plain text secret is returned.
+type NewAPIKeyResponse struct {
+	APIKey *db.APIKey `json:"api_key"`
+	Secret string     `json:"secret"`
+}
+
+// NewAPIKey creates a personal API key for the user.
+var NewAPIKey = route.Endpoint{
+	Method:  "POST",
+	Path:    "/apikey/new",
+	Prereqs: route.Prereqs(EnsureInteractive()),
+	Do: func(c *gin.Context) (interface{}, error) {
+		ctx := c.Request.Context()
+		app := MustApp(c)
+		user := MustUser(c)
+
+		var req NewAPIKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return nil, errors.Annotate(err, "cannot bind request")
+		}
+
+		key, secret, err := app.NewAPIKey(ctx, user.ID, req.Label, db.APIKeyScope(req.Scope))
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot create api key")
+		}
+
+		return &NewAPIKeyResponse{
+			APIKey: key,
+			Secret: secret,
+		}, nil
+	},
+}
+
+// UserAPIKeys returns all API keys for a user, including revoked ones.
+var UserAPIKeys = route.Endpoint{
+	Method:  "GET",
+	Path:    "/user/apikeys",
+	Prereqs: route.Prereqs(EnsureInteractive()),
+	Do: func(c *gin.Context) (interface{}, error) {
+		user := MustUser(c)
+
+		keys, err := user.APIKeys(c.Request.Context(), MustApp(c))
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return keys, nil
+	},
+}
+
+// UpdateAPIKey relabels an API key.
+var UpdateAPIKey = route.Endpoint{
+	Method:  "PUT",
+	Path:    "/apikey/update/:apikey_id",
+	Prereqs: route.Prereqs(EnsureInteractive(), EnsureAPIKey()),
+	Do: func(c *gin.Context) (interface{}, error) {
+		ctx := c.Request.Context()
+		app := MustApp(c)
+		key := MustAPIKey(c)
+
+		var req UpdateAPIKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return nil, errors.Annotate(err, "cannot bind request")
+		}
+
+		if err := key.SetLabel(ctx, app, req.Label); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return key, nil
+	},
+}
+
+// RevokeAPIKey stops an API key from being used.
+var RevokeAPIKey = route.Endpoint{
+	Method:  "DELETE",
+	Path:    "/apikey/revoke/:apikey_id",
+	Prereqs: route.Prereqs(EnsureInteractive(), EnsureAPIKey()),
+	Do: func(c *gin.Context) (interface{}, error) {
+		ctx := c.Request.Context()
+		app := MustApp(c)
+		key := MustAPIKey(c)
+
+		if err := key.Revoke(ctx, app); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return nil, nil
+	},
+}
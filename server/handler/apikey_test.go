@@ -0,0 +1,77 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/server/handler"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type apiKeysSuite struct {
+	APISuiteCore
+}
+
+var _ = gc.Suite(&apiKeysSuite{})
+
+func (s *apiKeysSuite) TestNewAPIKeyThenList(c *gc.C) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"label": "timesheets",
+		"scope": "write",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	body := s.Post200(c, "/apikey/new", string(payload))
+
+	var resp handler.NewAPIKeyResponse
+	c.Assert(json.Unmarshal([]byte(body), &resp), jc.ErrorIsNil)
+	c.Check(resp.Secret, gc.Matches, "wham_[0-9a-f]{64}")
+	c.Check(resp.APIKey.Label, gc.Equals, "timesheets")
+
+	keys := []db.APIKey{}
+	c.Assert(json.Unmarshal([]byte(s.Get200(c, "/user/apikeys")), &keys), jc.ErrorIsNil)
+	c.Assert(keys, gc.HasLen, 1)
+	c.Check(keys[0].ID, gc.Equals, resp.APIKey.ID)
+}
+
+func (s *apiKeysSuite) TestRevokeAPIKey(c *gc.C) {
+	key, _, err := s.App.NewAPIKey(context.Background(), s.user.ID, "timesheets", db.APIKeyScopeRead)
+	c.Assert(err, jc.ErrorIsNil)
+
+	s.Delete204(c, fmt.Sprintf("/apikey/revoke/%s", key.ID))
+
+	getKey, err := s.App.APIKey(context.Background(), key.ID)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(getKey.Revoked, jc.IsTrue)
+}
+
+func (s *apiKeysSuite) TestReadOnlyAPIKeyCannotWrite(c *gc.C) {
+	_, secret, err := s.App.NewAPIKey(context.Background(), s.user.ID, "reports", db.APIKeyScopeRead)
+	c.Assert(err, jc.ErrorIsNil)
+
+	req := httptest.NewRequest("GET", "/user/contacts", nil)
+	req.Header.Set("Authorization", "Bearer "+secret)
+	res := s.Serve(req)
+	c.Check(res.StatusCode, gc.Equals, 200)
+	res.Body.Close()
+
+	req = httptest.NewRequest("POST", "/contact/new", strings.NewReader("{}"))
+	req.Header.Set("Authorization", "Bearer "+secret)
+	res = s.Serve(req)
+	c.Check(res.StatusCode, gc.Equals, 403)
+	res.Body.Close()
+}
+
+func (s *apiKeysSuite) TestUnknownAPIKey(c *gc.C) {
+	req := httptest.NewRequest("GET", "/user/contacts", nil)
+	req.Header.Set("Authorization", "Bearer wham_nope")
+	res := s.Serve(req)
+	c.Check(res.StatusCode, gc.Equals, 401)
+	res.Body.Close()
+}
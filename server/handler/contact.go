@@ -1,8 +1,14 @@
 package handler
 
 import (
+	"fmt"
+	"net/http"
+
 	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/dedupe"
+	"github.com/wham-invoice/wham-platform/export"
 	"github.com/wham-invoice/wham-platform/server/route"
+	"github.com/wham-invoice/wham-platform/vcard"
 
 	"github.com/gin-gonic/gin"
 	"github.com/juju/errors"
@@ -19,13 +25,23 @@ type NewContactRequest struct {
 	Suburb            string `json:"suburb"`
 	Postcode          string `json:"postcode"`
 	Country           string `json:"country"`
+	// OrganisationID is optional; without it the contact belongs to the user.
+	OrganisationID string   `json:"organisation_id"`
+	PeppolID       string   `json:"peppol_id"`
+	BuyerReference string   `json:"buyer_reference"`
+	Tags           []string `json:"tags"`
+	// CustomFields holds values for the owner's custom contact fields, by
+	// key.
+	CustomFields map[string]string `json:"custom_fields"`
+	// Billing optionally sets how the contact is usually invoiced.
+	Billing *db.BillingDefaults `json:"billing"`
 }
 
 // Contact returns a contact by ID.
 var Contact = route.Endpoint{
 	Method:  "GET",
 	Path:    "/contact/get/:contact_id",
-	Prereqs: route.Prereqs(EnsureContact()),
+	Prereqs: route.Prereqs(EnsureContact(), PermitContact(db.PermissionRead)),
 	Do: func(c *gin.Context) (interface{}, error) {
 		contact := MustContact(c)
 
@@ -33,32 +49,37 @@ var Contact = route.Endpoint{
 	},
 }
 
-// UserContacts returns all contacts for a user.
+// UserContacts returns a page of the user's contacts, as a
+// ContactListRequest asks.
 var UserContacts = route.Endpoint{
 	Method: "GET",
 	Path:   "/user/contacts",
 	Do: func(c *gin.Context) (interface{}, error) {
-		user := MustUser(c)
-		contacts, err := user.Contacts(c.Request.Context(), MustApp(c))
-		if err != nil {
-			return nil, errors.Trace(err)
-		}
-
-		return contacts, nil
+		return listContacts(c, db.ContactFilter{UserID: MustUser(c).ID})
 	},
 }
 
-// DeleteContact deletes a contact by ID.
+// DeleteContact deletes a contact by ID. A contact with invoices is archived
+// instead, so the invoices still have someone to be billed to, and returned.
 var DeleteContact = route.Endpoint{
 	Method:  "DELETE",
 	Path:    "/contact/delete/:contact_id",
-	Prereqs: route.Prereqs(EnsureContact()),
+	Prereqs: route.Prereqs(EnsureContact(), PermitContact(db.PermissionWrite)),
 	Do: func(c *gin.Context) (interface{}, error) {
 		ctx := c.Request.Context()
 		app := MustApp(c)
 		contact := MustContact(c)
 
-		if err := contact.Delete(ctx, app); err != nil {
+		err := contact.Delete(ctx, app)
+		switch {
+		case err == db.ContactHasInvoices:
+			if err := contact.SetArchived(ctx, app, true); err != nil {
+				return nil, errors.Trace(err)
+			}
+			return contact, nil
+		case err == db.ContactNotFound:
+			return nil, route.NotFound
+		case err != nil:
 			return nil, errors.Trace(err)
 		}
 
@@ -66,6 +87,34 @@ var DeleteContact = route.Endpoint{
 	},
 }
 
+type ArchiveContactRequest struct {
+	Archived bool `json:"archived"`
+}
+
+// ArchiveContact archives a contact, or restores an archived one.
+var ArchiveContact = route.Endpoint{
+	Method:  "PUT",
+	Path:    "/contact/archive/:contact_id",
+	Prereqs: route.Prereqs(EnsureContact(), PermitContact(db.PermissionWrite)),
+	Do: func(c *gin.Context) (interface{}, error) {
+		contact := MustContact(c)
+
+		var req ArchiveContactRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		err := contact.SetArchived(c.Request.Context(), MustApp(c), req.Archived)
+		if err == db.ContactNotFound {
+			return nil, route.NotFound
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return contact, nil
+	},
+}
+
 // NewContact creates a new contact for the user.
 var NewContact = route.Endpoint{
 	Method: "POST",
@@ -79,8 +128,20 @@ var NewContact = route.Endpoint{
 		if err := c.ShouldBindJSON(&req); err != nil {
 			return nil, errors.Annotate(err, "cannot bind request")
 		}
+		if err := validatePeppolID(req.PeppolID); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		if req.OrganisationID != "" {
+			if err := authorize(c, req.OrganisationID, "", db.PermissionWrite); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
 
 		newContact := contactFromRequest(req, user.ID)
+		if err := normaliseContact(c, newContact); err != nil {
+			return nil, errors.Trace(err)
+		}
 
 		id, err := app.AddContact(ctx, newContact)
 		if err != nil {
@@ -101,12 +162,13 @@ func contactFromRequest(
 	userID string,
 ) *db.Contact {
 	return &db.Contact{
-		UserID:    userID,
-		FirstName: req.FirstName,
-		LastName:  req.LastName,
-		Phone:     req.Phone,
-		Email:     req.Email,
-		Company:   req.Company,
+		UserID:         userID,
+		OrganisationID: req.OrganisationID,
+		FirstName:      req.FirstName,
+		LastName:       req.LastName,
+		Phone:          req.Phone,
+		Email:          req.Email,
+		Company:        req.Company,
 		Address: &db.Address{
 			FirstLine:  req.AddressFirstLine,
 			SecondLine: req.AddressSecondLine,
@@ -114,5 +176,240 @@ func contactFromRequest(
 			Postcode:   req.Postcode,
 			Country:    req.Country,
 		},
+		PeppolID:       req.PeppolID,
+		BuyerReference: req.BuyerReference,
+		Tags:           req.Tags,
+		CustomFields:   req.CustomFields,
+		Billing:        req.Billing,
+	}
+}
+
+// normaliseContact tidies the contact's tags and billing defaults, and checks
+// its custom fields against those its owner has defined.
+func normaliseContact(c *gin.Context, contact *db.Contact) error {
+	if contact.Billing != nil {
+		if err := contact.Billing.Normalise(); err != nil {
+			return errors.Wrap(err, route.BadRequest)
+		}
+	}
+	tags, err := db.NormaliseTags(contact.Tags)
+	if err != nil {
+		return errors.Wrap(err, route.BadRequest)
 	}
+	contact.Tags = tags
+
+	fields, err := MustApp(c).ContactFields(c.Request.Context(), contact.OwnerID())
+	if err != nil {
+		return errors.Annotate(err, "cannot get custom fields")
+	}
+	values, err := fields.Normalise(contact.CustomFields)
+	if err != nil {
+		return errors.Wrap(err, route.BadRequest)
+	}
+	contact.CustomFields = values
+
+	return nil
+}
+
+// UpdateContact replaces a contact's details. Contacts can't change owner,
+// so the request's organisation_id is ignored. Invoices already issued keep
+// the details they were billed with.
+var UpdateContact = route.Endpoint{
+	Method:  "PUT",
+	Path:    "/contact/update/:contact_id",
+	Prereqs: route.Prereqs(EnsureContact(), PermitContact(db.PermissionWrite)),
+	Do: func(c *gin.Context) (interface{}, error) {
+		contact := MustContact(c)
+
+		var req NewContactRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		if err := validatePeppolID(req.PeppolID); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		req.OrganisationID = contact.OrganisationID
+		updated := contactFromRequest(req, contact.UserID)
+		updated.ID = contact.ID
+		updated.Archived = contact.Archived
+		if err := normaliseContact(c, updated); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		err := updated.Save(c.Request.Context(), MustApp(c))
+		if err == db.ContactNotFound {
+			return nil, route.NotFound
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return updated, nil
+	},
+}
+
+type ContactFieldsRequest struct {
+	// OrganisationID is optional; without it the fields are the user's.
+	OrganisationID string            `json:"organisation_id"`
+	Fields         []db.ContactField `json:"fields"`
+}
+
+// ContactFields returns the custom fields defined for the user's, or an
+// organisation's, contacts.
+var ContactFields = route.Endpoint{
+	Method: "GET",
+	Path:   "/contact/fields",
+	Do: func(c *gin.Context) (interface{}, error) {
+		var req struct {
+			OrganisationID string `form:"organisation_id"`
+		}
+		if err := c.ShouldBindQuery(&req); err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		ownerID, err := contactFieldsOwner(c, req.OrganisationID, db.PermissionRead)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		fields, err := MustApp(c).ContactFields(c.Request.Context(), ownerID)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return fields, nil
+	},
+}
+
+// SetContactFields replaces the custom fields defined for the user's, or an
+// organisation's, contacts.
+var SetContactFields = route.Endpoint{
+	Method: "PUT",
+	Path:   "/contact/fields",
+	Do: func(c *gin.Context) (interface{}, error) {
+		var req ContactFieldsRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		ownerID, err := contactFieldsOwner(c, req.OrganisationID, db.PermissionWrite)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		fields := &db.ContactFieldSet{OwnerID: ownerID, Fields: req.Fields}
+		if fields.Fields == nil {
+			fields.Fields = []db.ContactField{}
+		}
+		err = MustApp(c).SetContactFields(c.Request.Context(), fields)
+		if errors.IsNotValid(err) {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return fields, nil
+	},
+}
+
+// contactFieldsOwner returns whose custom fields the request is about,
+// checking the user holds perm over the organisation if there is one.
+func contactFieldsOwner(c *gin.Context, orgID string, perm db.Permission) (string, error) {
+	if orgID == "" {
+		return MustUser(c).ID, nil
+	}
+	if err := authorize(c, orgID, "", perm); err != nil {
+		return "", errors.Trace(err)
+	}
+	return orgID, nil
+}
+
+// ContactVCard downloads a contact as a vCard.
+var ContactVCard = route.Endpoint{
+	Method:  "GET",
+	Path:    "/contact/vcard/:contact_id",
+	Prereqs: route.Prereqs(EnsureContact(), PermitContact(db.PermissionRead)),
+	Do: func(c *gin.Context) (interface{}, error) {
+		contact := MustContact(c)
+
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=contact-%s.vcf", contact.ID))
+		c.Header("Content-Type", export.VCardContentType)
+		c.Status(http.StatusOK)
+		if err := vcard.Write(c.Writer, export.VCard(contact)); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return nil, nil
+	},
+}
+
+// ContactDuplicates lists groups of the user's, or an organisation's,
+// contacts that are probably the same client, for merging.
+var ContactDuplicates = route.Endpoint{
+	Method: "GET",
+	Path:   "/contact/duplicates",
+	Do: func(c *gin.Context) (interface{}, error) {
+		var req struct {
+			OrganisationID string `form:"organisation_id"`
+		}
+		if err := c.ShouldBindQuery(&req); err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		filter := db.ContactFilter{UserID: MustUser(c).ID}
+		if req.OrganisationID != "" {
+			if err := authorize(c, req.OrganisationID, "", db.PermissionRead); err != nil {
+				return nil, errors.Trace(err)
+			}
+			filter = db.ContactFilter{OrganisationID: req.OrganisationID}
+		}
+
+		var contacts []*db.Contact
+		err := MustApp(c).ForEachContact(c.Request.Context(), filter, func(contact *db.Contact) error {
+			contacts = append(contacts, contact)
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot get contacts")
+		}
+
+		groups := dedupe.Groups(contacts)
+		if groups == nil {
+			groups = []dedupe.Group{}
+		}
+		return groups, nil
+	},
+}
+
+type MergeContactsRequest struct {
+	DuplicateIDs []string `json:"duplicate_ids" binding:"required"`
+}
+
+// MergeContacts merges duplicates into the contact, moving their invoices to
+// it, and returns the merged contact.
+var MergeContacts = route.Endpoint{
+	Method:  "POST",
+	Path:    "/contact/merge/:contact_id",
+	Prereqs: route.Prereqs(EnsureContact(), PermitContact(db.PermissionWrite)),
+	Do: func(c *gin.Context) (interface{}, error) {
+		contact := MustContact(c)
+
+		var req MergeContactsRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+
+		// The duplicates must have the same owner as the contact, so the
+		// permission to change it covers them too.
+		merged, err := MustApp(c).MergeContacts(c.Request.Context(), contact.ID, req.DuplicateIDs)
+		switch {
+		case errors.Cause(err) == db.ContactNotFound:
+			return nil, route.NotFound
+		case errors.IsNotValid(err):
+			return nil, errors.Wrap(err, route.BadRequest)
+		case err != nil:
+			return nil, errors.Annotate(err, "cannot merge contacts")
+		}
+
+		return merged, nil
+	},
 }
@@ -5,9 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"net/http/httptest"
 	"strconv"
 
 	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/tests/setup"
 
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
@@ -117,12 +119,173 @@ func (s *ContactsSuite) TestContacts(c *gc.C) {
 
 	getContacts := s.Get200(c, "/user/contacts")
 
-	contactsRespList := []db.Contact{}
-	json.Unmarshal([]byte(getContacts), &contactsRespList)
+	page := db.ContactPage{}
+	c.Assert(json.Unmarshal([]byte(getContacts), &page), jc.ErrorIsNil)
 
-	c.Assert(contactsRespList, gc.HasLen, 2)
+	c.Assert(page.Items, gc.HasLen, 2)
+	c.Check(page.NextCursor, gc.Equals, "")
 
 	for _, contact := range contacts {
-		c.Check(contactsRespList, jc.Contains, contact)
+		c.Check(page.Items, jc.Contains, contact)
 	}
 }
+
+func (s *ContactsSuite) TestContactVCard(c *gc.C) {
+	contact := s.AddContact(context.Background(), c, s.user.ID)
+
+	card := s.Get200(c, fmt.Sprintf("/contact/vcard/%s", contact.ID))
+	c.Check(card, jc.Contains, "BEGIN:VCARD\r\nVERSION:3.0\r\n")
+	c.Check(card, jc.Contains, "EMAIL;TYPE=INTERNET,PREF:"+contact.Email+"\r\n")
+}
+
+func (s *ContactsSuite) TestDuplicatesAndMerge(c *gc.C) {
+	ctx := context.Background()
+	first := s.AddContact(ctx, c, s.user.ID)
+	second := setup.CreateContact(s.user.ID)
+	second.Email = first.Email
+	secondID, err := s.App.AddContact(ctx, &second)
+	c.Assert(err, jc.ErrorIsNil)
+	s.AddContact(ctx, c, s.user.ID)
+
+	var groups []struct {
+		Contacts []db.Contact `json:"contacts"`
+		Matches  []struct {
+			A, B    string
+			Reasons []string
+		} `json:"matches"`
+	}
+	c.Assert(json.Unmarshal([]byte(s.Get200(c, "/contact/duplicates")), &groups), jc.ErrorIsNil)
+	c.Assert(groups, gc.HasLen, 1)
+	c.Check(groups[0].Contacts, gc.HasLen, 2)
+	c.Check(groups[0].Matches[0].Reasons, jc.DeepEquals, []string{"same email"})
+
+	s.Post200(c, fmt.Sprintf("/contact/merge/%s", first.ID),
+		fmt.Sprintf(`{"duplicate_ids": [%q]}`, secondID))
+	c.Check(s.Get200(c, "/contact/duplicates"), gc.Equals, "[]")
+}
+
+func (s *ContactsSuite) TestMergeBadRequest(c *gc.C) {
+	contact := s.AddContact(context.Background(), c, s.user.ID)
+
+	s.Post400(c, fmt.Sprintf("/contact/merge/%s", contact.ID), `{"duplicate_ids": []}`)
+	s.Post400(c, fmt.Sprintf("/contact/merge/%s", contact.ID),
+		fmt.Sprintf(`{"duplicate_ids": [%q]}`, contact.ID))
+}
+
+func (s *ContactsSuite) TestDeleteContactWithInvoicesArchives(c *gc.C) {
+	ctx := context.Background()
+	contact := s.AddContact(ctx, c, s.user.ID)
+	unused := s.AddContact(ctx, c, s.user.ID)
+	invoice := setup.CreateInvoice(s.user.ID)
+	invoice.ContactID = contact.ID
+	_, err := s.App.AddInvoice(ctx, invoice)
+	c.Assert(err, jc.ErrorIsNil)
+
+	s.Delete204(c, fmt.Sprintf("/contact/delete/%s", unused.ID))
+	s.Get404(c, fmt.Sprintf("/contact/get/%s", unused.ID))
+
+	req := httptest.NewRequest("DELETE", fmt.Sprintf("/contact/delete/%s", contact.ID), nil)
+	res := s.Serve(req)
+	res.Body.Close()
+	c.Check(res.StatusCode, gc.Equals, 200)
+
+	var listed db.ContactPage
+	c.Assert(json.Unmarshal([]byte(s.Get200(c, "/user/contacts")), &listed), jc.ErrorIsNil)
+	c.Check(listed.Items, gc.HasLen, 0)
+	c.Assert(json.Unmarshal([]byte(s.Get200(c, "/user/contacts?include_archived=true")), &listed), jc.ErrorIsNil)
+	c.Assert(listed.Items, gc.HasLen, 1)
+	c.Check(listed.Items[0].Archived, jc.IsTrue)
+
+	s.Put200(c, fmt.Sprintf("/contact/archive/%s", contact.ID), `{"archived": false}`)
+	c.Assert(json.Unmarshal([]byte(s.Get200(c, "/user/contacts")), &listed), jc.ErrorIsNil)
+	c.Check(listed.Items, gc.HasLen, 1)
+}
+
+func (s *ContactsSuite) TestTagsAndCustomFields(c *gc.C) {
+	s.Put200(c, "/contact/fields", `{"fields": [
+		{"key": "po_number", "label": "PO number", "type": "text"},
+		{"key": "sector", "label": "Sector", "type": "select", "options": ["public", "private"]}
+	]}`)
+	s.Put400(c, "/contact/fields", `{"fields": [{"key": "po number", "label": "PO", "type": "text"}]}`)
+
+	contact := db.Contact{}
+	c.Assert(json.Unmarshal([]byte(s.Post200(c, "/contact/new", `{
+		"first_name": "Jane", "last_name": "Smith", "phone": "021", "email": "jane@smith.example",
+		"tags": ["Retainer", "government"],
+		"custom_fields": {"sector": "public"}
+	}`)), &contact), jc.ErrorIsNil)
+	c.Check(contact.Tags, jc.DeepEquals, []string{"government", "retainer"})
+	c.Check(contact.CustomFields, jc.DeepEquals, map[string]string{"sector": "public"})
+	s.AddContact(context.Background(), c, s.user.ID)
+
+	s.Post400(c, "/contact/new", `{
+		"first_name": "Bob", "last_name": "Brown", "phone": "021", "email": "bob@brown.example",
+		"custom_fields": {"sector": "charity"}
+	}`)
+
+	var listed db.ContactPage
+	c.Assert(json.Unmarshal([]byte(s.Get200(c, "/user/contacts?tag=Retainer&tag=government")), &listed), jc.ErrorIsNil)
+	c.Assert(listed.Items, gc.HasLen, 1)
+	c.Check(listed.Items[0].ID, gc.Equals, contact.ID)
+	c.Assert(json.Unmarshal([]byte(s.Get200(c, "/user/contacts?tag=one-off")), &listed), jc.ErrorIsNil)
+	c.Check(listed.Items, gc.HasLen, 0)
+
+	updated := db.Contact{}
+	c.Assert(json.Unmarshal([]byte(s.Put200(c, fmt.Sprintf("/contact/update/%s", contact.ID), `{
+		"first_name": "Jane", "last_name": "Smith", "phone": "021", "email": "jane@smith.example",
+		"tags": ["one-off"],
+		"custom_fields": {"po_number": "PO-7"}
+	}`)), &updated), jc.ErrorIsNil)
+	c.Check(updated.ID, gc.Equals, contact.ID)
+	c.Check(updated.Tags, jc.DeepEquals, []string{"one-off"})
+	c.Check(updated.CustomFields, jc.DeepEquals, map[string]string{"po_number": "PO-7"})
+	c.Check(s.Get200(c, "/contact/fields"), jc.Contains, `"po_number"`)
+}
+
+func (s *ContactsSuite) TestBillingDefaults(c *gc.C) {
+	contact := db.Contact{}
+	c.Assert(json.Unmarshal([]byte(s.Post200(c, "/contact/new", `{
+		"first_name": "Jane", "last_name": "Smith", "phone": "021", "email": "jane@smith.example",
+		"billing": {"payment_terms": "eom_20", "rate": 150, "currency": "aud", "recipients": ["accounts@smith.example"]}
+	}`)), &contact), jc.ErrorIsNil)
+	c.Check(contact.Billing, jc.DeepEquals, &db.BillingDefaults{
+		PaymentTerms: "eom_20",
+		Rate:         150,
+		Currency:     "AUD",
+		Recipients:   []string{"accounts@smith.example"},
+	})
+
+	s.Post400(c, "/contact/new", `{
+		"first_name": "Jane", "last_name": "Smith", "phone": "021", "email": "jane@smith.example",
+		"billing": {"payment_terms": "net"}
+	}`)
+}
+
+func (s *ContactsSuite) TestListContacts(c *gc.C) {
+	ctx := context.Background()
+	for _, name := range []string{"Brown", "Adams", "Clark"} {
+		contact := setup.CreateContact(s.user.ID)
+		contact.LastName = name
+		_, err := s.App.AddContact(ctx, &contact)
+		c.Assert(err, jc.ErrorIsNil)
+	}
+
+	var names []string
+	path := "/user/contacts?limit=2"
+	for path != "" {
+		var page db.ContactPage
+		c.Assert(json.Unmarshal([]byte(s.Get200(c, path)), &page), jc.ErrorIsNil)
+		c.Assert(len(page.Items) <= 2, jc.IsTrue)
+		for _, contact := range page.Items {
+			names = append(names, contact.LastName)
+		}
+		path = ""
+		if page.NextCursor != "" {
+			path = "/user/contacts?limit=2&cursor=" + page.NextCursor
+		}
+	}
+	c.Check(names, jc.DeepEquals, []string{"Adams", "Brown", "Clark"})
+
+	s.Get400(c, "/user/contacts?sort=phone")
+	s.Get400(c, "/user/contacts?sort=-name&cursor=nonsense")
+}
@@ -3,6 +3,8 @@ package handler
 import (
 	"context"
 	"errors"
+	"net/http"
+	"strings"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -12,11 +14,19 @@ import (
 
 const (
 	dbAppKey       = "server:app_db"
+	frontendURLKey = "server:frontend_url"
 	dbInvoiceKey   = "server:invoice"
 	dbContactKey   = "server:contact"
 	dbUserKey      = "server:user"
+	dbAPIKeyKey    = "server:api_key"
+	dbOrgKey       = "server:organisation"
+	dbMemberKey    = "server:member"
 	userSessionKey = "session:user"
 	sessionKey     = "interface:session"
+
+	// sessionAPIKeyKey holds the API key that authenticated the request, if
+	// any. It is unset for interactive sessions.
+	sessionAPIKeyKey = "session:api_key"
 )
 
 // TODO do multiple sessions work?
@@ -45,6 +55,18 @@ func MustApp(c *gin.Context) *db.App {
 	return c.MustGet(dbAppKey).(*db.App)
 }
 
+// SetFrontendURL returns middleware that stores the web app's URL in the gin
+// context.
+func SetFrontendURL(frontendURL string) gin.HandlerFunc {
+	return func(c *gin.Context) { c.Set(frontendURLKey, strings.TrimRight(frontendURL, "/")) }
+}
+
+// FrontendLink returns the URL of a page of the web app, e.g.
+// FrontendLink(c, "invoice", id), or panics if there's no web app URL.
+func FrontendLink(c *gin.Context, path ...string) string {
+	return c.MustGet(frontendURLKey).(string) + "/" + strings.Join(path, "/")
+}
+
 // MustApp returns the application database or panics.
 func MustInvoice(c *gin.Context) *db.Invoice {
 	return c.MustGet(dbInvoiceKey).(*db.Invoice)
@@ -59,6 +81,28 @@ func MustContact(c *gin.Context) *db.Contact {
 	return c.MustGet(dbContactKey).(*db.Contact)
 }
 
+func MustAPIKey(c *gin.Context) *db.APIKey {
+	return c.MustGet(dbAPIKeyKey).(*db.APIKey)
+}
+
+func MustOrganisation(c *gin.Context) *db.Organisation {
+	return c.MustGet(dbOrgKey).(*db.Organisation)
+}
+
+func MustMember(c *gin.Context) *db.Member {
+	return c.MustGet(dbMemberKey).(*db.Member)
+}
+
+// SessionAPIKey returns the API key that authenticated the request, or nil if
+// the request came from an interactive session.
+func SessionAPIKey(c *gin.Context) *db.APIKey {
+	key, ok := c.Get(sessionAPIKeyKey)
+	if !ok {
+		return nil
+	}
+	return key.(*db.APIKey)
+}
+
 // SetSession returns middleware that stores the session interface in the gin context.
 func SetSession(session Session) gin.HandlerFunc {
 	return func(c *gin.Context) { c.Set(sessionKey, session) }
@@ -132,6 +176,9 @@ func EnsureContact() gin.HandlerFunc {
 		if err == db.ContactNotFound {
 			return nil, route.NotFound
 		}
+		if err != nil {
+			return nil, err
+		}
 
 		return contact, nil
 	}
@@ -145,3 +192,130 @@ func EnsureContact() gin.HandlerFunc {
 		}
 	}
 }
+
+// EnsureScope returns middleware that rejects requests which modify data when
+// they are authenticated by a read-only API key.
+func EnsureScope() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := SessionAPIKey(c)
+		if key == nil || key.CanWrite() {
+			return
+		}
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			route.Abort(c, route.Forbidden)
+		}
+	}
+}
+
+// EnsureInteractive returns middleware that rejects requests authenticated by
+// an API key. It guards endpoints, like key management, that scripts should
+// never be able to reach.
+func EnsureInteractive() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if SessionAPIKey(c) != nil {
+			route.Abort(c, route.Forbidden)
+		}
+	}
+}
+
+// EnsureAPIKey returns middleware that extracts the value of :apikey_id and
+// sets the matching key in the context. Keys belonging to other users are
+// reported as not found.
+func EnsureAPIKey() gin.HandlerFunc {
+	getAPIKey := func(c *gin.Context) (*db.APIKey, error) {
+		var req struct {
+			ID string `uri:"apikey_id" binding:"required"`
+		}
+		if c.ShouldBindUri(&req); req.ID == "" {
+			return nil, errors.New("apikey_id is required")
+		}
+		app := MustApp(c)
+		user := MustUser(c)
+
+		key, err := app.APIKey(context.Background(), req.ID)
+		if err == db.APIKeyNotFound {
+			return nil, route.NotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if key.UserID != user.ID {
+			return nil, route.NotFound
+		}
+
+		return key, nil
+	}
+
+	return func(c *gin.Context) {
+		key, err := getAPIKey(c)
+		if err != nil {
+			route.Abort(c, err)
+		} else {
+			c.Set(dbAPIKeyKey, key)
+		}
+	}
+}
+
+// EnsureOrganisation returns middleware that extracts the value of
+// :organisation_id and sets the organisation in the context.
+func EnsureOrganisation() gin.HandlerFunc {
+	getOrganisation := func(c *gin.Context) (*db.Organisation, error) {
+		var req struct {
+			ID string `uri:"organisation_id" binding:"required"`
+		}
+		if c.ShouldBindUri(&req); req.ID == "" {
+			return nil, errors.New("organisation_id is required")
+		}
+		app := MustApp(c)
+
+		org, err := app.Organisation(context.Background(), req.ID)
+		if err == db.OrganisationNotFound {
+			return nil, route.NotFound
+		}
+
+		return org, err
+	}
+
+	return func(c *gin.Context) {
+		org, err := getOrganisation(c)
+		if err != nil {
+			route.Abort(c, err)
+		} else {
+			c.Set(dbOrgKey, org)
+		}
+	}
+}
+
+// EnsureMember returns middleware that extracts the value of :user_id and sets
+// that user's membership of the organisation set by EnsureOrganisation.
+func EnsureMember() gin.HandlerFunc {
+	getMember := func(c *gin.Context) (*db.Member, error) {
+		var req struct {
+			ID string `uri:"user_id" binding:"required"`
+		}
+		if c.ShouldBindUri(&req); req.ID == "" {
+			return nil, errors.New("user_id is required")
+		}
+		app := MustApp(c)
+		org := MustOrganisation(c)
+
+		member, err := app.Member(context.Background(), org.ID, req.ID)
+		if err == db.MemberNotFound {
+			return nil, route.NotFound
+		}
+
+		return member, err
+	}
+
+	return func(c *gin.Context) {
+		member, err := getMember(c)
+		if err != nil {
+			route.Abort(c, err)
+		} else {
+			c.Set(dbMemberKey, member)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/export"
+	"github.com/wham-invoice/wham-platform/server/route"
+)
+
+// NewCreditNoteRequest describes a credit against an invoice.
+type NewCreditNoteRequest struct {
+	// Amount is credited excluding GST, which is credited on top at the
+	// invoice's rate.
+	Amount float32 `json:"amount" binding:"required"`
+	Reason string  `json:"reason"`
+	// IssueDate defaults to today.
+	IssueDate string `json:"issue_date"`
+}
+
+// NewCreditNote credits part or all of an issued invoice. Credits against an
+// invoice can't add up to more than it charged.
+var NewCreditNote = route.Endpoint{
+	Method:  "POST",
+	Path:    "/invoice/credit/:invoice_id",
+	Prereqs: route.Prereqs(EnsureInvoice(), PermitInvoice(db.PermissionWrite)),
+	Do: func(c *gin.Context) (interface{}, error) {
+		ctx := c.Request.Context()
+		app := MustApp(c)
+		invoice := MustInvoice(c)
+
+		var req NewCreditNoteRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		note := &db.CreditNote{
+			InvoiceID: invoice.ID,
+			Amount:    req.Amount,
+			Reason:    req.Reason,
+		}
+		if req.IssueDate != "" {
+			var err error
+			if note.IssueDate, err = time.Parse(export.DateFormat, req.IssueDate); err != nil {
+				return nil, errors.Wrap(err, route.BadRequest)
+			}
+		}
+
+		id, err := app.AddCreditNote(ctx, note)
+		if err == db.InvoiceNotFound {
+			return nil, errors.Wrap(err, route.NotFound)
+		}
+		if errors.IsNotValid(err) {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot add credit note")
+		}
+		note.ID = id
+
+		return note, nil
+	},
+}
+
+// InvoiceCreditNotes returns the credit notes against an invoice, oldest
+// first.
+var InvoiceCreditNotes = route.Endpoint{
+	Method:  "GET",
+	Path:    "/invoice/credits/:invoice_id",
+	Prereqs: route.Prereqs(EnsureInvoice(), PermitInvoice(db.PermissionRead)),
+	Do: func(c *gin.Context) (interface{}, error) {
+		notes, err := MustInvoice(c).CreditNotes(c.Request.Context(), MustApp(c))
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot get credit notes")
+		}
+
+		return notes, nil
+	},
+}
@@ -0,0 +1,46 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/tests/setup"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type CreditNoteSuite struct {
+	APISuiteCore
+}
+
+var _ = gc.Suite(&CreditNoteSuite{})
+
+func (s *CreditNoteSuite) TestNewCreditNote(c *gc.C) {
+	invoice := setup.CreateInvoice(s.user.ID)
+	invoice.Hours, invoice.Rate = 1, 100
+	id, err := s.App.AddInvoice(context.Background(), invoice)
+	c.Assert(err, jc.ErrorIsNil)
+	invoice.ID = id
+
+	var note db.CreditNote
+	body := s.Post200(c, "/invoice/credit/"+invoice.ID, `{"amount": 60, "reason": "discount"}`)
+	c.Assert(json.Unmarshal([]byte(body), &note), jc.ErrorIsNil)
+	c.Check(note.ID, gc.Not(gc.Equals), "")
+	c.Check(note.InvoiceNumber, gc.Equals, invoice.Number)
+	c.Check(note.UserID, gc.Equals, s.user.ID)
+
+	var notes []db.CreditNote
+	c.Assert(json.Unmarshal([]byte(s.Get200(c, "/invoice/credits/"+invoice.ID)), &notes), jc.ErrorIsNil)
+	c.Assert(notes, gc.HasLen, 1)
+	c.Check(notes[0].Reason, gc.Equals, "discount")
+
+	// Only 40 is left to credit.
+	s.Post400(c, "/invoice/credit/"+invoice.ID, `{"amount": 50}`)
+	s.Post400(c, "/invoice/credit/"+invoice.ID, `{"amount": -1}`)
+	s.Post400(c, "/invoice/credit/"+invoice.ID, `{"amount": 1, "issue_date": "yesterday"}`)
+
+	// A credited invoice has to be voided rather than deleted.
+	s.Delete400(c, "/invoice/delete/"+invoice.ID)
+}
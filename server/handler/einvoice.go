@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/einvoice"
+	"github.com/wham-invoice/wham-platform/placeholder"
+	"github.com/wham-invoice/wham-platform/server/route"
+)
+
+// InvoiceUBL downloads the invoice as a PEPPOL BIS Billing 3.0 UBL document.
+// If the invoice can't be sent over PEPPOL, e.g. because the contact has no
+// PEPPOL ID, it responds 422 with the rules it breaks.
+var InvoiceUBL = route.Endpoint{
+	Method:  "GET",
+	Path:    "/invoice/ubl/:invoice_id",
+	Prereqs: route.Prereqs(EnsureInvoice(), PermitInvoice(db.PermissionRead)),
+	Do: func(c *gin.Context) (interface{}, error) {
+		ctx := c.Request.Context()
+		app := MustApp(c)
+		invoice := MustInvoice(c)
+
+		user, err := invoice.User(ctx, app)
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot get invoice owner")
+		}
+		contact, err := invoice.Contact(ctx, app)
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot get contact")
+		}
+		profile, err := user.BusinessProfile(ctx, app)
+		if err == db.BusinessProfileNotFound {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"violations": []einvoice.Violation{{
+					Rule:    "BR-06",
+					Message: "a business profile with the seller's legal name is required",
+				}},
+			})
+			return nil, nil
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		var buf bytes.Buffer
+		err = einvoice.WriteUBL(&buf, einvoice.Document{
+			Invoice: placeholder.Invoice(invoice, contact),
+			User:    user,
+			Profile: profile,
+			Contact: contact,
+		})
+		if verr, ok := errors.Cause(err).(*einvoice.ValidationError); ok {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"violations": verr.Violations})
+			return nil, nil
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=invoice-%d.xml", invoice.Number))
+		c.Data(http.StatusOK, "application/xml", buf.Bytes())
+
+		return nil, nil
+	},
+}
+
+// validatePeppolID returns a bad request error if id is set but isn't a
+// PEPPOL participant ID.
+func validatePeppolID(id string) error {
+	if id == "" {
+		return nil
+	}
+	if _, err := einvoice.ParseParticipantID(id); err != nil {
+		return errors.Wrap(err, route.BadRequest)
+	}
+	return nil
+}
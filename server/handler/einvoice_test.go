@@ -0,0 +1,73 @@
+package handler_test
+
+import (
+	"context"
+	"net/http/httptest"
+
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/tests/setup"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type einvoiceSuite struct {
+	APISuiteCore
+
+	profile *db.BusinessProfile
+}
+
+var _ = gc.Suite(&einvoiceSuite{})
+
+func (s *einvoiceSuite) SetUpTest(c *gc.C) {
+	s.APISuiteCore.SetUpTest(c)
+
+	s.profile = setup.CreateBusinessProfile(s.user.ID)
+	s.profile.Address.Country = "New Zealand"
+	s.profile.PeppolID = "0088:9429041234567"
+}
+
+// addInvoice adds an invoice billed to a contact with the given PEPPOL ID.
+func (s *einvoiceSuite) addInvoice(c *gc.C, peppolID string) *db.Invoice {
+	ctx := context.Background()
+
+	contact := setup.CreateContact(s.user.ID)
+	contact.Address.Country = "NZ"
+	contact.PeppolID = peppolID
+	contactID, err := s.App.AddContact(ctx, &contact)
+	c.Assert(err, jc.ErrorIsNil)
+
+	invoice := setup.CreateInvoice(s.user.ID)
+	invoice.ContactID = contactID
+	invoice.ID, err = s.App.AddInvoice(ctx, invoice)
+	c.Assert(err, jc.ErrorIsNil)
+
+	return invoice
+}
+
+func (s *einvoiceSuite) TestInvoiceUBL(c *gc.C) {
+	c.Assert(s.App.SetBusinessProfile(context.Background(), s.profile), jc.ErrorIsNil)
+	invoice := s.addInvoice(c, "0088:9429047654321")
+
+	res := s.Serve(httptest.NewRequest("GET", "/invoice/ubl/"+invoice.ID, nil))
+	c.Assert(res.StatusCode, gc.Equals, 200)
+	c.Check(res.Header.Get("Content-Type"), gc.Equals, "application/xml")
+	c.Check(readAll(c, res.Body), jc.Contains, `<cbc:EndpointID schemeID="0088">9429047654321</cbc:EndpointID>`)
+}
+
+func (s *einvoiceSuite) TestInvoiceUBLWithoutPeppolID(c *gc.C) {
+	c.Assert(s.App.SetBusinessProfile(context.Background(), s.profile), jc.ErrorIsNil)
+	invoice := s.addInvoice(c, "")
+
+	res := s.Serve(httptest.NewRequest("GET", "/invoice/ubl/"+invoice.ID, nil))
+	c.Assert(res.StatusCode, gc.Equals, 422)
+	c.Check(readAll(c, res.Body), jc.Contains, "PEPPOL-EN16931-R010")
+}
+
+func (s *einvoiceSuite) TestInvoiceUBLWithoutProfile(c *gc.C) {
+	invoice := s.addInvoice(c, "0088:9429047654321")
+
+	res := s.Serve(httptest.NewRequest("GET", "/invoice/ubl/"+invoice.ID, nil))
+	c.Check(res.StatusCode, gc.Equals, 422)
+	res.Body.Close()
+}
@@ -0,0 +1,278 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/export"
+	"github.com/wham-invoice/wham-platform/server/route"
+	"github.com/wham-invoice/wham-platform/vcard"
+)
+
+// ExportRequest is the query common to every export.
+type ExportRequest struct {
+	// Format is csv (the default) or xlsx.
+	Format string `form:"format"`
+	// Columns is a comma separated list of column keys; all of them if
+	// empty.
+	Columns string `form:"columns"`
+	// OrganisationID exports the organisation's records rather than the
+	// user's.
+	OrganisationID string `form:"organisation_id"`
+}
+
+// InvoiceExportRequest filters the invoices to export.
+type InvoiceExportRequest struct {
+	ExportRequest
+	InvoiceFilterRequest
+}
+
+// ExportInvoices downloads the chosen invoices as a spreadsheet, oldest
+// first, streaming rows as they're read.
+var ExportInvoices = route.Endpoint{
+	Method: "GET",
+	Path:   "/export/invoices",
+	Do: func(c *gin.Context) (interface{}, error) {
+		ctx := c.Request.Context()
+		app := MustApp(c)
+
+		var req InvoiceExportRequest
+		if err := c.ShouldBindQuery(&req); err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		format, columns, filter, err := invoiceExport(c, req)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		contacts := map[string]*db.Contact{}
+		err = app.ForEachContact(ctx, db.ContactFilter{
+			UserID:          filter.UserID,
+			OrganisationID:  filter.OrganisationID,
+			IncludeArchived: true,
+		}, func(contact *db.Contact) error {
+			contacts[contact.ID] = contact
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot get contacts")
+		}
+
+		stream := exportStream{c: c, format: format, name: "invoices", sheet: "Invoices"}
+		var table *export.InvoiceTable
+		err = app.ForEachInvoice(ctx, filter, func(invoice *db.Invoice) error {
+			if table == nil {
+				w, err := stream.start()
+				if err != nil {
+					return errors.Trace(err)
+				}
+				if table, err = export.NewInvoiceTable(w, columns); err != nil {
+					return errors.Trace(err)
+				}
+			}
+			// Show who the invoice was issued to, if we know.
+			contact := invoice.BillTo
+			if contact == nil {
+				contact = contacts[invoice.ContactID]
+			}
+			return table.Write(export.InvoiceRow{Invoice: invoice, Contact: contact})
+		})
+		if err == nil && table == nil {
+			// No invoices: still send the header row.
+			var w export.RowWriter
+			if w, err = stream.start(); err == nil {
+				_, err = export.NewInvoiceTable(w, columns)
+			}
+		}
+		return nil, stream.finish(err)
+	},
+}
+
+// invoiceExport checks the request and works out what to export.
+func invoiceExport(c *gin.Context, req InvoiceExportRequest) (
+	export.Format, []export.InvoiceColumn, db.InvoiceFilter, error,
+) {
+	var filter db.InvoiceFilter
+	format, err := export.ParseFormat(req.Format)
+	if err != nil {
+		return "", nil, filter, errors.Wrap(err, route.BadRequest)
+	}
+	columns, err := export.SelectInvoiceColumns(splitList([]string{req.Columns}))
+	if err != nil {
+		return "", nil, filter, errors.Wrap(err, route.BadRequest)
+	}
+	if filter, err = exportOwner(c, req.ExportRequest); err != nil {
+		return "", nil, filter, errors.Trace(err)
+	}
+	if err := req.InvoiceFilterRequest.apply(&filter); err != nil {
+		return "", nil, filter, errors.Trace(err)
+	}
+
+	return format, columns, filter, nil
+}
+
+// ExportContacts downloads the user's or organisation's contacts as a
+// spreadsheet, streaming rows as they're read.
+var ExportContacts = route.Endpoint{
+	Method: "GET",
+	Path:   "/export/contacts",
+	Do: func(c *gin.Context) (interface{}, error) {
+		app := MustApp(c)
+
+		var req ExportRequest
+		if err := c.ShouldBindQuery(&req); err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		format, err := export.ParseFormat(req.Format)
+		if err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		columns, err := export.SelectContactColumns(splitList([]string{req.Columns}))
+		if err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		owner, err := exportOwner(c, req)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		stream := exportStream{c: c, format: format, name: "contacts", sheet: "Contacts"}
+		var table *export.ContactTable
+		err = app.ForEachContact(c.Request.Context(), db.ContactFilter{
+			UserID:         owner.UserID,
+			OrganisationID: owner.OrganisationID,
+		}, func(contact *db.Contact) error {
+			if table == nil {
+				w, err := stream.start()
+				if err != nil {
+					return errors.Trace(err)
+				}
+				if table, err = export.NewContactTable(w, columns); err != nil {
+					return errors.Trace(err)
+				}
+			}
+			return table.Write(contact)
+		})
+		if err == nil && table == nil {
+			var w export.RowWriter
+			if w, err = stream.start(); err == nil {
+				_, err = export.NewContactTable(w, columns)
+			}
+		}
+		return nil, stream.finish(err)
+	},
+}
+
+// exportOwner returns a filter for the organisation's records if the request
+// names one the user can read, and otherwise for the user's own.
+func exportOwner(c *gin.Context, req ExportRequest) (db.InvoiceFilter, error) {
+	if req.OrganisationID == "" {
+		return db.InvoiceFilter{UserID: MustUser(c).ID}, nil
+	}
+	if err := authorize(c, req.OrganisationID, "", db.PermissionRead); err != nil {
+		return db.InvoiceFilter{}, errors.Trace(err)
+	}
+	return db.InvoiceFilter{OrganisationID: req.OrganisationID}, nil
+}
+
+// exportStream sends a spreadsheet download. It holds back the response
+// until there's a first row to write, so that failing to read any records
+// is still reported with a proper error status.
+type exportStream struct {
+	c      *gin.Context
+	format export.Format
+	name   string
+	sheet  string
+	w      export.RowWriter
+}
+
+func (s *exportStream) start() (export.RowWriter, error) {
+	filename := fmt.Sprintf("%s-%s.%s", s.name, time.Now().Format(export.DateFormat), s.format)
+	s.c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	s.c.Header("Content-Type", s.format.ContentType())
+	s.c.Header("Cache-Control", "no-store")
+	s.c.Status(http.StatusOK)
+
+	w, err := export.NewWriter(s.format, s.c.Writer, s.sheet)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	s.w = w
+	return w, nil
+}
+
+// finish completes the file. Once rows have gone out an error can only cut
+// the download short, so it is logged by the caller and the client sees a
+// truncated file.
+func (s *exportStream) finish(err error) error {
+	if s.w == nil {
+		return errors.Trace(err)
+	}
+	if closeErr := s.w.Close(); err == nil {
+		err = closeErr
+	}
+	return errors.Annotatef(err, "%s export failed part way", s.name)
+}
+
+// splitList splits comma separated values and drops empty ones, so both
+// ?status=paid,void and ?status=paid&status=void work.
+func splitList(values []string) []string {
+	var list []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// ExportContactsVCard downloads the user's or organisation's contacts as
+// one vCard file, streaming cards as they're read.
+var ExportContactsVCard = route.Endpoint{
+	Method: "GET",
+	Path:   "/export/contacts/vcard",
+	Do: func(c *gin.Context) (interface{}, error) {
+		var req ExportRequest
+		if err := c.ShouldBindQuery(&req); err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		owner, err := exportOwner(c, req)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		started := false
+		start := func() {
+			filename := fmt.Sprintf("contacts-%s.vcf", time.Now().Format(export.DateFormat))
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+			c.Header("Content-Type", export.VCardContentType)
+			c.Header("Cache-Control", "no-store")
+			c.Status(http.StatusOK)
+			started = true
+		}
+		err = MustApp(c).ForEachContact(c.Request.Context(), db.ContactFilter{
+			UserID:         owner.UserID,
+			OrganisationID: owner.OrganisationID,
+		}, func(contact *db.Contact) error {
+			if !started {
+				start()
+			}
+			return vcard.Write(c.Writer, export.VCard(contact))
+		})
+		if err != nil {
+			return nil, errors.Annotate(err, "vCard export failed")
+		}
+		if !started {
+			start()
+			c.Writer.WriteHeaderNow()
+		}
+		return nil, nil
+	},
+}
@@ -0,0 +1,82 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/wham-invoice/wham-platform/tests/setup"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type ExportSuite struct {
+	APISuiteCore
+}
+
+var _ = gc.Suite(&ExportSuite{})
+
+func (s *ExportSuite) TestExportInvoices(c *gc.C) {
+	contact := s.AddContact(context.Background(), c, s.user.ID)
+	inv := setup.CreateInvoice(s.user.ID)
+	inv.ContactID = contact.ID
+	id, err := s.App.AddInvoice(context.Background(), inv)
+	c.Assert(err, jc.ErrorIsNil)
+
+	res := s.Serve(httptest.NewRequest("GET", "/export/invoices?columns=id,contact,status", nil))
+	c.Assert(res.StatusCode, gc.Equals, 200)
+	c.Check(res.Header.Get("Content-Type"), gc.Equals, "text/csv; charset=utf-8")
+	c.Check(res.Header.Get("Content-Disposition"), gc.Matches, `attachment; filename=invoices-.*\.csv`)
+
+	records, err := csv.NewReader(res.Body).ReadAll()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(records, jc.DeepEquals, [][]string{
+		{"ID", "Contact", "Status"},
+		{id, contact.FirstName + " " + contact.LastName, "issued"},
+	})
+}
+
+func (s *ExportSuite) TestExportInvoicesEmpty(c *gc.C) {
+	body := s.Get200(c, "/export/invoices?columns=number&status=void")
+	c.Check(body, gc.Equals, "Number\n")
+}
+
+func (s *ExportSuite) TestExportInvoicesBadRequest(c *gc.C) {
+	for _, query := range []string{
+		"format=ods",
+		"columns=number,secret",
+		"status=lost",
+		"from=yesterday",
+		"from=2022-03-02&to=2022-03-01",
+	} {
+		c.Logf("query %s", query)
+		s.Get400(c, "/export/invoices?"+query)
+	}
+}
+
+func (s *ExportSuite) TestExportContacts(c *gc.C) {
+	contact := s.AddContact(context.Background(), c, s.user.ID)
+
+	body := s.Get200(c, "/export/contacts?columns=id,email")
+	c.Check(body, gc.Equals, fmt.Sprintf("ID,Email\n%s,%s\n", contact.ID, contact.Email))
+}
+
+func (s *ExportSuite) TestExportContactsXLSX(c *gc.C) {
+	s.AddContact(context.Background(), c, s.user.ID)
+
+	res := s.Serve(httptest.NewRequest("GET", "/export/contacts?format=xlsx", nil))
+	c.Assert(res.StatusCode, gc.Equals, 200)
+	c.Check(res.Header.Get("Content-Type"), gc.Equals, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Check(strings.HasSuffix(res.Header.Get("Content-Disposition"), ".xlsx"), jc.IsTrue)
+}
+
+func (s *ExportSuite) TestExportContactsVCard(c *gc.C) {
+	s.AddContact(context.Background(), c, s.user.ID)
+	s.AddContact(context.Background(), c, s.user.ID)
+
+	body := s.Get200(c, "/export/contacts/vcard")
+	c.Check(strings.Count(body, "BEGIN:VCARD\r\n"), gc.Equals, 2)
+}
@@ -6,10 +6,13 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
 	"github.com/wham-invoice/wham-platform/server/route"
 )
 
-// PDF returns the invoice pdf file by id
+// PDF streams the invoice pdf file by id. It supports Range requests so
+// downloads can resume, and ETag/Last-Modified so clients can revalidate
+// cheaply. Pass ?disposition=inline to have browsers preview the file.
 var PDF = route.Endpoint{
 	Method: "GET",
 	Path:   "/pdf/:pdf_id",
@@ -18,24 +21,49 @@ var PDF = route.Endpoint{
 		app := MustApp(c)
 
 		var req struct {
-			ID string `uri:"pdf_id" binding:"required"`
+			ID          string `uri:"pdf_id" binding:"required"`
+			Disposition string `form:"disposition"`
 		}
 		if c.ShouldBindUri(&req); req.ID == "" {
 			return nil, route.NotFound
 		}
+		if err := c.ShouldBindQuery(&req); err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+
+		disposition := "attachment"
+		switch req.Disposition {
+		case "", "attachment":
+		case "inline":
+			disposition = "inline"
+		default:
+			return nil, route.BadRequest
+		}
 
 		fileName := fmt.Sprintf("%s", req.ID)
-		body, err := app.PDF(c.Request.Context(), fileName)
+		obj, err := app.OpenPDF(c.Request.Context(), fileName)
+		if err == db.FileNotFound {
+			return nil, route.NotFound
+		}
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
+		defer obj.Close()
+
+		c.Header("Access-Control-Expose-Headers",
+			"Content-Disposition, Content-Range, Accept-Ranges, ETag, Last-Modified")
+		c.Header("Content-Disposition", fmt.Sprintf("%s; filename=%s.pdf", disposition, fileName))
+		c.Header("Content-Type", "application/pdf")
+		c.Header("ETag", obj.ETag)
+		// Clients may keep a copy but must check it is still current.
+		c.Header("Cache-Control", "private, no-cache")
 
-		// ISTM we're pulling the pdf body into memory then sending to the client.
-		// TODO what happens to PDF after we've sent it?
-		cType := http.DetectContentType(body)
-		c.Header("Access-Control-Expose-Headers", "Content-Disposition")
-		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.pdf", fileName))
-		c.Data(http.StatusOK, cType, body)
+		// ServeContent handles Range, If-Range, If-None-Match and
+		// If-Modified-Since, answering 206 or 304 as appropriate.
+		http.ServeContent(c.Writer, c.Request, fileName+".pdf", obj.Updated, obj)
+		// Bodiless responses like 304 only record their status; flush it so
+		// it isn't replaced with a 204.
+		c.Writer.WriteHeaderNow()
 
 		return nil, nil
 	},
@@ -0,0 +1,65 @@
+package handler_test
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type filesSuite struct {
+	APISuiteCore
+}
+
+var _ = gc.Suite(&filesSuite{})
+
+const fakePDF = "%PDF-1.3 not really a pdf %%EOF"
+
+func (s *filesSuite) SetUpTest(c *gc.C) {
+	s.APISuiteCore.SetUpTest(c)
+
+	err := s.App.StorePDF(context.Background(), "test-pdf", strings.NewReader(fakePDF))
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *filesSuite) TestPDF(c *gc.C) {
+	req := httptest.NewRequest("GET", "/pdf/test-pdf?disposition=inline", nil)
+	res := s.Serve(req)
+	c.Check(res.StatusCode, gc.Equals, 200)
+	c.Check(res.Header.Get("Content-Type"), gc.Equals, "application/pdf")
+	c.Check(res.Header.Get("Content-Disposition"), gc.Equals, "inline; filename=test-pdf.pdf")
+	c.Check(res.Header.Get("ETag"), gc.Not(gc.Equals), "")
+	c.Check(readAll(c, res.Body), gc.Equals, fakePDF)
+}
+
+func (s *filesSuite) TestPDFRange(c *gc.C) {
+	req := httptest.NewRequest("GET", "/pdf/test-pdf", nil)
+	req.Header.Set("Range", "bytes=0-7")
+	res := s.Serve(req)
+	c.Check(res.StatusCode, gc.Equals, 206)
+	c.Check(res.Header.Get("Content-Range"), gc.Equals, fmt.Sprintf("bytes 0-7/%d", len(fakePDF)))
+	c.Check(readAll(c, res.Body), gc.Equals, fakePDF[:8])
+}
+
+func (s *filesSuite) TestPDFNotModified(c *gc.C) {
+	res := s.Serve(httptest.NewRequest("GET", "/pdf/test-pdf", nil))
+	etag := res.Header.Get("ETag")
+	res.Body.Close()
+
+	req := httptest.NewRequest("GET", "/pdf/test-pdf", nil)
+	req.Header.Set("If-None-Match", etag)
+	res = s.Serve(req)
+	c.Check(res.StatusCode, gc.Equals, 304)
+	c.Check(readAll(c, res.Body), gc.Equals, "")
+}
+
+func (s *filesSuite) TestPDFNotFound(c *gc.C) {
+	s.Get404(c, "/pdf/no-such-pdf")
+}
+
+func (s *filesSuite) TestPDFBadDisposition(c *gc.C) {
+	s.Get400(c, "/pdf/test-pdf?disposition=sideways")
+}
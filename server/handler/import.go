@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/importer"
+	"github.com/wham-invoice/wham-platform/server/route"
+)
+
+// MaxImportBytes is the largest contacts file ImportContacts accepts.
+const MaxImportBytes = 5 << 20
+
+// ImportContactsRequest is the form sent alongside the file, in the
+// multipart field "file".
+type ImportContactsRequest struct {
+	// Format is csv or vcard. Without it .vcf and .vcard files are read as
+	// vCards and anything else as CSV.
+	Format string `form:"format"`
+	// Mapping is a JSON object from CSV header to contact field, e.g.
+	// {"E-mail": "email", "Name": "name"}. Without it the mapping is
+	// guessed from the headers.
+	Mapping string `form:"mapping"`
+	// DryRun checks the file and reports on each contact without creating
+	// any.
+	DryRun bool `form:"dry_run"`
+	// SkipDuplicates leaves out contacts that look like ones we have, or
+	// earlier ones in the file, rather than creating them anyway.
+	SkipDuplicates bool `form:"skip_duplicates"`
+	// OrganisationID imports into the organisation rather than for the
+	// user.
+	OrganisationID string `form:"organisation_id"`
+}
+
+// ImportContactsResponse reports on every contact in the file. Created is
+// empty for a dry run, and when any contact has errors: then nothing is
+// created and the file should be fixed and sent again.
+type ImportContactsResponse struct {
+	DryRun  bool           `json:"dry_run"`
+	Rows    []importer.Row `json:"rows"`
+	Created []string       `json:"created"`
+}
+
+// ImportContacts creates contacts in bulk from a CSV or vCard file. Either
+// every contact is created or none are.
+var ImportContacts = route.Endpoint{
+	Method: "POST",
+	Path:   "/contact/import",
+	Do: func(c *gin.Context) (interface{}, error) {
+		ctx := c.Request.Context()
+		app := MustApp(c)
+		user := MustUser(c)
+
+		var req ImportContactsRequest
+		if err := c.ShouldBind(&req); err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		filter := db.ContactFilter{UserID: user.ID}
+		if req.OrganisationID != "" {
+			if err := authorize(c, req.OrganisationID, "", db.PermissionWrite); err != nil {
+				return nil, errors.Trace(err)
+			}
+			filter = db.ContactFilter{OrganisationID: req.OrganisationID}
+		}
+
+		rows, err := readImport(c, req)
+		if errors.IsNotValid(err) {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		var existing []*db.Contact
+		err = app.ForEachContact(ctx, filter, func(contact *db.Contact) error {
+			existing = append(existing, contact)
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot get contacts")
+		}
+		importer.MarkDuplicates(rows, existing)
+		if rows == nil {
+			rows = []importer.Row{}
+		}
+
+		resp := &ImportContactsResponse{DryRun: req.DryRun, Rows: rows, Created: []string{}}
+		var contacts []*db.Contact
+		for _, row := range rows {
+			if !row.Valid() {
+				return resp, nil
+			}
+			if req.SkipDuplicates && len(row.Duplicates) > 0 {
+				continue
+			}
+			row.Contact.UserID = user.ID
+			row.Contact.OrganisationID = req.OrganisationID
+			contacts = append(contacts, row.Contact)
+		}
+		// A dry run has to fail as the import would.
+		if len(contacts) > db.MaxContactBatch {
+			return nil, errors.Wrap(
+				errors.NotValidf("more than %d contacts", db.MaxContactBatch), route.BadRequest)
+		}
+		if req.DryRun {
+			return resp, nil
+		}
+
+		ids, err := app.AddContacts(ctx, contacts)
+		if errors.IsNotValid(err) {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot add contacts")
+		}
+		resp.Created = append(resp.Created, ids...)
+
+		return resp, nil
+	},
+}
+
+// readImport reads the uploaded file as the request says.
+func readImport(c *gin.Context, req ImportContactsRequest) ([]importer.Row, error) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return nil, errors.NewNotValid(err, "no file")
+	}
+	if header.Size > MaxImportBytes {
+		return nil, errors.NotValidf("file larger than %d bytes", MaxImportBytes)
+	}
+
+	format := strings.ToLower(req.Format)
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(header.Filename)) {
+		case ".vcf", ".vcard":
+			format = "vcard"
+		default:
+			format = "csv"
+		}
+	}
+
+	var mapping importer.Mapping
+	if req.Mapping != "" {
+		if err := json.Unmarshal([]byte(req.Mapping), &mapping); err != nil {
+			return nil, errors.NewNotValid(err, "mapping")
+		}
+	}
+
+	f, err := header.Open()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer f.Close()
+
+	switch format {
+	case "csv":
+		rows, err := importer.ReadCSV(f, mapping)
+		return rows, errors.Trace(err)
+	case "vcard":
+		rows, err := importer.ReadVCard(f)
+		return rows, errors.Trace(err)
+	}
+	return nil, errors.NotValidf("import format %q", req.Format)
+}
@@ -0,0 +1,118 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http/httptest"
+
+	"github.com/wham-invoice/wham-platform/server/handler"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type ImportSuite struct {
+	APISuiteCore
+}
+
+var _ = gc.Suite(&ImportSuite{})
+
+// importContacts posts file with the form fields and returns the status and
+// decoded response.
+func (s *ImportSuite) importContacts(
+	c *gc.C, name, file string, fields map[string]string,
+) (int, handler.ImportContactsResponse) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for k, v := range fields {
+		c.Assert(w.WriteField(k, v), jc.ErrorIsNil)
+	}
+	part, err := w.CreateFormFile("file", name)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = part.Write([]byte(file))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(w.Close(), jc.ErrorIsNil)
+
+	req := httptest.NewRequest("POST", "/contact/import", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	res := s.Serve(req)
+	defer res.Body.Close()
+
+	var resp handler.ImportContactsResponse
+	if res.StatusCode == 200 {
+		data, err := ioutil.ReadAll(res.Body)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(json.Unmarshal(data, &resp), jc.ErrorIsNil)
+	}
+	return res.StatusCode, resp
+}
+
+func (s *ImportSuite) TestDryRun(c *gc.C) {
+	existing := s.AddContact(context.Background(), c, s.user.ID)
+
+	status, resp := s.importContacts(c, "contacts.csv",
+		"Name,Email\nJane Smith,jane@smith.example\nDup,"+existing.Email+"\n",
+		map[string]string{"dry_run": "true"})
+	c.Assert(status, gc.Equals, 200)
+	c.Check(resp.DryRun, jc.IsTrue)
+	c.Check(resp.Created, gc.HasLen, 0)
+	c.Assert(resp.Rows, gc.HasLen, 2)
+	c.Check(resp.Rows[0].Contact.FirstName, gc.Equals, "Jane")
+	c.Check(resp.Rows[1].Duplicates[0].ContactID, gc.Equals, existing.ID)
+
+	contacts, err := s.user.Contacts(context.Background(), s.App)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(contacts, gc.HasLen, 1)
+}
+
+func (s *ImportSuite) TestImportVCard(c *gc.C) {
+	status, resp := s.importContacts(c, "contacts.vcf",
+		"BEGIN:VCARD\nVERSION:4.0\nN:Smith;Jane;;;\nEMAIL:jane@smith.example\n"+
+			"ADR:;;1 Queen St;Auckland;;1010;New Zealand\nEND:VCARD\n", nil)
+	c.Assert(status, gc.Equals, 200)
+	c.Assert(resp.Created, gc.HasLen, 1)
+
+	contact, err := s.App.Contact(context.Background(), resp.Created[0])
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(contact.UserID, gc.Equals, s.user.ID)
+	c.Check(contact.GetFullName(), gc.Equals, "Jane Smith")
+	c.Check(contact.Address.Suburb, gc.Equals, "Auckland")
+}
+
+func (s *ImportSuite) TestInvalidRowsCreateNothing(c *gc.C) {
+	status, resp := s.importContacts(c, "contacts.csv",
+		"first_name,email\nJane,jane@smith.example\n,broken\n", nil)
+	c.Assert(status, gc.Equals, 200)
+	c.Check(resp.Created, gc.HasLen, 0)
+	c.Check(resp.Rows[1].Errors, gc.Not(gc.HasLen), 0)
+
+	contacts, err := s.user.Contacts(context.Background(), s.App)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(contacts, gc.HasLen, 0)
+}
+
+func (s *ImportSuite) TestSkipDuplicates(c *gc.C) {
+	status, resp := s.importContacts(c, "contacts.csv",
+		"first_name,email\nJane,jane@smith.example\nJane S,JANE@smith.example\n",
+		map[string]string{"skip_duplicates": "true"})
+	c.Assert(status, gc.Equals, 200)
+	c.Check(resp.Created, gc.HasLen, 1)
+}
+
+func (s *ImportSuite) TestBadRequests(c *gc.C) {
+	for _, test := range []struct {
+		name, file string
+		fields     map[string]string
+	}{
+		{"a.csv", "colour\nred\n", nil},
+		{"a.csv", "email\n", map[string]string{"mapping": "{not json"}},
+		{"a.csv", "email\n", map[string]string{"format": "xml"}},
+		{"a.vcf", "BEGIN:VCARD\nVERSION:2.1\nEND:VCARD\n", nil},
+	} {
+		status, _ := s.importContacts(c, test.name, test.file, test.fields)
+		c.Check(status, gc.Equals, 400, gc.Commentf("%s %q", test.name, test.file))
+	}
+}
@@ -1,17 +1,21 @@
 package handler
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/wham-invoice/wham-platform/db"
 	"github.com/wham-invoice/wham-platform/email"
 	"github.com/wham-invoice/wham-platform/pdf"
+	"github.com/wham-invoice/wham-platform/placeholder"
 	"github.com/wham-invoice/wham-platform/server/route"
+	"github.com/wham-invoice/wham-platform/util"
 
 	"github.com/juju/errors"
 	"golang.org/x/oauth2/google"
@@ -21,21 +25,39 @@ import (
 
 type EmailInvoiceRequest struct {
 	ID string `json:"invoice_id" binding:"required"`
+	// Message optionally replaces the email's text. It can use the same
+	// placeholders as invoice descriptions, e.g. {contact.first_name}, and
+	// the link to the invoice is added after it.
+	Message string `json:"message"`
 }
 
+type InvoiceStatusRequest struct {
+	Status db.InvoiceStatus `json:"status" binding:"required"`
+	// PaidDate defaults to today when marking an invoice paid.
+	PaidDate string `json:"paid_date"`
+}
+
+// NewInvoiceRequest describes an invoice to create. Rate, currency, tax
+// treatment and payment terms default to the contact's billing defaults.
 type NewInvoiceRequest struct {
 	ContactID   string  `json:"contact_id" binding:"required"`
 	Description string  `json:"description" binding:"required"`
 	Hours       float32 `json:"hours" binding:"required"`
-	Rate        float32 `json:"rate" binding:"required"`
-	DueDate     string  `json:"due_date" binding:"required"`
+	Rate        float32 `json:"rate"`
+	// DueDate is worked out from the payment terms if it is blank.
+	DueDate      string          `json:"due_date"`
+	PaymentTerms db.PaymentTerms `json:"payment_terms"`
+	Currency     string          `json:"currency"`
+	TaxTreatment db.TaxTreatment `json:"tax_treatment"`
+	// Template optionally overrides the user's default PDF template.
+	Template string `json:"template"`
 }
 
 // Invoice returns the invoice by id
 var Invoice = route.Endpoint{
 	Method:  "GET",
 	Path:    "/invoice/get/:invoice_id",
-	Prereqs: route.Prereqs(EnsureInvoice()),
+	Prereqs: route.Prereqs(EnsureInvoice(), PermitInvoice(db.PermissionRead)),
 	Do: func(c *gin.Context) (interface{}, error) {
 		invoice := MustInvoice(c)
 
@@ -64,13 +86,17 @@ var ViewInvoice = route.Endpoint{
 var DeleteInvoice = route.Endpoint{
 	Method:  "DELETE",
 	Path:    "/invoice/delete/:invoice_id",
-	Prereqs: route.Prereqs(EnsureInvoice()),
+	Prereqs: route.Prereqs(EnsureInvoice(), PermitInvoice(db.PermissionWrite)),
 	Do: func(c *gin.Context) (interface{}, error) {
 		ctx := c.Request.Context()
 		app := MustApp(c)
 		invoice := MustInvoice(c)
 
-		if err := invoice.Delete(ctx, app); err != nil {
+		err := invoice.Delete(ctx, app)
+		if errors.IsNotValid(err) {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		if err != nil {
 			return nil, errors.Trace(err)
 		}
 
@@ -78,22 +104,13 @@ var DeleteInvoice = route.Endpoint{
 	},
 }
 
-// TODO pagination
-// UserInvoices returns all invoices for a user.
+// UserInvoices returns a page of the user's invoices, as an
+// InvoiceListRequest asks.
 var UserInvoices = route.Endpoint{
 	Method: "GET",
 	Path:   "/user/invoices",
 	Do: func(c *gin.Context) (interface{}, error) {
-		ctx := c.Request.Context()
-		app := MustApp(c)
-		user := MustUser(c)
-
-		invoices, err := user.Invoices(ctx, app)
-		if err != nil {
-			return nil, errors.Annotate(err, "cannot get invoices")
-		}
-
-		return invoices, nil
+		return listInvoices(c, db.InvoiceFilter{UserID: MustUser(c).ID})
 	},
 }
 
@@ -104,29 +121,24 @@ var NewInvoice = route.Endpoint{
 	Do: func(c *gin.Context) (interface{}, error) {
 		ctx := c.Request.Context()
 		app := MustApp(c)
-		user := MustUser(c)
 
 		var req NewInvoiceRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			return nil, errors.Annotate(err, "cannot bind request")
 		}
 
-		newInvoice, err := invoiceFromRequest(req, user.ID)
+		pdfBuilder, err := invoiceBuilder(c, req)
 		if err != nil {
-			return nil, errors.Annotate(err, "cannot create invoice from request")
+			return nil, errors.Trace(err)
 		}
-
-		contact, err := app.Contact(ctx, newInvoice.ContactID)
-		if err != nil {
-			return nil, errors.Annotate(err, "cannot get contact ")
+		newInvoice := pdfBuilder.Invoice
+		// The number is printed on the PDF, so it is taken before the
+		// invoice is added.
+		if newInvoice.Number, err = app.NextInvoiceNumber(ctx, newInvoice.OwnerID()); err != nil {
+			return nil, errors.Annotate(err, "cannot number invoice")
 		}
 
-		pdfBuilder := &pdf.Builder{
-			App:     app,
-			Invoice: newInvoice,
-			User:    user,
-			Contact: contact}
-		pdfID, err := pdf.CreatePDF(ctx, *pdfBuilder)
+		pdfID, err := pdf.CreatePDF(ctx, pdfBuilder)
 		if err != nil {
 			return nil, errors.Annotate(err, "cannot create PDF from invoice")
 		}
@@ -147,6 +159,122 @@ var NewInvoice = route.Endpoint{
 	},
 }
 
+// PreviewInvoice renders the invoice a NewInvoiceRequest would create,
+// without saving anything. Pass ?format=png for a thumbnail of the first page
+// instead of the PDF.
+var PreviewInvoice = route.Endpoint{
+	Method: "POST",
+	Path:   "/invoice/preview",
+	Do: func(c *gin.Context) (interface{}, error) {
+		ctx := c.Request.Context()
+
+		format := c.DefaultQuery("format", "pdf")
+		if format != "pdf" && format != "png" {
+			return nil, route.BadRequest
+		}
+
+		var req NewInvoiceRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return nil, errors.Annotate(err, "cannot bind request")
+		}
+
+		pdfBuilder, err := invoiceBuilder(c, req)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		var buf bytes.Buffer
+		if err := pdf.Render(&buf, pdfBuilder); err != nil {
+			return nil, errors.Annotate(err, "cannot render preview")
+		}
+
+		contentType, body := "application/pdf", buf.Bytes()
+		if format == "png" {
+			body, err = pdf.Thumbnail(ctx, body, pdf.ThumbnailWidth)
+			if errors.IsNotSupported(err) {
+				return nil, errors.Wrap(err, route.NotImplemented)
+			}
+			if err != nil {
+				return nil, errors.Annotate(err, "cannot render thumbnail")
+			}
+			contentType = "image/png"
+		}
+
+		// Previews change with every edit, so there's no point keeping them.
+		c.Header("Cache-Control", "no-store")
+		c.Header("Content-Disposition", fmt.Sprintf("inline; filename=preview.%s", format))
+		c.Data(http.StatusOK, contentType, body)
+
+		return nil, nil
+	},
+}
+
+// UpdateInvoiceStatus moves an invoice to a new status and regenerates its
+// PDF with a matching stamp, e.g. PAID or VOID. The PDF the invoice was issued
+// with is kept as its original_pdf_id.
+var UpdateInvoiceStatus = route.Endpoint{
+	Method:  "PUT",
+	Path:    "/invoice/status/:invoice_id",
+	Prereqs: route.Prereqs(EnsureInvoice(), PermitInvoice(db.PermissionWrite)),
+	Do: func(c *gin.Context) (interface{}, error) {
+		ctx := c.Request.Context()
+		app := MustApp(c)
+		invoice := MustInvoice(c)
+
+		var req InvoiceStatusRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		if err := invoice.CheckStatus(req.Status); err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+
+		paidDate := time.Now()
+		if req.PaidDate != "" {
+			var err error
+			if paidDate, err = time.Parse("2006-01-02", req.PaidDate); err != nil {
+				return nil, errors.Wrap(err, route.BadRequest)
+			}
+		}
+
+		// Render the invoice as it will be, stamped with its new status.
+		updated := *invoice
+		updated.Status = req.Status
+		updated.PaidDate = paidDate
+		pdfBuilder, err := existingInvoiceBuilder(c, &updated)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		pdfBuilder.Overlay = pdf.StatusOverlay(&updated)
+		pdfID, err := pdf.CreatePDF(ctx, pdfBuilder)
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot create PDF from invoice")
+		}
+
+		oldPDFID := invoice.PDFID
+		if err := invoice.SetStatus(ctx, app, req.Status, paidDate, pdfID); err != nil {
+			return nil, errors.Trace(err)
+		}
+		// Only the original and the current PDF are worth keeping.
+		if oldPDFID != invoice.OriginalPDFID {
+			if err := app.DeletePDF(ctx, oldPDFID); err != nil {
+				util.Logger.Warnf("cannot delete superseded PDF %s: %v", oldPDFID, err)
+			}
+		}
+
+		return invoice, nil
+	},
+}
+
+// InvoiceTemplates returns the names of the PDF templates invoices can use.
+var InvoiceTemplates = route.Endpoint{
+	Method: "GET",
+	Path:   "/invoice/templates",
+	Do: func(c *gin.Context) (interface{}, error) {
+		return pdf.TemplateNames(), nil
+	},
+}
+
 // TODO invoice_id should be in path then use MustInvoice.
 var EmailInvoice = route.Endpoint{
 	Method: "POST",
@@ -166,13 +294,17 @@ var EmailInvoice = route.Endpoint{
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
+		if err := authorize(c, invoice.OrganisationID, invoice.UserID, db.PermissionWrite); err != nil {
+			return nil, errors.Trace(err)
+		}
 
 		contact, err := app.Contact(ctx, invoice.ContactID)
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
 
-		if err := emailInvoice(ctx, invoice, user, contact); err != nil {
+		link := FrontendLink(c, "invoice", invoice.ID)
+		if err := emailInvoice(ctx, link, invoice, user, contact, req.Message); err != nil {
 			return nil, errors.Trace(err)
 		}
 
@@ -180,54 +312,213 @@ var EmailInvoice = route.Endpoint{
 	},
 }
 
-// TODO config should be stored in config file. e.g url
+// emailInvoice emails the contact a link to the invoice.
 func emailInvoice(
 	ctx context.Context,
+	invoiceURL string,
 	invoice *db.Invoice,
 	user *db.User,
 	contact *db.Contact,
+	message string,
 ) error {
-	b, err := ioutil.ReadFile("/opt/google_web_client_credentials.json")
+	service, err := gmailService(ctx, user)
 	if err != nil {
 		return errors.Trace(err)
 	}
 
+	body := fmt.Sprintf("Hi %s,\n\n"+
+		"Your invoice is ready.\n\n"+
+		"To view and download it please visit: %s "+
+		"Thanks.\n"+
+		"%s", contact.FirstName, invoiceURL, user.FirstName)
+	if message != "" {
+		body = fmt.Sprintf("%s\n\n%s",
+			placeholder.Expand(message, placeholder.Values(contact, invoice)), invoiceURL)
+	}
+
+	return errors.Trace(
+		email.GmailSend(service, "me", recipients(contact), "Invoice", body),
+	)
+}
+
+// recipients returns who mail to the contact goes to: the contact and their
+// billing recipients.
+func recipients(contact *db.Contact) string {
+	to := []string{}
+	if contact.Email != "" {
+		to = append(to, contact.Email)
+	}
+	if contact.Billing != nil {
+		to = append(to, contact.Billing.Recipients...)
+	}
+	return strings.Join(to, ", ")
+}
+
+// gmailService returns a gmail client that sends mail as the user.
+func gmailService(ctx context.Context, user *db.User) (*gmail.Service, error) {
+	b, err := ioutil.ReadFile("/opt/google_web_client_credentials.json")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
 	config, err := google.ConfigFromJSON(b, gmail.GmailComposeScope, gmail.GmailSendScope)
 	if err != nil {
-		return errors.Trace(err)
+		return nil, errors.Trace(err)
 	}
 
 	httpClient := config.Client(context.Background(), &user.OAuth)
 	service, err := gmail.NewService(ctx, option.WithHTTPClient(httpClient))
 	if err != nil {
-		return errors.Trace(err)
+		return nil, errors.Trace(err)
 	}
 
-	invoiceURL := fmt.Sprintf("http://localhost:3000/invoice/%s", invoice.ID)
-	body := fmt.Sprintf("Hi %s,\n\n"+
-		"Your invoice is ready.\n\n"+
-		"To view and download it please visit: %s "+
-		"Thanks.\n"+
-		"%s", contact.FirstName, invoiceURL, user.FirstName)
+	return service, nil
+}
 
-	return errors.Trace(
-		email.GmailSend(service, "me", contact.Email, "Invoice", body),
-	)
+// validateTemplate returns a bad request error if name is set but isn't a
+// registered PDF template.
+func validateTemplate(name string) error {
+	if name == "" {
+		return nil
+	}
+	if _, ok := pdf.LookupTemplate(name); !ok {
+		return errors.Wrap(errors.NotFoundf("pdf template %q", name), route.BadRequest)
+	}
+	return nil
 }
 
-func invoiceFromRequest(req NewInvoiceRequest, userID string) (*db.Invoice, error) {
-	dueDate, err := time.Parse("2006-01-02T00:00:00.000", req.DueDate)
+// invoiceBuilder turns req into a new, unsaved invoice for the current user
+// and everything needed to render it.
+func invoiceBuilder(c *gin.Context, req NewInvoiceRequest) (pdf.Builder, error) {
+	ctx := c.Request.Context()
+	app := MustApp(c)
+	user := MustUser(c)
+
+	if err := validateTemplate(req.Template); err != nil {
+		return pdf.Builder{}, errors.Trace(err)
+	}
+
+	contact, err := app.Contact(ctx, req.ContactID)
+	if err == db.ContactNotFound {
+		return pdf.Builder{}, errors.Wrap(err, route.BadRequest)
+	}
 	if err != nil {
-		return nil, errors.Trace(err)
+		return pdf.Builder{}, errors.Annotate(err, "cannot get contact ")
+	}
+	// Invoices belong to whoever owns the contact being billed.
+	if err := authorize(c, contact.OrganisationID, contact.UserID, db.PermissionWrite); err != nil {
+		return pdf.Builder{}, errors.Trace(err)
+	}
+	if contact.Archived {
+		return pdf.Builder{}, errors.Wrap(errors.NotValidf("invoicing archived contact"), route.BadRequest)
 	}
 
-	return &db.Invoice{
-		UserID:      userID,
-		ContactID:   req.ContactID,
-		Description: req.Description,
-		Rate:        req.Rate,
-		Hours:       req.Hours,
-		IssueDate:   time.Now(),
-		DueDate:     dueDate,
+	newInvoice, err := invoiceFromRequest(req, user.ID, contact.Billing)
+	if err != nil {
+		return pdf.Builder{}, errors.Wrap(err, route.BadRequest)
+	}
+	newInvoice.OrganisationID = contact.OrganisationID
+	newInvoice.BillTo = contact.Snapshot()
+
+	profile, logo, err := businessProfile(c, user)
+	if err != nil {
+		return pdf.Builder{}, errors.Annotate(err, "cannot get business profile")
+	}
+
+	return pdf.Builder{
+		App:     app,
+		Invoice: newInvoice,
+		User:    user,
+		Profile: profile,
+		Logo:    logo,
+		Contact: contact,
 	}, nil
 }
+
+// existingInvoiceBuilder returns everything needed to render a saved
+// invoice, as issued by the invoice's owner.
+func existingInvoiceBuilder(c *gin.Context, invoice *db.Invoice) (pdf.Builder, error) {
+	ctx := c.Request.Context()
+	app := MustApp(c)
+
+	user, err := invoice.User(ctx, app)
+	if err != nil {
+		return pdf.Builder{}, errors.Annotate(err, "cannot get invoice owner")
+	}
+	contact, err := invoice.Contact(ctx, app)
+	if err != nil {
+		return pdf.Builder{}, errors.Annotate(err, "cannot get contact")
+	}
+	profile, logo, err := businessProfile(c, user)
+	if err != nil {
+		return pdf.Builder{}, errors.Annotate(err, "cannot get business profile")
+	}
+
+	return pdf.Builder{
+		App:     app,
+		Invoice: invoice,
+		User:    user,
+		Profile: profile,
+		Logo:    logo,
+		Contact: contact,
+	}, nil
+}
+
+// invoiceFromRequest makes the invoice req asks for, taking whatever it
+// leaves out from the contact's billing defaults, which may be nil.
+func invoiceFromRequest(req NewInvoiceRequest, userID string, defaults *db.BillingDefaults) (*db.Invoice, error) {
+	if defaults == nil {
+		defaults = &db.BillingDefaults{}
+	}
+	invoice := &db.Invoice{
+		UserID:       userID,
+		ContactID:    req.ContactID,
+		Description:  req.Description,
+		Rate:         req.Rate,
+		Hours:        req.Hours,
+		IssueDate:    time.Now(),
+		Template:     req.Template,
+		Status:       db.InvoiceStatusIssued,
+		Currency:     req.Currency,
+		TaxTreatment: req.TaxTreatment,
+	}
+	if invoice.Rate == 0 {
+		invoice.Rate = defaults.Rate
+	}
+	if invoice.Rate <= 0 {
+		return nil, errors.NotValidf("invoice without a rate")
+	}
+	if invoice.Currency == "" {
+		invoice.Currency = defaults.Currency
+	}
+	currency, err := db.NormaliseCurrency(invoice.Currency)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	invoice.Currency = currency
+	if invoice.TaxTreatment == "" {
+		invoice.TaxTreatment = defaults.TaxTreatment
+	}
+	if !invoice.TaxTreatment.Valid() {
+		return nil, errors.NotValidf("tax treatment %q", invoice.TaxTreatment)
+	}
+
+	if req.DueDate != "" {
+		if invoice.DueDate, err = time.Parse("2006-01-02T00:00:00.000", req.DueDate); err != nil {
+			return nil, errors.NotValidf("due date %q", req.DueDate)
+		}
+		return invoice, nil
+	}
+	invoice.PaymentTerms = req.PaymentTerms
+	if invoice.PaymentTerms == "" {
+		invoice.PaymentTerms = defaults.PaymentTerms
+	}
+	if invoice.PaymentTerms == "" {
+		return nil, errors.NotValidf("invoice without a due date or payment terms")
+	}
+	if invoice.DueDate, err = invoice.PaymentTerms.DueDate(invoice.IssueDate); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return invoice, nil
+}
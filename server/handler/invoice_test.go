@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http/httptest"
+	"strings"
 
 	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/tests/setup"
 
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
@@ -26,17 +29,15 @@ func (s *invoicesSuite) SetUpTest(c *gc.C) {
 }
 
 func (s *invoicesSuite) TestInvoices(c *gc.C) {
-	invoice1 := s.AddInvoice(c, s.user.ID)
-	_ = s.AddInvoice(c, s.user.ID)
-
-	body := s.Get200(c, "/user/invoices")
-	c.Check(body, jc.JSONEquals, map[string]interface{}{
-		"invoices": []interface{}{
-			map[string]interface{}{
-				"id": invoice1.ID,
-			},
-		},
-	})
+	invoice1 := s.AddInvoice(c, s.APISuiteCore.user.ID)
+	invoice2 := s.AddInvoice(c, s.APISuiteCore.user.ID)
+
+	var page db.InvoicePage
+	c.Assert(json.Unmarshal([]byte(s.Get200(c, "/user/invoices")), &page), jc.ErrorIsNil)
+	c.Assert(page.Items, gc.HasLen, 2)
+	c.Check(page.Items[0].ID, gc.Equals, invoice1.ID)
+	c.Check(page.Items[1].ID, gc.Equals, invoice2.ID)
+	c.Check(page.NextCursor, gc.Equals, "")
 }
 
 func (s *invoicesSuite) TestInvoice(c *gc.C) {
@@ -74,6 +75,98 @@ func (s *invoicesSuite) TestInvoiceEmail400(c *gc.C) {
 	s.Post400(c, "/invoice/email", string(payload))
 }
 
+func (s *invoicesSuite) TestInvoiceTemplates(c *gc.C) {
+	body := s.Get200(c, "/invoice/templates")
+	c.Check(body, jc.JSONEquals, []interface{}{"classic", "compact", "modern"})
+}
+
+func (s *invoicesSuite) previewPayload(c *gc.C) string {
+	ctx := context.Background()
+	contact := s.AddContact(ctx, c, s.APISuiteCore.user.ID)
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"contact_id":  contact.ID,
+		"description": "Website maintenance",
+		"hours":       7.5,
+		"rate":        120,
+		"due_date":    "2022-03-15T00:00:00.000",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	return string(payload)
+}
+
+func (s *invoicesSuite) TestPreviewInvoice(c *gc.C) {
+	req := httptest.NewRequest("POST", "/invoice/preview", strings.NewReader(s.previewPayload(c)))
+	res := s.Serve(req)
+	c.Assert(res.StatusCode, gc.Equals, 200)
+	c.Check(res.Header.Get("Content-Type"), gc.Equals, "application/pdf")
+	c.Check(readAll(c, res.Body), jc.HasPrefix, "%PDF-")
+
+	// Nothing is saved.
+	invoices, err := s.APISuiteCore.user.Invoices(context.Background(), s.App)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(invoices, gc.HasLen, 0)
+}
+
+func (s *invoicesSuite) TestPreviewInvoiceBadFormat(c *gc.C) {
+	s.Post400(c, "/invoice/preview?format=gif", s.previewPayload(c))
+}
+
+func (s *invoicesSuite) TestPreviewInvoiceBillingDefaults(c *gc.C) {
+	ctx := context.Background()
+	contact := setup.CreateContact(s.APISuiteCore.user.ID)
+	contact.Billing = &db.BillingDefaults{PaymentTerms: "net_14", Rate: 120, Currency: "AUD"}
+	id, err := s.App.AddContact(ctx, &contact)
+	c.Assert(err, jc.ErrorIsNil)
+	bare := s.AddContact(ctx, c, s.APISuiteCore.user.ID)
+
+	// Rate and due date come from the contact.
+	req := httptest.NewRequest("POST", "/invoice/preview", strings.NewReader(fmt.Sprintf(
+		`{"contact_id": %q, "description": "Retainer", "hours": 10}`, id)))
+	res := s.Serve(req)
+	res.Body.Close()
+	c.Check(res.StatusCode, gc.Equals, 200)
+
+	// Without defaults they are needed, and overrides are checked.
+	s.Post400(c, "/invoice/preview", fmt.Sprintf(
+		`{"contact_id": %q, "description": "Retainer", "hours": 10}`, bare.ID))
+	s.Post400(c, "/invoice/preview", fmt.Sprintf(
+		`{"contact_id": %q, "description": "Retainer", "hours": 10, "rate": 100, "payment_terms": "soon"}`, bare.ID))
+	s.Post400(c, "/invoice/preview", fmt.Sprintf(
+		`{"contact_id": %q, "description": "Retainer", "hours": 10, "tax_treatment": "reverse_charge"}`, id))
+}
+
+func (s *invoicesSuite) TestUpdateInvoiceStatus(c *gc.C) {
+	ctx := context.Background()
+	user := s.APISuiteCore.user
+	contact := s.AddContact(ctx, c, user.ID)
+
+	invoice := setup.CreateInvoice(user.ID)
+	invoice.ContactID = contact.ID
+	id, err := s.App.AddInvoice(ctx, invoice)
+	c.Assert(err, jc.ErrorIsNil)
+	issuedPDFID := invoice.PDFID
+
+	body := s.Put200(c, "/invoice/status/"+id, `{"status": "paid", "paid_date": "2022-03-10"}`)
+	var got db.Invoice
+	c.Assert(json.Unmarshal([]byte(body), &got), jc.ErrorIsNil)
+	c.Check(got.Status, gc.Equals, db.InvoiceStatusPaid)
+	c.Check(got.Paid, jc.IsTrue)
+	c.Check(got.OriginalPDFID, gc.Equals, issuedPDFID)
+	c.Check(got.PDFID, gc.Not(gc.Equals), issuedPDFID)
+
+	pdf, err := s.App.PDF(ctx, got.PDFID)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(pdf), jc.HasPrefix, "%PDF-")
+}
+
+func (s *invoicesSuite) TestUpdateInvoiceStatusInvalid(c *gc.C) {
+	invoice := s.AddInvoice(c, s.APISuiteCore.user.ID)
+
+	s.Put400(c, "/invoice/status/"+invoice.ID, `{"status": "lost"}`)
+	s.Put400(c, "/invoice/status/"+invoice.ID, `{"status": "draft"}`)
+}
+
 // func (s *invoicesSuite) TestInvoiceNew(c *gc.C) {
 // 	s.Post200(c, "/invoice/new")
 // }
@@ -89,3 +182,40 @@ func (s *invoicesSuite) TestInvoiceEmail400(c *gc.C) {
 // func (s *invoicesSuite) TestUserInvoice(c *gc.C) {
 // 	s.Get200(c, "/user/invoices")
 // }
+
+func (s *invoicesSuite) TestListInvoices(c *gc.C) {
+	ctx := context.Background()
+	var ids []string
+	for _, hours := range []float32{1, 3, 2} {
+		invoice := setup.CreateInvoice(s.APISuiteCore.user.ID)
+		invoice.Hours, invoice.Rate = hours, 100
+		id, err := s.App.AddInvoice(ctx, invoice)
+		c.Assert(err, jc.ErrorIsNil)
+		ids = append(ids, id)
+	}
+
+	var page db.InvoicePage
+	c.Assert(json.Unmarshal([]byte(s.Get200(c, "/user/invoices?sort=-total&limit=2")), &page), jc.ErrorIsNil)
+	c.Assert(page.Items, gc.HasLen, 2)
+	c.Check(page.Items[0].ID, gc.Equals, ids[1])
+	c.Check(page.Items[1].ID, gc.Equals, ids[2])
+	c.Assert(page.NextCursor, gc.Not(gc.Equals), "")
+	cursor := page.NextCursor
+
+	next := fmt.Sprintf("/user/invoices?sort=-total&limit=2&cursor=%s", cursor)
+	c.Assert(json.Unmarshal([]byte(s.Get200(c, next)), &page), jc.ErrorIsNil)
+	c.Assert(page.Items, gc.HasLen, 1)
+	c.Check(page.Items[0].ID, gc.Equals, ids[0])
+	c.Check(page.NextCursor, gc.Equals, "")
+
+	// Totals include GST.
+	c.Assert(json.Unmarshal([]byte(s.Get200(c, "/user/invoices?min_total=200&max_total=300")), &page), jc.ErrorIsNil)
+	c.Assert(page.Items, gc.HasLen, 1)
+	c.Check(page.Items[0].ID, gc.Equals, ids[2])
+
+	s.Get400(c, "/user/invoices?sort=number")
+	s.Get400(c, "/user/invoices?sort=total&cursor=nonsense")
+	s.Get400(c, "/user/invoices?min_total=300&max_total=200")
+	// A cursor is only good for the order it came from.
+	s.Get400(c, fmt.Sprintf("/user/invoices?sort=total&cursor=%s", cursor))
+}
@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/export"
+	"github.com/wham-invoice/wham-platform/server/route"
+)
+
+// PageRequest is the query common to every paginated list. Lists respond
+// with a page of items and the cursor to ask for the next page with, which
+// is empty on the last.
+type PageRequest struct {
+	// Sort is what to order by, starting with "-" for descending order.
+	Sort   string `form:"sort"`
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit"`
+}
+
+// order splits Sort into what to order by and which way.
+func (r PageRequest) order() (string, bool) {
+	if strings.HasPrefix(r.Sort, "-") {
+		return r.Sort[1:], true
+	}
+	return r.Sort, false
+}
+
+// InvoiceFilterRequest is the query that chooses invoices, for lists and
+// exports.
+type InvoiceFilterRequest struct {
+	// From and To bound the issue date, inclusive, as 2006-01-02.
+	From string `form:"from"`
+	To   string `form:"to"`
+	// Status may be repeated or comma separated.
+	Status    []string `form:"status"`
+	ContactID string   `form:"contact_id"`
+	// MinTotal and MaxTotal bound the total, inclusive.
+	MinTotal *float32 `form:"min_total"`
+	MaxTotal *float32 `form:"max_total"`
+}
+
+// apply checks the request and adds it to filter.
+func (r InvoiceFilterRequest) apply(filter *db.InvoiceFilter) error {
+	var err error
+	filter.ContactID = r.ContactID
+
+	if r.From != "" {
+		if filter.IssuedFrom, err = time.Parse(export.DateFormat, r.From); err != nil {
+			return errors.Wrap(err, route.BadRequest)
+		}
+	}
+	if r.To != "" {
+		to, err := time.Parse(export.DateFormat, r.To)
+		if err != nil {
+			return errors.Wrap(err, route.BadRequest)
+		}
+		filter.IssuedBefore = to.AddDate(0, 0, 1)
+	}
+	if !filter.IssuedFrom.IsZero() && !filter.IssuedBefore.IsZero() && !filter.IssuedFrom.Before(filter.IssuedBefore) {
+		return errors.Wrap(errors.NotValidf("date range"), route.BadRequest)
+	}
+
+	if r.MinTotal != nil && r.MaxTotal != nil && *r.MinTotal > *r.MaxTotal {
+		return errors.Wrap(errors.NotValidf("amount range"), route.BadRequest)
+	}
+	filter.MinTotal, filter.MaxTotal = r.MinTotal, r.MaxTotal
+
+	for _, s := range splitList(r.Status) {
+		status := db.InvoiceStatus(s)
+		if !status.Valid() {
+			return errors.Wrap(errors.NotValidf("invoice status %q", s), route.BadRequest)
+		}
+		filter.Statuses = append(filter.Statuses, status)
+	}
+
+	return nil
+}
+
+// InvoiceListRequest is the query for a list of invoices. They can be sorted
+// by issue_date (the default), due_date, total or contact_name.
+type InvoiceListRequest struct {
+	PageRequest
+	InvoiceFilterRequest
+}
+
+// listInvoices responds with a page of the owner's invoices, as the request
+// asks.
+func listInvoices(c *gin.Context, owner db.InvoiceFilter) (interface{}, error) {
+	var req InvoiceListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		return nil, errors.Wrap(err, route.BadRequest)
+	}
+	list := db.InvoiceList{InvoiceFilter: owner, Cursor: req.Cursor, Limit: req.Limit}
+	if err := req.InvoiceFilterRequest.apply(&list.InvoiceFilter); err != nil {
+		return nil, errors.Trace(err)
+	}
+	sort, descending := req.order()
+	list.Sort, list.Descending = db.InvoiceSort(sort), descending
+
+	page, err := MustApp(c).ListInvoices(c.Request.Context(), list)
+	if errors.IsNotValid(err) {
+		return nil, errors.Wrap(err, route.BadRequest)
+	}
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot get invoices")
+	}
+
+	return page, nil
+}
+
+// ContactListRequest is the query for a list of contacts. They can be sorted
+// by name (the default), company or email. Archived contacts are left out
+// unless IncludeArchived is set, and each tag leaves out contacts without
+// it.
+type ContactListRequest struct {
+	PageRequest
+	IncludeArchived bool     `form:"include_archived"`
+	Tags            []string `form:"tag"`
+}
+
+// listContacts responds with a page of the owner's contacts, as the request
+// asks.
+func listContacts(c *gin.Context, owner db.ContactFilter) (interface{}, error) {
+	var req ContactListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		return nil, errors.Wrap(err, route.BadRequest)
+	}
+	tags, err := db.NormaliseTags(req.Tags)
+	if err != nil {
+		return nil, errors.Wrap(err, route.BadRequest)
+	}
+	owner.IncludeArchived = req.IncludeArchived
+	sort, descending := req.order()
+
+	page, err := MustApp(c).ListContacts(c.Request.Context(), db.ContactList{
+		ContactFilter: owner,
+		Tags:          tags,
+		Sort:          db.ContactSort(sort),
+		Descending:    descending,
+		Cursor:        req.Cursor,
+		Limit:         req.Limit,
+	})
+	if errors.IsNotValid(err) {
+		return nil, errors.Wrap(err, route.BadRequest)
+	}
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot get contacts")
+	}
+
+	return page, nil
+}
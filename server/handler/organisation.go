@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/email"
+	"github.com/wham-invoice/wham-platform/server/route"
+)
+
+type NewOrganisationRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type InviteMemberRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required,oneof=admin bookkeeper read_only"`
+}
+
+type UpdateMemberRequest struct {
+	Role string `json:"role" binding:"required,oneof=admin bookkeeper read_only"`
+}
+
+// NewOrganisation creates an organisation owned by the user.
+var NewOrganisation = route.Endpoint{
+	Method: "POST",
+	Path:   "/organisation/new",
+	Do: func(c *gin.Context) (interface{}, error) {
+		ctx := c.Request.Context()
+		app := MustApp(c)
+		user := MustUser(c)
+
+		var req NewOrganisationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return nil, errors.Annotate(err, "cannot bind request")
+		}
+
+		org, err := app.NewOrganisation(ctx, req.Name, user)
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot create organisation")
+		}
+
+		return org, nil
+	},
+}
+
+// UserOrganisations returns every organisation the user is a member of.
+var UserOrganisations = route.Endpoint{
+	Method: "GET",
+	Path:   "/user/organisations",
+	Do: func(c *gin.Context) (interface{}, error) {
+		user := MustUser(c)
+
+		orgs, err := user.Organisations(c.Request.Context(), MustApp(c))
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return orgs, nil
+	},
+}
+
+// Organisation returns an organisation by ID.
+var Organisation = route.Endpoint{
+	Method:  "GET",
+	Path:    "/organisation/get/:organisation_id",
+	Prereqs: route.Prereqs(EnsureOrganisation(), PermitOrganisation(db.PermissionRead)),
+	Do: func(c *gin.Context) (interface{}, error) {
+		return MustOrganisation(c), nil
+	},
+}
+
+// OrganisationMembers returns the members of an organisation and their roles.
+var OrganisationMembers = route.Endpoint{
+	Method:  "GET",
+	Path:    "/organisation/members/:organisation_id",
+	Prereqs: route.Prereqs(EnsureOrganisation(), PermitOrganisation(db.PermissionRead)),
+	Do: func(c *gin.Context) (interface{}, error) {
+		org := MustOrganisation(c)
+
+		members, err := org.Members(c.Request.Context(), MustApp(c))
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return members, nil
+	},
+}
+
+// OrganisationInvoices returns a page of an organisation's invoices, as an
+// InvoiceListRequest asks.
+var OrganisationInvoices = route.Endpoint{
+	Method:  "GET",
+	Path:    "/organisation/invoices/:organisation_id",
+	Prereqs: route.Prereqs(EnsureOrganisation(), PermitOrganisation(db.PermissionRead)),
+	Do: func(c *gin.Context) (interface{}, error) {
+		return listInvoices(c, db.InvoiceFilter{OrganisationID: MustOrganisation(c).ID})
+	},
+}
+
+// OrganisationContacts returns a page of an organisation's contacts, as a
+// ContactListRequest asks.
+var OrganisationContacts = route.Endpoint{
+	Method:  "GET",
+	Path:    "/organisation/contacts/:organisation_id",
+	Prereqs: route.Prereqs(EnsureOrganisation(), PermitOrganisation(db.PermissionRead)),
+	Do: func(c *gin.Context) (interface{}, error) {
+		return listContacts(c, db.ContactFilter{OrganisationID: MustOrganisation(c).ID})
+	},
+}
+
+// InviteMember emails an invitation to join the organisation.
+var InviteMember = route.Endpoint{
+	Method:  "POST",
+	Path:    "/organisation/invite/:organisation_id",
+	Prereqs: route.Prereqs(EnsureOrganisation(), PermitOrganisation(db.PermissionManageMembers)),
+	Do: func(c *gin.Context) (interface{}, error) {
+		ctx := c.Request.Context()
+		app := MustApp(c)
+		user := MustUser(c)
+		org := MustOrganisation(c)
+
+		var req InviteMemberRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return nil, errors.Annotate(err, "cannot bind request")
+		}
+
+		invitation, err := org.Invite(ctx, app, req.Email, db.Role(req.Role), user.ID)
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot create invitation")
+		}
+
+		link := FrontendLink(c, "invitation", invitation.ID)
+		if err := emailInvitation(ctx, link, invitation, org, user); err != nil {
+			return nil, errors.Annotate(err, "cannot email invitation")
+		}
+
+		return invitation, nil
+	},
+}
+
+// AcceptInvitation makes the user a member of the organisation they were
+// invited to.
+var AcceptInvitation = route.Endpoint{
+	Method: "POST",
+	Path:   "/invitation/accept/:invitation_id",
+	Do: func(c *gin.Context) (interface{}, error) {
+		ctx := c.Request.Context()
+		app := MustApp(c)
+		user := MustUser(c)
+
+		var req struct {
+			ID string `uri:"invitation_id" binding:"required"`
+		}
+		if c.ShouldBindUri(&req); req.ID == "" {
+			return nil, route.NotFound
+		}
+
+		invitation, err := app.Invitation(ctx, req.ID)
+		if err == db.InvitationNotFound {
+			return nil, route.NotFound
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		member, err := invitation.Accept(ctx, app, user)
+		switch {
+		case errors.Cause(err) == db.InvitationNotFound:
+			return nil, route.NotFound
+		case errors.IsUnauthorized(err):
+			return nil, route.Forbidden
+		case errors.IsAlreadyExists(err):
+			return nil, route.BadRequest
+		case err != nil:
+			return nil, errors.Trace(err)
+		}
+
+		return member, nil
+	},
+}
+
+// UpdateMember changes a member's role.
+var UpdateMember = route.Endpoint{
+	Method: "PUT",
+	Path:   "/organisation/member/:organisation_id/:user_id",
+	Prereqs: route.Prereqs(
+		EnsureOrganisation(),
+		PermitOrganisation(db.PermissionManageMembers),
+		EnsureMember(),
+	),
+	Do: func(c *gin.Context) (interface{}, error) {
+		member := MustMember(c)
+
+		var req UpdateMemberRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return nil, errors.Annotate(err, "cannot bind request")
+		}
+
+		if member.Role == db.RoleOwner {
+			return nil, route.Forbidden
+		}
+		if err := member.SetRole(c.Request.Context(), MustApp(c), db.Role(req.Role)); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return member, nil
+	},
+}
+
+// RemoveMember takes a member out of the organisation.
+var RemoveMember = route.Endpoint{
+	Method: "DELETE",
+	Path:   "/organisation/member/:organisation_id/:user_id",
+	Prereqs: route.Prereqs(
+		EnsureOrganisation(),
+		PermitOrganisation(db.PermissionManageMembers),
+		EnsureMember(),
+	),
+	Do: func(c *gin.Context) (interface{}, error) {
+		member := MustMember(c)
+
+		if member.Role == db.RoleOwner {
+			return nil, route.Forbidden
+		}
+		if err := member.Remove(c.Request.Context(), MustApp(c)); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return nil, nil
+	},
+}
+
+// emailInvitation emails the invitee a link to accept the invitation.
+func emailInvitation(
+	ctx context.Context,
+	invitationURL string,
+	invitation *db.Invitation,
+	org *db.Organisation,
+	user *db.User,
+) error {
+	service, err := gmailService(ctx, user)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	body := fmt.Sprintf("Hi,\n\n"+
+		"%s has invited you to join %s on Wham.\n\n"+
+		"To accept please visit: %s "+
+		"Thanks.\n"+
+		"%s", user.FullName(), org.Name, invitationURL, user.FirstName)
+
+	return errors.Trace(
+		email.GmailSend(service, "me", invitation.Email, "Invitation", body),
+	)
+}
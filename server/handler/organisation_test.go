@@ -0,0 +1,75 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/tests/setup"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type organisationsSuite struct {
+	APISuiteCore
+}
+
+var _ = gc.Suite(&organisationsSuite{})
+
+func (s *organisationsSuite) TestNewOrganisationThenMembers(c *gc.C) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"name": "Acme",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	var org db.Organisation
+	body := s.Post200(c, "/organisation/new", string(payload))
+	c.Assert(json.Unmarshal([]byte(body), &org), jc.ErrorIsNil)
+	c.Check(org.OwnerID, gc.Equals, s.user.ID)
+
+	members := []db.Member{}
+	body = s.Get200(c, fmt.Sprintf("/organisation/members/%s", org.ID))
+	c.Assert(json.Unmarshal([]byte(body), &members), jc.ErrorIsNil)
+	c.Assert(members, gc.HasLen, 1)
+	c.Check(members[0].Role, gc.Equals, db.RoleOwner)
+}
+
+func (s *organisationsSuite) TestNonMemberCannotSeeOrganisation(c *gc.C) {
+	ctx := context.Background()
+	other := s.AddUser(ctx, c)
+	org, err := s.App.NewOrganisation(ctx, "Acme", other)
+	c.Assert(err, jc.ErrorIsNil)
+
+	s.Get404(c, fmt.Sprintf("/organisation/get/%s", org.ID))
+	s.Get404(c, fmt.Sprintf("/organisation/contacts/%s", org.ID))
+}
+
+func (s *organisationsSuite) TestReadOnlyMemberCannotDeleteContact(c *gc.C) {
+	ctx := context.Background()
+	owner := s.AddUser(ctx, c)
+	org, err := s.App.NewOrganisation(ctx, "Acme", owner)
+	c.Assert(err, jc.ErrorIsNil)
+
+	invitation, err := org.Invite(ctx, s.App, s.user.Email, db.RoleReadOnly, owner.ID)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = invitation.Accept(ctx, s.App, s.user)
+	c.Assert(err, jc.ErrorIsNil)
+
+	contact := setup.CreateContact(owner.ID)
+	contact.OrganisationID = org.ID
+	contactID, err := s.App.AddContact(ctx, &contact)
+	c.Assert(err, jc.ErrorIsNil)
+
+	s.Get200(c, fmt.Sprintf("/organisation/contacts/%s", org.ID))
+	s.Delete403(c, fmt.Sprintf("/contact/delete/%s", contactID))
+}
+
+func (s *organisationsSuite) TestOtherUsersContactIsNotFound(c *gc.C) {
+	ctx := context.Background()
+	other := s.AddUser(ctx, c)
+	contact := s.AddContact(ctx, c, other.ID)
+
+	s.Get404(c, fmt.Sprintf("/contact/get/%s", contact.ID))
+}
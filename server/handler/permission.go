@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/server/route"
+)
+
+// userRole returns the user's role over a resource belonging to orgID, or to
+// ownerID personally when orgID is blank. Users who cannot see the resource at
+// all get route.NotFound so we don't leak its existence.
+func userRole(
+	ctx context.Context,
+	app *db.App,
+	user *db.User,
+	orgID, ownerID string,
+) (db.Role, error) {
+	if orgID == "" {
+		if ownerID != "" && ownerID == user.ID {
+			return db.RoleOwner, nil
+		}
+		return "", route.NotFound
+	}
+
+	member, err := app.Member(ctx, orgID, user.ID)
+	if err == db.MemberNotFound {
+		return "", route.NotFound
+	}
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	return member.Role, nil
+}
+
+// authorize returns nil if the user in the context holds perm over a resource
+// belonging to orgID, or to ownerID personally when orgID is blank.
+func authorize(c *gin.Context, orgID, ownerID string, perm db.Permission) error {
+	role, err := userRole(c.Request.Context(), MustApp(c), MustUser(c), orgID, ownerID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if !role.Can(perm) {
+		return route.Forbidden
+	}
+
+	return nil
+}
+
+// permit returns middleware that aborts unless the user holds perm over the
+// resource that owner extracts from the context.
+func permit(perm db.Permission, owner func(*gin.Context) (orgID, ownerID string)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, ownerID := owner(c)
+		if err := authorize(c, orgID, ownerID, perm); err != nil {
+			route.Abort(c, err)
+		}
+	}
+}
+
+// PermitInvoice returns middleware that checks the user's role over the
+// invoice set by EnsureInvoice.
+func PermitInvoice(perm db.Permission) gin.HandlerFunc {
+	return permit(perm, func(c *gin.Context) (string, string) {
+		invoice := MustInvoice(c)
+		return invoice.OrganisationID, invoice.UserID
+	})
+}
+
+// PermitContact returns middleware that checks the user's role over the
+// contact set by EnsureContact.
+func PermitContact(perm db.Permission) gin.HandlerFunc {
+	return permit(perm, func(c *gin.Context) (string, string) {
+		contact := MustContact(c)
+		return contact.OrganisationID, contact.UserID
+	})
+}
+
+// PermitOrganisation returns middleware that checks the user's role in the
+// organisation set by EnsureOrganisation.
+func PermitOrganisation(perm db.Permission) gin.HandlerFunc {
+	return permit(perm, func(c *gin.Context) (string, string) {
+		return MustOrganisation(c).ID, ""
+	})
+}
@@ -0,0 +1,346 @@
+package handler
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/pdf"
+	"github.com/wham-invoice/wham-platform/server/route"
+)
+
+type BusinessProfileRequest struct {
+	TradingName         string `json:"trading_name"`
+	LegalName           string `json:"legal_name" binding:"required"`
+	TaxNumber           string `json:"tax_number"`
+	Phone               string `json:"phone"`
+	Email               string `json:"email"`
+	BankAccount         string `json:"bank_account"`
+	PaymentInstructions string `json:"payment_instructions"`
+	AddressFirstLine    string `json:"address_first_line"`
+	AddressSecondLine   string `json:"address_second_line"`
+	Suburb              string `json:"suburb"`
+	Postcode            string `json:"postcode"`
+	Country             string `json:"country"`
+	DefaultTemplate     string `json:"default_template"`
+	PeppolID            string `json:"peppol_id"`
+}
+
+type PaymentSettingsRequest struct {
+	QRCode          db.QRCodeKind `json:"qr_code"`
+	IBAN            string        `json:"iban"`
+	BIC             string        `json:"bic"`
+	PaymentLink     string        `json:"payment_link"`
+	ReferencePrefix string        `json:"reference_prefix"`
+}
+
+type ThemeRequest struct {
+	AccentColor string `json:"accent_color"`
+	StripeColor string `json:"stripe_color"`
+	HeaderColor string `json:"header_color"`
+	Font        string `json:"font"`
+}
+
+// BusinessProfile returns the user's business profile.
+var BusinessProfile = route.Endpoint{
+	Method: "GET",
+	Path:   "/user/profile",
+	Do: func(c *gin.Context) (interface{}, error) {
+		user := MustUser(c)
+
+		profile, err := user.BusinessProfile(c.Request.Context(), MustApp(c))
+		if err == db.BusinessProfileNotFound {
+			return nil, route.NotFound
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return profile, nil
+	},
+}
+
+// UpdateBusinessProfile creates or replaces the user's business profile.
+var UpdateBusinessProfile = route.Endpoint{
+	Method: "PUT",
+	Path:   "/profile/update",
+	Do: func(c *gin.Context) (interface{}, error) {
+		ctx := c.Request.Context()
+		app := MustApp(c)
+		user := MustUser(c)
+
+		var req BusinessProfileRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return nil, errors.Annotate(err, "cannot bind request")
+		}
+		if err := validateTemplate(req.DefaultTemplate); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if err := validatePeppolID(req.PeppolID); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		existing, err := user.BusinessProfile(ctx, app)
+		if err != nil && err != db.BusinessProfileNotFound {
+			return nil, errors.Trace(err)
+		}
+
+		profile := profileFromRequest(req, user.ID)
+		// The logo, theme and payment settings are set separately, so keep
+		// whatever we already have.
+		profile.LogoID = existing.LogoID
+		profile.Theme = existing.Theme
+		profile.Payment = existing.Payment
+
+		if err := app.SetBusinessProfile(ctx, profile); err != nil {
+			return nil, errors.Annotate(err, "cannot save business profile")
+		}
+
+		return profile, nil
+	},
+}
+
+// DeleteBusinessProfile deletes the user's business profile.
+var DeleteBusinessProfile = route.Endpoint{
+	Method: "DELETE",
+	Path:   "/profile/delete",
+	Do: func(c *gin.Context) (interface{}, error) {
+		ctx := c.Request.Context()
+		app := MustApp(c)
+		user := MustUser(c)
+
+		profile, err := user.BusinessProfile(ctx, app)
+		if err == db.BusinessProfileNotFound {
+			return nil, route.NotFound
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		if err := profile.Delete(ctx, app); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return nil, nil
+	},
+}
+
+// UploadLogo stores a PNG or JPEG logo, sent as the multipart field "logo",
+// for use in the user's PDFs.
+var UploadLogo = route.Endpoint{
+	Method: "POST",
+	Path:   "/profile/logo",
+	Do: func(c *gin.Context) (interface{}, error) {
+		ctx := c.Request.Context()
+		app := MustApp(c)
+		user := MustUser(c)
+
+		profile, err := user.BusinessProfile(ctx, app)
+		if err == db.BusinessProfileNotFound {
+			return nil, route.NotFound
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		header, err := c.FormFile("logo")
+		if err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		f, err := header.Open()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		defer f.Close()
+
+		// Read one byte more than we allow so oversized files fail validation.
+		data, err := ioutil.ReadAll(io.LimitReader(f, pdf.MaxLogoBytes+1))
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		contentType, err := pdf.ValidateLogo(data)
+		if errors.IsNotValid(err) {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		logoID, err := app.StoreLogo(ctx, user.ID, data, contentType)
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot store logo")
+		}
+		if err := profile.SetLogo(ctx, app, logoID); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return profile, nil
+	},
+}
+
+// ProfileLogo returns the user's logo image.
+var ProfileLogo = route.Endpoint{
+	Method: "GET",
+	Path:   "/profile/logo",
+	Do: func(c *gin.Context) (interface{}, error) {
+		ctx := c.Request.Context()
+		app := MustApp(c)
+		user := MustUser(c)
+
+		profile, err := user.BusinessProfile(ctx, app)
+		if err == db.BusinessProfileNotFound {
+			return nil, route.NotFound
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if profile.LogoID == "" {
+			return nil, route.NotFound
+		}
+
+		body, err := app.Logo(ctx, profile.LogoID)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		c.Data(http.StatusOK, http.DetectContentType(body), body)
+
+		return nil, nil
+	},
+}
+
+// UpdateTheme sets the colours and font used in the user's PDFs.
+var UpdateTheme = route.Endpoint{
+	Method: "PUT",
+	Path:   "/profile/theme",
+	Do: func(c *gin.Context) (interface{}, error) {
+		ctx := c.Request.Context()
+		app := MustApp(c)
+		user := MustUser(c)
+
+		var req ThemeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return nil, errors.Annotate(err, "cannot bind request")
+		}
+
+		theme := &db.Theme{
+			AccentColor: req.AccentColor,
+			StripeColor: req.StripeColor,
+			HeaderColor: req.HeaderColor,
+			Font:        req.Font,
+		}
+		if _, err := pdf.NewTheme(theme); err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+
+		profile, err := user.BusinessProfile(ctx, app)
+		if err == db.BusinessProfileNotFound {
+			return nil, route.NotFound
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		if err := profile.SetTheme(ctx, app, theme); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return profile, nil
+	},
+}
+
+// UpdatePaymentSettings sets how clients are asked to pay, including the
+// payment QR code printed on invoices.
+var UpdatePaymentSettings = route.Endpoint{
+	Method: "PUT",
+	Path:   "/profile/payment",
+	Do: func(c *gin.Context) (interface{}, error) {
+		ctx := c.Request.Context()
+		app := MustApp(c)
+		user := MustUser(c)
+
+		var req PaymentSettingsRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return nil, errors.Annotate(err, "cannot bind request")
+		}
+
+		settings := &db.PaymentSettings{
+			QRCode:          req.QRCode,
+			IBAN:            req.IBAN,
+			BIC:             req.BIC,
+			PaymentLink:     req.PaymentLink,
+			ReferencePrefix: req.ReferencePrefix,
+		}
+		if err := pdf.ValidatePaymentSettings(settings); err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+
+		profile, err := user.BusinessProfile(ctx, app)
+		if err == db.BusinessProfileNotFound {
+			return nil, route.NotFound
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		if err := profile.SetPaymentSettings(ctx, app, settings); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return profile, nil
+	},
+}
+
+func profileFromRequest(
+	req BusinessProfileRequest,
+	userID string,
+) *db.BusinessProfile {
+	return &db.BusinessProfile{
+		UserID:              userID,
+		TradingName:         req.TradingName,
+		LegalName:           req.LegalName,
+		TaxNumber:           req.TaxNumber,
+		Phone:               req.Phone,
+		Email:               req.Email,
+		BankAccount:         req.BankAccount,
+		PaymentInstructions: req.PaymentInstructions,
+		DefaultTemplate:     req.DefaultTemplate,
+		PeppolID:            req.PeppolID,
+		Address: &db.Address{
+			FirstLine:  req.AddressFirstLine,
+			SecondLine: req.AddressSecondLine,
+			Suburb:     req.Suburb,
+			Postcode:   req.Postcode,
+			Country:    req.Country,
+		},
+	}
+}
+
+// businessProfile returns the user's profile and logo. The profile is nil if
+// they haven't set one up, and the logo is nil if they haven't uploaded one.
+func businessProfile(c *gin.Context, user *db.User) (*db.BusinessProfile, []byte, error) {
+	ctx := c.Request.Context()
+	app := MustApp(c)
+
+	profile, err := user.BusinessProfile(ctx, app)
+	if err == db.BusinessProfileNotFound {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	if profile.LogoID == "" {
+		return profile, nil, nil
+	}
+
+	logo, err := app.Logo(ctx, profile.LogoID)
+	if err != nil {
+		return nil, nil, errors.Annotate(err, "cannot get logo")
+	}
+
+	return profile, logo, nil
+}
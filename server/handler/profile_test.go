@@ -0,0 +1,119 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http/httptest"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type profilesSuite struct {
+	APISuiteCore
+}
+
+var _ = gc.Suite(&profilesSuite{})
+
+func (s *profilesSuite) TestNoProfile(c *gc.C) {
+	s.Get404(c, "/user/profile")
+}
+
+func (s *profilesSuite) TestUpdateThenGet(c *gc.C) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"trading_name":       "Acme",
+		"legal_name":         "Acme Limited",
+		"tax_number":         "123-456-789",
+		"bank_account":       "12-3456-7890123-00",
+		"address_first_line": "1 Queen St",
+	})
+	c.Assert(err, jc.ErrorIsNil)
+
+	s.Put200(c, "/profile/update", string(payload))
+
+	body := s.Get200(c, "/user/profile")
+	c.Check(body, jc.JSONEquals, map[string]interface{}{
+		"user_id":              s.user.ID,
+		"trading_name":         "Acme",
+		"legal_name":           "Acme Limited",
+		"tax_number":           "123-456-789",
+		"phone":                "",
+		"email":                "",
+		"bank_account":         "12-3456-7890123-00",
+		"payment_instructions": "",
+		"logo_id":              "",
+		"theme":                nil,
+		"default_template":     "",
+		"address": map[string]interface{}{
+			"address_first_line":  "1 Queen St",
+			"address_second_line": "",
+			"address_suburb":      "",
+			"address_postcode":    "",
+			"address_country":     "",
+		},
+	})
+}
+
+func (s *profilesSuite) TestDeleteProfile(c *gc.C) {
+	s.SetBusinessProfile(context.Background(), c, s.user.ID)
+
+	s.Delete204(c, "/profile/delete")
+	s.Get404(c, "/user/profile")
+}
+
+func (s *profilesSuite) TestUpdateTheme(c *gc.C) {
+	s.SetBusinessProfile(context.Background(), c, s.user.ID)
+
+	body := s.Put200(c, "/profile/theme", `{"accent_color": "#336699", "font": "helvetica"}`)
+	c.Check(body, jc.Contains, `"accent_color":"#336699"`)
+}
+
+func (s *profilesSuite) TestUpdateThemeInvalid(c *gc.C) {
+	s.SetBusinessProfile(context.Background(), c, s.user.ID)
+
+	s.Put400(c, "/profile/theme", `{"accent_color": "blue"}`)
+}
+
+func (s *profilesSuite) TestUpdatePaymentSettings(c *gc.C) {
+	s.SetBusinessProfile(context.Background(), c, s.user.ID)
+
+	body := s.Put200(c, "/profile/payment", `{"qr_code": "epc", "iban": "DE89370400440532013000"}`)
+	c.Check(body, jc.Contains, `"iban":"DE89370400440532013000"`)
+}
+
+func (s *profilesSuite) TestUpdatePaymentSettingsInvalid(c *gc.C) {
+	s.SetBusinessProfile(context.Background(), c, s.user.ID)
+
+	s.Put400(c, "/profile/payment", `{"qr_code": "epc", "iban": "DE00000000000000000000"}`)
+}
+
+func (s *profilesSuite) TestUploadLogo(c *gc.C) {
+	s.SetBusinessProfile(context.Background(), c, s.user.ID)
+
+	var img bytes.Buffer
+	c.Assert(png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 64, 64))), jc.ErrorIsNil)
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("logo", "logo.png")
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = part.Write(img.Bytes())
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(w.Close(), jc.ErrorIsNil)
+
+	req := httptest.NewRequest("POST", "/profile/logo", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	res := s.Serve(req)
+	c.Check(res.StatusCode, gc.Equals, 200)
+	res.Body.Close()
+
+	c.Check(s.Get200(c, "/profile/logo"), gc.Equals, img.String())
+}
+
+func (s *profilesSuite) TestUnknownDefaultTemplate(c *gc.C) {
+	s.Put400(c, "/profile/update", `{"legal_name": "Acme", "default_template": "fancy"}`)
+}
@@ -0,0 +1,268 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/export"
+	"github.com/wham-invoice/wham-platform/pdf"
+	"github.com/wham-invoice/wham-platform/report"
+	"github.com/wham-invoice/wham-platform/server/route"
+)
+
+// ReportRequest is the query common to every report.
+type ReportRequest struct {
+	// Format is json (the default), csv, xlsx or pdf.
+	Format string `form:"format"`
+	// OrganisationID reports on the organisation's invoices rather than the
+	// user's.
+	OrganisationID string `form:"organisation_id"`
+}
+
+// AgingReportRequest is the query for an aging report.
+type AgingReportRequest struct {
+	ReportRequest
+	// AsOf is the day to report on, as 2006-01-02. It defaults to today.
+	AsOf string `form:"as_of"`
+}
+
+// asOf returns the day the request reports on.
+func (r AgingReportRequest) asOf() (time.Time, error) {
+	if r.AsOf == "" {
+		return time.Now(), nil
+	}
+	asOf, err := time.Parse(export.DateFormat, r.AsOf)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, route.BadRequest)
+	}
+	return asOf, nil
+}
+
+// format returns the format the request asks for, in lower case.
+func (r ReportRequest) format() (string, error) {
+	format := strings.ToLower(r.Format)
+	switch format {
+	case "", "json", "pdf", string(export.CSV), string(export.XLSX):
+		return format, nil
+	}
+	return "", errors.Wrap(errors.NotValidf("report format %q", r.Format), route.BadRequest)
+}
+
+// reportContacts returns the owner's contacts, archived ones included, by
+// ID.
+func reportContacts(c *gin.Context, owner db.InvoiceFilter) (map[string]*db.Contact, error) {
+	contacts := map[string]*db.Contact{}
+	err := MustApp(c).ForEachContact(c.Request.Context(), db.ContactFilter{
+		UserID:          owner.UserID,
+		OrganisationID:  owner.OrganisationID,
+		IncludeArchived: true,
+	}, func(contact *db.Contact) error {
+		contacts[contact.ID] = contact
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot get contacts")
+	}
+	return contacts, nil
+}
+
+// reportOwner returns the ID of the business a report is for. A report
+// covers one business, so the user's invoices for their organisations are
+// left out of their own.
+func reportOwner(filter db.InvoiceFilter) string {
+	if filter.OrganisationID != "" {
+		return filter.OrganisationID
+	}
+	return filter.UserID
+}
+
+// tabular is a report that can be laid out as a table.
+type tabular interface {
+	WriteTable(export.RowWriter) error
+	PDFTable() pdf.Table
+}
+
+// respondReport sends the report in format: as a PDF or spreadsheet named
+// after name and the period it covers, or otherwise as JSON.
+func respondReport(c *gin.Context, format, name, period, sheet string, result tabular) (interface{}, error) {
+	switch format {
+	case "pdf":
+		var buf bytes.Buffer
+		if err := pdf.RenderTable(&buf, result.PDFTable(), pdf.DefaultTheme()); err != nil {
+			return nil, errors.Trace(err)
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s-%s.pdf", name, period))
+		c.Header("Cache-Control", "no-store")
+		c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+		return nil, nil
+	case string(export.CSV), string(export.XLSX):
+		stream := exportStream{c: c, format: export.Format(format), name: name, sheet: sheet}
+		w, err := stream.start()
+		if err == nil {
+			err = result.WriteTable(w)
+		}
+		return nil, stream.finish(err)
+	}
+	return result, nil
+}
+
+// AgingReport buckets what each contact owes by how overdue it is: current,
+// 1-30, 31-60, 61-90 and over 90 days past the due date, as of a day that
+// may be in the past.
+var AgingReport = route.Endpoint{
+	Method: "GET",
+	Path:   "/report/aging",
+	Do: func(c *gin.Context) (interface{}, error) {
+		ctx := c.Request.Context()
+		app := MustApp(c)
+
+		var req AgingReportRequest
+		if err := c.ShouldBindQuery(&req); err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		asOf, err := req.asOf()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		format, err := req.format()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		filter, err := exportOwner(c, ExportRequest{OrganisationID: req.OrganisationID})
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		contacts, err := reportContacts(c, filter)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		aging := report.NewAging(asOf)
+		owner := reportOwner(filter)
+		filter.IssuedBefore = time.Date(asOf.Year(), asOf.Month(), asOf.Day()+1, 0, 0, 0, 0, time.UTC)
+		err = app.ForEachInvoice(ctx, filter, func(invoice *db.Invoice) error {
+			if invoice.OwnerID() == owner {
+				aging.Add(invoice, contacts[invoice.ContactID])
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot get invoices")
+		}
+		err = app.ForEachCreditNote(ctx, db.CreditNoteFilter{
+			UserID:         filter.UserID,
+			OrganisationID: filter.OrganisationID,
+			IssuedBefore:   filter.IssuedBefore,
+		}, func(note *db.CreditNote) error {
+			aging.AddCreditNote(note)
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot get credit notes")
+		}
+		result := aging.Report()
+
+		return respondReport(c, format, "aging", result.AsOf.Format(export.DateFormat), "Aging", result)
+	},
+}
+
+// GSTReportRequest is the query for a GST report.
+type GSTReportRequest struct {
+	ReportRequest
+	// Period is the last month the return covers, as 2006-01.
+	Period string `form:"period" binding:"required"`
+	// Frequency is monthly, two_monthly (the default) or six_monthly.
+	Frequency string `form:"frequency"`
+	// Basis is invoice (the default) or payments.
+	Basis string `form:"basis"`
+}
+
+// GSTReport lists the sales, GST charged and credit notes for a GST return,
+// with their totals. On the invoice basis invoices count when they were
+// issued, and on the payments basis when they were paid; credit notes count
+// when they were issued either way.
+var GSTReport = route.Endpoint{
+	Method: "GET",
+	Path:   "/report/gst",
+	Do: func(c *gin.Context) (interface{}, error) {
+		ctx := c.Request.Context()
+		app := MustApp(c)
+
+		var req GSTReportRequest
+		if err := c.ShouldBindQuery(&req); err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		format, err := req.format()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		end, err := time.Parse("2006-01", req.Period)
+		if err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		frequency := report.GSTFrequency(strings.ToLower(req.Frequency))
+		if frequency == "" {
+			frequency = report.GSTTwoMonthly
+		}
+		period, err := report.NewGSTPeriod(frequency, end)
+		if err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		basis := report.GSTBasis(strings.ToLower(req.Basis))
+		if basis == "" {
+			basis = report.GSTInvoiceBasis
+		}
+		gst, err := report.NewGST(period, basis)
+		if err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+
+		filter, err := exportOwner(c, ExportRequest{OrganisationID: req.OrganisationID})
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		contacts, err := reportContacts(c, filter)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		owner := reportOwner(filter)
+		// Invoices paid in the period may have been issued before it.
+		filter.IssuedBefore = period.Before()
+		if basis == report.GSTInvoiceBasis {
+			filter.IssuedFrom = period.Start
+		}
+		err = app.ForEachInvoice(ctx, filter, func(invoice *db.Invoice) error {
+			if invoice.OwnerID() == owner {
+				gst.AddInvoice(invoice, contacts[invoice.ContactID])
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot get invoices")
+		}
+		err = app.ForEachCreditNote(ctx, db.CreditNoteFilter{
+			UserID:         filter.UserID,
+			OrganisationID: filter.OrganisationID,
+			IssuedFrom:     period.Start,
+			IssuedBefore:   period.Before(),
+		}, func(note *db.CreditNote) error {
+			if note.OrganisationID == filter.OrganisationID {
+				gst.AddCreditNote(note, contacts[note.ContactID])
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot get credit notes")
+		}
+		result := gst.Report()
+
+		return respondReport(c, format, "gst", period.End.Format("2006-01"), "GST", result)
+	},
+}
@@ -0,0 +1,189 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/wham-invoice/wham-platform/report"
+	"github.com/wham-invoice/wham-platform/tests/setup"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type ReportSuite struct {
+	APISuiteCore
+}
+
+var _ = gc.Suite(&ReportSuite{})
+
+func (s *ReportSuite) TestAgingReport(c *gc.C) {
+	ctx := context.Background()
+	contact := s.AddContact(ctx, c, s.user.ID)
+	invoice := setup.CreateInvoice(s.user.ID)
+	invoice.ContactID = contact.ID
+	invoice.Hours, invoice.Rate = 1, 100
+	invoice.IssueDate = time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	invoice.DueDate = time.Date(2022, 5, 15, 0, 0, 0, 0, time.UTC)
+	id, err := s.App.AddInvoice(ctx, invoice)
+	c.Assert(err, jc.ErrorIsNil)
+
+	// The user's invoices for their organisations aren't in their own report.
+	org, err := s.App.NewOrganisation(ctx, "Acme", s.user)
+	c.Assert(err, jc.ErrorIsNil)
+	orgInvoice := *invoice
+	orgInvoice.OrganisationID = org.ID
+	_, err = s.App.AddInvoice(ctx, &orgInvoice)
+	c.Assert(err, jc.ErrorIsNil)
+
+	var r report.AgingReport
+	c.Assert(json.Unmarshal([]byte(s.Get200(c, "/report/aging?as_of=2022-06-30")), &r), jc.ErrorIsNil)
+	c.Assert(r.Rows, gc.HasLen, 1)
+	c.Check(r.Rows[0].ContactID, gc.Equals, contact.ID)
+	c.Check(r.Rows[0].Days31To60, gc.Equals, float64(115))
+
+	// Before it was issued, nothing was owed.
+	c.Assert(json.Unmarshal([]byte(s.Get200(c, "/report/aging?as_of=2022-04-30")), &r), jc.ErrorIsNil)
+	c.Check(r.Rows, gc.HasLen, 0)
+
+	csv := s.Get200(c, "/report/aging?as_of=2022-06-30&format=csv")
+	c.Check(strings.Split(csv, "\n")[2], gc.Equals, "Total,,NZD,1,0.00,0.00,115.00,0.00,0.00,115.00")
+
+	res := s.Serve(httptest.NewRequest("GET", "/report/aging?as_of=2022-06-30&format=pdf", nil))
+	c.Assert(res.StatusCode, gc.Equals, 200)
+	c.Check(res.Header.Get("Content-Type"), gc.Equals, "application/pdf")
+	c.Check(readAll(c, res.Body), jc.HasPrefix, "%PDF-")
+
+	// Credit notes issued by then come off what was owed.
+	s.Post200(c, "/invoice/credit/"+id, `{"amount": 20, "issue_date": "2022-06-01"}`)
+	c.Assert(json.Unmarshal([]byte(s.Get200(c, "/report/aging?as_of=2022-06-30")), &r), jc.ErrorIsNil)
+	c.Assert(r.Rows, gc.HasLen, 1)
+	c.Check(r.Rows[0].Days31To60, gc.Equals, float64(92))
+	c.Assert(json.Unmarshal([]byte(s.Get200(c, "/report/aging?as_of=2022-05-31")), &r), jc.ErrorIsNil)
+	c.Assert(r.Rows, gc.HasLen, 1)
+	c.Check(r.Rows[0].Days1To30, gc.Equals, float64(115))
+
+	s.Get400(c, "/report/aging?as_of=30/06/2022")
+	s.Get400(c, "/report/aging?format=doc")
+}
+
+func (s *ReportSuite) TestGSTReport(c *gc.C) {
+	ctx := context.Background()
+	contact := s.AddContact(ctx, c, s.user.ID)
+	invoice := setup.CreateInvoice(s.user.ID)
+	invoice.ContactID = contact.ID
+	invoice.Hours, invoice.Rate = 1, 100
+	invoice.IssueDate = time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	invoice.DueDate = time.Date(2022, 5, 15, 0, 0, 0, 0, time.UTC)
+	id, err := s.App.AddInvoice(ctx, invoice)
+	c.Assert(err, jc.ErrorIsNil)
+	s.Post200(c, "/invoice/credit/"+id, `{"amount": 20, "issue_date": "2022-06-01"}`)
+
+	var r report.GSTReport
+	c.Assert(json.Unmarshal([]byte(s.Get200(c, "/report/gst?period=2022-06")), &r), jc.ErrorIsNil)
+	c.Check(r.Basis, gc.Equals, report.GSTInvoiceBasis)
+	c.Check(r.Period.Frequency, gc.Equals, report.GSTTwoMonthly)
+	c.Assert(r.Lines, gc.HasLen, 2)
+	c.Check(r.Lines[1].Kind, gc.Equals, report.GSTLineCreditNote)
+	c.Assert(r.Totals, gc.HasLen, 1)
+	c.Check(r.Totals[0].NetGST, gc.Equals, float64(12))
+
+	// It hasn't been paid, so there's nothing on the payments basis but the
+	// credit.
+	c.Assert(json.Unmarshal([]byte(s.Get200(c, "/report/gst?period=2022-06&basis=payments")), &r), jc.ErrorIsNil)
+	c.Check(r.Lines, gc.HasLen, 1)
+
+	csv := s.Get200(c, "/report/gst?period=2022-06&format=csv")
+	c.Check(strings.Split(csv, "\n")[0], gc.Equals, "Date,Type,Invoice,Contact,Currency,Tax,Net,GST,Total")
+
+	res := s.Serve(httptest.NewRequest("GET", "/report/gst?period=2022-06&format=pdf", nil))
+	c.Assert(res.StatusCode, gc.Equals, 200)
+	c.Check(res.Header.Get("Content-Disposition"), gc.Equals, "attachment; filename=gst-2022-06.pdf")
+
+	s.Get400(c, "/report/gst")
+	s.Get400(c, "/report/gst?period=2022-06&frequency=weekly")
+	s.Get400(c, "/report/gst?period=2022-06&basis=cash")
+}
+
+func (s *ReportSuite) TestAnalytics(c *gc.C) {
+	ctx := context.Background()
+	contact := s.AddContact(ctx, c, s.user.ID)
+	invoice := setup.CreateInvoice(s.user.ID)
+	invoice.ContactID = contact.ID
+	invoice.Hours, invoice.Rate = 1, 100
+	invoice.IssueDate = time.Now()
+	invoice.DueDate = time.Now().AddDate(0, 0, 20)
+	_, err := s.App.AddInvoice(ctx, invoice)
+	c.Assert(err, jc.ErrorIsNil)
+
+	var r report.AnalyticsReport
+	c.Assert(json.Unmarshal([]byte(s.Get200(c, "/report/analytics?months=2")), &r), jc.ErrorIsNil)
+	c.Assert(r.Months, gc.HasLen, 2)
+	c.Check(r.Months[1].Invoiced, gc.Equals, float64(115))
+	c.Assert(r.Contacts, gc.HasLen, 1)
+	c.Check(r.Contacts[0].ContactID, gc.Equals, contact.ID)
+	c.Check(r.Contacts[0].Name, gc.Not(gc.Equals), "")
+	c.Assert(r.Forecast, gc.HasLen, 1)
+	c.Check(r.Forecast[0].Expected, gc.Equals, float64(115))
+
+	s.Get400(c, "/report/analytics?months=100")
+}
+
+func (s *ReportSuite) TestStatement(c *gc.C) {
+	ctx := context.Background()
+	contact := s.AddContact(ctx, c, s.user.ID)
+	invoice := setup.CreateInvoice(s.user.ID)
+	invoice.ContactID = contact.ID
+	invoice.Hours, invoice.Rate = 1, 100
+	invoice.IssueDate = time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	invoice.DueDate = time.Date(2022, 5, 15, 0, 0, 0, 0, time.UTC)
+	id, err := s.App.AddInvoice(ctx, invoice)
+	c.Assert(err, jc.ErrorIsNil)
+	s.Post200(c, "/invoice/credit/"+id, `{"amount": 20, "issue_date": "2022-06-01"}`)
+
+	path := "/contact/statement/" + contact.ID
+	var r report.StatementReport
+	c.Assert(json.Unmarshal([]byte(s.Get200(c, path+"?from=2022-06-01&to=2022-06-30")), &r), jc.ErrorIsNil)
+	c.Assert(r.Lines, gc.HasLen, 1)
+	c.Check(r.Lines[0].Kind, gc.Equals, report.StatementCreditNote)
+	c.Assert(r.Balances, gc.HasLen, 1)
+	c.Check(r.Balances[0].Opening, gc.Equals, float64(115))
+	c.Check(r.Balances[0].Closing, gc.Equals, float64(92))
+
+	res := s.Serve(httptest.NewRequest("GET", path+"?from=2022-05-01&to=2022-06-30&format=pdf", nil))
+	c.Assert(res.StatusCode, gc.Equals, 200)
+	c.Check(res.Header.Get("Content-Type"), gc.Equals, "application/pdf")
+	c.Check(readAll(c, res.Body), jc.HasPrefix, "%PDF-")
+
+	s.Get400(c, path)
+	s.Get400(c, path+"?from=2022-06-30&to=2022-06-01")
+	s.Post400(c, "/contact/statement/email/"+contact.ID, `{"from": "30/06/2022"}`)
+}
+
+func (s *ReportSuite) TestStatementAfterMerge(c *gc.C) {
+	ctx := context.Background()
+	contact := s.AddContact(ctx, c, s.user.ID)
+	duplicate := s.AddContact(ctx, c, s.user.ID)
+	invoice := setup.CreateInvoice(s.user.ID)
+	invoice.ContactID = duplicate.ID
+	invoice.Hours, invoice.Rate = 1, 100
+	invoice.IssueDate = time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	invoice.DueDate = time.Date(2022, 5, 15, 0, 0, 0, 0, time.UTC)
+	id, err := s.App.AddInvoice(ctx, invoice)
+	c.Assert(err, jc.ErrorIsNil)
+	s.Post200(c, "/invoice/credit/"+id, `{"amount": 20, "issue_date": "2022-06-01"}`)
+	s.Post200(c, "/contact/merge/"+contact.ID, fmt.Sprintf(`{"duplicate_ids": [%q]}`, duplicate.ID))
+
+	// The invoice and its credit note both came with the duplicate.
+	var r report.StatementReport
+	path := "/contact/statement/" + contact.ID + "?from=2022-05-01&to=2022-06-30"
+	c.Assert(json.Unmarshal([]byte(s.Get200(c, path)), &r), jc.ErrorIsNil)
+	c.Assert(r.Lines, gc.HasLen, 2)
+	c.Check(r.Lines[1].Kind, gc.Equals, report.StatementCreditNote)
+	c.Assert(r.Balances, gc.HasLen, 1)
+	c.Check(r.Balances[0].Closing, gc.Equals, float64(92))
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/gin-contrib/cors"
@@ -23,6 +24,9 @@ type Session interface {
 // Config configures an api server.
 type Config struct {
 	AllowOrigin string
+	// FrontendURL is where the web app is served from, which emails link
+	// to, e.g. https://app.example.com.
+	FrontendURL string
 	AppDB       *db.App
 	RedisStore  *redis.Store
 	Session     Session
@@ -36,6 +40,10 @@ func (cfg Config) Validate() error {
 		return errors.New("blank AllowOrigin")
 	}
 
+	if u, err := url.Parse(cfg.FrontendURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return errors.Errorf("bad FrontendURL %q", cfg.FrontendURL)
+	}
+
 	if cfg.AppDB == nil {
 		return errors.New("missing AppDB")
 	}
@@ -88,15 +96,59 @@ func Root(cfg Config) (route.Installer, error) {
 				Prereqs: auth,
 				Installers: route.Installers(
 					Invoice,
+					InvoiceTemplates,
 					EmailInvoice,
 					NewInvoice,
+					PreviewInvoice,
+					UpdateInvoiceStatus,
+					NewCreditNote,
+					InvoiceCreditNotes,
+					InvoiceUBL,
 					DeleteInvoice,
 					UserInvoices,
+					ExportInvoices,
+					ExportContacts,
+					ExportContactsVCard,
 					Contact,
 					UserContacts,
 					NewContact,
 					DeleteContact,
+					ArchiveContact,
+					ImportContacts,
+					ContactVCard,
+					ContactStatement,
+					EmailStatement,
+					ContactDuplicates,
+					MergeContacts,
+					UpdateContact,
+					ContactFields,
+					SetContactFields,
+					Search,
+					AgingReport,
+					GSTReport,
+					Analytics,
 					UserSummary,
+					NewAPIKey,
+					UserAPIKeys,
+					UpdateAPIKey,
+					RevokeAPIKey,
+					NewOrganisation,
+					UserOrganisations,
+					Organisation,
+					OrganisationMembers,
+					OrganisationInvoices,
+					OrganisationContacts,
+					InviteMember,
+					AcceptInvitation,
+					UpdateMember,
+					RemoveMember,
+					BusinessProfile,
+					UpdateBusinessProfile,
+					DeleteBusinessProfile,
+					UploadLogo,
+					ProfileLogo,
+					UpdateTheme,
+					UpdatePaymentSettings,
 				),
 			},
 		),
@@ -112,6 +164,7 @@ func authorized(cfg Config) ([]gin.HandlerFunc, error) {
 	return route.Prereqs(
 		SetSession(cfg.Session),
 		EnsureUser(),
+		EnsureScope(),
 	), nil
 }
 
@@ -127,6 +180,7 @@ func rootPreReqs(cfg Config) ([]gin.HandlerFunc, error) {
 		sessions.Sessions(sessionName, *cfg.RedisStore),
 		setUpCors(cfg),
 		SetAppDB(cfg.AppDB),
+		SetFrontendURL(cfg.FrontendURL),
 	), nil
 }
 
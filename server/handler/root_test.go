@@ -0,0 +1,36 @@
+package handler_test
+
+import (
+	"net/http/httptest"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/server/handler"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type configSuite struct{}
+
+var _ = gc.Suite(&configSuite{})
+
+func (s *configSuite) TestFrontendURL(c *gc.C) {
+	cfg := handler.Config{
+		AllowOrigin: "http://test.origin",
+		AppDB:       &db.App{},
+		Session:     handler.RealSession{},
+	}
+	for _, bad := range []string{"", "app.example.com", "/app"} {
+		cfg.FrontendURL = bad
+		c.Check(cfg.Validate(), gc.ErrorMatches, `bad FrontendURL ".*"`)
+	}
+	cfg.FrontendURL = "https://app.example.com"
+	c.Check(cfg.Validate(), jc.ErrorIsNil)
+}
+
+func (s *configSuite) TestFrontendLink(c *gc.C) {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	handler.SetFrontendURL("https://app.example.com/")(ctx)
+	c.Check(handler.FrontendLink(ctx, "invoice", "abc"), gc.Equals, "https://app.example.com/invoice/abc")
+}
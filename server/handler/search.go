@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/server/route"
+)
+
+// SearchRequest is the query Search takes.
+type SearchRequest struct {
+	Query          string `form:"q" binding:"required"`
+	OrganisationID string `form:"organisation_id"`
+	// Kind, which may be repeated, keeps only contact or invoice results.
+	Kind            []string `form:"kind"`
+	Limit           int      `form:"limit"`
+	IncludeArchived bool     `form:"include_archived"`
+}
+
+// Search finds the user's, or an organisation's, invoices and contacts by
+// invoice number, description, and contact name, company and email.
+var Search = route.Endpoint{
+	Method: "GET",
+	Path:   "/search",
+	Do: func(c *gin.Context) (interface{}, error) {
+		var req SearchRequest
+		if err := c.ShouldBindQuery(&req); err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		query := db.SearchQuery{
+			UserID:          MustUser(c).ID,
+			Text:            req.Query,
+			Kinds:           req.Kind,
+			Limit:           req.Limit,
+			IncludeArchived: req.IncludeArchived,
+		}
+		if req.OrganisationID != "" {
+			if err := authorize(c, req.OrganisationID, "", db.PermissionRead); err != nil {
+				return nil, errors.Trace(err)
+			}
+			query.UserID, query.OrganisationID = "", req.OrganisationID
+		}
+
+		results, err := MustApp(c).Search(c.Request.Context(), query)
+		if errors.IsNotValid(err) {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot search")
+		}
+
+		return results, nil
+	},
+}
@@ -0,0 +1,37 @@
+package handler_test
+
+import (
+	"encoding/json"
+
+	"github.com/wham-invoice/wham-platform/db"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type SearchSuite struct {
+	APISuiteCore
+}
+
+var _ = gc.Suite(&SearchSuite{})
+
+func (s *SearchSuite) TestSearch(c *gc.C) {
+	contact := db.Contact{}
+	c.Assert(json.Unmarshal([]byte(s.Post200(c, "/contact/new", `{
+		"first_name": "Jane", "last_name": "Smith", "phone": "021", "email": "jane@smith.example",
+		"company": "Smithworks"
+	}`)), &contact), jc.ErrorIsNil)
+
+	var results []db.SearchResult
+	c.Assert(json.Unmarshal([]byte(s.Get200(c, "/search?q=smithw&kind=contact")), &results), jc.ErrorIsNil)
+	c.Assert(results, gc.HasLen, 1)
+	c.Check(results[0].Kind, gc.Equals, "contact")
+	c.Check(results[0].Contact.ID, gc.Equals, contact.ID)
+	c.Check(results[0].Fields, jc.DeepEquals, []string{"company"})
+
+	c.Assert(json.Unmarshal([]byte(s.Get200(c, "/search?q=smith&kind=invoice")), &results), jc.ErrorIsNil)
+	c.Check(results, gc.HasLen, 0)
+
+	s.Get400(c, "/search")
+	s.Get400(c, "/search?q=smith&kind=user")
+}
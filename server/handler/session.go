@@ -2,8 +2,10 @@ package handler
 
 import (
 	"context"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
 	"github.com/wham-invoice/wham-platform/db"
 	"github.com/wham-invoice/wham-platform/server/route"
 )
@@ -29,3 +31,56 @@ func (RealSession) GetUser(
 	return user, nil
 
 }
+
+// APIKeySession authenticates requests that carry an API key in an
+// "Authorization: Bearer" header. Any other request is handed to Fallback.
+type APIKeySession struct {
+	Fallback Session
+}
+
+// GetUser returns the owner of the API key on the request.
+func (s APIKeySession) GetUser(
+	c *gin.Context,
+	app *db.App,
+) (*db.User, error) {
+	secret := bearerToken(c)
+	if secret == "" {
+		return s.Fallback.GetUser(c, app)
+	}
+
+	ctx := c.Request.Context()
+	key, err := app.APIKeyBySecret(ctx, secret)
+	if err == db.APIKeyNotFound {
+		return nil, route.Unauthorized
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	user, err := app.User(ctx, key.UserID)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if user == nil {
+		return nil, route.Unauthorized
+	}
+
+	if err := key.Touch(ctx, app); err != nil {
+		return nil, errors.Trace(err)
+	}
+	c.Set(sessionAPIKeyKey, key)
+
+	return user, nil
+}
+
+// bearerToken returns the token from the Authorization header, if any.
+func bearerToken(c *gin.Context) string {
+	const scheme = "Bearer "
+
+	header := c.GetHeader("Authorization")
+	if len(header) <= len(scheme) || !strings.EqualFold(header[:len(scheme)], scheme) {
+		return ""
+	}
+
+	return strings.TrimSpace(header[len(scheme):])
+}
@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/juju/errors"
+	"github.com/wham-invoice/wham-platform/db"
+	"github.com/wham-invoice/wham-platform/email"
+	"github.com/wham-invoice/wham-platform/export"
+	"github.com/wham-invoice/wham-platform/pdf"
+	"github.com/wham-invoice/wham-platform/placeholder"
+	"github.com/wham-invoice/wham-platform/report"
+	"github.com/wham-invoice/wham-platform/server/route"
+)
+
+// StatementRequest is the query for a contact's statement.
+type StatementRequest struct {
+	// Format is json (the default), csv, xlsx or pdf.
+	Format string `form:"format"`
+	// From and To are the first and last days the statement covers, as
+	// 2006-01-02. To defaults to today.
+	From string `form:"from" binding:"required"`
+	To   string `form:"to"`
+}
+
+// EmailStatementRequest describes a statement to email to its contact.
+type EmailStatementRequest struct {
+	From string `json:"from" binding:"required"`
+	To   string `json:"to"`
+	// Message optionally replaces the email's text. It can use the contact
+	// placeholders invoice emails can, e.g. {contact.first_name}, and the
+	// link to the statement is added after it.
+	Message string `json:"message"`
+}
+
+// statementDays parses the first and last days of a statement, as
+// 2006-01-02. A blank last day is today.
+func statementDays(from, to string) (time.Time, time.Time, error) {
+	first, err := time.Parse(export.DateFormat, from)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.Wrap(err, route.BadRequest)
+	}
+	last := time.Now()
+	if to != "" {
+		if last, err = time.Parse(export.DateFormat, to); err != nil {
+			return time.Time{}, time.Time{}, errors.Wrap(err, route.BadRequest)
+		}
+	}
+	return first, last, nil
+}
+
+// contactStatement works out the contact's statement from the invoices and
+// credit notes of whoever owns the contact.
+func contactStatement(c *gin.Context, contact *db.Contact, from, to time.Time) (report.StatementReport, error) {
+	ctx := c.Request.Context()
+	app := MustApp(c)
+
+	statement, err := report.NewStatement(contact, from, to)
+	if err != nil {
+		return report.StatementReport{}, errors.Wrap(err, route.BadRequest)
+	}
+	// Invoices belong to whoever owns the contact they bill.
+	filter := db.InvoiceFilter{ContactID: contact.ID}
+	if contact.OrganisationID != "" {
+		filter.OrganisationID = contact.OrganisationID
+	} else {
+		filter.UserID = contact.UserID
+	}
+	filter.IssuedBefore = time.Date(to.Year(), to.Month(), to.Day()+1, 0, 0, 0, 0, time.UTC)
+
+	var invoiceIDs []string
+	err = app.ForEachInvoice(ctx, filter, func(invoice *db.Invoice) error {
+		statement.AddInvoice(invoice)
+		invoiceIDs = append(invoiceIDs, invoice.ID)
+		return nil
+	})
+	if err != nil {
+		return report.StatementReport{}, errors.Annotate(err, "cannot get invoices")
+	}
+	// Credit notes are found by the invoices they credit, which always say
+	// who they bill.
+	for len(invoiceIDs) > 0 {
+		batch := invoiceIDs
+		if len(batch) > db.MaxCreditNoteInvoices {
+			batch = batch[:db.MaxCreditNoteInvoices]
+		}
+		invoiceIDs = invoiceIDs[len(batch):]
+		err = app.ForEachCreditNote(ctx, db.CreditNoteFilter{
+			UserID:         filter.UserID,
+			OrganisationID: filter.OrganisationID,
+			InvoiceIDs:     batch,
+			IssuedBefore:   filter.IssuedBefore,
+		}, func(note *db.CreditNote) error {
+			statement.AddCreditNote(note)
+			return nil
+		})
+		if err != nil {
+			return report.StatementReport{}, errors.Annotate(err, "cannot get credit notes")
+		}
+	}
+
+	return statement.Report(), nil
+}
+
+// ContactStatement is a contact's account over a range of days: what they
+// owed at the start, the invoices, payments and credit notes since, and what
+// they owed at the end.
+var ContactStatement = route.Endpoint{
+	Method:  "GET",
+	Path:    "/contact/statement/:contact_id",
+	Prereqs: route.Prereqs(EnsureContact(), PermitContact(db.PermissionRead)),
+	Do: func(c *gin.Context) (interface{}, error) {
+		var req StatementRequest
+		if err := c.ShouldBindQuery(&req); err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		format, err := ReportRequest{Format: req.Format}.format()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		from, to, err := statementDays(req.From, req.To)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		result, err := contactStatement(c, MustContact(c), from, to)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		period := fmt.Sprintf("%s-%s", result.From.Format(export.DateFormat), result.To.Format(export.DateFormat))
+
+		return respondReport(c, format, "statement", period, "Statement", result)
+	},
+}
+
+// EmailStatement renders a contact's statement as a PDF and emails them a
+// link to it, as EmailInvoice does for invoices.
+var EmailStatement = route.Endpoint{
+	Method:  "POST",
+	Path:    "/contact/statement/email/:contact_id",
+	Prereqs: route.Prereqs(EnsureContact(), PermitContact(db.PermissionWrite)),
+	Do: func(c *gin.Context) (interface{}, error) {
+		ctx := c.Request.Context()
+		contact := MustContact(c)
+
+		var req EmailStatementRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return nil, errors.Wrap(err, route.BadRequest)
+		}
+		from, to, err := statementDays(req.From, req.To)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		result, err := contactStatement(c, contact, from, to)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		pdfID, err := pdf.CreateTablePDF(ctx, MustApp(c), result.PDFTable(), pdf.DefaultTheme())
+		if err != nil {
+			return nil, errors.Annotate(err, "cannot create PDF from statement")
+		}
+
+		link := FrontendLink(c, "statement", pdfID)
+		if err := emailStatement(ctx, link, result, MustUser(c), contact, req.Message); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return nil, nil
+	},
+}
+
+// emailStatement emails the contact a link to their statement.
+func emailStatement(
+	ctx context.Context,
+	statementURL string,
+	statement report.StatementReport,
+	user *db.User,
+	contact *db.Contact,
+	message string,
+) error {
+	service, err := gmailService(ctx, user)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\n"+
+		"Your statement for %s to %s is ready.\n\n"+
+		"To view and download it please visit: %s "+
+		"Thanks.\n"+
+		"%s", contact.FirstName,
+		statement.From.Format("2 January 2006"), statement.To.Format("2 January 2006"),
+		statementURL, user.FirstName)
+	if message != "" {
+		body = fmt.Sprintf("%s\n\n%s",
+			placeholder.Expand(message, placeholder.Values(contact, nil)), statementURL)
+	}
+
+	return errors.Trace(
+		email.GmailSend(service, "me", recipients(contact), "Statement", body),
+	)
+}
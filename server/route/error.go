@@ -35,8 +35,9 @@ func Abort(c *gin.Context, err error) {
 }
 
 var (
-	BadRequest   = HTTPError{http.StatusBadRequest}
-	Unauthorized = HTTPError{http.StatusUnauthorized}
-	NotFound     = HTTPError{http.StatusNotFound}
-	Forbidden    = HTTPError{http.StatusForbidden}
+	BadRequest     = HTTPError{http.StatusBadRequest}
+	Unauthorized   = HTTPError{http.StatusUnauthorized}
+	NotFound       = HTTPError{http.StatusNotFound}
+	Forbidden      = HTTPError{http.StatusForbidden}
+	NotImplemented = HTTPError{http.StatusNotImplemented}
 )
@@ -47,6 +47,12 @@ func (ep Endpoint) Install(rg *gin.RouterGroup) {
 			return
 		}
 		if resp == nil {
+			// Endpoints that stream their own response have already
+			// written a status; don't try to overwrite it.
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
 			c.AbortWithStatus(http.StatusNoContent)
 			return
 		} else {
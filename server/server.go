@@ -4,9 +4,12 @@ import (
 	"context"
 	"encoding/gob"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/wham-invoice/wham-platform/db"
 	"github.com/wham-invoice/wham-platform/server/handler"
+	"github.com/wham-invoice/wham-platform/util"
 	"golang.org/x/oauth2"
 
 	"github.com/gin-contrib/sessions/redis"
@@ -42,7 +45,12 @@ func configure(ctx context.Context, cfg *handler.Config) (string, error) {
 	// TODO all this config should be in a config file.
 	serverAddr := "0.0.0.0:8080"
 
-	cfg.AllowOrigin = "http://localhost:3000"
+	// The web app is the only origin allowed, and what emails link to.
+	cfg.FrontendURL = "http://localhost:3000"
+	if frontendURL := os.Getenv(util.FRONTEND_URL); frontendURL != "" {
+		cfg.FrontendURL = frontendURL
+	}
+	cfg.AllowOrigin = strings.TrimRight(cfg.FrontendURL, "/")
 
 	// TODO i think 'secret' needs to be an actual secret...
 	store, err := redis.NewStore(
@@ -57,7 +65,9 @@ func configure(ctx context.Context, cfg *handler.Config) (string, error) {
 	}
 	cfg.RedisStore = &store
 
-	cfg.Session = &handler.RealSession{}
+	cfg.Session = &handler.APIKeySession{
+		Fallback: &handler.RealSession{},
+	}
 
 	// Set this up last, once everything else looks like it worked.
 	// Don't bother to close, it should live as long as the process anyway.
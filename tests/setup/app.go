@@ -32,7 +32,14 @@ func (s *ApplicationSuiteCore) SetUpTest(c *gc.C) {
 	c.Assert(util.SetDebugLogger(), jc.ErrorIsNil)
 	c.Assert(s.App.UsersDeleteAll(ctx, 50), jc.ErrorIsNil)
 	c.Assert(s.App.InvoicesDeleteAll(ctx, 50), jc.ErrorIsNil)
+	c.Assert(s.App.InvoiceNumbersDeleteAll(ctx, 50), jc.ErrorIsNil)
+	c.Assert(s.App.SearchVersionsDeleteAll(ctx, 50), jc.ErrorIsNil)
+	c.Assert(s.App.CreditNotesDeleteAll(ctx, 50), jc.ErrorIsNil)
+	c.Assert(s.App.AnalyticsDeleteAll(ctx, 50), jc.ErrorIsNil)
 	c.Assert(s.App.ContactsDeleteAll(ctx, 50), jc.ErrorIsNil)
+	c.Assert(s.App.APIKeysDeleteAll(ctx, 50), jc.ErrorIsNil)
+	c.Assert(s.App.OrganisationsDeleteAll(ctx, 50), jc.ErrorIsNil)
+	c.Assert(s.App.ProfilesDeleteAll(ctx, 50), jc.ErrorIsNil)
 	// TODO delete all files from storage.
 }
 
@@ -140,3 +147,35 @@ func CreateContact(userID string) db.Contact {
 		Address:   address,
 	}
 }
+
+func (s *ApplicationSuiteCore) SetBusinessProfile(
+	ctx context.Context,
+	c *gc.C,
+	userID string,
+) *db.BusinessProfile {
+	profile := CreateBusinessProfile(userID)
+	err := s.App.SetBusinessProfile(ctx, profile)
+	c.Assert(err, jc.ErrorIsNil)
+
+	return profile
+}
+
+func CreateBusinessProfile(userID string) *db.BusinessProfile {
+	return &db.BusinessProfile{
+		UserID:              userID,
+		TradingName:         strconv.Itoa(rand.Int()),
+		LegalName:           strconv.Itoa(rand.Int()),
+		TaxNumber:           strconv.Itoa(rand.Int()),
+		Phone:               strconv.Itoa(rand.Int()),
+		Email:               strconv.Itoa(rand.Int()),
+		BankAccount:         strconv.Itoa(rand.Int()),
+		PaymentInstructions: strconv.Itoa(rand.Int()),
+		Address: &db.Address{
+			FirstLine:  strconv.Itoa(rand.Int()),
+			SecondLine: strconv.Itoa(rand.Int()),
+			Suburb:     strconv.Itoa(rand.Int()),
+			Postcode:   strconv.Itoa(rand.Int()),
+			Country:    strconv.Itoa(rand.Int()),
+		},
+	}
+}
@@ -10,6 +10,8 @@ import (
 const (
 	GCP_CLIENT_ID     = "GCP_CLIENT_ID"
 	GCP_CLIENT_SECRET = "GCP_CLIENT_SECRET"
+	// FRONTEND_URL is where the web app is served from.
+	FRONTEND_URL = "FRONTEND_URL"
 )
 
 func ToFormattedDate(t time.Time) string {
@@ -0,0 +1,277 @@
+// Package vcard reads the parts of vCard 3.0 (RFC 2426) and 4.0 (RFC 6350)
+// files that we keep about a contact.
+package vcard
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// Card is one vCard.
+type Card struct {
+	// Line is where the card starts in the file, for reporting problems.
+	Line          int
+	Version       string
+	FormattedName string
+	FamilyName    string
+	GivenName     string
+	Organisation  string
+	// Emails, Phones and Addresses are in the order given, except that
+	// preferred ones come first.
+	Emails    []string
+	Phones    []string
+	Addresses []Address
+	Note      string
+}
+
+// Address is a card's ADR property.
+type Address struct {
+	POBox      string
+	Extended   string
+	Street     string
+	Locality   string
+	Region     string
+	PostalCode string
+	Country    string
+}
+
+// property is one content line: [group.]NAME;PARAM=value:value
+type property struct {
+	name   string
+	params map[string][]string
+	value  string
+}
+
+// preferred reports whether the property is marked as the one to use, which
+// is TYPE=pref in 3.0 and PREF=1 in 4.0.
+func (p property) preferred() bool {
+	for _, t := range p.params["TYPE"] {
+		if strings.EqualFold(t, "pref") {
+			return true
+		}
+	}
+	return len(p.params["PREF"]) > 0 && p.params["PREF"][0] == "1"
+}
+
+// Parse reads every card in r. Properties we don't use are skipped.
+func Parse(r io.Reader) ([]Card, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var cards []Card
+	var card *Card
+	var preferred map[string]int
+	for _, l := range lines {
+		if strings.TrimSpace(l.text) == "" {
+			continue
+		}
+		p, err := parseProperty(l.text)
+		if err != nil {
+			return nil, errors.Annotatef(err, "line %d", l.number)
+		}
+
+		switch {
+		case p.name == "BEGIN" && strings.EqualFold(p.value, "VCARD"):
+			if card != nil {
+				return nil, errors.NotValidf("line %d: card inside card", l.number)
+			}
+			card = &Card{Line: l.number}
+			preferred = map[string]int{}
+			continue
+		case card == nil:
+			return nil, errors.NotValidf("line %d: %s outside a card", l.number, p.name)
+		case p.name == "END" && strings.EqualFold(p.value, "VCARD"):
+			if card.Version != "3.0" && card.Version != "4.0" {
+				return nil, errors.NotSupportedf("line %d: vCard version %q", card.Line, card.Version)
+			}
+			cards = append(cards, *card)
+			card = nil
+			continue
+		}
+
+		switch p.name {
+		case "VERSION":
+			card.Version = strings.TrimSpace(p.value)
+		case "FN":
+			card.FormattedName = unescape(p.value)
+		case "N":
+			n := structured(p.value)
+			card.FamilyName, card.GivenName = n[0], n[1]
+		case "ORG":
+			// Units after the organisation name are dropped.
+			card.Organisation = structured(p.value)[0]
+		case "EMAIL":
+			card.Emails = add(card.Emails, unescape(p.value), p.preferred(), preferred, "EMAIL")
+		case "TEL":
+			card.Phones = add(card.Phones, telephone(p.value), p.preferred(), preferred, "TEL")
+		case "ADR":
+			a := structured(p.value)
+			adr := Address{a[0], a[1], a[2], a[3], a[4], a[5], a[6]}
+			if p.preferred() {
+				i := preferred["ADR"]
+				card.Addresses = append(card.Addresses[:i], append([]Address{adr}, card.Addresses[i:]...)...)
+				preferred["ADR"]++
+			} else {
+				card.Addresses = append(card.Addresses, adr)
+			}
+		case "NOTE":
+			card.Note = unescape(p.value)
+		}
+	}
+	if card != nil {
+		return nil, errors.NotValidf("line %d: card without END", card.Line)
+	}
+	return cards, nil
+}
+
+// add appends v to list, or inserts it after the other preferred values.
+func add(list []string, v string, pref bool, preferred map[string]int, name string) []string {
+	if v == "" {
+		return list
+	}
+	if !pref {
+		return append(list, v)
+	}
+	i := preferred[name]
+	preferred[name]++
+	return append(list[:i], append([]string{v}, list[i:]...)...)
+}
+
+// telephone drops the tel: prefix 4.0 cards may use.
+func telephone(v string) string {
+	v = unescape(v)
+	if len(v) > 4 && strings.EqualFold(v[:4], "tel:") {
+		return v[4:]
+	}
+	return v
+}
+
+type line struct {
+	number int
+	text   string
+}
+
+// unfold joins lines continued with a leading space or tab.
+func unfold(r io.Reader) ([]line, error) {
+	var lines []line
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1024*1024)
+	for n := 1; s.Scan(); n++ {
+		text := strings.TrimSuffix(s.Text(), "\r")
+		if n == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		if len(lines) > 0 && text != "" && (text[0] == ' ' || text[0] == '\t') {
+			lines[len(lines)-1].text += text[1:]
+			continue
+		}
+		lines = append(lines, line{n, text})
+	}
+	return lines, errors.Trace(s.Err())
+}
+
+func parseProperty(s string) (property, error) {
+	// The value starts at the first colon that isn't in a quoted parameter.
+	quoted := false
+	colon := -1
+	for i, r := range s {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return property{}, errors.NotValidf("content line %q", s)
+	}
+
+	parts := splitUnquoted(s[:colon], ';')
+	name := strings.ToUpper(parts[0])
+	if dot := strings.LastIndexByte(name, '.'); dot >= 0 {
+		name = name[dot+1:]
+	}
+	p := property{name: name, params: map[string][]string{}, value: s[colon+1:]}
+	for _, param := range parts[1:] {
+		key, values := param, ""
+		if eq := strings.IndexByte(param, '='); eq >= 0 {
+			key, values = param[:eq], param[eq+1:]
+		} else {
+			// 2.1 style bare types, which some 3.0 writers still use.
+			key, values = "TYPE", param
+		}
+		key = strings.ToUpper(key)
+		for _, v := range splitUnquoted(values, ',') {
+			p.params[key] = append(p.params[key], strings.Trim(v, `"`))
+		}
+	}
+	return p, nil
+}
+
+func splitUnquoted(s string, sep rune) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// structured splits a value on unescaped semicolons and unescapes each
+// component. There are always at least seven components, so callers can
+// index the ones they expect without checking.
+func structured(v string) []string {
+	var parts []string
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		switch {
+		case v[i] == '\\' && i+1 < len(v):
+			b.WriteByte(v[i])
+			b.WriteByte(v[i+1])
+			i++
+		case v[i] == ';':
+			parts = append(parts, unescape(b.String()))
+			b.Reset()
+		default:
+			b.WriteByte(v[i])
+		}
+	}
+	parts = append(parts, unescape(b.String()))
+	for len(parts) < 7 {
+		parts = append(parts, "")
+	}
+	return parts
+}
+
+func unescape(v string) string {
+	if !strings.ContainsRune(v, '\\') {
+		return strings.TrimSpace(v)
+	}
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] == '\\' && i+1 < len(v) {
+			i++
+			switch v[i] {
+			case 'n', 'N':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(v[i])
+			}
+			continue
+		}
+		b.WriteByte(v[i])
+	}
+	return strings.TrimSpace(b.String())
+}
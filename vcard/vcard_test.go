@@ -0,0 +1,90 @@
+package vcard_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/wham-invoice/wham-platform/vcard"
+
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	gc.TestingT(t)
+}
+
+type vcardSuite struct{}
+
+var _ = gc.Suite(&vcardSuite{})
+
+func (s *vcardSuite) TestParse(c *gc.C) {
+	f, err := os.Open("testdata/contacts.vcf")
+	c.Assert(err, jc.ErrorIsNil)
+	defer f.Close()
+
+	cards, err := vcard.Parse(f)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(cards, jc.DeepEquals, []vcard.Card{{
+		Line:          1,
+		Version:       "3.0",
+		FormattedName: "Jane Q. Smith",
+		FamilyName:    "Smith",
+		GivenName:     "Jane",
+		Organisation:  "Smith, Jones & Co",
+		Emails:        []string{"jane@smith.example", "jane@home.example"},
+		Phones:        []string{"+64 9 555 0100"},
+		Addresses: []vcard.Address{{
+			Extended:   "Level 2",
+			Street:     "1 Queen St",
+			Locality:   "Auckland",
+			PostalCode: "1010",
+			Country:    "New Zealand",
+		}},
+		Note: "Pays on\nthe 20th",
+	}, {
+		Line:          13,
+		Version:       "4.0",
+		FormattedName: "Acme Ltd",
+		Organisation:  "Acme Ltd",
+		Emails:        []string{"accounts@acme.example"},
+		Phones:        []string{"+64-4-555-0199"},
+	}})
+}
+
+func (s *vcardSuite) TestLineFeeds(c *gc.C) {
+	cards, err := vcard.Parse(strings.NewReader("BEGIN:VCARD\nVERSION:4.0\nFN:A\n\nEND:VCARD\n"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cards, gc.HasLen, 1)
+	c.Check(cards[0].FormattedName, gc.Equals, "A")
+}
+
+func (s *vcardSuite) TestErrors(c *gc.C) {
+	for _, test := range []struct {
+		in    string
+		err   string
+		check func(error) bool
+	}{{
+		in:    "BEGIN:VCARD\nVERSION:2.1\nEND:VCARD\n",
+		err:   `line 1: vCard version "2.1" not supported`,
+		check: errors.IsNotSupported,
+	}, {
+		in:    "BEGIN:VCARD\nVERSION:3.0\n",
+		err:   `line 1: card without END not valid`,
+		check: errors.IsNotValid,
+	}, {
+		in:    "FN:Stray\n",
+		err:   `line 1: FN outside a card not valid`,
+		check: errors.IsNotValid,
+	}, {
+		in:    "BEGIN:VCARD\nVERSION:3.0\nnonsense\nEND:VCARD\n",
+		err:   `line 3: content line "nonsense" not valid`,
+		check: errors.IsNotValid,
+	}} {
+		_, err := vcard.Parse(strings.NewReader(test.in))
+		c.Check(err, gc.ErrorMatches, test.err)
+		c.Check(err, jc.Satisfies, test.check)
+	}
+}
@@ -0,0 +1,87 @@
+package vcard
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/juju/errors"
+)
+
+// Write writes the cards as vCard 3.0, which more address books read than
+// 4.0. Every card gets an FN, falling back to the organisation or first
+// email, since readers reject cards without one.
+func Write(w io.Writer, cards ...Card) error {
+	bw := bufio.NewWriter(w)
+	for _, card := range cards {
+		writeLine(bw, "BEGIN:VCARD")
+		writeLine(bw, "VERSION:3.0")
+
+		fn := card.FormattedName
+		if fn == "" {
+			fn = strings.TrimSpace(card.GivenName + " " + card.FamilyName)
+		}
+		if fn == "" {
+			fn = card.Organisation
+		}
+		if fn == "" && len(card.Emails) > 0 {
+			fn = card.Emails[0]
+		}
+		writeLine(bw, "FN:"+escape(fn))
+		writeLine(bw, "N:"+escape(card.FamilyName)+";"+escape(card.GivenName)+";;;")
+		if card.Organisation != "" {
+			writeLine(bw, "ORG:"+escape(card.Organisation))
+		}
+		for i, email := range card.Emails {
+			writeLine(bw, "EMAIL;TYPE=INTERNET"+pref(i)+":"+escape(email))
+		}
+		for i, phone := range card.Phones {
+			writeLine(bw, "TEL;TYPE=VOICE"+pref(i)+":"+escape(phone))
+		}
+		for i, a := range card.Addresses {
+			writeLine(bw, "ADR;TYPE=WORK"+pref(i)+":"+strings.Join([]string{
+				escape(a.POBox), escape(a.Extended), escape(a.Street), escape(a.Locality),
+				escape(a.Region), escape(a.PostalCode), escape(a.Country),
+			}, ";"))
+		}
+		if card.Note != "" {
+			writeLine(bw, "NOTE:"+escape(card.Note))
+		}
+		writeLine(bw, "END:VCARD")
+	}
+	return errors.Trace(bw.Flush())
+}
+
+// pref marks the first of several values as the preferred one.
+func pref(i int) string {
+	if i == 0 {
+		return ",PREF"
+	}
+	return ""
+}
+
+// writeLine ends s with CRLF, folding it so no line is longer than 75
+// octets and without splitting a UTF-8 character.
+func writeLine(w *bufio.Writer, s string) {
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.WriteString(s[:cut])
+		w.WriteString("\r\n ")
+		s = s[cut:]
+		// Continuation lines start with the space.
+		limit = 74
+	}
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\r\n", `\n`, "\n", `\n`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
@@ -0,0 +1,84 @@
+package vcard_test
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/wham-invoice/wham-platform/vcard"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+)
+
+type writeSuite struct{}
+
+var _ = gc.Suite(&writeSuite{})
+
+func (s *writeSuite) TestWrite(c *gc.C) {
+	var buf bytes.Buffer
+	err := vcard.Write(&buf, vcard.Card{
+		GivenName:    "Jane",
+		FamilyName:   "Smith",
+		Organisation: "Smith, Jones; Co",
+		Emails:       []string{"jane@smith.example", "jane@home.example"},
+		Phones:       []string{"+64 9 555 0100"},
+		Addresses:    []vcard.Address{{Street: "1 Queen St", Locality: "Auckland", PostalCode: "1010"}},
+		Note:         "Pays on\nthe 20th",
+	}, vcard.Card{Organisation: "Acme"})
+	c.Assert(err, jc.ErrorIsNil)
+
+	c.Check(buf.String(), gc.Equals, strings.Join([]string{
+		"BEGIN:VCARD",
+		"VERSION:3.0",
+		"FN:Jane Smith",
+		"N:Smith;Jane;;;",
+		`ORG:Smith\, Jones\; Co`,
+		"EMAIL;TYPE=INTERNET,PREF:jane@smith.example",
+		"EMAIL;TYPE=INTERNET:jane@home.example",
+		"TEL;TYPE=VOICE,PREF:+64 9 555 0100",
+		"ADR;TYPE=WORK,PREF:;;1 Queen St;Auckland;;1010;",
+		`NOTE:Pays on\nthe 20th`,
+		"END:VCARD",
+		"BEGIN:VCARD",
+		"VERSION:3.0",
+		"FN:Acme",
+		"N:;;;;",
+		"ORG:Acme",
+		"END:VCARD",
+		"",
+	}, "\r\n"))
+}
+
+func (s *writeSuite) TestFolding(c *gc.C) {
+	note := strings.Repeat("ā", 100)
+	var buf bytes.Buffer
+	c.Assert(vcard.Write(&buf, vcard.Card{FormattedName: "A", Note: note}), jc.ErrorIsNil)
+
+	for _, line := range strings.Split(buf.String(), "\r\n") {
+		c.Check(len(line) <= 75, jc.IsTrue, gc.Commentf("%q", line))
+	}
+
+	cards, err := vcard.Parse(&buf)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(cards[0].Note, gc.Equals, note)
+}
+
+func (s *writeSuite) TestRoundTrip(c *gc.C) {
+	card := vcard.Card{
+		Line:          1,
+		Version:       "3.0",
+		FormattedName: "Jane Smith",
+		GivenName:     "Jane",
+		FamilyName:    "Smith",
+		Organisation:  `Back\slash & Co`,
+		Emails:        []string{"jane@smith.example", "jane@home.example"},
+		Phones:        []string{"+64 9 555 0100"},
+		Addresses:     []vcard.Address{{Street: "1 Queen St", Extended: "Level 2", Locality: "Auckland", Country: "New Zealand"}},
+	}
+	var buf bytes.Buffer
+	c.Assert(vcard.Write(&buf, card), jc.ErrorIsNil)
+
+	cards, err := vcard.Parse(&buf)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(cards, jc.DeepEquals, []vcard.Card{card})
+}